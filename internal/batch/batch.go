@@ -0,0 +1,331 @@
+// Package batch 实现批量下载：按URL或 "书名|作者" 列表依次下载书籍并汇总结果
+package batch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-novel/internal/config"
+	"go-novel/internal/core"
+	"go-novel/internal/library"
+	"go-novel/internal/model"
+	"go-novel/internal/sse"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+	StatusDone    = "done"
+)
+
+// Item 批量任务中的一本书
+type Item struct {
+	Line     string `json:"line"`
+	URL      string `json:"url"`
+	BookName string `json:"bookName"`
+	Author   string `json:"author"`
+	SourceId int    `json:"sourceId"`
+	Source   string `json:"source"` // 书源的限定ID "规则文件#规则ID"
+	FileName string `json:"fileName"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason"`
+}
+
+// Summary 批量任务汇总
+type Summary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Pending   int `json:"pending"`
+}
+
+// Batch 批量下载任务
+type Batch struct {
+	ID         string    `json:"id"`
+	Format     string    `json:"format"`
+	Source     string    `json:"source"` // 指定的书源，规则ID或限定ID，为空时不指定
+	Status     string    `json:"status"`
+	Items      []Item    `json:"items"`
+	Summary    Summary   `json:"summary"`
+	CreatedAt  time.Time `json:"createdAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// Manager 批量任务管理器
+type Manager struct {
+	config  *config.Config
+	batches map[string]*Batch
+	mutex   sync.Mutex
+	seq     int
+}
+
+var (
+	manager *Manager
+	once    sync.Once
+)
+
+// GetManager 获取批量任务管理器实例
+func GetManager() *Manager {
+	once.Do(func() {
+		manager = &Manager{
+			config:  config.GetConfig(),
+			batches: make(map[string]*Batch),
+		}
+	})
+	return manager
+}
+
+// ParseLines 解析批量列表，忽略空行和 # 开头的注释行
+func ParseLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// ReadListFile 读取批量列表文件
+func ReadListFile(fp string) ([]string, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseLines(f)
+}
+
+// Create 创建批量任务，source 为规则ID或限定ID "规则文件#规则ID"，为空或 -1 时按URL匹配书源、按全部书源搜索
+func (m *Manager) Create(lines []string, format string, source string) (*Batch, error) {
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("批量列表为空")
+	}
+	sourceCfg := m.config.Copy().Source
+	if err := sourceCfg.SelectSource(source); err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = m.config.Download.ExtName
+	}
+	if format != "epub" && format != "txt" {
+		return nil, fmt.Errorf("不支持的格式，仅支持epub和txt")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.seq++
+	b := &Batch{
+		ID:        fmt.Sprintf("batch-%d-%d", time.Now().Unix(), m.seq),
+		Format:    format,
+		Source:    source,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+	for _, line := range lines {
+		b.Items = append(b.Items, Item{Line: line, Status: StatusPending})
+	}
+	b.Summary = summarize(b.Items)
+	m.batches[b.ID] = b
+	return b.snapshot(), nil
+}
+
+// Get 获取批量任务
+func (m *Manager) Get(id string) (*Batch, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	b, exists := m.batches[id]
+	if !exists {
+		return nil, false
+	}
+	return b.snapshot(), true
+}
+
+// List 获取全部批量任务，按创建时间倒序
+func (m *Manager) List() []Batch {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	list := make([]Batch, 0, len(m.batches))
+	for _, b := range m.batches {
+		list = append(list, *b.snapshot())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Run 依次下载批量任务中的书籍，完成后广播汇总结果
+func (m *Manager) Run(id string) (*Batch, error) {
+	m.mutex.Lock()
+	b, exists := m.batches[id]
+	if !exists {
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("未找到批量任务: %s", id)
+	}
+	if b.Status != StatusPending {
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("批量任务已在执行: %s", id)
+	}
+	b.Status = StatusRunning
+	m.mutex.Unlock()
+
+	// 逐本下载，章节下载本身已是并发的
+	for i := range b.Items {
+		m.updateItem(b, i, func(item *Item) { item.Status = StatusRunning })
+
+		item, err := m.download(b, b.Items[i])
+		if err != nil {
+			item.Status = StatusFailed
+			item.Reason = err.Error()
+			fmt.Printf("批量下载失败 [%d/%d] %s: %v\n", i+1, len(b.Items), item.Line, err)
+		} else {
+			item.Status = StatusSuccess
+			fmt.Printf("批量下载完成 [%d/%d] %s\n", i+1, len(b.Items), item.Line)
+		}
+		m.updateItem(b, i, func(current *Item) { *current = item })
+	}
+
+	m.mutex.Lock()
+	b.Status = StatusDone
+	b.FinishedAt = time.Now()
+	b.Summary = summarize(b.Items)
+	result := b.snapshot()
+	m.mutex.Unlock()
+
+	fmt.Printf("批量任务 %s 完成: 共 %d 本，成功 %d 本，失败 %d 本\n",
+		result.ID, result.Summary.Total, result.Summary.Succeeded, result.Summary.Failed)
+	sse.BroadcastEvent("batch-finished", map[string]any{
+		"id":      result.ID,
+		"summary": result.Summary,
+		"items":   result.Items,
+	})
+
+	return result, nil
+}
+
+// download 下载单本书籍，返回填充了书籍信息的条目
+func (m *Manager) download(b *Batch, item Item) (Item, error) {
+	cfg := m.config.Copy()
+	if err := cfg.Source.SelectSource(b.Source); err != nil {
+		return item, err
+	}
+	cfg.Download.ExtName = b.Format
+	cfg.Download.DownloadId = ""
+
+	if strings.HasPrefix(item.Line, "http://") || strings.HasPrefix(item.Line, "https://") {
+		item.URL = item.Line
+	} else {
+		result, err := m.resolve(&cfg, item.Line)
+		if err != nil {
+			return item, err
+		}
+		item.URL = result.URL
+		item.BookName = result.BookName
+		item.Author = result.Author
+		item.SourceId, item.Source = result.SourceId, result.Source
+		// 搜索结果已确定书源
+		if err := cfg.Source.SelectSource(result.Source); err != nil {
+			return item, err
+		}
+	}
+
+	if err := core.NewCrawler(&cfg).Crawl(item.URL); err != nil {
+		return item, err
+	}
+
+	// 从书库索引中获取下载后的文件信息
+	lib := library.GetLibrary(cfg.Download.DownloadPath)
+	entries, err := lib.List(library.Filter{Format: b.Format}, "updated", true)
+	if err == nil {
+		for _, entry := range entries {
+			if entry.URL == item.URL {
+				item.FileName = entry.FileName
+				item.BookName = entry.BookName
+				item.Author = entry.Author
+				item.SourceId, item.Source = entry.SourceId, entry.Source
+				break
+			}
+		}
+	}
+	return item, nil
+}
+
+// resolve 通过搜索将 "书名|作者" 解析为书籍URL，要求书名完全匹配，作者为空时不校验
+func (m *Manager) resolve(cfg *config.Config, line string) (*model.SearchResult, error) {
+	bookName, author, _ := strings.Cut(line, "|")
+	bookName = strings.TrimSpace(bookName)
+	author = strings.TrimSpace(author)
+	if bookName == "" {
+		return nil, fmt.Errorf("书名不能为空")
+	}
+
+	// 不限制搜索结果数量，避免目标书籍被截断
+	searchCfg := *cfg
+	searchCfg.Source.SearchLimit = 0
+	results, err := core.NewCrawler(&searchCfg).Search(bookName)
+	if err != nil {
+		return nil, fmt.Errorf("搜索失败: %w", err)
+	}
+
+	for _, result := range results {
+		if result.BookName != bookName {
+			continue
+		}
+		if author != "" && result.Author != author {
+			continue
+		}
+		return &result, nil
+	}
+
+	if author != "" {
+		return nil, fmt.Errorf("未搜索到匹配的书籍: %s(%s)，共 %d 条搜索结果", bookName, author, len(results))
+	}
+	return nil, fmt.Errorf("未搜索到匹配的书籍: %s，共 %d 条搜索结果", bookName, len(results))
+}
+
+// updateItem 在锁内修改条目并刷新汇总
+func (m *Manager) updateItem(b *Batch, index int, fn func(item *Item)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fn(&b.Items[index])
+	b.Summary = summarize(b.Items)
+}
+
+// snapshot 复制批量任务，调用方需持有锁
+func (b *Batch) snapshot() *Batch {
+	result := *b
+	result.Items = append([]Item(nil), b.Items...)
+	return &result
+}
+
+// summarize 统计各状态数量
+func summarize(items []Item) Summary {
+	summary := Summary{Total: len(items)}
+	for _, item := range items {
+		switch item.Status {
+		case StatusSuccess:
+			summary.Succeeded++
+		case StatusFailed:
+			summary.Failed++
+		default:
+			summary.Pending++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,115 @@
+package batch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-novel/internal/config"
+)
+
+func TestParseLines(t *testing.T) {
+	lines, err := ParseLines(strings.NewReader("# 注释\n\nhttps://www.example.com/book/1/\n  仙逆 | 耳根  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[1] != "仙逆 | 耳根" {
+		t.Errorf("解析结果不正确: %q", lines)
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	books := map[string]string{"1": "仙逆|耳根", "2": "凡人修仙传|忘语"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/book/"), "/")
+		switch {
+		case r.URL.Path == "/search":
+			w.Write([]byte(`<ul>
+<li><a class="name" href="/book/1/">仙逆</a><span class="author">耳根</span></li>
+<li><a class="name" href="/book/2/">凡人修仙传</a><span class="author">忘语</span></li>
+<li><a class="name" href="/book/3/">凡人修仙传同人</a><span class="author">路人</span></li>
+</ul>`))
+		case strings.HasSuffix(r.URL.Path, ".html"):
+			w.Write([]byte(`<div id="content">正文内容</div>`))
+		case books[id] != "":
+			name, author, _ := strings.Cut(books[id], "|")
+			w.Write([]byte(`<h1>` + name + `</h1><p class="author">` + author + `</p>
+<div id="list"><a href="/book/` + id + `/1.html">第一章</a><a href="/book/` + id + `/2.html">第二章</a></div>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	rule := `[{"id": 1, "name": "测试书源", "url": "` + server.URL + `/",
+"search": {"url": "` + server.URL + `/search?q=%s", "method": "get", "result": "li", "bookName": "a.name", "author": ".author"},
+"book": {"bookName": "h1", "author": ".author"}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}]`
+	if err := os.MkdirAll(filepath.Join("configs", "rules"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("configs", "rules", "main-rules.json"), []byte(rule), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Download.DownloadPath = "downloads"
+	cfg.Download.ExtName = "txt"
+	cfg.Source.ActiveRules = "main-rules.json"
+	cfg.Source.SourceId = -1
+	cfg.Crawl.Threads = 2
+	if err := os.MkdirAll(cfg.Download.DownloadPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{config: cfg, batches: make(map[string]*Batch)}
+
+	b, err := m.Create([]string{
+		server.URL + "/book/1/",
+		"凡人修仙传|忘语",
+		"凡人修仙传|路人",
+		server.URL + "/book/404/",
+	}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Summary.Total != 4 || b.Summary.Pending != 4 {
+		t.Errorf("新建任务的汇总不正确: %+v", b.Summary)
+	}
+
+	result, err := m.Run(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != StatusDone || result.Summary != (Summary{Total: 4, Succeeded: 2, Failed: 2}) {
+		t.Fatalf("任务汇总不正确: %s %+v", result.Status, result.Summary)
+	}
+
+	// URL 行直接下载，书名和文件名来自书库索引
+	if item := result.Items[0]; item.Status != StatusSuccess || item.BookName != "仙逆" || item.FileName != "仙逆(耳根).txt" || item.Source != "main-rules.json#1" {
+		t.Errorf("URL 条目结果不正确: %+v", item)
+	}
+	// 书名|作者 行通过搜索解析为书籍URL，书名需完全匹配
+	if item := result.Items[1]; item.Status != StatusSuccess || item.URL != server.URL+"/book/2/" || item.FileName != "凡人修仙传(忘语).txt" {
+		t.Errorf("书名|作者 条目结果不正确: %+v", item)
+	}
+	if item := result.Items[2]; item.Status != StatusFailed || !strings.Contains(item.Reason, "未搜索到匹配的书籍: 凡人修仙传(路人)") {
+		t.Errorf("作者不匹配时应失败: %+v", item)
+	}
+	if item := result.Items[3]; item.Status != StatusFailed || item.Reason == "" {
+		t.Errorf("下载失败的条目应记录原因: %+v", item)
+	}
+	if _, err := os.Stat(filepath.Join("downloads", "凡人修仙传(忘语).txt")); err != nil {
+		t.Errorf("应生成书籍文件: %v", err)
+	}
+
+	if _, err := m.Run(b.ID); err == nil {
+		t.Error("已执行的任务不能再次执行")
+	}
+	if got, ok := m.Get(b.ID); !ok || got.Summary != result.Summary {
+		t.Errorf("获取任务结果不正确: %+v", got)
+	}
+}
@@ -0,0 +1,222 @@
+// Package charmap 还原反爬虫的字符混淆：自定义字体把常用字替换为私用区字符，
+// 或在文字之间插入零宽字符等不可见的干扰字符
+package charmap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// PrivateUse 是否为私用区字符，自定义字体通常把常用字映射到这些码位
+func PrivateUse(r rune) bool {
+	return unicode.Is(unicode.Co, r)
+}
+
+// fillers 显示为空白但不属于空白字符的填充字符
+var fillers = map[rune]bool{'\u115f': true, '\u1160': true, '\u3164': true, '\uffa0': true}
+
+// Noise 是否为干扰字符：零宽空格、零宽连接符、方向标记、软连字符等格式字符，以及显示为空白的填充字符
+func Noise(r rune) bool {
+	return unicode.Is(unicode.Cf, r) || fillers[r]
+}
+
+// Decoder 按映射表还原章节文本，并去除干扰字符
+type Decoder struct {
+	replacer   *strings.Replacer
+	stripNoise bool
+	noise      map[rune]bool
+}
+
+// NewDecoder 创建解码器。mapping 的键为页面中的字符或字符串，较长的键优先；
+// stripNoise 时去除 Noise 字符，noiseChars 中的字符总是去除。没有需要处理的内容时返回 nil
+func NewDecoder(mapping map[string]string, stripNoise bool, noiseChars string) (*Decoder, error) {
+	if len(mapping) == 0 && !stripNoise && noiseChars == "" {
+		return nil, nil
+	}
+
+	d := &Decoder{stripNoise: stripNoise}
+	for _, r := range noiseChars {
+		if d.noise == nil {
+			d.noise = make(map[rune]bool)
+		}
+		d.noise[r] = true
+	}
+
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		if key == "" {
+			return nil, errors.New("映射的字符不能为空")
+		}
+		if d.strip(key) != key {
+			return nil, fmt.Errorf("映射的字符 %q 中包含会被去除的干扰字符", key)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) > 0 {
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) > len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		pairs := make([]string, 0, len(keys)*2)
+		for _, key := range keys {
+			pairs = append(pairs, key, mapping[key])
+		}
+		d.replacer = strings.NewReplacer(pairs...)
+	}
+	return d, nil
+}
+
+// Decode 先去除干扰字符再按映射表替换，d 为 nil 时原样返回
+func (d *Decoder) Decode(s string) string {
+	if d == nil {
+		return s
+	}
+	s = d.strip(s)
+	if d.replacer != nil {
+		s = d.replacer.Replace(s)
+	}
+	return s
+}
+
+// strip 去除干扰字符
+func (d *Decoder) strip(s string) string {
+	if !d.stripNoise && d.noise == nil {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if d.stripNoise && Noise(r) || d.noise[r] {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Char 文本中的私用区字符
+type Char struct {
+	Char    string `json:"char"`
+	Code    string `json:"code"` // 码位，如 U+E0A3
+	Count   int    `json:"count"`
+	Context string `json:"context"` // 第一次出现处的上下文
+}
+
+// contextRunes Scan 返回的上下文在字符两侧各保留的字数
+const contextRunes = 8
+
+// Scan 统计文本中的私用区字符，按出现次数从多到少排列，用于编写映射表
+func Scan(text string) []Char {
+	runes := []rune(text)
+	index := make(map[rune]int)
+	var chars []Char
+	for i, r := range runes {
+		if !PrivateUse(r) {
+			continue
+		}
+		if n, ok := index[r]; ok {
+			chars[n].Count++
+			continue
+		}
+		start, end := max(i-contextRunes, 0), min(i+contextRunes+1, len(runes))
+		index[r] = len(chars)
+		chars = append(chars, Char{
+			Char:    string(r),
+			Code:    fmt.Sprintf("U+%04X", r),
+			Count:   1,
+			Context: strings.Join(strings.Fields(string(runes[start:end])), " "),
+		})
+	}
+	sort.SliceStable(chars, func(i, j int) bool { return chars[i].Count > chars[j].Count })
+	return chars
+}
+
+// 对齐时重新同步的参数：在正确文本中最多向后查找 learnMaxSkip 个字，需连续 learnWindow 个字一致
+const (
+	learnMaxSkip = 200
+	learnWindow  = 6
+)
+
+// Learn 对照同一章节的混淆文本和正确文本（如其他书源的同一章），推断私用区字符的映射。
+// 两段文本去除空白和干扰字符后逐字对齐，遇到不一致的普通字符时在正确文本中向后查找重新对齐，
+// 仍无法对齐时跳过混淆文本中的字符。同一字符对应多个字时取出现最多的，其余记入 conflicts
+func Learn(obfuscated, plain string) (mapping map[string]string, conflicts []string) {
+	a, b := normalize(obfuscated), normalize(plain)
+	votes := make(map[rune]map[rune]int)
+
+	// matches 从 a[i]、b[j] 开始的一段是否一致，私用区字符与任何字一致
+	matches := func(i, j int) bool {
+		for t := 0; t < learnWindow; t++ {
+			if i+t >= len(a) || j+t >= len(b) {
+				return t > 0
+			}
+			if !PrivateUse(a[i+t]) && a[i+t] != b[j+t] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case PrivateUse(a[i]):
+			if votes[a[i]] == nil {
+				votes[a[i]] = make(map[rune]int)
+			}
+			votes[a[i]][b[j]]++
+			i, j = i+1, j+1
+		case a[i] == b[j]:
+			i, j = i+1, j+1
+		default:
+			skipped := false
+			for k := j + 1; k <= j+learnMaxSkip && k < len(b); k++ {
+				if matches(i, k) {
+					j, skipped = k, true
+					break
+				}
+			}
+			if !skipped {
+				i++
+			}
+		}
+	}
+
+	mapping = make(map[string]string, len(votes))
+	keys := make([]rune, 0, len(votes))
+	for r := range votes {
+		keys = append(keys, r)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, r := range keys {
+		candidates := make([]rune, 0, len(votes[r]))
+		for c := range votes[r] {
+			candidates = append(candidates, c)
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			ci, cj := votes[r][candidates[i]], votes[r][candidates[j]]
+			return ci > cj || ci == cj && candidates[i] < candidates[j]
+		})
+		mapping[string(r)] = string(candidates[0])
+		if len(candidates) > 1 {
+			parts := make([]string, len(candidates))
+			for i, c := range candidates {
+				parts[i] = fmt.Sprintf("%c(%d)", c, votes[r][c])
+			}
+			conflicts = append(conflicts, fmt.Sprintf("U+%04X: %s", r, strings.Join(parts, " ")))
+		}
+	}
+	return mapping, conflicts
+}
+
+// normalize 去除空白和干扰字符
+func normalize(s string) []rune {
+	runes := make([]rune, 0, len(s))
+	for _, r := range s {
+		if !unicode.IsSpace(r) && !Noise(r) {
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
@@ -0,0 +1,54 @@
+package charmap
+
+import (
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	d, err := NewDecoder(map[string]string{"\ue001": "的", "\ue002": "是", "\ue003\ue004": "他们"}, true, "★")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := d.Decode("这\u200b\ue002我\ue001书，\ue003\ue004来\ufeff了★")
+	if want := "这是我的书，他们来了"; got != want {
+		t.Errorf("解码结果为 %q，期望 %q", got, want)
+	}
+
+	if d, _ := NewDecoder(nil, false, ""); d != nil || d.Decode("原样") != "原样" {
+		t.Error("未配置时应返回 nil 并原样输出")
+	}
+	if _, err := NewDecoder(map[string]string{"": "的"}, false, ""); err == nil {
+		t.Error("空的映射字符应返回错误")
+	}
+	if _, err := NewDecoder(map[string]string{"\u200b": "的"}, true, ""); err == nil {
+		t.Error("映射字符会被去除时应返回错误")
+	}
+}
+
+func TestScan(t *testing.T) {
+	chars := Scan("他\ue002一个好人，书是\ue001的\ue002")
+	if len(chars) != 2 || chars[0].Code != "U+E002" || chars[0].Count != 2 || chars[1].Char != "\ue001" {
+		t.Fatalf("统计结果不正确: %+v", chars)
+	}
+	if chars[0].Context != "他\ue002一个好人，书是\ue001" {
+		t.Errorf("上下文不正确: %q", chars[0].Context)
+	}
+}
+
+func TestLearn(t *testing.T) {
+	// 混淆文本中有干扰字符和多余的广告，正确文本的空白不同
+	obfuscated := "第一章\n\n　　他\ue002一个\ue003人，这\u200b\ue002\ue001书。\n　　广告文字\n　　我\ue001朋友说\ue003。"
+	plain := "第一章 他是一个好人，这是的书。我的朋友说好。"
+	mapping, conflicts := Learn(obfuscated, plain)
+	if len(mapping) != 3 || mapping["\ue001"] != "的" || mapping["\ue002"] != "是" || mapping["\ue003"] != "好" {
+		t.Errorf("推断的映射不正确: %v", mapping)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("不应有冲突: %v", conflicts)
+	}
+
+	_, conflicts = Learn("\ue001\ue001\ue001", "的的了")
+	if len(conflicts) != 1 || conflicts[0] != "U+E001: 的(2) 了(1)" {
+		t.Errorf("冲突不正确: %v", conflicts)
+	}
+}
@@ -0,0 +1,710 @@
+// Package cli 实现命令行模式：搜索、下载、批量下载、书库维护与启动Web服务
+package cli
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-novel/internal/batch"
+	"go-novel/internal/charmap"
+	"go-novel/internal/config"
+	"go-novel/internal/core"
+	"go-novel/internal/embed"
+	"go-novel/internal/fetcher"
+	"go-novel/internal/fixture"
+	"go-novel/internal/library"
+	"go-novel/internal/rules"
+	"go-novel/internal/web"
+
+	"golang.org/x/term"
+)
+
+const (
+	// ExitOK 执行成功
+	ExitOK = 0
+	// ExitFailure 执行失败
+	ExitFailure = 1
+	// ExitUsage 参数错误
+	ExitUsage = 2
+)
+
+// command 子命令
+type command struct {
+	name  string
+	usage string
+	run   func(cfg *config.Config, args []string) int
+}
+
+var commands = []command{
+	{"search", "search <关键词> [--source N|文件#N] [--limit N]    搜索书籍", runSearch},
+	{"download", "download <URL> [--format epub|txt] [--source N|文件#N] [--range 1-100]    下载书籍", runDownload},
+	{"batch", "batch <列表文件> [--format epub|txt] [--source N|文件#N]    批量下载", runBatch},
+	{"login", "login --source 文件#N [--username U] [--password P] [--delete]    保存书源的登录凭据并测试登录", runLogin},
+	{"charmap", "charmap <章节URL...> [--source N|文件#N] [--plain 正文.txt]    统计章节中的私用区字符，对照正确文本生成字符映射表", runCharmap},
+	{"infer", "infer <目录URL> [--save]    自动识别没有规则的网站的目录和正文，可保存为草稿规则", runInfer},
+	{"lint", "lint [规则文件...]    校验规则文件，默认校验当前激活的规则", runLint},
+	{"import", "import <规则包、阅读书源文件或URL> [--file legado-rules.json] [--dry-run]    导入规则包或阅读 (Legado) 书源", runImport},
+	{"export", "export [--file 规则文件] [--source 1,2] [--out 文件]    导出规则包，用于分享", runExport},
+	{"record", "record [--file 规则文件] [--source N] [--keyword K] [--url URL] [--out 目录]    录制书源页面，用于离线回归测试", runRecord},
+	{"rescan", "rescan    根据下载目录中的书籍文件重建书库索引", runRescan},
+	{"serve", "serve [--port N]    启动Web服务", runServe},
+	{"version", "version    显示版本", runVersion},
+}
+
+// Run 执行命令行，返回进程退出码
+func Run(args []string) int {
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		printUsage(os.Stdout)
+		return ExitOK
+	}
+
+	// 初始化配置
+	cfg := config.InitConfig()
+
+	if err := embed.WriteEmbeddedFiles(); err != nil {
+		fmt.Fprintf(os.Stderr, "释放内置文件失败: %v\n", err)
+		return ExitFailure
+	}
+
+	// 未指定子命令时按配置启动Web服务
+	if len(args) == 0 {
+		if cfg.Web.Enabled != 1 {
+			fmt.Println("Web服务未启用 (web.enabled=0)，请使用以下命令：")
+			printUsage(os.Stdout)
+			return ExitUsage
+		}
+		return runServe(cfg, nil)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(cfg, args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "未知命令: %s\n", args[0])
+	printUsage(os.Stderr)
+	return ExitUsage
+}
+
+// printUsage 输出命令用法
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "用法: go-novel <命令> [参数]")
+	fmt.Fprintln(w)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\n", cmd.usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "不带命令运行时，若配置中 web.enabled=1 则启动Web服务")
+}
+
+// parseArgs 解析参数，允许选项出现在位置参数之后
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// newFlagSet 创建子命令参数集
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// runSearch 搜索书籍并输出结果
+func runSearch(cfg *config.Config, args []string) int {
+	fs := newFlagSet("search")
+	source := fs.String("source", strconv.Itoa(cfg.Source.SourceId), "书源ID或 规则文件#书源ID，-1 表示搜索全部书源")
+	limit := fs.Int("limit", cfg.Source.SearchLimit, "每个书源显示的搜索结果数量，0 表示全部")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	keyword := strings.TrimSpace(strings.Join(positional, " "))
+	if keyword == "" {
+		fmt.Fprintln(os.Stderr, "请输入书名或作者")
+		return ExitUsage
+	}
+
+	searchCfg := *cfg
+	if err := searchCfg.Source.SelectSource(*source); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitUsage
+	}
+	searchCfg.Source.SearchLimit = *limit
+	results, err := core.NewCrawler(&searchCfg).Search(keyword)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "搜索失败: %v\n", err)
+		return ExitFailure
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(os.Stderr, "未搜索到: %s\n", keyword)
+		return ExitFailure
+	}
+
+	fmt.Printf("共搜索到 %d 条结果:\n", len(results))
+	for i, result := range results {
+		fmt.Printf("%3d. 《%s》 %s | 书源 %s | %s\n", i+1, result.BookName, result.Author, result.Source, result.LatestChapter)
+		fmt.Printf("     %s\n", result.URL)
+	}
+	return ExitOK
+}
+
+// runDownload 下载单本书籍
+func runDownload(cfg *config.Config, args []string) int {
+	fs := newFlagSet("download")
+	format := fs.String("format", cfg.Download.ExtName, "文件格式 (epub/txt)")
+	source := fs.String("source", strconv.Itoa(cfg.Source.SourceId), "书源ID或 规则文件#书源ID，-1 表示按URL匹配")
+	chapterRange := fs.String("range", "", "章节范围，如 1-100、50-、-20")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "请指定一个书籍URL")
+		return ExitUsage
+	}
+	if *format != "epub" && *format != "txt" {
+		fmt.Fprintln(os.Stderr, "不支持的格式，仅支持epub和txt")
+		return ExitUsage
+	}
+	if *chapterRange != "" {
+		if _, _, err := core.ParseChapterRange(*chapterRange); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+	}
+
+	downloadCfg := *cfg
+	if err := downloadCfg.Source.SelectSource(*source); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitUsage
+	}
+	downloadCfg.Download.ExtName = *format
+	downloadCfg.Download.DownloadId = ""
+	downloadCfg.Download.ChapterRange = *chapterRange
+
+	if err := os.MkdirAll(downloadCfg.Download.DownloadPath, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "创建下载目录失败: %v\n", err)
+		return ExitFailure
+	}
+
+	crawler := core.NewCrawler(&downloadCfg)
+	reporter := newTerminalReporter(os.Stderr)
+	crawler.SetProgressReporter(reporter)
+
+	if err := crawler.Crawl(positional[0]); err != nil {
+		reporter.finish()
+		fmt.Fprintf(os.Stderr, "下载书籍失败: %v\n", err)
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// runBatch 执行批量下载并输出每本书的结果，有失败时返回非零退出码
+func runBatch(cfg *config.Config, args []string) int {
+	fs := newFlagSet("batch")
+	format := fs.String("format", cfg.Download.ExtName, "文件格式 (epub/txt)")
+	source := fs.String("source", strconv.Itoa(cfg.Source.SourceId), "书源ID或 规则文件#书源ID，-1 表示按URL匹配、搜索全部书源")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "请指定一个批量列表文件")
+		return ExitUsage
+	}
+
+	lines, err := batch.ReadListFile(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取批量列表失败: %v\n", err)
+		return ExitFailure
+	}
+
+	manager := batch.GetManager()
+	b, err := manager.Create(lines, *format, *source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建批量任务失败: %v\n", err)
+		return ExitFailure
+	}
+
+	result, err := manager.Run(b.ID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "批量任务执行失败: %v\n", err)
+		return ExitFailure
+	}
+
+	fmt.Println("批量下载结果:")
+	for _, item := range result.Items {
+		if item.Status == batch.StatusSuccess {
+			fmt.Printf("  [成功] %s -> %s\n", item.Line, item.FileName)
+		} else {
+			fmt.Printf("  [失败] %s: %s\n", item.Line, item.Reason)
+		}
+	}
+	fmt.Printf("共 %d 本，成功 %d 本，失败 %d 本\n", result.Summary.Total, result.Summary.Succeeded, result.Summary.Failed)
+
+	if result.Summary.Failed > 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// runLogin 保存书源的登录凭据并立即登录一次，未指定密码时从标准输入读取
+func runLogin(cfg *config.Config, args []string) int {
+	fs := newFlagSet("login")
+	source := fs.String("source", "", "书源ID或 规则文件#书源ID")
+	username := fs.String("username", "", "用户名")
+	password := fs.String("password", "", "密码，为空时从标准输入读取")
+	remove := fs.Bool("delete", false, "删除保存的登录凭据")
+	if _, err := parseArgs(fs, args); err != nil {
+		return ExitUsage
+	}
+
+	file, id, err := config.ParseSourceId(*source)
+	if err != nil || id <= 0 {
+		fmt.Fprintln(os.Stderr, "请使用 --source 指定书源")
+		return ExitUsage
+	}
+	if file == "" {
+		file = cfg.Source.PrimaryRules()
+	}
+	qualified := config.QualifiedSourceId(file, id)
+
+	if *remove {
+		if err := config.SetCredential(qualified, nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitFailure
+		}
+		fmt.Printf("已删除 %s 的登录凭据\n", qualified)
+		return ExitOK
+	}
+
+	rule, err := rules.GetRuleManager().GetRuleById(file, id)
+	if err != nil || rule == nil {
+		fmt.Fprintf(os.Stderr, "未找到书源: %s\n", qualified)
+		return ExitFailure
+	}
+	if *username == "" {
+		fmt.Fprintln(os.Stderr, "请使用 --username 指定用户名")
+		return ExitUsage
+	}
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "密码: ")
+		if *password, err = readPassword(); err != nil {
+			fmt.Fprintln(os.Stderr, "读取密码失败")
+			return ExitUsage
+		}
+	}
+
+	if err := config.SetCredential(qualified, config.Credential{"username": *username, "password": *password}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+	fmt.Printf("已保存 %s 的登录凭据\n", qualified)
+
+	if err := core.NewCrawler(cfg).Login(rule); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// readPassword 从标准输入读取一行密码，标准输入是终端时不回显
+func readPassword() (string, error) {
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// runInfer 自动识别没有规则的网站的章节列表和正文，输出识别结果，指定 --save 时保存为草稿规则
+func runInfer(cfg *config.Config, args []string) int {
+	fs := newFlagSet("infer")
+	save := fs.Bool("save", false, "将识别出的规则保存到 "+rules.DraftRulesFile)
+	urls, err := parseArgs(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if len(urls) != 1 {
+		fmt.Fprintln(os.Stderr, "请指定一个目录页URL")
+		return ExitUsage
+	}
+
+	result, err := core.NewCrawler(cfg).InferRule(urls[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "自动识别失败: %v\n", err)
+		return ExitFailure
+	}
+	rule := result.Rule
+	fmt.Printf("书名: %s\n", rule.Book.BookName)
+	fmt.Printf("章节列表: %s (%d 章)\n", rule.Toc.Item, result.Chapters)
+	fmt.Printf("正文: %s\n", rule.Chapter.Content)
+	fmt.Printf("第一章 %s:\n%s\n", result.FirstChapter, result.Sample)
+	if !*save {
+		fmt.Println("使用 --save 将识别出的规则保存为草稿")
+		return ExitOK
+	}
+
+	id, issues, err := rules.GetRuleManager().SaveDraft(*rule)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "保存草稿规则失败: %v\n", err)
+		return ExitFailure
+	}
+	for _, issue := range issues {
+		fmt.Printf("[警告] %s\n", issue.Error())
+	}
+	fmt.Printf("已保存为 %s#%d，检查后可移动到激活的规则文件\n", rules.DraftRulesFile, id)
+	return ExitOK
+}
+
+// runCharmap 下载章节并统计仍未映射的私用区字符和干扰字符，提供正确文本时推断 chapter.charMap
+func runCharmap(cfg *config.Config, args []string) int {
+	fs := newFlagSet("charmap")
+	source := fs.String("source", strconv.Itoa(cfg.Source.SourceId), "书源ID或 规则文件#书源ID，-1 表示按URL匹配")
+	plainFile := fs.String("plain", "", "与章节内容相同的正确文本文件，多个章节时依次拼接")
+	urls, err := parseArgs(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if len(urls) == 0 {
+		fmt.Fprintln(os.Stderr, "请指定至少一个章节URL")
+		return ExitUsage
+	}
+
+	chapterCfg := *cfg
+	if err := chapterCfg.Source.SelectSource(*source); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitUsage
+	}
+	crawler := core.NewCrawler(&chapterCfg)
+	var texts []string
+	for _, u := range urls {
+		text, err := crawler.FetchChapter(u)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "下载章节失败 %s: %v\n", u, err)
+			return ExitFailure
+		}
+		texts = append(texts, text)
+	}
+	text := strings.Join(texts, "\n")
+
+	noise := make(map[rune]int)
+	for _, r := range text {
+		if charmap.Noise(r) {
+			noise[r]++
+		}
+	}
+	noiseRunes := make([]rune, 0, len(noise))
+	for r := range noise {
+		noiseRunes = append(noiseRunes, r)
+	}
+	sort.Slice(noiseRunes, func(i, j int) bool { return noiseRunes[i] < noiseRunes[j] })
+	for _, r := range noiseRunes {
+		fmt.Printf("[干扰] U+%04X 出现 %d 次，可开启 chapter.stripNoise\n", r, noise[r])
+	}
+
+	chars := charmap.Scan(text)
+	for _, c := range chars {
+		fmt.Printf("[未映射] %s 出现 %d 次: %s\n", c.Code, c.Count, c.Context)
+	}
+	if len(chars) == 0 {
+		fmt.Println("章节中没有未映射的私用区字符")
+		return ExitOK
+	}
+	if *plainFile == "" {
+		fmt.Println("使用 --plain 提供同一章节的正确文本，可以推断字符映射表")
+		return ExitOK
+	}
+
+	plain, err := os.ReadFile(*plainFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取正确文本失败: %v\n", err)
+		return ExitFailure
+	}
+	mapping, conflicts := charmap.Learn(text, string(plain))
+	for _, conflict := range conflicts {
+		fmt.Printf("[冲突] %s\n", conflict)
+	}
+	fmt.Printf("推断出 %d/%d 个字符，将以下内容合并到规则的 chapter.charMap:\n", len(mapping), len(chars))
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		// 私用区字符在终端中通常无法显示，输出为转义形式
+		lines[i] = fmt.Sprintf("  \"\\u%04x\": %q", []rune(key)[0], mapping[key])
+	}
+	fmt.Printf("\"charMap\": {\n%s\n}\n", strings.Join(lines, ",\n"))
+	return ExitOK
+}
+
+// runLint 校验规则文件并输出问题，存在错误时返回非零退出码
+func runLint(cfg *config.Config, args []string) int {
+	fs := newFlagSet("lint")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if len(files) == 0 {
+		files = cfg.Source.RuleFiles()
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, file := range files {
+		issues, err := rules.GetRuleManager().Lint(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			errorCount++
+			continue
+		}
+		for _, issue := range issues {
+			if issue.Severity == rules.SeverityError {
+				errorCount++
+				fmt.Printf("[错误] %s\n", issue.Error())
+			} else {
+				warningCount++
+				fmt.Printf("[警告] %s\n", issue.Error())
+			}
+		}
+	}
+
+	fmt.Printf("共 %d 个错误，%d 个警告\n", errorCount, warningCount)
+	if errorCount > 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// runImport 将规则包合并到规则文件，或将阅读书源转换为规则并追加，输出跳过的书源和无法转换的字段
+func runImport(cfg *config.Config, args []string) int {
+	fs := newFlagSet("import")
+	file := fs.String("file", "legado-rules.json", "导入到的规则文件，不存在时创建")
+	dryRun := fs.Bool("dry-run", false, "只转换并输出结果，不写入规则文件")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return ExitUsage
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "请指定规则包、阅读书源文件或URL")
+		return ExitUsage
+	}
+
+	source := positional[0]
+	data, err := readImportSource(cfg, source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取书源失败: %v\n", err)
+		return ExitFailure
+	}
+
+	result, err := rules.GetRuleManager().ImportRules(*file, filepath.Base(source), data, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+
+	for _, issue := range result.Issues {
+		if issue.Severity == rules.SeverityError {
+			fmt.Printf("[跳过] %s\n", issue.Error())
+		} else {
+			fmt.Printf("[警告] %s\n", issue.Error())
+		}
+	}
+	for _, rule := range result.Imported {
+		fmt.Printf("[导入] %d %s\n", rule.ID, rule.Name)
+	}
+	for _, rule := range result.Updated {
+		fmt.Printf("[更新] %d %s\n", rule.ID, rule.Name)
+	}
+
+	if meta := result.Meta; meta != nil && meta.Name != "" {
+		fmt.Printf("规则包: %s %s %s\n", meta.Name, meta.Version, meta.Author)
+	}
+	action := "已导入"
+	if *dryRun {
+		action = "可导入"
+	}
+	fmt.Printf("共 %d 个书源，%s %d 个、更新 %d 个到 %s\n", result.Sources, action, len(result.Imported), len(result.Updated), *file)
+	if len(result.Imported)+len(result.Updated) == 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// runExport 将规则文件中的书源导出为带元数据的规则包
+func runExport(cfg *config.Config, args []string) int {
+	fs := newFlagSet("export")
+	file := fs.String("file", cfg.Source.PrimaryRules(), "规则文件")
+	sources := fs.String("source", "", "导出的书源ID，逗号分隔，为空时导出全部")
+	out := fs.String("out", "", "输出文件，默认为 <规则文件名>-export.json")
+	if _, err := parseArgs(fs, args); err != nil {
+		return ExitUsage
+	}
+
+	var ids []int
+	for _, s := range strings.Split(*sources, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "书源ID无效: %s\n", s)
+			return ExitUsage
+		}
+		ids = append(ids, id)
+	}
+
+	data, err := rules.ExportRules(*file, ids)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailure
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(filepath.Base(*file), ".json") + "-export.json"
+	}
+	if err := os.WriteFile(*out, append(data, '\n'), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "写入文件失败: %v\n", err)
+		return ExitFailure
+	}
+	fmt.Printf("已导出 %s 到 %s\n", *file, *out)
+	return ExitOK
+}
+
+// runVersion 显示程序版本
+func runVersion(cfg *config.Config, args []string) int {
+	fmt.Printf("go-novel %s\n", config.Version)
+	return ExitOK
+}
+
+// readImportSource 读取本地书源文件，http(s) 开头时下载
+func readImportSource(cfg *config.Config, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	f := fetcher.New(fetcher.WithTransport(core.NewTransport(cfg)), fetcher.WithTimeout(30*time.Second))
+	resp, err := fetcher.Get(context.Background(), f, source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// runRecord 录制书源的搜索、详情、目录和章节页面，默认录制规则文件中所有启用的书源
+func runRecord(cfg *config.Config, args []string) int {
+	fs := newFlagSet("record")
+	file := fs.String("file", cfg.Source.PrimaryRules(), "规则文件")
+	sourceId := fs.Int("source", -1, "书源ID，-1 表示录制全部书源")
+	keyword := fs.String("keyword", "斗破苍穹", "搜索关键词")
+	bookURL := fs.String("url", "", "书籍URL，为空时使用第一条搜索结果")
+	out := fs.String("out", "fixtures", "录制数据保存目录，相对路径基于当前目录；回放测试读取源码中的 internal/fixture/testdata")
+	if _, err := parseArgs(fs, args); err != nil {
+		return ExitUsage
+	}
+
+	ruleList, err := rules.GetRuleManager().LoadRules(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载规则失败: %v\n", err)
+		return ExitFailure
+	}
+
+	failed := 0
+	recorded := 0
+	for _, rule := range ruleList {
+		if *sourceId == -1 && rule.Disabled || *sourceId != -1 && rule.ID != *sourceId {
+			continue
+		}
+
+		fx, err := fixture.Record(cfg, *out, fixture.Options{
+			RulesFile: *file,
+			RuleID:    rule.ID,
+			Keyword:   *keyword,
+			BookURL:   *bookURL,
+		})
+		if err != nil {
+			failed++
+			fmt.Printf("[失败] %d %s: %v\n", rule.ID, rule.Name, err)
+			continue
+		}
+		recorded++
+		fmt.Printf("[成功] %d %s: %s，%d 个页面，%d 章\n", rule.ID, rule.Name, fx.Expected.Book.BookName, len(fx.Responses), fx.Expected.Chapters)
+	}
+
+	if recorded == 0 && failed == 0 {
+		fmt.Fprintf(os.Stderr, "未找到要录制的书源\n")
+		return ExitFailure
+	}
+	fmt.Printf("录制完成: 成功 %d 个，失败 %d 个，保存目录: %s\n", recorded, failed, *out)
+	if failed > 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+// runRescan 重建书库索引
+func runRescan(cfg *config.Config, args []string) int {
+	fs := newFlagSet("rescan")
+	if _, err := parseArgs(fs, args); err != nil {
+		return ExitUsage
+	}
+
+	lib := library.GetLibrary(cfg.Download.DownloadPath)
+	if err := lib.Rescan(); err != nil {
+		fmt.Fprintf(os.Stderr, "重建书库索引失败: %v\n", err)
+		return ExitFailure
+	}
+	books, _ := lib.List(library.Filter{}, "name", false)
+	fmt.Printf("书库索引已重建，共 %d 本书籍: %s\n", len(books), lib.Dir())
+	return ExitOK
+}
+
+// runServe 启动Web服务，命令行指定时忽略 web.enabled 配置
+func runServe(cfg *config.Config, args []string) int {
+	fs := newFlagSet("serve")
+	port := fs.Int("port", cfg.Web.Port, "Web服务端口")
+	if _, err := parseArgs(fs, args); err != nil {
+		return ExitUsage
+	}
+
+	cfg.Web.Enabled = 1
+	cfg.Web.Port = *port
+	if err := web.StartServer(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Web服务启动失败: %v\n", err)
+		return ExitFailure
+	}
+	return ExitOK
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		format     string
+		rangeValue string
+		wantErr    bool
+	}{
+		{args: []string{"http://a/"}, positional: []string{"http://a/"}, format: "epub"},
+		{args: []string{"http://a/", "--format", "txt", "--range", "1-100"}, positional: []string{"http://a/"}, format: "txt", rangeValue: "1-100"},
+		{args: []string{"--range=50-", "http://a/", "http://b/"}, positional: []string{"http://a/", "http://b/"}, format: "epub", rangeValue: "50-"},
+		{args: []string{"仙逆", "-format", "txt", "耳根"}, positional: []string{"仙逆", "耳根"}, format: "txt"},
+		{args: []string{"http://a/", "--", "--format"}, positional: []string{"http://a/", "--format"}, format: "epub"},
+		{args: []string{"http://a/", "--unknown"}, wantErr: true},
+		{args: []string{"http://a/", "--range"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		format := fs.String("format", "epub", "")
+		chapterRange := fs.String("range", "", "")
+
+		positional, err := parseArgs(fs, tt.args)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: 应返回错误", tt.args)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(positional, tt.positional) || *format != tt.format || *chapterRange != tt.rangeValue {
+			t.Errorf("%q: 得到 %q format=%q range=%q, %v", tt.args, positional, *format, *chapterRange, err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/book/1/":
+			w.Write([]byte(`<html><body><h1>仙逆</h1><p class="author">耳根</p><div id="list">
+<a href="/book/1/1.html">第一章 离乡</a><a href="/book/1/2.html">第二章 入门</a><a href="/book/1/3.html">第三章 拜师</a></div></body></html>`))
+		case "/book/1/1.html", "/book/1/2.html", "/book/1/3.html":
+			w.Write([]byte(`<html><body><div id="content">` + r.URL.Path + ` 的正文</div></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	rule := `[{"id": 1, "name": "测试书源", "url": "` + server.URL + `/", "search": {"disabled": true},
+"book": {"bookName": "h1", "author": ".author"}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}]`
+	if err := os.MkdirAll(filepath.Join("configs", "rules"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("configs", "rules", "main-rules.json"), []byte(rule), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bookUrl := server.URL + "/book/1/"
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"帮助", []string{"--help"}, ExitOK},
+		{"版本", []string{"version"}, ExitOK},
+		{"未指定命令且未启用Web服务", nil, ExitUsage},
+		{"未知命令", []string{"unknown"}, ExitUsage},
+		{"未知参数", []string{"download", bookUrl, "--unknown"}, ExitUsage},
+		{"缺少关键词", []string{"search"}, ExitUsage},
+		{"无效的书源", []string{"search", "仙逆", "--source", "other-rules.json#1"}, ExitUsage},
+		{"缺少URL", []string{"download"}, ExitUsage},
+		{"多个URL", []string{"download", bookUrl, bookUrl}, ExitUsage},
+		{"不支持的格式", []string{"download", bookUrl, "--format", "pdf"}, ExitUsage},
+		{"无效的章节范围", []string{"download", bookUrl, "--range", "abc"}, ExitUsage},
+		{"章节范围起始大于结束", []string{"download", bookUrl, "--range", "3-1"}, ExitUsage},
+		{"章节范围超出目录", []string{"download", bookUrl, "--range", "5-"}, ExitFailure},
+		{"下载失败", []string{"download", server.URL + "/book/2/"}, ExitFailure},
+		{"批量列表不存在", []string{"batch", "missing.txt"}, ExitFailure},
+		{"按章节范围下载", []string{"download", "--range", "2-3", bookUrl, "--format", "txt"}, ExitOK},
+	}
+	for _, tt := range tests {
+		if got := Run(tt.args); got != tt.want {
+			t.Errorf("%s %q: 退出码 %d，期望 %d", tt.name, tt.args, got, tt.want)
+		}
+	}
+
+	// 只下载范围内的章节
+	data, err := os.ReadFile(filepath.Join("downloads", "仙逆(耳根).txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := string(data); strings.Contains(text, "离乡") || !strings.Contains(text, "入门") || !strings.Contains(text, "拜师") {
+		t.Errorf("应只包含第2到3章:\n%s", text)
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressBarWidth 进度条宽度
+const progressBarWidth = 30
+
+// terminalReporter 在终端中以进度条显示下载进度
+type terminalReporter struct {
+	out      io.Writer
+	mutex    sync.Mutex
+	start    time.Time
+	lastDraw time.Time
+	drawn    bool
+}
+
+// newTerminalReporter 创建终端进度显示
+func newTerminalReporter(out io.Writer) *terminalReporter {
+	return &terminalReporter{out: out, start: time.Now()}
+}
+
+// Progress 刷新进度条，限制刷新频率避免刷屏
+func (r *terminalReporter) Progress(current, total int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if current < total && time.Since(r.lastDraw) < 200*time.Millisecond {
+		return
+	}
+	r.draw(current, total)
+}
+
+// Complete 显示完成进度
+func (r *terminalReporter) Complete(total int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.draw(total, total)
+	fmt.Fprintf(r.out, "\n下载完成，共 %d 章，耗时 %.1f 秒\n", total, time.Since(r.start).Seconds())
+	r.drawn = false
+}
+
+// Error 在进度条下方输出错误
+func (r *terminalReporter) Error(message string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.drawn {
+		fmt.Fprintln(r.out)
+		r.drawn = false
+	}
+	fmt.Fprintf(r.out, "错误: %s\n", message)
+}
+
+// finish 结束进度条所在行
+func (r *terminalReporter) finish() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.drawn {
+		fmt.Fprintln(r.out)
+		r.drawn = false
+	}
+}
+
+// draw 绘制进度条，调用方需持有锁
+func (r *terminalReporter) draw(current, total int) {
+	percent := 0.0
+	if total > 0 {
+		percent = float64(current) / float64(total)
+	}
+	filled := int(percent * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	fmt.Fprintf(r.out, "\r[%s] %d/%d (%.1f%%)", bar, current, total, percent*100)
+	r.lastDraw = time.Now()
+	r.drawn = true
+}
@@ -3,19 +3,33 @@ package config
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 
 	"go-novel/internal/embed"
+	"go-novel/internal/util"
 
 	"github.com/spf13/viper"
 )
 
+// DevVersion 未通过编译参数指定版本时的版本号
+const DevVersion = "dev"
+
+// Version 程序版本，发布时通过 -ldflags "-X go-novel/internal/config.Version=v1.2.0" 设置
+var Version = DevVersion
+
 type Config struct {
 	Download DownloadConfig `mapstructure:"download"`
 	Source   SourceConfig   `mapstructure:"source"`
 	Crawl    CrawlConfig    `mapstructure:"crawl"`
 	Web      WebConfig      `mapstructure:"web"`
 	Proxy    ProxyConfig    `mapstructure:"proxy"`
+	Watch    WatchConfig    `mapstructure:"watch"`
 }
 
 type DownloadConfig struct {
@@ -23,6 +37,8 @@ type DownloadConfig struct {
 	ExtName              string `mapstructure:"extname"`
 	PreserveChapterCache int    `mapstructure:"preserve-chapter-cache"`
 	DownloadId           string `mapstructure:"download-id"` // 添加下载ID字段
+	Incremental          bool   `mapstructure:"-"`           // 增量下载：复用章节缓存，只下载新章节
+	ChapterRange         string `mapstructure:"-"`           // 章节范围，如 "1-100"、"50-"，为空时下载全部
 }
 
 type SourceConfig struct {
@@ -32,6 +48,67 @@ type SourceConfig struct {
 	SearchLimit int    `mapstructure:"search-limit"`
 }
 
+// RuleFiles 返回激活的规则文件，active-rules 中可以用逗号分隔多个文件
+func (s SourceConfig) RuleFiles() []string {
+	var files []string
+	for _, file := range strings.Split(s.ActiveRules, ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// PrimaryRules 返回第一个激活的规则文件，未限定规则文件的书源ID对应该文件中的书源
+func (s SourceConfig) PrimaryRules() string {
+	if files := s.RuleFiles(); len(files) > 0 {
+		return files[0]
+	}
+	return s.ActiveRules
+}
+
+// SelectSource 指定使用的书源。source 可以是规则ID，对应第一个激活的规则文件中的书源，
+// 也可以是 "规则文件#规则ID" 形式的限定ID，此时只使用该规则文件；为空时使用 -1 (不指定书源)
+func (s *SourceConfig) SelectSource(source string) error {
+	file, id, err := ParseSourceId(source)
+	if err != nil {
+		return err
+	}
+	if file != "" {
+		if !slices.Contains(s.RuleFiles(), file) {
+			return fmt.Errorf("规则文件未激活: %s", file)
+		}
+		s.ActiveRules = file
+	}
+	s.SourceId = id
+	return nil
+}
+
+// QualifiedSourceId 返回书源的限定ID "规则文件#规则ID"，同时激活的多个规则文件可以使用相同的规则ID。
+// file 为空时只返回规则ID
+func QualifiedSourceId(file string, id int) string {
+	if file == "" {
+		return strconv.Itoa(id)
+	}
+	return file + "#" + strconv.Itoa(id)
+}
+
+// ParseSourceId 解析规则ID或限定ID，为空时返回 -1
+func ParseSourceId(source string) (file string, id int, err error) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return "", -1, nil
+	}
+	idStr := source
+	if i := strings.LastIndex(source, "#"); i >= 0 {
+		file, idStr = source[:i], source[i+1:]
+	}
+	if id, err = strconv.Atoi(idStr); err != nil || file != "" && id <= 0 {
+		return "", 0, fmt.Errorf("无效的书源ID: %s", source)
+	}
+	return file, id, nil
+}
+
 type CrawlConfig struct {
 	Threads          int `mapstructure:"threads"`
 	MinInterval      int `mapstructure:"min-interval"`
@@ -53,11 +130,26 @@ type ProxyConfig struct {
 	Port    int    `mapstructure:"port"`
 }
 
+type WatchConfig struct {
+	Enabled    int `mapstructure:"enabled"`
+	Interval   int `mapstructure:"interval"`
+	AutoUpdate int `mapstructure:"auto-update"`
+}
+
 var (
 	config *Config
 	once   sync.Once
+	// mutex 保护运行时修改的配置项，如 SetActiveRules 切换激活的规则文件
+	mutex sync.RWMutex
 )
 
+// Copy 在锁内复制配置，并发读取时不与 SetActiveRules 等运行时修改冲突
+func (c *Config) Copy() Config {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return *c
+}
+
 func InitConfig() *Config {
 	once.Do(func() {
 		// 设置配置文件
@@ -86,6 +178,9 @@ func InitConfig() *Config {
 		viper.SetDefault("proxy.enabled", 0)
 		viper.SetDefault("proxy.host", "127.0.0.1")
 		viper.SetDefault("proxy.port", 7890)
+		viper.SetDefault("watch.enabled", 1)
+		viper.SetDefault("watch.interval", 360)
+		viper.SetDefault("watch.auto-update", 0)
 
 		// 读取配置文件
 		if err := viper.ReadInConfig(); err != nil {
@@ -127,3 +222,42 @@ func GetConfig() *Config {
 	}
 	return config
 }
+
+// activeRulesPattern 匹配配置文件中的 active-rules 行
+var activeRulesPattern = regexp.MustCompile(`(?m)^(\s*active-rules\s*=)[^\r\n]*`)
+
+// SetActiveRules 切换激活的规则文件 (多个文件以逗号分隔)，并写回配置文件中的 active-rules 行，保留其余内容和注释
+func SetActiveRules(filename string) error {
+	cfg := GetConfig()
+
+	// 读取、改写配置文件和更新内存中的配置在同一把锁内完成
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	fp := viper.ConfigFileUsed()
+	if fp == "" {
+		// 使用嵌入配置启动时写入释放到磁盘的配置文件
+		fp = filepath.Join("configs", "config.ini")
+	}
+
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	if !activeRulesPattern.Match(data) {
+		return fmt.Errorf("配置文件中未找到 active-rules: %s", fp)
+	}
+
+	data = activeRulesPattern.ReplaceAllFunc(data, func(line []byte) []byte {
+		key := activeRulesPattern.FindSubmatch(line)[1]
+		return append(append([]byte{}, key...), " "+filename...)
+	})
+	// 写入临时文件后替换，其他进程读取配置文件时不会看到写了一半的内容
+	if err := util.WriteFileAtomic(fp, data, 0644); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+
+	viper.Set("source.active-rules", filename)
+	cfg.Source.ActiveRules = filename
+	return nil
+}
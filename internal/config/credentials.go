@@ -0,0 +1,111 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"go-novel/internal/util"
+
+	"github.com/spf13/viper"
+)
+
+// CredentialsFileName 书源登录凭据文件，与 config.ini 保存在同一目录下
+const CredentialsFileName = "credentials.json"
+
+// Credential 书源的登录凭据，通常包含 username 和 password，其余字段同样可以在登录规则中作为变量使用
+type Credential map[string]string
+
+// CredentialInfo 凭据列表中的一项，不包含密码
+type CredentialInfo struct {
+	Source   string `json:"source"` // 书源的限定ID "规则文件#规则ID"
+	Username string `json:"username"`
+}
+
+// credentialsMutex 保护凭据文件的读写
+var credentialsMutex sync.Mutex
+
+// credentialsPath 凭据文件路径，使用嵌入配置启动时为 configs 目录
+func credentialsPath() string {
+	if fp := viper.ConfigFileUsed(); fp != "" {
+		return filepath.Join(filepath.Dir(fp), CredentialsFileName)
+	}
+	return filepath.Join("configs", CredentialsFileName)
+}
+
+// loadCredentials 读取所有凭据，文件不存在时返回空表
+func loadCredentials() (map[string]Credential, error) {
+	credentials := make(map[string]Credential)
+	data, err := os.ReadFile(credentialsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return credentials, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取登录凭据失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("解析登录凭据失败: %w", err)
+	}
+	return credentials, nil
+}
+
+// GetCredential 获取书源的登录凭据，source 为书源的限定ID
+func GetCredential(source string) (Credential, bool) {
+	credentialsMutex.Lock()
+	defer credentialsMutex.Unlock()
+
+	credentials, err := loadCredentials()
+	if err != nil {
+		fmt.Println(err)
+		return nil, false
+	}
+	credential, ok := credentials[source]
+	return credential, ok
+}
+
+// SetCredential 保存书源的登录凭据，credential 为空时删除。文件权限为 0600
+func SetCredential(source string, credential Credential) error {
+	credentialsMutex.Lock()
+	defer credentialsMutex.Unlock()
+
+	credentials, err := loadCredentials()
+	if err != nil {
+		return err
+	}
+	if len(credential) == 0 {
+		delete(credentials, source)
+	} else {
+		credentials[source] = credential
+	}
+
+	data, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 替换整个文件，已存在的文件权限过宽时也会改为 0600
+	if err := util.WriteFileAtomic(credentialsPath(), data, 0600); err != nil {
+		return fmt.Errorf("写入登录凭据失败: %w", err)
+	}
+	return nil
+}
+
+// ListCredentials 列出已保存凭据的书源，按书源排序
+func ListCredentials() ([]CredentialInfo, error) {
+	credentialsMutex.Lock()
+	defer credentialsMutex.Unlock()
+
+	credentials, err := loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]CredentialInfo, 0, len(credentials))
+	for source, credential := range credentials {
+		list = append(list, CredentialInfo{Source: source, Username: credential["username"]})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Source < list[j].Source })
+	return list, nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSetCredentialPermission(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows不支持Unix文件权限")
+	}
+	t.Chdir(t.TempDir())
+
+	// 已存在的凭据文件权限过宽
+	fp := filepath.Join("configs", CredentialsFileName)
+	if err := os.MkdirAll("configs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fp, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetCredential("测试书源", Credential{"username": "user", "password": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("凭据文件权限应为 0600，实际 %o", perm)
+	}
+	if credential, ok := GetCredential("测试书源"); !ok || credential["password"] != "secret" {
+		t.Errorf("应能读取保存的凭据: %v", credential)
+	}
+}
@@ -1,12 +1,18 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 
+	"go-novel/internal/config"
 	"go-novel/internal/model"
+	"go-novel/internal/urltemplate"
+	"go-novel/internal/util"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -16,7 +22,7 @@ func (c *Crawler) parseBookInfo(bookUrl string, rule *model.Rule) (*model.Book,
 	// 发起HTTP请求
 	fmt.Printf("Debug: 开始解析书籍信息，URL: %s\n", bookUrl)
 
-	resp, err := c.client.Get(bookUrl)
+	resp, err := c.fetchPage(context.Background(), c.fetcher, rule, StageBook, bookUrl)
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +34,7 @@ func (c *Crawler) parseBookInfo(bookUrl string, rule *model.Rule) (*model.Book,
 	}
 
 	// 解析HTML文档
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	doc, err := parseDocument(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -37,23 +43,30 @@ func (c *Crawler) parseBookInfo(bookUrl string, rule *model.Rule) (*model.Book,
 	book := &model.Book{
 		URL:      bookUrl,
 		SourceId: rule.ID,
+		Source:   config.QualifiedSourceId(rule.File, rule.ID),
 	}
 
 	// 显示页面标题
 	title := doc.Find("title").Text()
 	fmt.Printf("Debug: 页面标题: %s\n", title)
 
-	// 根据规则提取信息
+	// 根据规则提取信息，已提取的书名和作者可在之后字段的脚本中通过 book 访问
+	compiled := compiledRule(rule)
+	jsBook := &util.JsBook{URL: bookUrl}
+	js := c.jsContext(context.Background(), bookUrl)
+	js.Book = jsBook
 	if rule.Book.BookName != "" {
-		book.BookName = c.extractText(doc.Selection, rule.Book.BookName)
+		book.BookName = compiled.Book.BookName.TextWith(doc.Selection, js)
 		fmt.Printf("Debug: 根据规则提取到书名: '%s'\n", book.BookName)
+		jsBook.Name = book.BookName
 	}
 	if rule.Book.Author != "" {
-		book.Author = c.extractText(doc.Selection, rule.Book.Author)
+		book.Author = compiled.Book.Author.TextWith(doc.Selection, js)
 		fmt.Printf("Debug: 根据规则提取到作者: '%s'\n", book.Author)
+		jsBook.Author = book.Author
 	}
 	if rule.Book.Intro != "" {
-		book.Intro = c.extractText(doc.Selection, rule.Book.Intro)
+		book.Intro = compiled.Book.Intro.TextWith(doc.Selection, js)
 		if len(book.Intro) > 50 {
 			fmt.Printf("Debug: 根据规则提取到简介: %s...\n", book.Intro[:50])
 		} else {
@@ -61,31 +74,31 @@ func (c *Crawler) parseBookInfo(bookUrl string, rule *model.Rule) (*model.Book,
 		}
 	}
 	if rule.Book.Category != "" {
-		book.Category = c.extractText(doc.Selection, rule.Book.Category)
+		book.Category = compiled.Book.Category.TextWith(doc.Selection, js)
 		fmt.Printf("Debug: 根据规则提取到分类: '%s'\n", book.Category)
 	}
 	if rule.Book.CoverUrl != "" {
-		book.CoverUrl = c.extractAttr(doc.Selection, rule.Book.CoverUrl, "src")
+		book.CoverUrl = compiled.Book.CoverUrl.AttrWith(doc.Selection, "src", js)
 		if book.CoverUrl == "" {
 			// 尝试从content属性中获取
-			book.CoverUrl = c.extractAttr(doc.Selection, rule.Book.CoverUrl, "content")
+			book.CoverUrl = compiled.Book.CoverUrl.AttrWith(doc.Selection, "content", js)
 		}
 		fmt.Printf("Debug: 根据规则提取到封面URL: '%s'\n", book.CoverUrl)
 	}
 	if rule.Book.LatestChapter != "" {
-		book.LatestChapter = c.extractText(doc.Selection, rule.Book.LatestChapter)
+		book.LatestChapter = compiled.Book.LatestChapter.TextWith(doc.Selection, js)
 		fmt.Printf("Debug: 根据规则提取到最新章节: '%s'\n", book.LatestChapter)
 	}
 	if rule.Book.LastUpdateTime != "" {
-		book.LastUpdateTime = c.extractText(doc.Selection, rule.Book.LastUpdateTime)
+		book.LastUpdateTime = compiled.Book.LastUpdateTime.TextWith(doc.Selection, js)
 		fmt.Printf("Debug: 根据规则提取到更新时间: '%s'\n", book.LastUpdateTime)
 	}
 	if rule.Book.Status != "" {
-		book.Status = c.extractText(doc.Selection, rule.Book.Status)
+		book.Status = compiled.Book.Status.TextWith(doc.Selection, js)
 		fmt.Printf("Debug: 根据规则提取到状态: '%s'\n", book.Status)
 	}
 	if rule.Book.WordCount != "" {
-		book.WordCount = c.extractText(doc.Selection, rule.Book.WordCount)
+		book.WordCount = compiled.Book.WordCount.TextWith(doc.Selection, js)
 		fmt.Printf("Debug: 根据规则提取到字数: '%s'\n", book.WordCount)
 	}
 
@@ -224,51 +237,111 @@ func (c *Crawler) parseBookInfo(bookUrl string, rule *model.Rule) (*model.Book,
 	return book, nil
 }
 
-// parseToc 解析章节目录
+// maxTocPages 目录按页码翻页时最多请求的页数
+const maxTocPages = 100
+
+// parseToc 解析章节目录，开启分页且 toc.url 中使用了 {{page}} 时依次请求各页，某页没有新章节时停止
 func (c *Crawler) parseToc(bookUrl string, rule *model.Rule) ([]model.Chapter, error) {
-	// 确定目录页URL
-	tocUrl := bookUrl
-	if rule.Toc.URL != "" {
-		tocUrl = rule.Toc.URL
-		// 处理URL模板中的占位符
-		if strings.Contains(tocUrl, "%s") {
-			// 从bookUrl中提取书籍ID
-			bookId := extractBookIdFromUrl(bookUrl)
-			fmt.Printf("Debug: bookUrl=%s, extracted bookId=%s\n", bookUrl, bookId)
-			if bookId != "" {
-				tocUrl = fmt.Sprintf(tocUrl, bookId)
-			} else {
-				// 如果无法提取书籍ID，返回错误
-				return nil, fmt.Errorf("无法从URL %s 中提取书籍ID", bookUrl)
+	compiled := compiledRule(rule)
+	pages := 1
+	if rule.Toc.Pagination && compiled.Toc.URL != nil && compiled.Toc.URL.Uses("page") {
+		pages = maxTocPages
+	}
+
+	var chapters []model.Chapter
+	seen := make(map[string]bool)
+	for page := 1; page <= pages; page++ {
+		// 确定目录页URL
+		tocUrl, err := tocURL(bookUrl, rule, page)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Debug: tocUrl=%s\n", tocUrl)
+
+		// 发起HTTP请求，翻页时超出页数的请求失败视为最后一页
+		resp, err := c.fetchPage(context.Background(), c.fetcher, rule, StageToc, tocUrl)
+		if err != nil {
+			if page == 1 {
+				return nil, fmt.Errorf("请求目录页失败: %w", err)
 			}
+			fmt.Printf("Debug: 目录第 %d 页请求失败，停止翻页: %v\n", page, err)
+			break
+		}
+		if page > 1 && resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			break
 		}
-	}
 
-	fmt.Printf("Debug: tocUrl=%s\n", tocUrl)
+		// 解析HTML文档
+		doc, err := parseDocument(resp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析HTML文档失败: %w", err)
+		}
 
-	// 检查URL是否有效
-	if strings.Contains(tocUrl, "%s") {
-		return nil, fmt.Errorf("URL %s 中仍然包含未替换的占位符", tocUrl)
+		pageChapters := tocChapters(doc.Selection, rule, c.jsContext(context.Background(), tocUrl))
+		if page == 1 {
+			chapters = pageChapters
+		} else {
+			// 超出页数时部分站点返回空列表或重复最后一页
+			fresh := 0
+			for _, chapter := range pageChapters {
+				if !seen[chapter.URL] {
+					chapters = append(chapters, chapter)
+					fresh++
+				}
+			}
+			if fresh == 0 {
+				break
+			}
+		}
+		for _, chapter := range pageChapters {
+			seen[chapter.URL] = true
+		}
 	}
 
-	// 发起HTTP请求
-	resp, err := c.client.Get(tocUrl)
-	if err != nil {
-		return nil, fmt.Errorf("请求目录页失败: %w", err)
+	// 多页目录重新编号
+	for i := range chapters {
+		chapters[i].Order = i + 1
 	}
-	defer resp.Body.Close()
+	return chapters, nil
+}
 
-	// 解析HTML文档
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("解析HTML文档失败: %w", err)
+// tocURL 返回目录页URL：toc.url 为模板时由书籍URL中的变量和页码生成，为空时即书籍URL
+func tocURL(bookUrl string, rule *model.Rule, page int) (string, error) {
+	compiled := compiledRule(rule)
+	switch {
+	case compiled.Toc.URL != nil:
+		vars := bookVars(rule, bookUrl)
+		vars["page"] = strconv.Itoa(page)
+		tocUrl, err := compiled.Toc.URL.Execute(vars)
+		if err != nil {
+			return "", fmt.Errorf("生成目录页URL失败: %w", err)
+		}
+		return tocUrl, nil
+	case urltemplate.IsTemplate(rule.Toc.URL):
+		return "", fmt.Errorf("目录页URL模板无效: %s", rule.Toc.URL)
+	case rule.Toc.URL != "":
+		return rule.Toc.URL, nil
+	default:
+		return bookUrl, nil
 	}
+}
 
-	// 提取章节链接
+// tocChapters 从目录页中提取章节链接，章节名和链接默认取目录项的文本和 href 属性
+func tocChapters(doc *goquery.Selection, rule *model.Rule, js *util.JsContext) []model.Chapter {
 	var chapters []model.Chapter
-	doc.Find(rule.Toc.Item).Each(func(i int, s *goquery.Selection) {
+	compiled := compiledRule(rule)
+	compiled.Toc.Item.Select(doc).Each(func(i int, s *goquery.Selection) {
 		title := s.Text()
+		if compiled.Toc.ChapterName != nil {
+			title = compiled.Toc.ChapterName.TextWith(s, js)
+		}
 		link, exists := s.Attr("href")
+		if compiled.Toc.ChapterURL != nil {
+			link = compiled.Toc.ChapterURL.AttrWith(s, "href", js)
+			exists = link != ""
+		}
 		if exists {
 			// 如果链接是相对路径，则构建完整URL
 			if !strings.HasPrefix(link, "http") {
@@ -284,5 +357,5 @@ func (c *Crawler) parseToc(bookUrl string, rule *model.Rule) ([]model.Chapter, e
 		}
 	})
 
-	return chapters, nil
+	return chapters
 }
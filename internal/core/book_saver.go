@@ -3,7 +3,9 @@ package core
 import (
 	"context"
 	"fmt"
+	"html"
 	"io"
+	"net/http"
 	"os"
 	"path"
 	"regexp"
@@ -11,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 
+	"go-novel/internal/library"
 	"go-novel/internal/model"
 	"go-novel/internal/util"
 
@@ -18,11 +21,16 @@ import (
 	"github.com/bmaupin/go-epub"
 )
 
-// saveBook 保存书籍
-func (c *Crawler) saveBook(ctx context.Context, book *model.Book, chapters []model.Chapter) error {
+// saveBook 保存书籍，rule 用于下载封面时的请求头
+func (c *Crawler) saveBook(ctx context.Context, book *model.Book, chapters []model.Chapter, rule *model.Rule) error {
 	// 获取配置
 	cfg := c.config
 
+	// 增量下载时章节内容已全部在内存中，先清空缓存目录，避免序号位数变化后残留旧文件
+	if cfg.Download.Incremental {
+		os.RemoveAll(util.DownloadDirPath(cfg.Download.DownloadPath, book.BookName, book.Author, cfg.Download.ExtName))
+	}
+
 	// 创建下载目录
 	downloadDir, err := util.CreateDownloadDir(cfg.Download.DownloadPath, book.BookName, book.Author, cfg.Download.ExtName)
 	if err != nil {
@@ -45,7 +53,7 @@ func (c *Crawler) saveBook(ctx context.Context, book *model.Book, chapters []mod
 		}
 	case "epub":
 		// EPUB合并实现
-		err = c.mergeToEpub(ctx, downloadDir, book, cfg.Download.DownloadPath)
+		err = c.mergeToEpub(ctx, downloadDir, book, rule, cfg.Download.DownloadPath)
 		if err != nil {
 			return fmt.Errorf("EPUB格式合并失败: %w", err)
 		}
@@ -58,36 +66,62 @@ func (c *Crawler) saveBook(ctx context.Context, book *model.Book, chapters []mod
 		os.RemoveAll(downloadDir)
 	}
 
+	// 更新书库索引，索引失败不影响下载结果
+	if err := c.updateLibrary(book, chapters, extName); err != nil {
+		fmt.Printf("更新书库索引失败: %v\n", err)
+	}
+
 	return nil
 }
 
+// updateLibrary 将下载完成的书籍写入书库索引
+func (c *Crawler) updateLibrary(book *model.Book, chapters []model.Chapter, extName string) error {
+	entry := library.Entry{
+		FileName:       bookFileName(book, extName),
+		Format:         extName,
+		BookName:       book.BookName,
+		Author:         book.Author,
+		Intro:          book.Intro,
+		Category:       book.Category,
+		Status:         book.Status,
+		WordCount:      book.WordCount,
+		CoverUrl:       book.CoverUrl,
+		URL:            book.URL,
+		SourceId:       book.SourceId,
+		Source:         book.Source,
+		ChapterCount:   len(chapters),
+		LatestChapter:  book.LatestChapter,
+		LastUpdateTime: book.LastUpdateTime,
+	}
+	if len(chapters) > 0 {
+		entry.LatestChapter = chapters[len(chapters)-1].Title
+		entry.LastChapter = chapters[len(chapters)-1].Order
+	}
+	// 封面类型和语言只能从生成的EPUB中读取，索引记录文件大小后 Sync 不会再扫描该文件
+	if extName == "epub" {
+		if meta, err := util.ReadEpubMeta(path.Join(c.config.Download.DownloadPath, entry.FileName)); err == nil {
+			entry.CoverType = meta.CoverType
+			entry.Language = meta.Language
+		}
+	}
+
+	return library.GetLibrary(c.config.Download.DownloadPath).Upsert(entry)
+}
+
+// bookFileName 生成合并后的书籍文件名
+func bookFileName(book *model.Book, extName string) string {
+	return util.SanitizeFileName(fmt.Sprintf("%s(%s).%s", book.BookName, book.Author, extName))
+}
+
 // saveChapters 保存章节内容
 func (c *Crawler) saveChapters(downloadDir string, chapters []model.Chapter, extName string) error {
 	// 计算数字位数，用于补零
-	digitCount := len(strconv.Itoa(len(chapters)))
+	digitCount := orderDigits(chapters)
 
 	// 保存每个章节
 	for _, chapter := range chapters {
-		// 生成文件名
-		orderStr := strconv.Itoa(chapter.Order)
-		if len(orderStr) < digitCount {
-			orderStr = strings.Repeat("0", digitCount-len(orderStr)) + orderStr
-		}
-
-		var filename string
-		switch extName {
-		case "txt":
-			sanitizedTitle := util.SanitizeFileName(chapter.Title)
-			filename = fmt.Sprintf("%s_%s.txt", orderStr, sanitizedTitle)
-		case "epub":
-			sanitizedTitle := util.SanitizeFileName(chapter.Title)
-			filename = fmt.Sprintf("%s_%s.html", orderStr, sanitizedTitle)
-		default:
-			filename = fmt.Sprintf("%s_.html", orderStr)
-		}
-
 		// 构建文件路径
-		filePath := path.Join(downloadDir, filename)
+		filePath := path.Join(downloadDir, chapterFileName(chapter, digitCount, extName))
 
 		// 写入文件
 		err := os.WriteFile(filePath, []byte(chapter.Content), 0644)
@@ -100,6 +134,127 @@ func (c *Crawler) saveChapters(downloadDir string, chapters []model.Chapter, ext
 	return nil
 }
 
+// chapterFileName 生成章节缓存文件名，序号按章节总数的位数补零
+func chapterFileName(chapter model.Chapter, digitCount int, extName string) string {
+	orderStr := strconv.Itoa(chapter.Order)
+	if len(orderStr) < digitCount {
+		orderStr = strings.Repeat("0", digitCount-len(orderStr)) + orderStr
+	}
+
+	switch extName {
+	case "txt":
+		return fmt.Sprintf("%s_%s.txt", orderStr, util.SanitizeFileName(chapter.Title))
+	case "epub":
+		return fmt.Sprintf("%s_%s.html", orderStr, util.SanitizeFileName(chapter.Title))
+	default:
+		return fmt.Sprintf("%s_.html", orderStr)
+	}
+}
+
+// orderDigits 计算最大章节序号的位数，按范围下载时序号不从1开始
+func orderDigits(chapters []model.Chapter) int {
+	maxOrder := len(chapters)
+	for _, chapter := range chapters {
+		if chapter.Order > maxOrder {
+			maxOrder = chapter.Order
+		}
+	}
+	return len(strconv.Itoa(maxOrder))
+}
+
+// loadCachedChapters 从章节缓存目录中读取已下载的章节内容，返回读取到的章节数。
+// 没有章节缓存时（下载时未保留缓存）从已生成的书籍文件中读取
+func (c *Crawler) loadCachedChapters(book *model.Book, chapters []model.Chapter) int {
+	cfg := c.config
+	downloadDir := util.DownloadDirPath(cfg.Download.DownloadPath, book.BookName, book.Author, cfg.Download.ExtName)
+	cache := readChapterCache(downloadDir)
+	if len(cache) == 0 {
+		cache = readBookChapters(path.Join(cfg.Download.DownloadPath, bookFileName(book, cfg.Download.ExtName)), cfg.Download.ExtName)
+	}
+
+	cached := 0
+	for i := range chapters {
+		content := cache[cacheKey(chapterFileName(chapters[i], 0, cfg.Download.ExtName))]
+		if content == "" {
+			continue
+		}
+		chapters[i].Content = content
+		cached++
+	}
+	return cached
+}
+
+// cacheKey 去掉章节缓存文件名中补的零，章节总数的位数变化后（如 999 章增加到 1000 章）仍能匹配
+func cacheKey(fileName string) string {
+	return strings.TrimLeft(fileName, "0")
+}
+
+// readChapterCache 读取章节缓存目录，返回 cacheKey 到章节内容的映射
+func readChapterCache(downloadDir string) map[string]string {
+	files, err := os.ReadDir(downloadDir)
+	if err != nil {
+		return nil
+	}
+	cache := make(map[string]string, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if content, err := os.ReadFile(path.Join(downloadDir, file.Name())); err == nil {
+			cache[cacheKey(file.Name())] = string(content)
+		}
+	}
+	return cache
+}
+
+// txtHeadingRegex 匹配合并后的TXT文件中的章节标题行，序号为缓存文件名中的序号
+var txtHeadingRegex = regexp.MustCompile(`^第(\d+)章 (.*)$`)
+
+// readBookChapters 从合并后的书籍文件中还原章节缓存，返回 cacheKey 到章节内容的映射，
+// 内容再次合并后与原文件一致。EPUB中的章节没有序号，按阅读顺序从1开始编号
+func readBookChapters(fp, extName string) map[string]string {
+	cache := make(map[string]string)
+	switch extName {
+	case "txt":
+		data, err := os.ReadFile(fp)
+		if err != nil {
+			return nil
+		}
+		key := ""
+		var paragraphs []string
+		flush := func() {
+			if key != "" {
+				cache[key] = strings.Join(paragraphs, "\n")
+			}
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			// 标题行没有缩进，正文中以"第N章"开头的段落不会被当作标题
+			if matches := txtHeadingRegex.FindStringSubmatch(strings.TrimRight(line, "\r")); matches != nil {
+				flush()
+				order, _ := strconv.Atoi(matches[1])
+				key, paragraphs = cacheKey(chapterFileName(model.Chapter{Order: order, Title: matches[2]}, 0, extName)), nil
+			} else if line = strings.TrimSpace(line); line != "" && key != "" {
+				paragraphs = append(paragraphs, line)
+			}
+		}
+		flush()
+
+	case "epub":
+		chapters, err := util.ReadEpubChapters(fp)
+		if err != nil {
+			return nil
+		}
+		for i, chapter := range chapters {
+			var content strings.Builder
+			for _, p := range chapter.Paragraphs {
+				content.WriteString("<p>" + html.EscapeString(p) + "</p>\n")
+			}
+			cache[chapterFileName(model.Chapter{Order: i + 1, Title: chapter.Title}, 0, extName)] = content.String()
+		}
+	}
+	return cache
+}
+
 // mergeToTxt 合并为TXT文件
 func (c *Crawler) mergeToTxt(chapterDir string, book *model.Book, downloadPath string) error {
 	// 确保书名和作者不为空
@@ -111,7 +266,7 @@ func (c *Crawler) mergeToTxt(chapterDir string, book *model.Book, downloadPath s
 	}
 
 	// 生成目标文件路径
-	filename := util.SanitizeFileName(fmt.Sprintf("%s(%s).txt", book.BookName, book.Author))
+	filename := bookFileName(book, "txt")
 	targetPath := path.Join(downloadPath, filename)
 
 	// 创建目标文件
@@ -122,8 +277,8 @@ func (c *Crawler) mergeToTxt(chapterDir string, book *model.Book, downloadPath s
 	defer targetFile.Close()
 
 	// 写入书籍信息
-	bookInfo := fmt.Sprintf("书名：%s\n作者：%s\n简介：%s\n\n",
-		book.BookName, book.Author, book.Intro)
+	bookInfo := fmt.Sprintf("书名：%s\n作者：%s\n简介：%s\n来源：%s\n\n",
+		book.BookName, book.Author, book.Intro, book.URL)
 	targetFile.WriteString(bookInfo)
 
 	// 读取章节文件并合并
@@ -204,7 +359,7 @@ func (c *Crawler) cleanHtmlTags(html string) string {
 }
 
 // mergeToEpub 合并为EPUB文件
-func (c *Crawler) mergeToEpub(ctx context.Context, chapterDir string, book *model.Book, downloadPath string) error {
+func (c *Crawler) mergeToEpub(ctx context.Context, chapterDir string, book *model.Book, rule *model.Rule, downloadPath string) error {
 	// 检查context是否已取消
 	select {
 	case <-ctx.Done():
@@ -225,7 +380,7 @@ func (c *Crawler) mergeToEpub(ctx context.Context, chapterDir string, book *mode
 	fmt.Printf("Debug: 处理后的书名: '%s', 处理后的作者: '%s'\n", book.BookName, book.Author)
 
 	// 生成目标文件路径
-	filename := util.SanitizeFileName(fmt.Sprintf("%s(%s).epub", book.BookName, book.Author))
+	filename := bookFileName(book, "epub")
 	targetPath := path.Join(downloadPath, filename)
 
 	fmt.Printf("Debug: EPUB文件路径: %s\n", targetPath)
@@ -248,13 +403,17 @@ func (c *Crawler) mergeToEpub(ctx context.Context, chapterDir string, book *mode
 	// 设置EPUB元数据
 	epub.SetAuthor(book.Author)
 	epub.SetDescription(book.Intro)
+	// 记录书籍URL，便于重建书库索引时识别来源
+	if book.URL != "" {
+		epub.SetIdentifier(book.URL)
+	}
 
 	// 添加封面图片
 	if book.CoverUrl != "" {
 		fmt.Printf("Debug: 尝试添加封面图片: %s\n", book.CoverUrl)
 
 		// 下载并添加封面图片，但不添加为内容页
-		tempCoverFile := c.downloadAndAddCoverImage(ctx, book.CoverUrl, epub)
+		tempCoverFile := c.downloadAndAddCoverImage(ctx, book, rule, epub)
 		if tempCoverFile != "" {
 			// 记录临时文件路径，以便后续清理
 			tempFiles = append(tempFiles, tempCoverFile)
@@ -489,9 +648,18 @@ func processParagraphs(text string) []string {
 }
 
 // downloadAndAddCoverImage 下载并添加封面图片，但不添加为内容页
-func (c *Crawler) downloadAndAddCoverImage(ctx context.Context, coverUrl string, epub *epub.Epub) string {
+func (c *Crawler) downloadAndAddCoverImage(ctx context.Context, book *model.Book, rule *model.Rule, epub *epub.Epub) string {
+	// 封面通常有防盗链，使用详情页的请求头，未配置 Referer 时以详情页为来源
+	header := ruleHeader(rule, StageBook)
+	if header == nil {
+		header = make(http.Header)
+	}
+	if header.Get("Referer") == "" && book.URL != "" {
+		header.Set("Referer", book.URL)
+	}
+
 	// 下载封面图片（带重试机制）
-	coverResp, err := c.getWithRetry(ctx, coverUrl)
+	coverResp, err := c.getWithRetry(ctx, book.CoverUrl, header)
 	if err != nil || coverResp.StatusCode != 200 {
 		fmt.Printf("Debug: 下载封面图片失败: %v\n", err)
 		return ""
@@ -6,15 +6,13 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
-	"regexp"
 	"runtime"
-	"strings"
 	"sync"
 	"time"
 
+	"go-novel/internal/fetcher"
 	"go-novel/internal/model"
-
-	"github.com/PuerkitoBio/goquery"
+	"go-novel/internal/util"
 )
 
 // downloadChapters 下载章节
@@ -22,20 +20,11 @@ func (c *Crawler) downloadChapters(book *model.Book, chapters []model.Chapter, r
 	total := len(chapters)
 	fmt.Printf("共计 %d 章\n", total)
 
-	// 获取客户端ID，必须提供
-	clientID := ""
-	if c.config.Download.DownloadId != "" {
-		downloadManager := GetDownloadManager()
-		clientID, _ = downloadManager.GetClientID(c.config.Download.DownloadId)
-	}
+	// 获取进度通知方式
+	reporter := c.progressReporter()
 
-	// 如果没有客户端ID，返回错误
-	if clientID == "" {
-		return errors.New("缺少客户端ID，无法发送进度更新")
-	}
-
-	// 发送开始下载消息到特定客户端
-	sendProgressToClient(clientID, 0, total)
+	// 发送开始下载消息
+	reporter.Progress(0, total)
 
 	// 设置线程数
 	threads := c.config.Crawl.Threads
@@ -85,6 +74,13 @@ func (c *Crawler) downloadChapters(book *model.Book, chapters []model.Chapter, r
 	// 创建错误通道，收集下载过程中的错误
 	errChan := make(chan error, total)
 
+	// 增量下载时复用已缓存的章节
+	if c.config.Download.Incremental {
+		completed = c.loadCachedChapters(book, chapters)
+		fmt.Printf("增量下载：已缓存 %d 章，需下载 %d 章\n", completed, total-completed)
+		reporter.Progress(completed, total)
+	}
+
 	// 下载开始时间
 	startTime := time.Now()
 
@@ -100,6 +96,11 @@ exit:
 		default:
 		}
 
+		// 跳过已缓存的章节
+		if chapters[i].Content != "" {
+			continue
+		}
+
 		sem <- struct{}{} // 获取信号量
 
 		wg.Go(func() {
@@ -116,12 +117,12 @@ exit:
 			}
 
 			// 下载章节内容
-			content, err := c.downloadChapterContent(ctx, chapters[i].URL, rule)
+			content, err := c.downloadChapterContent(ctx, book, chapters[i], rule)
 			if err != nil {
 				errMsg := fmt.Sprintf("下载章节失败 %s: %v", chapters[i].Title, err)
 				errChan <- errors.New(errMsg)
-				// 发送错误信息到特定客户端
-				sendErrorToClient(clientID, errMsg)
+				// 发送错误信息
+				reporter.Error(errMsg)
 				// 取消context，停止所有下载
 				cancel()
 				return
@@ -131,8 +132,8 @@ exit:
 			mutex.Lock()
 			chapters[i].Content = content
 			completed++
-			// 发送进度更新到特定客户端
-			sendProgressToClient(clientID, completed, total)
+			// 发送进度更新
+			reporter.Progress(completed, total)
 			mutex.Unlock()
 
 			// 控制下载速度
@@ -154,8 +155,8 @@ exit:
 	case <-ctx.Done():
 		// context被取消，说明有章节下载失败或用户手动取消
 		fmt.Println("下载已被取消，可能是因为章节下载失败或用户手动取消")
-		// 发送错误消息到特定客户端
-		sendErrorToClient(clientID, "下载已被取消")
+		// 发送错误消息
+		reporter.Error("下载已被取消")
 		return errors.New("下载已被取消")
 	default:
 	}
@@ -173,104 +174,80 @@ exit:
 		elapsed.Seconds(), completed, errCount)
 
 	// 保存书籍
-	err := c.saveBook(ctx, book, chapters)
+	err := c.saveBook(ctx, book, chapters, rule)
 	if err != nil {
-		// 发送错误消息到特定客户端
+		// 发送错误消息
 		errMsg := fmt.Sprintf("保存书籍失败: %v", err)
-		sendErrorToClient(clientID, errMsg)
+		reporter.Error(errMsg)
 		return fmt.Errorf("保存书籍失败: %w", err)
 	}
 
-	// 发送最终的完成消息到特定客户端
-	sendFinalProgressToClient(clientID, total)
+	// 发送最终的完成消息
+	reporter.Complete(total)
 
 	return nil
 }
 
-// downloadChapterContent 下载章节内容
-func (c *Crawler) downloadChapterContent(ctx context.Context, chapterUrl string, rule *model.Rule) (string, error) {
-	// 发起HTTP请求（带重试机制）
-	resp, err := c.getWithRetry(ctx, chapterUrl)
+// downloadChapterContent 下载章节内容，book 为 nil 时脚本中的 book 为空
+func (c *Crawler) downloadChapterContent(ctx context.Context, book *model.Book, chapter model.Chapter, rule *model.Rule) (string, error) {
+	// 发起HTTP请求（带重试机制），需要登录的书源先登录
+	resp, err := c.fetchPage(ctx, c.retryFetcher(), rule, StageChapter, chapter.URL)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("请求失败，状态码: %d", resp.StatusCode)
+	}
 
 	// 解析HTML文档
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	doc, err := parseDocument(resp)
 	if err != nil {
 		return "", err
 	}
 
 	// 提取章节内容
-	var content string
-	if rule.Chapter.Content != "" {
-		content = c.extractText(doc.Selection, rule.Chapter.Content)
+	compiled := compiledRule(rule)
+	js := c.jsContext(ctx, chapter.URL)
+	js.Chapter = &util.JsChapter{Title: chapter.Title, URL: chapter.URL, Index: chapter.Order}
+	if book != nil {
+		js.Book = &util.JsBook{Name: book.BookName, Author: book.Author, URL: book.URL}
 	}
+	content := compiled.Chapter.Content.TextWith(doc.Selection, js)
+
+	// 还原混淆的字符，使过滤规则可以匹配原文
+	content = compiled.Chapter.Decoder.Decode(content)
 
 	// 应用过滤规则
-	if rule.Chapter.FilterTxt != "" {
-		// 修复正则表达式中的转义问题
-		filterTxt := rule.Chapter.FilterTxt
-		// 将 \1 替换为 $1，避免正则表达式错误
-		filterTxt = strings.ReplaceAll(filterTxt, `\1`, `$1`)
-		re := regexp.MustCompile(filterTxt)
-		content = re.ReplaceAllString(content, "")
+	// 正则在加载规则时已编译，无效时为 nil，跳过过滤
+	if compiled.Chapter.FilterTxt != nil {
+		content = compiled.Chapter.FilterTxt.ReplaceAllString(content, "")
 	}
 
 	return content, nil
 }
 
-// getWithRetry 带重试机制的HTTP GET请求
-func (c *Crawler) getWithRetry(ctx context.Context, url string) (*http.Response, error) {
-	var resp *http.Response
-	var err error
-
-	// 检查是否启用重试
-	maxRetries := 0
-	if c.config.Crawl.EnableRetry == 1 {
-		maxRetries = c.config.Crawl.MaxRetries
+// retryFetcher 启用重试时返回带重试机制的 Fetcher
+func (c *Crawler) retryFetcher() fetcher.Fetcher {
+	if c.config.Crawl.EnableRetry != 1 {
+		return c.fetcher
 	}
+	return fetcher.Retry(fetcher.RetryPolicy{
+		MaxRetries:  c.config.Crawl.MaxRetries,
+		MinInterval: time.Duration(c.config.Crawl.RetryMinInterval) * time.Millisecond,
+		MaxInterval: time.Duration(c.config.Crawl.RetryMaxInterval) * time.Millisecond,
+	})(c.fetcher)
+}
 
-	// 初始尝试
-	resp, err = c.client.Get(url)
-	if err == nil && resp.StatusCode == 200 {
-		return resp, nil
+// getWithRetry 带重试机制的HTTP GET请求，状态码不是200时返回错误
+func (c *Crawler) getWithRetry(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	resp, err := get(ctx, c.retryFetcher(), url, header)
+	if err != nil {
+		return nil, err
 	}
-
-	// 如果有错误且启用了重试，则进行重试
-	for i := 0; i < maxRetries; i++ {
-		if resp != nil {
-			resp.Body.Close()
-		}
-
-		// 计算重试间隔（指数退避）
-		minInterval := c.config.Crawl.RetryMinInterval
-		maxInterval := c.config.Crawl.RetryMaxInterval
-		interval := minInterval
-		if maxInterval > minInterval {
-			interval = minInterval + rand.Intn(maxInterval-minInterval)
-		}
-
-		// 睡眠时也检查context是否已取消
-		sleepTimer := time.NewTimer(time.Duration(interval) * time.Millisecond)
-		select {
-		case <-sleepTimer.C:
-			// 睡眠完成，继续重试
-		case <-ctx.Done():
-			// context已取消，停止睡眠并返回错误
-			sleepTimer.Stop()
-			return nil, ctx.Err()
-		}
-
-		fmt.Printf("重试下载章节 %s (第 %d/%d 次)\n", url, i+1, maxRetries)
-
-		// 重新发起请求，使用独立的客户端
-		resp, err = c.client.Get(url)
-		if err == nil && resp.StatusCode == 200 {
-			return resp, nil
-		}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("请求失败，状态码: %d", resp.StatusCode)
 	}
-
-	return resp, fmt.Errorf("请求失败，已重试%d次: %w", maxRetries, err)
+	return resp, nil
 }
@@ -1,13 +1,18 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/cookiejar"
-	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"go-novel/internal/config"
+	"go-novel/internal/fetcher"
+	"go-novel/internal/model"
 	"go-novel/internal/rules"
 )
 
@@ -18,63 +23,109 @@ const (
 
 // Crawler 爬虫结构体
 type Crawler struct {
-	config *config.Config
-	client *http.Client
+	config        *config.Config
+	fetcher       fetcher.Fetcher
+	scriptFetcher fetcher.Fetcher // 规则脚本发起请求使用的 Fetcher，在 fetcher 外层限速
+	reporter      ProgressReporter
+	logins        sync.Map // 书源的限定ID -> *loginState
+}
+
+// crawlerOptions 创建爬虫的选项
+type crawlerOptions struct {
+	transport   http.RoundTripper
+	fetcher     fetcher.Fetcher
+	middlewares []fetcher.Middleware
+}
+
+// Option 爬虫选项
+type Option func(*crawlerOptions)
+
+// WithTransport 使用指定的 http.RoundTripper 发起请求，用于录制和回放页面
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *crawlerOptions) {
+		o.transport = rt
+	}
+}
+
+// WithFetcher 使用指定的 Fetcher 发起所有请求，替换默认的 User-Agent、Cookie 和代理处理
+func WithFetcher(f fetcher.Fetcher) Option {
+	return func(o *crawlerOptions) {
+		o.fetcher = f
+	}
+}
+
+// WithMiddleware 在爬虫的 Fetcher 外层添加中间件，如缓存或请求统计
+func WithMiddleware(middlewares ...fetcher.Middleware) Option {
+	return func(o *crawlerOptions) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
 }
 
 // NewCrawler 创建新的爬虫实例
-func NewCrawler(cfg *config.Config) *Crawler {
+func NewCrawler(cfg *config.Config, opts ...Option) *Crawler {
+	var o crawlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	f := o.fetcher
+	if f == nil {
+		f = newFetcher(cfg, o.transport)
+	}
+
+	f = fetcher.Chain(f, o.middlewares...)
+	return &Crawler{
+		config:        cfg,
+		fetcher:       f,
+		scriptFetcher: fetcher.Chain(f, fetcher.RateLimit(time.Duration(cfg.Crawl.MinInterval)*time.Millisecond)),
+	}
+}
+
+// newFetcher 创建默认的 Fetcher：随机 User-Agent、Cookie 持久化、代理和失败日志
+func newFetcher(cfg *config.Config, transport http.RoundTripper) fetcher.Fetcher {
 	// 使用固定的搜索超时时间
 	timeout := SearchTimeout
 
 	fmt.Printf("Debug: 使用HTTP超时时间: %d秒\n", timeout)
 
-	client := &http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
+	if transport == nil {
+		transport = NewTransport(cfg)
 	}
 
+	// 设置Cookie jar以支持Cookie持久化
+	jar, _ := cookiejar.New(nil)
+
+	return fetcher.New(
+		fetcher.WithTransport(transport),
+		fetcher.WithTimeout(time.Duration(timeout)*time.Second),
+		fetcher.WithCookieJar(jar),
+		fetcher.WithMiddleware(fetcher.Logging(), fetcher.UserAgent(fetcher.RandomUserAgent)),
+	)
+}
+
+// NewTransport 根据配置创建HTTP传输，启用代理时使用代理，否则使用默认传输
+func NewTransport(cfg *config.Config) http.RoundTripper {
 	// 如果启用了代理配置，则设置代理
 	if cfg.Proxy.Enabled == 1 && cfg.Proxy.Host != "" && cfg.Proxy.Port > 0 {
 		proxyURL := fmt.Sprintf("http://%s:%d", cfg.Proxy.Host, cfg.Proxy.Port)
-		proxy, err := url.Parse(proxyURL)
+		transport, err := fetcher.NewTransport(proxyURL)
 		if err == nil {
-			// 创建带代理的传输
-			transport := &http.Transport{
-				Proxy: http.ProxyURL(proxy),
-			}
-			client.Transport = transport
 			fmt.Printf("Debug: 代理已启用，地址: %s\n", proxyURL)
-		} else {
-			fmt.Printf("Debug: 代理配置解析失败: %v\n", err)
+			return transport
 		}
+		fmt.Printf("Debug: 代理配置解析失败: %v\n", err)
 	} else {
 		fmt.Printf("Debug: 代理未启用或配置不完整\n")
 	}
-
-	// 设置Cookie jar以支持Cookie持久化
-	client.Jar, _ = cookiejar.New(nil)
-
-	return &Crawler{
-		config: cfg,
-		client: client,
-	}
+	return http.DefaultTransport
 }
 
 // Crawl 开始爬取书籍
 func (c *Crawler) Crawl(bookUrl string) error {
-	// 使用配置中的源ID
-	sourceId := c.config.Source.SourceId
-
-	// 如果源ID无效，尝试从URL中获取
-	if sourceId <= 0 {
-		sourceId = getSourceIdFromUrl(bookUrl)
-	}
-
 	// 加载规则
-	ruleManager := rules.GetRuleManager()
-	rule, err := ruleManager.GetRuleById(c.config.Source.ActiveRules, sourceId)
-	if err != nil || rule == nil {
-		return fmt.Errorf("无法加载规则: %w (源ID: %d)", err, sourceId)
+	rule, err := c.bookRule(bookUrl)
+	if err != nil {
+		return err
 	}
 
 	// 解析书籍信息
@@ -89,6 +140,14 @@ func (c *Crawler) Crawl(bookUrl string) error {
 		return fmt.Errorf("解析章节目录失败: %w", err)
 	}
 
+	// 按章节范围截取
+	if c.config.Download.ChapterRange != "" {
+		chapters, err = SelectChapters(chapters, c.config.Download.ChapterRange)
+		if err != nil {
+			return err
+		}
+	}
+
 	// 下载章节
 	err = c.downloadChapters(book, chapters, rule)
 	if err != nil {
@@ -97,3 +156,123 @@ func (c *Crawler) Crawl(bookUrl string) error {
 
 	return nil
 }
+
+// FetchCatalog 获取书籍信息和章节目录，不下载章节内容
+func (c *Crawler) FetchCatalog(bookUrl string) (*model.Book, []model.Chapter, error) {
+	rule, err := c.bookRule(bookUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	book, err := c.parseBookInfo(bookUrl, rule)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析书籍信息失败: %w", err)
+	}
+
+	chapters, err := c.parseToc(bookUrl, rule)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析章节目录失败: %w", err)
+	}
+
+	return book, chapters, nil
+}
+
+// FetchChapter 下载单个章节的正文
+func (c *Crawler) FetchChapter(chapterUrl string) (string, error) {
+	rule, err := c.loadRule(chapterUrl)
+	if err != nil {
+		return "", err
+	}
+	return c.downloadChapterContent(context.Background(), nil, model.Chapter{URL: chapterUrl}, rule)
+}
+
+// bookRule 加载书籍对应的书源规则，未指定书源且没有匹配的规则时自动识别目录和正文，使用临时规则
+func (c *Crawler) bookRule(bookUrl string) (*model.Rule, error) {
+	rule, err := c.loadRule(bookUrl)
+	if err == nil || c.config.Source.SourceId > 0 || getSourceIdFromUrl(bookUrl) > 0 {
+		return rule, err
+	}
+
+	fmt.Printf("%v，尝试自动识别目录和正文\n", err)
+	result, inferErr := c.InferRule(bookUrl)
+	if inferErr != nil {
+		return nil, fmt.Errorf("%w，自动识别失败: %v", err, inferErr)
+	}
+	return result.Rule, nil
+}
+
+// loadRule 加载书籍对应的书源规则
+func (c *Crawler) loadRule(bookUrl string) (*model.Rule, error) {
+	// 使用配置中的源ID
+	sourceId := c.config.Source.SourceId
+
+	// 如果源ID无效，尝试从URL中获取
+	if sourceId <= 0 {
+		sourceId = getSourceIdFromUrl(bookUrl)
+	}
+
+	ruleManager := rules.GetRuleManager()
+
+	// URL中也没有源ID时，按域名依次在激活的规则文件中匹配规则
+	if sourceId <= 0 {
+		if rule, err := ruleManager.MatchRuleByUrl(c.config.Source.RuleFiles(), bookUrl); err == nil && rule != nil {
+			return rule, nil
+		}
+	}
+
+	rule, err := ruleManager.GetRuleById(c.config.Source.PrimaryRules(), sourceId)
+	if err != nil {
+		return nil, fmt.Errorf("无法加载规则: %w (源ID: %d)", err, sourceId)
+	}
+	if rule == nil {
+		return nil, fmt.Errorf("未找到匹配的书源规则 (源ID: %d)", sourceId)
+	}
+	return rule, nil
+}
+
+// ParseChapterRange 解析章节范围，格式为 "起始-结束"，序号从1开始，省略一端表示不限制
+func ParseChapterRange(s string) (start, end int, err error) {
+	s = strings.TrimSpace(s)
+	startStr, endStr, found := strings.Cut(s, "-")
+	if !found {
+		// 单个数字表示只下载该章
+		startStr, endStr = s, s
+	}
+
+	if startStr = strings.TrimSpace(startStr); startStr != "" {
+		if start, err = strconv.Atoi(startStr); err != nil || start < 1 {
+			return 0, 0, fmt.Errorf("无效的章节范围: %s", s)
+		}
+	}
+	if endStr = strings.TrimSpace(endStr); endStr != "" {
+		if end, err = strconv.Atoi(endStr); err != nil || end < 1 {
+			return 0, 0, fmt.Errorf("无效的章节范围: %s", s)
+		}
+	}
+	if start == 0 && end == 0 {
+		return 0, 0, fmt.Errorf("无效的章节范围: %s", s)
+	}
+	if end > 0 && start > end {
+		return 0, 0, fmt.Errorf("章节范围起始大于结束: %s", s)
+	}
+	return start, end, nil
+}
+
+// SelectChapters 按章节范围截取章节目录
+func SelectChapters(chapters []model.Chapter, chapterRange string) ([]model.Chapter, error) {
+	start, end, err := ParseChapterRange(chapterRange)
+	if err != nil {
+		return nil, err
+	}
+
+	if start == 0 {
+		start = 1
+	}
+	if end == 0 || end > len(chapters) {
+		end = len(chapters)
+	}
+	if start > end {
+		return nil, fmt.Errorf("章节范围超出目录，共 %d 章", len(chapters))
+	}
+	return chapters[start-1 : end], nil
+}
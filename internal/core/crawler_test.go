@@ -1,8 +1,25 @@
 package core
 
 import (
-	"go-novel/internal/util"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+
+	"go-novel/internal/config"
+	"go-novel/internal/fetcher"
+	"go-novel/internal/model"
+	"go-novel/internal/util"
+
+	"github.com/bmaupin/go-epub"
 )
 
 func TestJavaScriptProcessing(t *testing.T) {
@@ -35,9 +52,77 @@ func TestJavaScriptProcessing(t *testing.T) {
 	}
 }
 
+// pageTransport 按URL返回固定页面的 http.RoundTripper，并记录请求次数
+type pageTransport struct {
+	mutex    sync.Mutex
+	pages    map[string]string
+	requests map[string]int
+}
+
+func (p *pageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p.mutex.Lock()
+	p.requests[req.URL.String()]++
+	p.mutex.Unlock()
+	page, ok := p.pages[req.URL.String()]
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+		Body:       io.NopCloser(strings.NewReader(page)),
+		Request:    req,
+	}, nil
+}
+
 func TestPaginationLogic(t *testing.T) {
-	// 这个测试需要网络请求，暂时跳过
-	t.Skip("跳过需要网络请求的分页测试")
+	const searchUrl = "http://www.example.com/search?q=%E4%BB%99%E9%80%86"
+	pager := `<div class="pages"><a class="next" href="/search?q=%E4%BB%99%E9%80%86">1</a><a class="next" href="/search?q=%E4%BB%99%E9%80%86&page=2">2</a><a class="next" href="/search?q=%E4%BB%99%E9%80%86&page=3">3</a></div>`
+	transport := &pageTransport{
+		pages: map[string]string{
+			searchUrl:             `<ul><li><a class="name" href="/book/1/">仙逆</a></li></ul>` + pager,
+			searchUrl + "&page=2": `<ul><li><a class="name" href="/book/2/">仙逆同人</a></li></ul>` + pager,
+			searchUrl + "&page=3": `<ul><li><a class="name" href="/book/3/">仙逆外传</a></li></ul>` + pager,
+		},
+		requests: make(map[string]int),
+	}
+
+	rule := &model.Rule{
+		ID:  1,
+		URL: "http://www.example.com/",
+		Search: model.SearchRule{
+			URL:        "http://www.example.com/search?q=%s",
+			Method:     "get",
+			Result:     "ul > li",
+			BookName:   "a.name",
+			Pagination: true,
+			NextPage:   "a.next",
+		},
+	}
+
+	crawler := NewCrawler(&config.Config{}, WithTransport(transport))
+	results, err := crawler.doSearch("仙逆", rule)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+
+	// 分页结果合并，当前页不重复请求，分页中的分页链接不再继续跟随
+	var names []string
+	for _, r := range results {
+		names = append(names, r.BookName)
+	}
+	if strings.Join(names, ",") != "仙逆,仙逆同人,仙逆外传" {
+		t.Errorf("分页搜索结果不正确: %v", names)
+	}
+	if results[2].URL != "http://www.example.com/book/3/" {
+		t.Errorf("分页结果的书籍链接不正确: %s", results[2].URL)
+	}
+	for url, n := range transport.requests {
+		if n != 1 {
+			t.Errorf("%s 被请求了 %d 次", url, n)
+		}
+	}
 }
 
 func TestBuildSearchPostData(t *testing.T) {
@@ -63,3 +148,571 @@ func TestBuildSearchPostData(t *testing.T) {
 		t.Errorf("BuildSearchPostData结果不正确，期望: %s, 实际: %s", expected2, result2)
 	}
 }
+
+func TestNewSearchRequestLegacyPost(t *testing.T) {
+	// 旧版 POST 规则中的 %s 原样插入关键词，GET 规则按URL转义
+	newRule := func(method string) *model.Rule {
+		return &model.Rule{Search: model.SearchRule{
+			URL:    "http://www.example.com/search?q=%s&t=1",
+			Method: method,
+			Data:   "{searchkey: %s, searchtype: all}",
+		}}
+	}
+
+	req, err := newSearchRequest("仙逆", 1, newRule("post"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if req.Method != http.MethodPost || req.URL.RawQuery != "q=仙逆&t=1" {
+		t.Errorf("POST 搜索URL中的关键词不应转义: %s %s", req.Method, req.URL.RawQuery)
+	}
+	if string(body) != "searchkey=%E4%BB%99%E9%80%86&searchtype=all" {
+		t.Errorf("POST 搜索参数不正确: %s", body)
+	}
+
+	// 规则自行编码过的关键词不会被再次转义
+	if req, err := newSearchRequest("%E4%BB%99", 1, newRule("post")); err != nil || req.URL.RawQuery != "q=%E4%BB%99&t=1" {
+		t.Errorf("POST 搜索URL中的关键词被重复转义: %v %v", req.URL, err)
+	}
+
+	if req, err := newSearchRequest("仙逆", 1, newRule("get")); err != nil || req.URL.RawQuery != "q=%E4%BB%99%E9%80%86&t=1" {
+		t.Errorf("GET 搜索URL中的关键词应转义: %v %v", req.URL, err)
+	}
+}
+
+func TestCrawlerFetcher(t *testing.T) {
+	var failures atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次请求失败，重试后成功
+		if failures.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `<div id="content">`+r.UserAgent()+`(本章完)</div>`)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{}
+	cfg.Crawl.EnableRetry = 1
+	cfg.Crawl.MaxRetries = 2
+	cfg.Crawl.RetryMinInterval = 1
+
+	// 外层中间件能看到每一次重试
+	var requests []string
+	count := func(next fetcher.Fetcher) fetcher.Fetcher {
+		return fetcher.Func(func(req *http.Request) (*http.Response, error) {
+			requests = append(requests, req.URL.Path)
+			return next.Do(req)
+		})
+	}
+	crawler := NewCrawler(cfg, WithTransport(server.Client().Transport), WithMiddleware(count))
+
+	rule := &model.Rule{Chapter: model.ChapterRule{Content: "#content", FilterTxt: `\(本章完\)`}}
+	content, err := crawler.downloadChapterContent(context.Background(), nil, model.Chapter{URL: server.URL + "/1/1.html"}, rule)
+	if err != nil {
+		t.Fatalf("下载章节失败: %v", err)
+	}
+	if !strings.HasPrefix(content, "Mozilla/5.0") || strings.Contains(content, "本章完") {
+		t.Errorf("章节内容不正确: %q", content)
+	}
+	if len(requests) != 2 {
+		t.Errorf("期望请求 2 次，实际 %v", requests)
+	}
+}
+
+func TestCharMap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<div id=\"content\">他\ue001一个好\u200b人\ufeff\u3000\ue002看\ue003\ue004</div>")
+	}))
+	defer server.Close()
+
+	// 字符映射在 filterTxt 之前生效
+	rule := &model.Rule{Chapter: model.ChapterRule{
+		Content:    "#content",
+		CharMap:    map[string]string{"\ue001": "是", "\ue002": "请", "\ue003\ue004": "下章"},
+		StripNoise: true,
+		FilterTxt:  `请看下章`,
+	}}
+	crawler := NewCrawler(&config.Config{}, WithTransport(server.Client().Transport))
+	content, err := crawler.downloadChapterContent(context.Background(), nil, model.Chapter{URL: server.URL + "/1.html"}, rule)
+	if err != nil || strings.TrimSpace(content) != "他是一个好人" {
+		t.Errorf("还原后的正文不正确: %q, %v", content, err)
+	}
+}
+
+func TestScriptHttp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/1.html":
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "abc", Path: "/"})
+			io.WriteString(w, `<div id="content" data-cid="42">加载中...</div>`)
+		case "/api/chapter":
+			// 正文接口需要页面设置的Cookie
+			if cookie, _ := r.Cookie("token"); cookie == nil || r.FormValue("id") != "42" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			io.WriteString(w, `{"data": {"text": "`+r.Method+` 正文"}}`)
+		}
+	}))
+	defer server.Close()
+
+	crawler := NewCrawler(&config.Config{}, WithTransport(server.Client().Transport))
+	download := func(content string) (string, error) {
+		rule := &model.Rule{Chapter: model.ChapterRule{Content: content}}
+		return crawler.downloadChapterContent(context.Background(), nil, model.Chapter{URL: server.URL + "/1/1.html"}, rule)
+	}
+
+	content, err := download(`#content@js:r = httpJson("/api/chapter", {id: queryAttr("#content", "data-cid")}).data.text`)
+	if err != nil || content != "POST 正文" {
+		t.Errorf("脚本请求接口的结果不正确: %q, %v", content, err)
+	}
+	content, _ = download(`#content@js:r = JSON.parse(httpGet("../api/chapter?id=42")).data.text`)
+	if content != "GET 正文" {
+		t.Errorf("脚本请求接口的结果不正确: %q", content)
+	}
+
+	// 请求失败时脚本出错，保留原值
+	content, _ = download(`#content@js:r = httpGet("/api/chapter?id=1")`)
+	if content != "加载中..." {
+		t.Errorf("请求失败时应保留原值: %q", content)
+	}
+}
+
+func TestJSONSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/search":
+			io.WriteString(w, `{"data": [{"name": "`+r.FormValue("q")+`", "author": "耳根", "id": 7}]}`)
+		case "/api/book/7":
+			io.WriteString(w, `{"book": {"name": "仙逆", "author": "耳根"}, "chapters": [{"title": "第一章", "cid": 1}, {"title": "第二章", "cid": 2}]}`)
+		case "/api/chapter/1":
+			io.WriteString(w, `{"paragraphs": ["第一段", "第二段"]}`)
+		}
+	}))
+	defer server.Close()
+
+	rule := &model.Rule{
+		URL: server.URL + "/",
+		Search: model.SearchRule{
+			URL:      server.URL + "/api/search?q=%s",
+			Result:   "$.data[*]",
+			BookName: "$.name",
+			BookURL:  "$.id@js:r = '/api/book/' + r",
+			Author:   "$.author",
+		},
+		Book:    model.BookRule{BookName: "$.book.name", Author: "@json:book.author"},
+		Toc:     model.TocRule{Item: "$.chapters[*]", ChapterName: "$.title", ChapterURL: "$.cid@js:r = '/api/chapter/' + r"},
+		Chapter: model.ChapterRule{Content: "$.paragraphs[*]"},
+	}
+	crawler := NewCrawler(&config.Config{}, WithTransport(server.Client().Transport))
+
+	results, err := crawler.doSearch("仙逆", rule)
+	if err != nil || len(results) != 1 || results[0].BookName != "仙逆" || results[0].Author != "耳根" || results[0].URL != server.URL+"/api/book/7" {
+		t.Fatalf("JSON搜索结果不正确: %+v, %v", results, err)
+	}
+	book, err := crawler.parseBookInfo(results[0].URL, rule)
+	if err != nil || book.BookName != "仙逆" || book.Author != "耳根" {
+		t.Fatalf("JSON书籍信息不正确: %+v, %v", book, err)
+	}
+	chapters, err := crawler.parseToc(results[0].URL, rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) != 2 || chapters[1].Title != "第二章" || chapters[0].URL != server.URL+"/api/chapter/1" {
+		t.Fatalf("JSON目录不正确: %+v", chapters)
+	}
+	content, err := crawler.downloadChapterContent(context.Background(), book, chapters[0], rule)
+	if err != nil || content != "第一段\n第二段" {
+		t.Errorf("JSON正文不正确: %q, %v", content, err)
+	}
+}
+
+func TestURLTemplates(t *testing.T) {
+	transport := &pageTransport{
+		pages: map[string]string{
+			// 第3页重复第2页，视为最后一页
+			"http://www.tpl.example/search?q=%CF%C9%C4%E6&p=1": `<ul><li><a href="/book/12345.html">仙逆</a></li></ul>`,
+			"http://www.tpl.example/search?q=%CF%C9%C4%E6&p=2": `<ul><li><a href="/book/12346.html">仙逆外传</a></li></ul>`,
+			"http://www.tpl.example/search?q=%CF%C9%C4%E6&p=3": `<ul><li><a href="/book/12346.html">仙逆外传</a></li></ul>`,
+			// 第3页不存在
+			"http://www.tpl.example/12/12345/index_1.html": `<div id="list"><a href="/12/12345/1.html">第一章</a><a href="/12/12345/2.html">第二章</a></div>`,
+			"http://www.tpl.example/12/12345/index_2.html": `<div id="list"><a href="/12/12345/3.html">第三章</a></div>`,
+		},
+		requests: make(map[string]int),
+	}
+	rule := &model.Rule{
+		URL: "http://www.tpl.example/",
+		Search: model.SearchRule{
+			URL:        "http://www.tpl.example/search?q={{keyword|gbk}}&p={{page}}",
+			Result:     "li",
+			BookName:   "a",
+			Pagination: true,
+		},
+		Book:    model.BookRule{URL: `/book/(\d+)\.html`},
+		Toc:     model.TocRule{URL: "http://www.tpl.example/{{$1/1000}}/{{bookId}}/index_{{page}}.html", Item: "#list a", Pagination: true},
+		Chapter: model.ChapterRule{Content: "#content"},
+	}
+	crawler := NewCrawler(&config.Config{}, WithTransport(transport))
+
+	results, err := crawler.doSearch("仙逆", rule)
+	if err != nil || len(results) != 2 || results[1].URL != "http://www.tpl.example/book/12346.html" {
+		t.Fatalf("按页码翻页的搜索结果不正确: %+v, %v", results, err)
+	}
+
+	chapters, err := crawler.parseToc(results[0].URL, rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chapters) != 3 || chapters[2].Title != "第三章" || chapters[2].Order != 3 {
+		t.Fatalf("按页码翻页的目录不正确: %+v", chapters)
+	}
+	if transport.requests["http://www.tpl.example/12/12345/index_3.html"] != 1 {
+		t.Errorf("目录应在第3页请求失败后停止: %v", transport.requests)
+	}
+}
+
+func TestRuleHeaders(t *testing.T) {
+	var mutex sync.Mutex
+	headers := make(map[string]http.Header)
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		headers[r.URL.Path] = r.Header.Clone()
+		if r.URL.Path == "/search" {
+			data, _ := io.ReadAll(r.Body)
+			body = string(data)
+		}
+		mutex.Unlock()
+		switch r.URL.Path {
+		case "/search":
+			io.WriteString(w, `<ul><li><a href="/book/1/">仙逆</a></li></ul>`)
+		case "/book/1/":
+			io.WriteString(w, `<h1>仙逆</h1><div id="list"><a href="/book/1/1.html">第一章</a></div>`)
+		case "/book/1/1.html":
+			io.WriteString(w, `<div id="content">正文</div>`)
+		case "/cover.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			io.WriteString(w, "\xff\xd8\xff\xe0\x00\x10JFIF\x00\xff\xd9")
+		}
+	}))
+	defer server.Close()
+
+	rule := &model.Rule{
+		URL:     server.URL + "/",
+		Headers: map[string]string{"Accept-Language": "zh-CN", "User-Agent": "go-novel-test"},
+		Search: model.SearchRule{
+			URL:      server.URL + "/search",
+			Method:   "post",
+			Data:     `{"q": "{{keyword}}", "page": {{page}}}`,
+			BodyType: "json",
+			Headers:  map[string]string{"Accept-Language": "en"},
+			Result:   "li",
+			BookName: "a",
+		},
+		Book:    model.BookRule{BookName: "h1"},
+		Toc:     model.TocRule{Item: "#list a", Headers: map[string]string{"Referer": server.URL + "/"}},
+		Chapter: model.ChapterRule{Content: "#content", Headers: map[string]string{"X-Requested-With": "XMLHttpRequest"}},
+	}
+	crawler := NewCrawler(&config.Config{}, WithTransport(server.Client().Transport))
+
+	results, err := crawler.doSearch(`仙"逆`, rule)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("搜索失败: %+v, %v", results, err)
+	}
+	book, err := crawler.parseBookInfo(results[0].URL, rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chapters, err := crawler.parseToc(results[0].URL, rule)
+	if err != nil || len(chapters) != 1 {
+		t.Fatalf("解析目录失败: %+v, %v", chapters, err)
+	}
+	if _, err := crawler.downloadChapterContent(context.Background(), book, chapters[0], rule); err != nil {
+		t.Fatal(err)
+	}
+	book.CoverUrl = server.URL + "/cover.jpg"
+	if tempFile := crawler.downloadAndAddCoverImage(context.Background(), book, rule, epub.NewEpub(book.BookName)); tempFile == "" {
+		t.Fatal("下载封面失败")
+	} else {
+		os.Remove(tempFile)
+	}
+
+	search := headers["/search"]
+	if body != `{"q": "仙\"逆", "page": 1}` || search.Get("Content-Type") != "application/json; charset=utf-8" || search.Get("Accept-Language") != "en" {
+		t.Errorf("搜索请求不正确: %s %v", body, search)
+	}
+	if h := headers["/book/1/"]; h.Get("Referer") != server.URL+"/" || h.Get("Accept-Language") != "zh-CN" || h.Get("User-Agent") != "go-novel-test" {
+		t.Errorf("目录请求头不正确: %v", h)
+	}
+	if h := headers["/book/1/1.html"]; h.Get("X-Requested-With") != "XMLHttpRequest" || h.Get("Referer") != "" || h.Get("User-Agent") != "go-novel-test" {
+		t.Errorf("正文请求头不正确: %v", h)
+	}
+	if h := headers["/cover.jpg"]; h.Get("Referer") != book.URL || h.Get("Accept-Language") != "zh-CN" || h.Get("User-Agent") != "go-novel-test" {
+		t.Errorf("封面请求头不正确: %v", h)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var logins atomic.Int32
+	var expired, unavailable atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := r.Cookie("session")
+		switch r.URL.Path {
+		case "/login":
+			if unavailable.CompareAndSwap(true, false) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.Method != http.MethodPost || r.FormValue("user") != "reader" || r.FormValue("pass") != "secret" {
+				io.WriteString(w, `{"code": 1}`)
+				return
+			}
+			n := logins.Add(1)
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.Itoa(int(n)), Path: "/"})
+			io.WriteString(w, `{"code": 0}`)
+		case "/book/1/1.html":
+			// 第一个会话在请求正文时过期
+			if session == nil || session.Value == "1" && expired.CompareAndSwap(false, true) {
+				io.WriteString(w, `<div id="content">请先登录后阅读</div>`)
+				return
+			}
+			io.WriteString(w, `<div id="content">完整正文</div>`)
+		}
+	}))
+	defer server.Close()
+
+	rule := &model.Rule{
+		ID:   1,
+		Name: "登录测试",
+		File: "login.json",
+		URL:  server.URL + "/",
+		Login: &model.LoginRule{
+			URL:     "/login",
+			Data:    `{"user": "{{username}}", "pass": "{{password}}"}`,
+			Success: `"code": 0`,
+			Expired: "请先登录",
+		},
+		Chapter: model.ChapterRule{Content: "#content"},
+	}
+	chapter := model.Chapter{URL: server.URL + "/book/1/1.html"}
+
+	// 没有凭据时以游客身份继续
+	content, err := NewCrawler(&config.Config{}, WithTransport(server.Client().Transport)).downloadChapterContent(context.Background(), nil, chapter, rule)
+	if err != nil || content != "请先登录后阅读" || logins.Load() != 0 {
+		t.Fatalf("没有凭据时应以游客身份请求: %q, %v", content, err)
+	}
+
+	if err := config.SetCredential("login.json#1", config.Credential{"username": "reader", "password": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	crawler := NewCrawler(&config.Config{}, WithTransport(server.Client().Transport))
+	content, err = crawler.downloadChapterContent(context.Background(), nil, chapter, rule)
+	if err != nil || content != "完整正文" {
+		t.Fatalf("登录失效后应重新登录并重试: %q, %v", content, err)
+	}
+	if logins.Load() != 2 {
+		t.Errorf("期望登录 2 次，实际 %d 次", logins.Load())
+	}
+	content, _ = crawler.downloadChapterContent(context.Background(), nil, chapter, rule)
+	if content != "完整正文" || logins.Load() != 2 {
+		t.Errorf("登录后不应重复登录: %q, %d", content, logins.Load())
+	}
+
+	// 登录请求失败后，下一个请求重新登录
+	unavailable.Store(true)
+	crawler = NewCrawler(&config.Config{}, WithTransport(server.Client().Transport))
+	if _, err := crawler.downloadChapterContent(context.Background(), nil, chapter, rule); err == nil {
+		t.Fatal("登录请求失败时应返回错误")
+	}
+	if content, err := crawler.downloadChapterContent(context.Background(), nil, chapter, rule); err != nil || content != "完整正文" {
+		t.Errorf("登录失败后应重新登录: %q, %v", content, err)
+	}
+
+	// 密码错误时登录失败
+	config.SetCredential("login.json#1", config.Credential{"username": "reader", "password": "wrong"})
+	if err := NewCrawler(&config.Config{}, WithTransport(server.Client().Transport)).Login(rule); err == nil || !strings.Contains(err.Error(), "登录失败") {
+		t.Errorf("密码错误时应登录失败: %v", err)
+	}
+	if list, _ := config.ListCredentials(); len(list) != 1 || list[0].Username != "reader" {
+		t.Errorf("凭据列表不正确: %+v", list)
+	}
+}
+
+func TestMultipleRuleFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := filepath.Join("configs", "rules")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// 两个规则文件使用相同的规则ID
+	rule := `[{"id": 1, "name": "HOST", "url": "http://HOST/", "search": {"url": "http://HOST/search?q=%s", "method": "get", "result": "li", "bookName": "a"}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}]`
+	for file, host := range map[string]string{"multi-a.json": "www.a.example", "multi-b.json": "www.b.example"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(strings.ReplaceAll(rule, "HOST", host)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	transport := &pageTransport{
+		pages: map[string]string{
+			"http://www.a.example/search?q=%E4%BB%99%E9%80%86": `<ul><li><a href="/book/1/">仙逆</a></li></ul>`,
+			"http://www.b.example/search?q=%E4%BB%99%E9%80%86": `<ul><li><a href="/book/1/">仙逆</a></li></ul>`,
+		},
+		requests: make(map[string]int),
+	}
+
+	cfg := &config.Config{}
+	cfg.Source.ActiveRules = "multi-a.json, multi-b.json"
+	cfg.Source.SourceId = -1
+	results, err := NewCrawler(cfg, WithTransport(transport)).Search("仙逆")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]string{}
+	for _, r := range results {
+		sources[r.Source] = r.URL
+	}
+	if len(sources) != 2 || sources["multi-a.json#1"] != "http://www.a.example/book/1/" || sources["multi-b.json#1"] != "http://www.b.example/book/1/" {
+		t.Fatalf("聚合搜索应包含所有激活规则文件的书源: %+v", results)
+	}
+
+	// 限定ID指定规则文件，规则ID对应第一个规则文件，未指定时按域名在所有文件中匹配
+	for source, want := range map[string]string{"multi-b.json#1": "www.b.example", "1": "www.a.example", "": "www.b.example"} {
+		downloadCfg := *cfg
+		if err := downloadCfg.Source.SelectSource(source); err != nil {
+			t.Fatal(err)
+		}
+		rule, err := NewCrawler(&downloadCfg).loadRule("http://www.b.example/book/1/")
+		if err != nil || rule.Name != want {
+			t.Errorf("书源 %q 应使用 %s 的规则，实际 %+v %v", source, want, rule, err)
+		}
+	}
+	if err := cfg.Source.SelectSource("proxy-rules.json#1"); err == nil {
+		t.Error("未激活的规则文件不能被指定")
+	}
+}
+
+func TestInferRule(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filepath.Join("configs", "rules"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var toc strings.Builder
+	toc.WriteString(`<html><head><title>仙逆最新章节</title></head><body>
+<div class="nav"><a href="/">首页</a><a href="/sort/1/">玄幻</a><a href="/sort/2/">仙侠</a></div>
+<h1>仙逆</h1>
+<div class="latest"><a href="/book/1/10.html">第十章</a><a href="/book/1/9.html">第九章</a></div>
+<div id="list"><dl>`)
+	for i := 1; i <= 10; i++ {
+		toc.WriteString(`<dd><a href="/book/1/` + strconv.Itoa(i) + `.html">第` + strconv.Itoa(i) + `章</a></dd>`)
+	}
+	toc.WriteString(`</dl></div><div class="footer"><a href="/about">关于</a></div></body></html>`)
+
+	paragraph := "王林站在山巅，望着远处连绵的群山，心中感慨万千。这一路走来，经历了太多的生死离别，"
+	chapter := `<html><body><div class="nav"><a href="/">首页</a><a href="/book/1/">目录</a></div>
+<div class="sidebar"><ul><li><a href="/hot/1">热门推荐一</a></li><li><a href="/hot/2">热门推荐二</a></li></ul></div>
+<div class="box"><h1>第一章</h1><div id="content">` + strings.Repeat(paragraph+"<br><br>", 5) + `</div>
+<div class="page"><a href="/book/1/">目录</a><a href="/book/1/2.html">下一章</a></div></div></body></html>`
+
+	pages := map[string]string{"http://www.infer.example/book/1/": toc.String()}
+	for i := 1; i <= 10; i++ {
+		pages["http://www.infer.example/book/1/"+strconv.Itoa(i)+".html"] = chapter
+	}
+	transport := &pageTransport{pages: pages, requests: make(map[string]int)}
+	crawler := NewCrawler(&config.Config{}, WithTransport(transport))
+
+	result, err := crawler.InferRule("http://www.infer.example/book/1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rule.Toc.Item != "#list > dl a" || result.Chapters != 10 || result.Rule.Chapter.Content != "#content" {
+		t.Fatalf("识别结果不正确: toc=%q chapters=%d content=%q", result.Rule.Toc.Item, result.Chapters, result.Rule.Chapter.Content)
+	}
+	if result.FirstChapter != "http://www.infer.example/book/1/1.html" || !strings.HasPrefix(result.Sample, "王林站在山巅") {
+		t.Errorf("第一章不正确: %s %q", result.FirstChapter, result.Sample)
+	}
+
+	// 没有匹配的规则时，获取目录自动使用识别出的规则
+	book, chapters, err := crawler.FetchCatalog("http://www.infer.example/book/1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.BookName != "仙逆" || len(chapters) != 10 || chapters[9].URL != "http://www.infer.example/book/1/10.html" {
+		t.Errorf("目录不正确: %+v %d", book, len(chapters))
+	}
+
+	// 指定书源时不自动识别
+	cfg := &config.Config{}
+	cfg.Source.SourceId = 1
+	if _, _, err := NewCrawler(cfg, WithTransport(transport)).FetchCatalog("http://www.infer.example/book/1/"); err == nil {
+		t.Error("指定的书源不存在时应返回错误")
+	}
+
+	transport.pages["http://www.infer.example/empty/"] = `<html><body><p>` + paragraph + `</p></body></html>`
+	if _, err := crawler.InferRule("http://www.infer.example/empty/"); err == nil {
+		t.Error("没有章节列表时应返回错误")
+	}
+}
+
+func TestLoadCachedChapters(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cfg := &config.Config{}
+	cfg.Download.DownloadPath = "downloads"
+	book := &model.Book{BookName: "仙逆", Author: "耳根", URL: "http://www.example.com/book/1/"}
+	chapters := func(n int) []model.Chapter {
+		list := make([]model.Chapter, n)
+		for i := range list {
+			list[i] = model.Chapter{Order: i + 1, Title: "第" + strconv.Itoa(i+1) + "章", URL: "http://www.example.com/book/1/" + strconv.Itoa(i+1) + ".html"}
+		}
+		return list
+	}
+
+	// 章节数从 999 增加到 1000 后，补零位数不同的缓存仍能匹配
+	cfg.Download.ExtName = "txt"
+	dir, err := util.CreateDownloadDir(cfg.Download.DownloadPath, book.BookName, book.Author, cfg.Download.ExtName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "001_第1章.txt"), []byte("缓存的正文"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	list := chapters(1000)
+	if cached := NewCrawler(cfg).loadCachedChapters(book, list); cached != 1 || list[0].Content != "缓存的正文" {
+		t.Errorf("应读取到补零位数不同的缓存，实际 %d 章", cached)
+	}
+	os.RemoveAll(dir)
+
+	// 下载时未保留章节缓存，从生成的书籍文件中还原，再次合并后内容不变
+	for _, ext := range []string{"txt", "epub"} {
+		cfg.Download.ExtName = ext
+		crawler := NewCrawler(cfg)
+		list := chapters(3)
+		for i := range list {
+			list[i].Content = "第一段 & <注释>\n第二段"
+		}
+		if err := crawler.saveBook(context.Background(), book, list, &model.Rule{}); err != nil {
+			t.Fatal(err)
+		}
+		fp := filepath.Join(cfg.Download.DownloadPath, bookFileName(book, ext))
+		original, _ := os.ReadFile(fp)
+		originalChapters, _ := util.ReadEpubChapters(fp)
+
+		list = chapters(4)
+		if cached := crawler.loadCachedChapters(book, list); cached != 3 || list[3].Content != "" {
+			t.Fatalf("%s: 应从书籍文件还原 3 章，实际 %d 章", ext, cached)
+		}
+		if err := crawler.saveBook(context.Background(), book, list[:3], &model.Rule{}); err != nil {
+			t.Fatal(err)
+		}
+		if ext == "txt" {
+			if merged, _ := os.ReadFile(fp); string(merged) != string(original) {
+				t.Errorf("还原后重新合并的TXT不一致:\n%s\n---\n%s", merged, original)
+			}
+		} else if got, _ := util.ReadEpubChapters(fp); len(got) != 3 || !reflect.DeepEqual(got, originalChapters) {
+			t.Errorf("还原后重新合并的EPUB不一致:\n%+v\n%+v", got, originalChapters)
+		}
+	}
+}
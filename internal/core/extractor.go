@@ -1,228 +1,123 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"regexp"
-	"strings"
+	"strconv"
 
+	"go-novel/internal/fetcher"
+	"go-novel/internal/model"
+	"go-novel/internal/rules"
+	"go-novel/internal/selector"
+	"go-novel/internal/urltemplate"
 	"go-novel/internal/util"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/antchfx/htmlquery"
 )
 
-// extractText 从选择器中提取文本，支持JavaScript调用和XPath
-func (c *Crawler) extractText(s *goquery.Selection, selector string) string {
-	if selector == "" {
-		return ""
-	}
-
-	// 处理JavaScript调用
-	if strings.Contains(selector, "@js:") {
-		parts := strings.Split(selector, "@js:")
-		selector = parts[0]
-
-		// 首先提取原始文本
-		text := c.extractTextSimple(s, selector)
-		// fmt.Printf("Debug: 使用选择器 '%s' 提取到原始文本: '%s'\n", selector, text)
-
-		// 如果有JavaScript代码
-		if len(parts) > 1 {
-			jsCode := parts[1]
-			// fmt.Printf("Debug: 执行JS代码: '%s' 对文本进行处理\n", jsCode)
-
-			// 使用完整的JavaScript引擎处理
-			result, err := util.CallJs(jsCode, text)
-			if err != nil {
-				fmt.Printf("Debug: JavaScript执行出错: %v\n", err)
-				return text
-			}
-			text = result
-			// fmt.Printf("Debug: JavaScript执行结果: '%s'\n", text)
-		}
-
-		return text
+// compiledRule 获取预编译的规则，未经规则管理器加载的规则即时编译
+func compiledRule(rule *model.Rule) *model.CompiledRule {
+	if rule.Compiled == nil {
+		rules.Compile(rule)
 	}
-
-	// 检查是否是XPath
-	if strings.HasPrefix(selector, "/") || strings.HasPrefix(selector, "//") || strings.HasPrefix(selector, "(") {
-		// 使用XPath提取
-		return c.extractTextWithXPath(s, selector)
-	}
-
-	// 处理meta标签的特殊情况
-	if strings.HasPrefix(selector, "meta[") {
-		fmt.Printf("Debug: 检测到meta标签选择器: '%s'\n", selector)
-		// 如果是meta标签，尝试提取content属性
-		content := c.extractAttr(s, selector, "content")
-		fmt.Printf("Debug: 仞meta标签提取到content属性值: '%s'\n", content)
-		return content
-	}
-
-	// 默认使用CSS选择器
-	result := strings.TrimSpace(s.Find(selector).Text())
-	// fmt.Printf("Debug: 使用CSS选择器'%s'提取到文本: '%s'\n", selector, result)
-	return result
+	return rule.Compiled
 }
 
-// extractTextSimple 使用CSS选择器简单提取文本
-func (c *Crawler) extractTextSimple(s *goquery.Selection, selector string) string {
-	if selector == "" {
+// extractAbsAttr 从选择器中提取属性，并转换为绝对URL
+func (c *Crawler) extractAbsAttr(s *goquery.Selection, sel *selector.Selector, attr string, baseURL string) string {
+	relativeURL := sel.AttrWith(s, attr, c.jsContext(context.Background(), baseURL))
+	if relativeURL == "" {
 		return ""
 	}
 
-	// 默认使用CSS选择器
-	return strings.TrimSpace(s.Find(selector).Text())
+	// 将相对URL转换为绝对URL
+	absoluteURL := joinURL(baseURL, relativeURL)
+	return absoluteURL
 }
 
-// extractTextWithXPath 使用XPath提取文本
-func (c *Crawler) extractTextWithXPath(s *goquery.Selection, xpathExpr string) string {
-	// 将goquery.Selection转换为HTML字符串
-	htmlStr, err := s.Html()
-	if err != nil {
-		return ""
-	}
-
-	// 解析HTML
-	doc, err := htmlquery.Parse(strings.NewReader(htmlStr))
+// parseDocument 读取并解析响应，JSON接口的响应转换为节点树，以便使用 JSONPath
+func parseDocument(resp *http.Response) (*goquery.Document, error) {
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return ""
-	}
-
-	// 使用XPath表达式查找元素
-	node, err := htmlquery.Query(doc, xpathExpr)
-	if err != nil || node == nil {
-		return ""
+		return nil, err
 	}
-
-	// 返回文本内容
-	return strings.TrimSpace(htmlquery.InnerText(node))
+	return selector.ParseDocument(data, resp.Header.Get("Content-Type"))
 }
 
-// extractAttr 从选择器中提取属性，支持JavaScript调用和XPath
-func (c *Crawler) extractAttr(s *goquery.Selection, selector, attr string) string {
-	if selector == "" {
-		return ""
-	}
-
-	// 处理JavaScript调用
-	if strings.Contains(selector, "@js:") {
-		parts := strings.Split(selector, "@js:")
-		selector = parts[0]
+// jsContext 创建规则脚本的页面上下文，脚本中的HTTP请求随 ctx 取消
+func (c *Crawler) jsContext(ctx context.Context, baseURL string) *util.JsContext {
+	return &util.JsContext{BaseURL: baseURL, Fetch: c.jsFetch(ctx)}
+}
 
-		// 首先提取属性值
-		var value string
-		if strings.HasPrefix(selector, "/") || strings.HasPrefix(selector, "//") || strings.HasPrefix(selector, "(") {
-			// 使用XPath提取
-			value = c.extractAttrWithXPath(s, selector, attr)
-		} else {
-			// 默认使用CSS选择器
-			value, _ = s.Find(selector).First().Attr(attr)
+// jsFetch 通过爬虫的 Fetcher 发起脚本中的HTTP请求，与页面请求共用代理和Cookie，并按 min-interval 限速
+func (c *Crawler) jsFetch(ctx context.Context) func(util.JsRequest) (string, error) {
+	return func(r util.JsRequest) (string, error) {
+		header := make(http.Header)
+		for key, value := range r.Header {
+			header.Set(key, value)
 		}
-
-		// fmt.Printf("Debug: 使用选择器 '%s' 提取到属性 '%s' 的值: '%s'\n", selector, attr, value)
-
-		// 如果有JavaScript代码
-		if len(parts) > 1 && value != "" {
-			jsCode := parts[1]
-			// fmt.Printf("Debug: 执行JS代码: '%s' 对属性值进行处理\n", jsCode)
-
-			// 使用完整的JavaScript引擎处理
-			result, err := util.CallJs(jsCode, value)
-			if err != nil {
-				fmt.Printf("Debug: JavaScript执行出错: %v\n", err)
-				return value
-			}
-			value = result
-			// fmt.Printf("Debug: JavaScript执行结果: '%s'\n", value)
+		req, err := fetcher.Request{Method: r.Method, URL: r.URL, Body: r.Body, Header: header}.Build(ctx)
+		if err != nil {
+			return "", err
 		}
 
-		return value
-	}
-
-	// 检查是否是XPath
-	if strings.HasPrefix(selector, "/") || strings.HasPrefix(selector, "//") || strings.HasPrefix(selector, "(") {
-		// 使用XPath提取
-		return c.extractAttrWithXPath(s, selector, attr)
-	}
-
-	// 处理meta标签的特殊情况
-	if strings.HasPrefix(selector, "meta[") {
-		// fmt.Printf("Debug: 检测到meta标签选择器: '%s', 要提取的属性: '%s'\n", selector, attr)
-		// 使用根元素来确保可以选中全局meta标签
-		root := s
-		// 如果s不是文档节点，发现其根节点
-		if s.Parent().Length() > 0 {
-			root = s.Parent()
-			for root.Parent().Length() > 0 {
-				root = root.Parent()
-			}
+		resp, err := c.scriptFetcher.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return "", fmt.Errorf("请求 %s 失败，状态码: %d", r.URL, resp.StatusCode)
 		}
 
-		// 使用根节点选中meta标签
-		meta := root.Find(selector)
-		if meta.Length() > 0 {
-			value, exists := meta.First().Attr(attr)
-			if exists {
-				// fmt.Printf("Debug: 从 meta标签提取到%s属性值: '%s'\n", attr, value)
-				return value
-			} else if attr == "href" {
-				// 如果要获取href属性，但meta标签没有，尝试获取content属性
-				value, exists = meta.First().Attr("content")
-				if exists {
-					// fmt.Printf("Debug: meta标签没有href属性，使用content属性作为替代: '%s'\n", value)
-					return value
-				}
-			}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, util.DefaultJsMaxOutput+1))
+		if err != nil {
+			return "", err
 		}
-		return ""
+		if len(body) > util.DefaultJsMaxOutput {
+			return "", fmt.Errorf("请求 %s 的响应超过 %d 字节", r.URL, util.DefaultJsMaxOutput)
+		}
+		return string(body), nil
 	}
-
-	// 默认使用CSS选择器
-	value, _ := s.Find(selector).First().Attr(attr)
-	return value
 }
 
-// extractAttrWithXPath 使用XPath提取属性
-func (c *Crawler) extractAttrWithXPath(s *goquery.Selection, xpathExpr, attr string) string {
-	// 将goquery.Selection转换为HTML字符串
-	htmlStr, err := s.Html()
-	if err != nil {
-		return ""
+// bookVars 目录URL模板的变量：bookUrl、page、book.url 正则的分组 $1、$2… 和命名分组，以及书籍ID bookId (同 id)。
+// 书籍ID依次取命名分组 bookId、id 和第一个分组，都没有时按常见格式从URL中提取
+func bookVars(rule *model.Rule, bookUrl string) urltemplate.Vars {
+	vars := urltemplate.Vars{"bookUrl": bookUrl, "page": "1"}
+	if re := compiledRule(rule).Book.URL; re != nil {
+		if m := re.FindStringSubmatch(bookUrl); m != nil {
+			for i, name := range re.SubexpNames() {
+				if i == 0 {
+					continue
+				}
+				vars["$"+strconv.Itoa(i)] = m[i]
+				if name != "" {
+					vars[name] = m[i]
+				}
+			}
+		}
 	}
 
-	// 解析HTML
-	doc, err := htmlquery.Parse(strings.NewReader(htmlStr))
-	if err != nil {
-		return ""
+	bookId := vars["bookId"]
+	for _, key := range []string{"id", "$1"} {
+		if bookId == "" {
+			bookId = vars[key]
+		}
 	}
-
-	// 使用XPath表达式查找元素
-	node, err := htmlquery.Query(doc, xpathExpr)
-	if err != nil || node == nil {
-		return ""
+	if bookId == "" {
+		bookId = extractBookIdFromUrl(bookUrl)
 	}
-
-	// 获取属性值
-	for _, a := range node.Attr {
-		if a.Key == attr {
-			return a.Val
+	if bookId != "" {
+		vars["bookId"] = bookId
+		if vars["id"] == "" {
+			vars["id"] = bookId
 		}
 	}
-
-	return ""
-}
-
-// extractAbsAttr 从选择器中提取属性，并转换为绝对URL
-func (c *Crawler) extractAbsAttr(s *goquery.Selection, selector, attr string, baseURL string) string {
-	relativeURL := c.extractAttr(s, selector, attr)
-	if relativeURL == "" {
-		return ""
-	}
-
-	// 将相对URL转换为绝对URL
-	absoluteURL := joinURL(baseURL, relativeURL)
-	return absoluteURL
+	return vars
 }
 
 // extractBookIdFromUrl 从书籍URL中提取书籍ID
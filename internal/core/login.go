@@ -0,0 +1,196 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go-novel/internal/config"
+	"go-novel/internal/fetcher"
+	"go-novel/internal/model"
+	"go-novel/internal/urltemplate"
+	"go-novel/internal/util"
+)
+
+// stageLogin 登录请求，只用于合并请求头
+const stageLogin = "login"
+
+// loginState 书源在当前爬虫中的登录状态，generation 在每次登录成功后加一，用于合并并发的重新登录。
+// 没有登录凭据时 guest 为 true，不再检查登录失效。登录失败不记录，下一个请求重新登录
+type loginState struct {
+	mutex      sync.Mutex
+	done       bool
+	guest      bool
+	generation int
+}
+
+// loginState 返回书源的登录状态，不存在时创建
+func (c *Crawler) loginState(rule *model.Rule) *loginState {
+	state, _ := c.logins.LoadOrStore(config.QualifiedSourceId(rule.File, rule.ID), &loginState{})
+	return state.(*loginState)
+}
+
+// Login 立即使用保存的凭据登录书源，用于检查登录规则和凭据
+func (c *Crawler) Login(rule *model.Rule) error {
+	if rule.Login == nil {
+		return fmt.Errorf("书源 %s 没有登录规则", rule.Name)
+	}
+	if _, ok := config.GetCredential(config.QualifiedSourceId(rule.File, rule.ID)); !ok {
+		return fmt.Errorf("书源 %s 没有保存登录凭据", rule.Name)
+	}
+	_, _, err := c.ensureLogin(context.Background(), rule)
+	return err
+}
+
+// ensureLogin 需要登录的书源在第一次请求前登录，返回当前的登录代数和是否以游客身份访问
+func (c *Crawler) ensureLogin(ctx context.Context, rule *model.Rule) (int, bool, error) {
+	if rule.Login == nil {
+		return 0, true, nil
+	}
+	state := c.loginState(rule)
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if !state.done {
+		if err := state.login(ctx, c, rule); err != nil {
+			return state.generation, false, err
+		}
+	}
+	return state.generation, state.guest, nil
+}
+
+// relogin 登录失效后重新登录。generation 为发现失效的请求所用的登录代数，其他请求已重新登录时直接返回
+func (c *Crawler) relogin(ctx context.Context, rule *model.Rule, generation int) error {
+	state := c.loginState(rule)
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.generation == generation {
+		fmt.Printf("书源 %s 登录已失效，重新登录\n", rule.Name)
+		return state.login(ctx, c, rule)
+	}
+	return nil
+}
+
+// login 登录并更新状态，调用方需持有锁。失败时回到未登录状态，
+// 一次网络错误不会导致之后的请求全部失败
+func (state *loginState) login(ctx context.Context, c *Crawler, rule *model.Rule) error {
+	guest, err := c.login(ctx, rule)
+	if err != nil {
+		state.done = false
+		return err
+	}
+	state.guest, state.done = guest, true
+	state.generation++
+	return nil
+}
+
+// login 使用保存的凭据登录书源，登录后的Cookie保存在爬虫的 Cookie jar 中。没有凭据时返回 guest 为 true，以游客身份继续
+func (c *Crawler) login(ctx context.Context, rule *model.Rule) (guest bool, err error) {
+	source := config.QualifiedSourceId(rule.File, rule.ID)
+	credential, ok := config.GetCredential(source)
+	if !ok {
+		fmt.Printf("书源 %s 需要登录，但没有保存登录凭据 (%s)，以游客身份继续\n", rule.Name, source)
+		return true, nil
+	}
+
+	l := rule.Login
+	var result string
+	if l.Script != "" {
+		result, err = c.loginScript(ctx, rule, credential)
+	} else {
+		result, err = c.loginRequest(ctx, rule, credential)
+	}
+	if err != nil {
+		return false, fmt.Errorf("书源 %s 登录失败: %w", rule.Name, err)
+	}
+	if l.Success != "" && !strings.Contains(result, l.Success) {
+		return false, fmt.Errorf("书源 %s 登录失败: 响应中没有 %q", rule.Name, l.Success)
+	}
+
+	fmt.Printf("书源 %s 登录成功\n", rule.Name)
+	return false, nil
+}
+
+// loginScript 执行登录脚本，脚本通过 httpPost 等函数发起请求，返回值用于检查 success
+func (c *Crawler) loginScript(ctx context.Context, rule *model.Rule, credential config.Credential) (string, error) {
+	program, err := util.CompileJs(rule.Login.Script)
+	if err != nil {
+		return "", err
+	}
+	jsCtx := c.jsContext(ctx, rule.URL)
+	jsCtx.Credential = credential
+	return util.RunJs(program, "", jsCtx)
+}
+
+// loginRequest 发起登录请求，返回响应正文
+func (c *Crawler) loginRequest(ctx context.Context, rule *model.Rule, credential config.Credential) (string, error) {
+	l := rule.Login
+	vars := urltemplate.Vars(credential)
+	t, err := urltemplate.Compile(l.URL)
+	if err != nil {
+		return "", err
+	}
+	loginURL, err := t.Execute(vars)
+	if err != nil {
+		return "", err
+	}
+
+	req := fetcher.Request{URL: util.ResolveURL(rule.URL, loginURL), Header: ruleHeader(rule, stageLogin), Referer: rule.URL}
+	if !strings.EqualFold(l.Method, http.MethodGet) {
+		req.Method = http.MethodPost
+		if req.Body, req.ContentType, err = buildRequestBody(l.Data, l.BodyType, vars); err != nil {
+			return "", err
+		}
+	}
+	httpReq, err := req.Build(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.retryFetcher().Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// fetchPage 请求书源的详情页、目录或正文。需要登录的书源先登录，
+// 页面中出现登录失效标记时重新登录并重试一次
+func (c *Crawler) fetchPage(ctx context.Context, f fetcher.Fetcher, rule *model.Rule, stage, url string) (*http.Response, error) {
+	generation, guest, err := c.ensureLogin(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := get(ctx, f, url, ruleHeader(rule, stage))
+	if err != nil || guest || rule.Login.Expired == "" || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(body, []byte(rule.Login.Expired)) {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+
+	if err := c.relogin(ctx, rule, generation); err != nil {
+		return nil, err
+	}
+	return get(ctx, f, url, ruleHeader(rule, stage))
+}
@@ -5,16 +5,60 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+
+	"go-novel/internal/urltemplate"
 )
 
-// BuildSearchPostData 构建搜索POST数据
+// buildRequestBody 按 bodyType 构建搜索或登录的请求体，返回请求体和 Content-Type：
+// form 将 data 解析为参数后按表单编码，json 和 raw 直接替换 data 中的变量，json 中的值按JSON字符串转义
+func buildRequestBody(data, bodyType string, vars urltemplate.Vars) (string, string, error) {
+	switch strings.ToLower(bodyType) {
+	case "", "form":
+		body, err := buildSearchPostData(data, vars)
+		return body, "application/x-www-form-urlencoded", err
+	case "json", "raw":
+		t, err := urltemplate.Compile(urltemplate.Legacy(data, "keyword"))
+		if err != nil {
+			return "", "", err
+		}
+		if strings.EqualFold(bodyType, "json") {
+			body, err := t.ExecuteJSON(vars)
+			return body, "application/json; charset=utf-8", err
+		}
+		// raw 请求体的 Content-Type 默认为表单，可通过请求头指定
+		body, err := t.ExecuteRaw(vars)
+		return body, "", err
+	default:
+		return "", "", fmt.Errorf("不支持的请求体格式: %s", bodyType)
+	}
+}
+
+// BuildSearchPostData 构建第一页的搜索POST数据，参数值中的 %s 和 {{keyword}} 替换为关键词
 func BuildSearchPostData(dataStr string, keyword string) string {
+	data, err := buildSearchPostData(dataStr, searchVars(keyword, 1))
+	if err != nil {
+		fmt.Printf("Debug: 构建 POST 数据失败: %v\n", err)
+	}
+	return data
+}
+
+// buildSearchPostData 构建搜索POST数据，每个参数值按URL模板替换变量，编码过滤器在表单编码之前生效
+func buildSearchPostData(dataStr string, vars urltemplate.Vars) (string, error) {
 	// 先打印原始数据进行调试
 	fmt.Printf("Debug: 原始 POST 数据字符串: %s\n", dataStr)
 
 	// 如果数据是空的，返回空字符串
 	if dataStr == "" {
-		return ""
+		return "", nil
+	}
+
+	// 参数值按模板生成，不转义，由表单编码统一转义
+	render := func(value string) (string, error) {
+		t, err := urltemplate.Compile(urltemplate.Legacy(value, "keyword"))
+		if err != nil {
+			return "", err
+		}
+		return t.ExecuteRaw(vars)
 	}
 
 	// 尝试解析为JSON格式
@@ -25,15 +69,11 @@ func BuildSearchPostData(dataStr string, keyword string) string {
 		for key, value := range dataMap {
 			// 处理值为字符串的情况
 			if strValue, ok := value.(string); ok {
-				if strValue == "%s" {
-					formData.Add(key, keyword)
-				} else if strings.Contains(strValue, "%s") {
-					// 如果值中包含%s，进行替换
-					replacedValue := strings.ReplaceAll(strValue, "%s", keyword)
-					formData.Add(key, replacedValue)
-				} else {
-					formData.Add(key, strValue)
+				rendered, err := render(strValue)
+				if err != nil {
+					return "", fmt.Errorf("POST 参数 %s: %w", key, err)
 				}
+				formData.Add(key, rendered)
 			} else {
 				// 其他类型直接转换为字符串
 				formData.Add(key, fmt.Sprintf("%v", value))
@@ -43,7 +83,7 @@ func BuildSearchPostData(dataStr string, keyword string) string {
 		// 生成的表单数据
 		encodedData := formData.Encode()
 		fmt.Printf("Debug: 生成的 POST 表单数据: %s\n", encodedData)
-		return encodedData
+		return encodedData, nil
 	}
 
 	// 如果不是JSON格式，使用原来的处理方式
@@ -74,21 +114,17 @@ func BuildSearchPostData(dataStr string, keyword string) string {
 		key := strings.Trim(strings.TrimSpace(parts[0]), `"'`)
 		value := strings.Trim(strings.TrimSpace(parts[1]), `"'`)
 
-		// 替换关键字
-		if value == "%s" {
-			formData.Add(key, keyword)
-		} else if strings.Contains(value, "%s") {
-			// 如果值中包含%s，进行替换
-			replacedValue := strings.ReplaceAll(value, "%s", keyword)
-			formData.Add(key, replacedValue)
-		} else {
-			formData.Add(key, value)
+		// 替换关键字等变量
+		rendered, err := render(value)
+		if err != nil {
+			return "", fmt.Errorf("POST 参数 %s: %w", key, err)
 		}
+		formData.Add(key, rendered)
 	}
 
 	// 生成的表单数据
 	encodedData := formData.Encode()
 	fmt.Printf("Debug: 生成的 POST 表单数据: %s\n", encodedData)
 
-	return encodedData
+	return encodedData, nil
 }
@@ -0,0 +1,302 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"go-novel/internal/charmap"
+	"go-novel/internal/fetcher"
+	"go-novel/internal/model"
+	"go-novel/internal/rules"
+	"go-novel/internal/selector"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// StageSearch 搜索结果页
+	StageSearch = "search"
+	// StageBook 书籍详情页
+	StageBook = "book"
+	// StageToc 目录页
+	StageToc = "toc"
+	// StageChapter 章节正文页
+	StageChapter = "chapter"
+)
+
+// playgroundMaxItems 搜索结果和目录最多返回的条目数，避免大目录页响应过大
+const playgroundMaxItems = 100
+
+// PlaygroundRequest 规则调试请求，URL 与 HTML 二选一，同时提供时 URL 只用于解析相对链接
+type PlaygroundRequest struct {
+	Rule    model.Rule `json:"rule"`
+	Stage   string     `json:"stage"` // search、book、toc、chapter，为空时调试规则中配置了的所有阶段
+	URL     string     `json:"url"`
+	HTML    string     `json:"html"`
+	Keyword string     `json:"keyword"` // 未提供URL和HTML时，按搜索规则请求该关键词
+}
+
+// FieldResult 单个字段的提取结果
+type FieldResult struct {
+	Field    string `json:"field"`
+	Selector string `json:"selector"`
+	selector.Trace
+	Error string `json:"error,omitempty"` // 选择器编译错误
+}
+
+// PlaygroundResult 规则调试结果
+type PlaygroundResult struct {
+	URL     string             `json:"url,omitempty"` // 实际请求的地址
+	Issues  []rules.Issue      `json:"issues,omitempty"`
+	Search  *SearchPlayground  `json:"search,omitempty"`
+	Book    []FieldResult      `json:"book,omitempty"`
+	Toc     *TocPlayground     `json:"toc,omitempty"`
+	Chapter *ChapterPlayground `json:"chapter,omitempty"`
+}
+
+// SearchPlayground 搜索结果页的提取结果
+type SearchPlayground struct {
+	Result FieldResult     `json:"result"`
+	Items  [][]FieldResult `json:"items"`
+}
+
+// TocPlayground 目录页的提取结果
+type TocPlayground struct {
+	Item     FieldResult     `json:"item"`
+	Total    int             `json:"total"`
+	Chapters []model.Chapter `json:"chapters"`
+}
+
+// ChapterPlayground 章节页的提取结果，Filtered 为应用字符映射和 filterTxt 后的正文，
+// PrivateUse 为其中仍未映射的私用区字符，用于编写 charMap
+type ChapterPlayground struct {
+	Title      FieldResult    `json:"title"`
+	Content    FieldResult    `json:"content"`
+	Filtered   string         `json:"filtered"`
+	PrivateUse []charmap.Char `json:"privateUse,omitempty"`
+}
+
+// Playground 使用规则片段解析指定页面，返回每个字段的提取结果，用于编写和调试规则
+func (c *Crawler) Playground(req PlaygroundRequest) (*PlaygroundResult, error) {
+	rule := req.Rule
+	result := &PlaygroundResult{}
+
+	// 规则片段通常缺少ID、名称等，只报告具体字段（如 toc.item）的问题
+	for _, issue := range rules.Compile(&rule) {
+		if strings.Contains(issue.Field, ".") {
+			result.Issues = append(result.Issues, issue)
+		}
+	}
+
+	stages, err := playgroundStages(req.Stage, &rule)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, pageURL, err := c.playgroundPage(req, &rule)
+	if err != nil {
+		return nil, err
+	}
+	result.URL = pageURL
+
+	// 相对链接以页面地址为准，粘贴HTML且未提供URL时使用书源地址
+	baseURL := pageURL
+	if baseURL == "" {
+		baseURL = rule.URL
+	}
+
+	// 脚本中的 baseUrl 和 resolveUrl 同样以该地址为准
+	js := c.jsContext(context.Background(), baseURL)
+
+	compileErrors := make(map[string]string)
+	for _, issue := range result.Issues {
+		if issue.Severity == rules.SeverityError {
+			compileErrors[issue.Field] = issue.Message
+		}
+	}
+	field := func(path, raw string, sel *selector.Selector, s *goquery.Selection, attr string) FieldResult {
+		return FieldResult{
+			Field:    path,
+			Selector: raw,
+			Trace:    sel.Debug(s, attr, js),
+			Error:    compileErrors[path],
+		}
+	}
+
+	compiled := rule.Compiled
+	for _, stage := range stages {
+		switch stage {
+		case StageSearch:
+			search := &SearchPlayground{Result: field("search.result", rule.Search.Result, compiled.Search.Result, doc, "")}
+			compiled.Search.Result.Select(doc).EachWithBreak(func(i int, s *goquery.Selection) bool {
+				item := []FieldResult{
+					field("search.bookName", rule.Search.BookName, compiled.Search.BookName, s, ""),
+					field("search.author", rule.Search.Author, compiled.Search.Author, s, ""),
+					field("search.category", rule.Search.Category, compiled.Search.Category, s, ""),
+					field("search.wordCount", rule.Search.WordCount, compiled.Search.WordCount, s, ""),
+					field("search.status", rule.Search.Status, compiled.Search.Status, s, ""),
+					field("search.latestChapter", rule.Search.LatestChapter, compiled.Search.LatestChapter, s, ""),
+					field("search.lastUpdateTime", rule.Search.LastUpdateTime, compiled.Search.LastUpdateTime, s, ""),
+				}
+
+				// 书籍链接取 bookUrl 或书名选择器的 href 属性
+				link := field("url", rule.Search.BookName, compiled.Search.BookName, s, "href")
+				if rule.Search.BookURL != "" {
+					link = field("search.bookUrl", rule.Search.BookURL, compiled.Search.BookURL, s, "href")
+				}
+				if link.Value != "" {
+					link.Value = joinURL(baseURL, link.Value)
+				}
+				item = append(item, link)
+
+				search.Items = append(search.Items, configuredFields(item))
+				return len(search.Items) < playgroundMaxItems
+			})
+			result.Search = search
+
+		case StageBook:
+			result.Book = []FieldResult{
+				field("book.bookName", rule.Book.BookName, compiled.Book.BookName, doc, ""),
+				field("book.author", rule.Book.Author, compiled.Book.Author, doc, ""),
+				field("book.intro", rule.Book.Intro, compiled.Book.Intro, doc, ""),
+				field("book.category", rule.Book.Category, compiled.Book.Category, doc, ""),
+				field("book.coverUrl", rule.Book.CoverUrl, compiled.Book.CoverUrl, doc, "src"),
+				field("book.latestChapter", rule.Book.LatestChapter, compiled.Book.LatestChapter, doc, ""),
+				field("book.lastUpdateTime", rule.Book.LastUpdateTime, compiled.Book.LastUpdateTime, doc, ""),
+				field("book.status", rule.Book.Status, compiled.Book.Status, doc, ""),
+				field("book.wordCount", rule.Book.WordCount, compiled.Book.WordCount, doc, ""),
+			}
+			// 与解析书籍信息一致，封面没有 src 属性时取 content 属性
+			if cover := &result.Book[4]; cover.Value == "" && compiled.Book.CoverUrl != nil {
+				cover.Trace = compiled.Book.CoverUrl.Debug(doc, "content", js)
+			}
+			result.Book = configuredFields(result.Book)
+
+		case StageToc:
+			// 与下载时一致，章节链接相对于书源地址
+			tocRule := rule
+			if tocRule.URL == "" {
+				tocRule.URL = baseURL
+			}
+			chapters := tocChapters(doc, &tocRule, js)
+			toc := &TocPlayground{
+				Item:     field("toc.item", rule.Toc.Item, compiled.Toc.Item, doc, ""),
+				Total:    len(chapters),
+				Chapters: chapters,
+			}
+			// 目录项的文本是所有章节标题拼接，只保留匹配数量
+			toc.Item.Value = ""
+			if len(chapters) > playgroundMaxItems {
+				toc.Chapters = chapters[:playgroundMaxItems]
+			}
+			result.Toc = toc
+
+		case StageChapter:
+			chapter := &ChapterPlayground{
+				Title:   field("chapter.title", rule.Chapter.Title, compiled.Chapter.Title, doc, ""),
+				Content: field("chapter.content", rule.Chapter.Content, compiled.Chapter.Content, doc, ""),
+			}
+			chapter.Filtered = compiled.Chapter.Decoder.Decode(chapter.Content.Value)
+			if compiled.Chapter.FilterTxt != nil {
+				chapter.Filtered = compiled.Chapter.FilterTxt.ReplaceAllString(chapter.Filtered, "")
+			}
+			chapter.PrivateUse = charmap.Scan(chapter.Filtered)
+			result.Chapter = chapter
+		}
+	}
+
+	return result, nil
+}
+
+// configuredFields 去掉规则中未配置的字段
+func configuredFields(fields []FieldResult) []FieldResult {
+	var configured []FieldResult
+	for _, f := range fields {
+		if f.Selector != "" {
+			configured = append(configured, f)
+		}
+	}
+	return configured
+}
+
+// playgroundStages 确定要调试的阶段
+func playgroundStages(stage string, rule *model.Rule) ([]string, error) {
+	switch stage {
+	case StageSearch, StageBook, StageToc, StageChapter:
+		return []string{stage}, nil
+	case "":
+	default:
+		return nil, fmt.Errorf("不支持的阶段: %s", stage)
+	}
+
+	var stages []string
+	if rule.Search.Result != "" {
+		stages = append(stages, StageSearch)
+	}
+	// 只配置了请求头的详情页没有可调试的内容
+	book := rule.Book
+	book.Headers = nil
+	if !reflect.DeepEqual(book, model.BookRule{}) {
+		stages = append(stages, StageBook)
+	}
+	if rule.Toc.Item != "" {
+		stages = append(stages, StageToc)
+	}
+	if rule.Chapter.Content != "" || rule.Chapter.Title != "" {
+		stages = append(stages, StageChapter)
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("规则中没有可调试的选择器")
+	}
+	return stages, nil
+}
+
+// playgroundPage 获取要解析的页面，返回文档和实际请求的地址
+func (c *Crawler) playgroundPage(req PlaygroundRequest, rule *model.Rule) (*goquery.Selection, string, error) {
+	if req.HTML != "" {
+		doc, err := selector.ParseDocument([]byte(req.HTML), "")
+		if err != nil {
+			return nil, "", fmt.Errorf("解析HTML文档失败: %w", err)
+		}
+		return doc.Selection, req.URL, nil
+	}
+
+	var httpReq *http.Request
+	var err error
+	switch {
+	case req.URL != "":
+		// 详情页、目录和正文与下载时一样先登录
+		if req.Stage != StageSearch {
+			if _, _, err := c.ensureLogin(context.Background(), rule); err != nil {
+				return nil, "", err
+			}
+		}
+		httpReq, err = fetcher.Request{URL: req.URL, Header: ruleHeader(rule, req.Stage)}.Build(context.Background())
+	case req.Keyword != "" && rule.Search.URL != "":
+		httpReq, err = newSearchRequest(req.Keyword, 1, rule)
+	default:
+		return nil, "", fmt.Errorf("请提供URL、HTML或搜索关键词")
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	resp, err := c.fetcher.Do(httpReq)
+	if err != nil {
+		return nil, "", fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("请求失败，状态码: %d", resp.StatusCode)
+	}
+
+	doc, err := parseDocument(resp)
+	if err != nil {
+		return nil, "", fmt.Errorf("解析HTML文档失败: %w", err)
+	}
+	return doc.Selection, resp.Request.URL.String(), nil
+}
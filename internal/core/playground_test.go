@@ -0,0 +1,66 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"go-novel/internal/config"
+	"go-novel/internal/model"
+)
+
+const playgroundPage = `<html><head>
+<meta property="og:novel:book_name" content="诡秘之主">
+</head><body>
+<p class="author">作者：爱潜水的乌贼</p>
+<div id="list"><a href="/1/1.html">第一章</a><a href="/1/2.html">第二章</a></div>
+<div id="content">正文内容(本章完)</div>
+</body></html>`
+
+func TestPlayground(t *testing.T) {
+	crawler := NewCrawler(&config.Config{})
+
+	result, err := crawler.Playground(PlaygroundRequest{
+		Rule: model.Rule{
+			URL: "https://www.example.com/",
+			Book: model.BookRule{
+				BookName: `meta[property="og:novel:book_name"]`,
+				Author:   "p.author@js:r=r.replace('作者：', '')",
+				Intro:    "#intro@js:r=undefinedFunc(r)",
+			},
+			Toc:     model.TocRule{Item: "//div[@id='list']/a"},
+			Chapter: model.ChapterRule{Content: "#content", FilterTxt: `\(本章完\)`, Title: "h1["},
+		},
+		HTML: playgroundPage,
+	})
+	if err != nil {
+		t.Fatalf("调试规则失败: %v", err)
+	}
+
+	book := make(map[string]FieldResult)
+	for _, f := range result.Book {
+		book[f.Field] = f
+	}
+	if f := book["book.bookName"]; f.Value != "诡秘之主" || f.Kind != "meta" {
+		t.Errorf("书名提取结果不正确: %+v", f)
+	}
+	if f := book["book.author"]; f.Value != "爱潜水的乌贼" || f.BeforeJs != "作者：爱潜水的乌贼" || !f.Js {
+		t.Errorf("作者提取结果不正确: %+v", f)
+	}
+	if f := book["book.intro"]; f.JsError == "" {
+		t.Errorf("简介脚本出错时应返回错误信息: %+v", f)
+	}
+
+	if result.Toc == nil || result.Toc.Total != 2 || result.Toc.Item.Kind != "xpath" {
+		t.Fatalf("目录提取结果不正确: %+v", result.Toc)
+	}
+	if got := result.Toc.Chapters[1].URL; got != "https://www.example.com/1/2.html" {
+		t.Errorf("章节链接应转换为绝对地址，实际: %s", got)
+	}
+
+	if result.Chapter == nil || result.Chapter.Content.Value != "正文内容(本章完)" || result.Chapter.Filtered != "正文内容" {
+		t.Fatalf("正文过滤前后的结果不正确: %+v", result.Chapter)
+	}
+	if !strings.Contains(result.Chapter.Title.Error, "CSS选择器错误") {
+		t.Errorf("应返回选择器编译错误，实际: %+v", result.Chapter.Title)
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"fmt"
+
+	"go-novel/internal/sse"
+)
+
+// ProgressReporter 下载进度通知接口
+type ProgressReporter interface {
+	// Progress 章节下载进度
+	Progress(current, total int)
+	// Complete 书籍下载并保存完成
+	Complete(total int)
+	// Error 下载出错
+	Error(message string)
+}
+
+// sseReporter 通过SSE将进度发送到特定客户端，没有客户端时只输出到日志
+type sseReporter struct {
+	clientID string
+}
+
+// Progress 发送进度更新到特定客户端
+func (r *sseReporter) Progress(current, total int) {
+	// 发送进度到特定SSE客户端
+	sse.SendProgressToClient(r.clientID, current, total)
+
+	// 记录日志，方便调试
+	fmt.Printf("下载进度: %d/%d (%.2f%%)\n", current, total, float64(current)/float64(total)*100)
+}
+
+// Complete 发送最终完成进度到特定客户端
+func (r *sseReporter) Complete(total int) {
+	// 确保进度为100%
+	sse.SendProgressToClient(r.clientID, total, total)
+
+	// 发送下载完成消息，使用标准的SendComplete函数
+	sse.SendCompleteToClient(r.clientID, total)
+
+	// 记录日志
+	fmt.Printf("下载完成，总章节数: %d\n", total)
+}
+
+// Error 发送错误信息到特定客户端
+func (r *sseReporter) Error(message string) {
+	sse.SendErrorToClient(r.clientID, message)
+	fmt.Printf("下载错误: %s\n", message)
+}
+
+// SetProgressReporter 设置进度通知方式，默认通过SSE通知下载任务对应的客户端
+func (c *Crawler) SetProgressReporter(reporter ProgressReporter) {
+	c.reporter = reporter
+}
+
+// progressReporter 获取进度通知方式
+func (c *Crawler) progressReporter() ProgressReporter {
+	if c.reporter != nil {
+		return c.reporter
+	}
+
+	// 获取客户端ID，后台任务（如追更）没有客户端时进度只输出到日志
+	clientID := ""
+	if c.config.Download.DownloadId != "" {
+		clientID, _ = GetDownloadManager().GetClientID(c.config.Download.DownloadId)
+	}
+	return &sseReporter{clientID: clientID}
+}
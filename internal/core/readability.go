@@ -0,0 +1,404 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"go-novel/internal/model"
+	"go-novel/internal/rules"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const (
+	// inferMinChapters 同一格式的链接至少有这么多条才视为章节列表
+	inferMinChapters = 5
+	// inferMinContent 识别出的正文至少有这么多字
+	inferMinContent = 100
+	// inferSampleRunes 识别结果中正文示例的字数
+	inferSampleRunes = 200
+	// idAnchorDepth 带 id 的祖先在这么多层以内时，选择器总是以它为起点
+	idAnchorDepth = 3
+)
+
+// InferResult 自动识别的结果，Rule 可以直接用于下载，也可以保存为草稿规则
+type InferResult struct {
+	Rule         *model.Rule `json:"rule"`
+	Chapters     int         `json:"chapters"`     // 识别出的章节数
+	FirstChapter string      `json:"firstChapter"` // 用于识别正文的第一章地址
+	Sample       string      `json:"sample"`       // 第一章正文的开头
+}
+
+// InferRule 为没有规则的网站识别目录页的章节列表和章节页的正文，生成临时规则。
+// 章节列表为同一容器中链接格式相同的最长链接列表，正文为文字密度最高的元素
+func (c *Crawler) InferRule(tocUrl string) (*InferResult, error) {
+	doc, pageURL, err := c.inferPage(tocUrl)
+	if err != nil {
+		return nil, fmt.Errorf("请求目录页失败: %w", err)
+	}
+	item, links, relative, err := inferTocItem(doc, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	u, _ := url.Parse(pageURL)
+	rule := &model.Rule{
+		Name:    u.Host + " (自动识别)",
+		URL:     u.Scheme + "://" + u.Host + "/",
+		Comment: "自动识别生成的草稿规则，请检查后移动到激活的规则文件",
+		Search:  model.SearchRule{Disabled: true},
+		Book:    inferBook(doc),
+		Toc:     model.TocRule{Item: item},
+	}
+	// 章节链接为相对路径时相对于目录页
+	if relative {
+		rule.URL = pageURL
+	}
+
+	chapterDoc, _, err := c.inferPage(links[0])
+	if err != nil {
+		return nil, fmt.Errorf("请求第一章失败: %w", err)
+	}
+	if rule.Chapter.Content, err = inferContent(chapterDoc); err != nil {
+		return nil, err
+	}
+
+	// 临时规则没有ID，只检查具体字段（如 toc.item）的问题
+	for _, issue := range rules.Compile(rule) {
+		if issue.Severity == rules.SeverityError && strings.Contains(issue.Field, ".") {
+			return nil, fmt.Errorf("识别出的规则无效: %s", issue.Error())
+		}
+	}
+	content := rule.Compiled.Chapter.Content.Text(chapterDoc.Selection)
+	fmt.Printf("自动识别 %s: 目录 %s (%d 章)，正文 %s\n", pageURL, item, len(links), rule.Chapter.Content)
+
+	return &InferResult{
+		Rule:         rule,
+		Chapters:     len(links),
+		FirstChapter: links[0],
+		Sample:       truncateRunes(strings.TrimSpace(content), inferSampleRunes),
+	}, nil
+}
+
+// inferPage 请求页面并解析，返回文档和重定向后的地址
+func (c *Crawler) inferPage(pageUrl string) (*goquery.Document, string, error) {
+	resp, err := get(context.Background(), c.retryFetcher(), pageUrl, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+	doc, err := parseDocument(resp)
+	if err != nil {
+		return nil, "", err
+	}
+	return doc, resp.Request.URL.String(), nil
+}
+
+// inferBook 书籍信息优先使用小说网站常见的 og:novel 元数据，否则使用 h1 或页面标题
+func inferBook(doc *goquery.Document) model.BookRule {
+	meta := func(property string) string {
+		sel := `meta[property="` + property + `"]`
+		if doc.Find(sel).Length() > 0 {
+			return sel
+		}
+		return ""
+	}
+
+	book := model.BookRule{
+		BookName: meta("og:novel:book_name"),
+		Author:   meta("og:novel:author"),
+		Intro:    meta("og:description"),
+		Category: meta("og:novel:category"),
+		CoverUrl: meta("og:image"),
+		Status:   meta("og:novel:status"),
+	}
+	if book.BookName == "" {
+		book.BookName = "title"
+		if doc.Find("h1").Length() > 0 {
+			book.BookName = "h1[0]"
+		}
+	}
+	return book
+}
+
+// linkGroup 同一容器中格式相同的链接
+type linkGroup struct {
+	container *html.Node
+	pattern   string
+	parents   map[string]bool // 链接的父元素标签
+	hrefs     []string        // 去重后的绝对地址
+	relative  bool            // 是否有相对于当前目录的链接
+}
+
+// digitsPattern 链接格式中的数字部分
+var digitsPattern = regexp.MustCompile(`\d+`)
+
+// inferTocItem 识别章节列表，返回目录项选择器、章节地址和是否使用了相对路径
+func inferTocItem(doc *goquery.Document, pageURL string) (string, []string, bool, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	type groupKey struct {
+		container *html.Node
+		pattern   string
+	}
+	groups := make(map[groupKey]*linkGroup)
+	var order []*linkGroup
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href := strings.TrimSpace(s.AttrOr("href", ""))
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return
+		}
+		u, err := base.Parse(href)
+		if err != nil || u.Host != base.Host {
+			return
+		}
+		u.Fragment = ""
+		if u.Path == base.Path && u.RawQuery == base.RawQuery {
+			return
+		}
+
+		// 格式为数字替换为 0 的路径和查询参数名，如 /book/0/0.html、/read.php?bid&cid
+		pattern := digitsPattern.ReplaceAllString(u.Path, "0")
+		if query := u.Query(); len(query) > 0 {
+			pattern += "?" + strings.Join(slices.Sorted(maps.Keys(query)), "&")
+		}
+		n := s.Get(0)
+		key := groupKey{listContainer(n), pattern}
+		g := groups[key]
+		if g == nil {
+			g = &linkGroup{container: key.container, pattern: key.pattern, parents: make(map[string]bool)}
+			groups[key] = g
+			order = append(order, g)
+		}
+		if !slices.Contains(g.hrefs, u.String()) {
+			g.hrefs = append(g.hrefs, u.String())
+		}
+		g.parents[n.Parent.Data] = true
+		if !strings.HasPrefix(href, "/") && !strings.Contains(href, "://") {
+			g.relative = true
+		}
+	})
+
+	// 链接最多的一组，数量相同时取靠后的，目录页的完整列表通常在最新章节之后
+	var best *linkGroup
+	for _, g := range order {
+		if best == nil || len(g.hrefs) >= len(best.hrefs) {
+			best = g
+		}
+	}
+	if best == nil || len(best.hrefs) < inferMinChapters || best.container == nil {
+		return "", nil, false, fmt.Errorf("未能识别章节列表，页面中没有至少 %d 个格式相同的链接", inferMinChapters)
+	}
+
+	container := cssPath(doc, best.container)
+	item := container + " a"
+	// 容器中还有其他链接时，限定为章节链接所在的父元素
+	if doc.Find(item).Length() > len(best.hrefs) && len(best.parents) == 1 {
+		for parent := range best.parents {
+			if parent != best.container.Data {
+				item = container + " " + parent + " > a"
+			}
+		}
+	}
+	return item, best.hrefs, best.relative, nil
+}
+
+// listWrappers 列表项中包裹链接的元素
+var listWrappers = map[string]bool{
+	"li": true, "dd": true, "dt": true, "span": true, "td": true, "tr": true, "tbody": true,
+	"p": true, "b": true, "strong": true, "em": true, "i": true, "font": true,
+}
+
+// listContainer 链接所在的列表容器，跳过 li、dd 等包裹元素
+func listContainer(n *html.Node) *html.Node {
+	p := n.Parent
+	for p != nil && p.Type == html.ElementNode && listWrappers[p.Data] {
+		p = p.Parent
+	}
+	if p == nil || p.Type != html.ElementNode {
+		return nil
+	}
+	return p
+}
+
+// skipTags 不含正文的元素
+var skipTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "textarea": true, "option": true,
+	"a": true, "button": true, "select": true, "head": true, "title": true,
+}
+
+// paragraphTags 包裹正文段落的元素，其文字计入上一层容器
+var paragraphTags = map[string]bool{"p": true, "span": true, "font": true, "b": true, "strong": true, "em": true, "i": true}
+
+var (
+	// positiveNames id 或 class 中包含这些词的元素更可能是正文
+	positiveNames = regexp.MustCompile(`(?i)content|chapter|article|booktext|txt|text|read`)
+	// negativeNames id 或 class 中包含这些词的元素不太可能是正文
+	negativeNames = regexp.MustCompile(`(?i)nav|menu|header|footer|comment|sidebar|recommend|copyright|(^|[\s_-])ads?([\s_-]|$)`)
+)
+
+// inferContent 按文字密度识别正文所在的元素：每段文字计入所在的容器，
+// 段落中的中文标点额外加分，按链接文字的比例扣分，id 或 class 像正文时加分
+func inferContent(doc *goquery.Document) (string, error) {
+	scores := make(map[*html.Node]float64)
+	var order []*html.Node
+	for _, body := range doc.Find("body").Nodes {
+		var walk func(n *html.Node)
+		walk = func(n *html.Node) {
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				switch child.Type {
+				case html.ElementNode:
+					if !skipTags[child.Data] {
+						walk(child)
+					}
+				case html.TextNode:
+					text := strings.TrimSpace(child.Data)
+					if utf8.RuneCountInString(text) < 10 {
+						continue
+					}
+					container := n
+					if paragraphTags[container.Data] && container.Parent != nil {
+						container = container.Parent
+					}
+					if _, ok := scores[container]; !ok {
+						order = append(order, container)
+					}
+					scores[container] += float64(utf8.RuneCountInString(text) + 2*strings.Count(text, "，") + 2*strings.Count(text, "。"))
+				}
+			}
+		}
+		walk(body)
+	}
+
+	var best *html.Node
+	var bestScore float64
+	for _, n := range order {
+		s := goquery.NewDocumentFromNode(n).Selection
+		total := utf8.RuneCountInString(s.Text())
+		links := utf8.RuneCountInString(s.Find("a").Text())
+		score := scores[n]
+		if total > 0 {
+			score *= 1 - float64(links)/float64(total)
+		}
+		names := s.AttrOr("id", "") + " " + s.AttrOr("class", "")
+		if positiveNames.MatchString(names) {
+			score *= 1.25
+		}
+		if negativeNames.MatchString(names) {
+			score *= 0.5
+		}
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil || scores[best] < inferMinContent {
+		return "", fmt.Errorf("未能识别正文，页面中没有足够长的文字")
+	}
+	return cssPath(doc, best), nil
+}
+
+// identPattern 可以直接用于CSS选择器的 id 和 class
+var identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// cssPath 生成能唯一选中元素的CSS选择器：从元素向上直到带 id 的祖先，附近有 id 时以它为起点，
+// 否则取最短的路径，优先使用标签和 class，仍不唯一时加上 :nth-of-type
+func cssPath(doc *goquery.Document, n *html.Node) string {
+	var plain, indexed []string
+	for cur := n; cur != nil && cur.Type == html.ElementNode; cur = cur.Parent {
+		if id := attrValue(cur, "id"); identPattern.MatchString(id) {
+			plain = append(plain, "#"+id)
+			indexed = append(indexed, "#"+id)
+			break
+		}
+		segment := cur.Data
+		for _, class := range strings.Fields(attrValue(cur, "class")) {
+			if identPattern.MatchString(class) {
+				segment += "." + class
+			}
+		}
+		plain = append(plain, segment)
+		if index, count := typeIndex(cur); count > 1 {
+			segment += fmt.Sprintf(":nth-of-type(%d)", index)
+		}
+		indexed = append(indexed, segment)
+		if cur.Data == "body" {
+			break
+		}
+	}
+
+	unique := func(sel string) bool {
+		matched := doc.Find(sel)
+		return matched.Length() == 1 && matched.Get(0) == n
+	}
+	// 附近有带 id 的祖先时以它为起点，比只用标签名的路径更稳定
+	if last := plain[len(plain)-1]; strings.HasPrefix(last, "#") && len(plain) <= idAnchorDepth {
+		parts := slices.Clone(plain)
+		slices.Reverse(parts)
+		if sel := strings.Join(parts, " > "); unique(sel) {
+			return sel
+		}
+	}
+
+	for _, segments := range [][]string{plain, indexed} {
+		for i := 1; i <= len(segments); i++ {
+			parts := slices.Clone(segments[:i])
+			slices.Reverse(parts)
+			sel := strings.Join(parts, " > ")
+			if unique(sel) {
+				return sel
+			}
+		}
+	}
+	parts := slices.Clone(indexed)
+	slices.Reverse(parts)
+	return strings.Join(parts, " > ")
+}
+
+// typeIndex 元素在同类型兄弟元素中的位置，从 1 开始，以及同类型兄弟元素的数量
+func typeIndex(n *html.Node) (index, count int) {
+	if n.Parent == nil {
+		return 1, 1
+	}
+	for sibling := n.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		if sibling.Type == html.ElementNode && sibling.Data == n.Data {
+			count++
+			if sibling == n {
+				index = count
+			}
+		}
+	}
+	return index, count
+}
+
+// attrValue 返回元素的属性值
+func attrValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// truncateRunes 截取前 n 个字
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+	"net/http"
+
+	"go-novel/internal/fetcher"
+	"go-novel/internal/model"
+)
+
+// ruleHeader 合并规则和阶段的请求头，阶段中的同名项优先，stage 为空时只使用规则的请求头。
+// 请求头中的 User-Agent 会替代随机 User-Agent
+func ruleHeader(rule *model.Rule, stage string) http.Header {
+	var stageHeaders map[string]string
+	switch stage {
+	case StageSearch:
+		stageHeaders = rule.Search.Headers
+	case StageBook:
+		stageHeaders = rule.Book.Headers
+	case StageToc:
+		stageHeaders = rule.Toc.Headers
+	case StageChapter:
+		stageHeaders = rule.Chapter.Headers
+	case stageLogin:
+		if rule.Login != nil {
+			stageHeaders = rule.Login.Headers
+		}
+	}
+	if len(rule.Headers) == 0 && len(stageHeaders) == 0 {
+		return nil
+	}
+
+	header := make(http.Header)
+	for _, headers := range []map[string]string{rule.Headers, stageHeaders} {
+		for key, value := range headers {
+			header.Set(key, value)
+		}
+	}
+	return header
+}
+
+// get 发起带有请求头的GET请求
+func get(ctx context.Context, f fetcher.Fetcher, url string, header http.Header) (*http.Response, error) {
+	req, err := fetcher.Request{URL: url, Header: header}.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return f.Do(req)
+}
@@ -1,16 +1,21 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"go-novel/internal/config"
+	"go-novel/internal/fetcher"
 	"go-novel/internal/model"
 	"go-novel/internal/rules"
+	"go-novel/internal/selector"
+	"go-novel/internal/urltemplate"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -25,9 +30,9 @@ func (c *Crawler) Search(keyword string) ([]model.SearchResult, error) {
 		return c.aggregatedSearch(keyword)
 	}
 
-	// 加载规则
+	// 加载规则，多个规则文件时为第一个文件中的书源
 	ruleManager := rules.GetRuleManager()
-	rule, err := ruleManager.GetRuleById(c.config.Source.ActiveRules, sourceId)
+	rule, err := ruleManager.GetRuleById(c.config.Source.PrimaryRules(), sourceId)
 	if err != nil {
 		return nil, fmt.Errorf("无法加载规则: %w", err)
 	}
@@ -62,7 +67,7 @@ func (c *Crawler) aggregatedSearch(keyword string) ([]model.SearchResult, error)
 	ruleManager := rules.GetRuleManager()
 
 	// 获取可搜索的规则
-	searchableRules, err := ruleManager.GetSearchableRules(c.config.Source.ActiveRules)
+	searchableRules, err := ruleManager.GetSearchableRules(c.config.Source.RuleFiles()...)
 	if err != nil {
 		return nil, fmt.Errorf("加载可搜索规则失败: %w", err)
 	}
@@ -85,9 +90,10 @@ func (c *Crawler) aggregatedSearch(keyword string) ([]model.SearchResult, error)
 			}()
 
 			// 创建新的爬虫实例用于这个源的搜索
-			searchCfg := *c.config // 复制配置
+			searchCfg := c.config.Copy() // 复制配置
+			searchCfg.Source.ActiveRules = rule.File
 			searchCfg.Source.SourceId = rule.ID
-			searchCrawler := NewCrawler(&searchCfg)
+			searchCrawler := NewCrawler(&searchCfg, WithFetcher(c.fetcher))
 
 			// 执行搜索
 			searchResults, err := searchCrawler.doSearch(keyword, &rule)
@@ -125,53 +131,17 @@ func (c *Crawler) aggregatedSearch(keyword string) ([]model.SearchResult, error)
 func (c *Crawler) doSearch(keyword string, rule *model.Rule) ([]model.SearchResult, error) {
 	searchRule := rule.Search
 
-	// 构建请求URL
-	var requestURL string
-	if strings.ToLower(searchRule.Method) == "get" {
-		// GET请求需要对关键字进行URL编码
-		encodedKeyword := url.QueryEscape(keyword)
-		requestURL = strings.ReplaceAll(searchRule.URL, "%s", encodedKeyword)
-	} else {
-		// POST请求直接替换
-		requestURL = strings.ReplaceAll(searchRule.URL, "%s", keyword)
+	req, err := newSearchRequest(keyword, 1, rule)
+	if err != nil {
+		return nil, err
 	}
 
 	// 添加详细日志
-	fmt.Printf("搜索源 %s (%d) 开始请求: %s [方法: %s]\n", rule.Name, rule.ID, requestURL, searchRule.Method)
+	fmt.Printf("搜索源 %s (%d) 开始请求: %s [方法: %s]\n", rule.Name, rule.ID, req.URL, searchRule.Method)
 	start := time.Now()
 
-	// 创建请求
-	var req *http.Request
-	var err error
-
-	if strings.ToLower(searchRule.Method) == "post" {
-		// 处理POST请求
-		data := BuildSearchPostData(searchRule.Data, keyword)
-		req, err = http.NewRequest("POST", requestURL, strings.NewReader(data))
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	} else {
-		// 处理GET请求
-		req, err = http.NewRequest("GET", requestURL, nil)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// 设置默认User-Agent（如果未设置）
-	if req.Header.Get("User-Agent") == "" {
-		req.Header.Set("User-Agent", randomUserAgent())
-	}
-
-	// 设置Cookies（如果规则中有指定）
-	if searchRule.Cookies != "" {
-		req.Header.Set("Cookie", searchRule.Cookies)
-	}
-
 	// 发起请求
-	resp, err := c.client.Do(req)
+	resp, err := c.fetcher.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("请求失败: %w", err)
 	}
@@ -190,11 +160,97 @@ func (c *Crawler) doSearch(keyword string, rule *model.Rule) ([]model.SearchResu
 		return nil, fmt.Errorf("解析搜索结果失败: %w", err)
 	}
 
+	// 搜索URL或请求参数中使用了 {{page}} 时按页码翻页，否则在解析时按下一页链接翻页
+	if searchRule.Pagination && len(searchResults) > 0 && rules.SearchUsesPage(compiledRule(rule)) {
+		searchResults = append(searchResults, c.searchPages(keyword, rule, searchResults)...)
+	}
+
 	fmt.Printf("搜索源 %s (%d) 解析到 %d 条结果\n", rule.Name, rule.ID, len(searchResults))
 
 	return searchResults, nil
 }
 
+// maxSearchPages 搜索翻页时最多额外请求的页数
+const maxSearchPages = 3
+
+// searchVars 搜索URL和请求参数模板的变量
+func searchVars(keyword string, page int) urltemplate.Vars {
+	return urltemplate.Vars{"keyword": keyword, "page": strconv.Itoa(page)}
+}
+
+// newSearchRequest 根据搜索规则构建第 page 页的请求，page 从1开始
+func newSearchRequest(keyword string, page int, rule *model.Rule) (*http.Request, error) {
+	searchRule := rule.Search
+	compiled := compiledRule(rule)
+	vars := searchVars(keyword, page)
+
+	// 构建请求URL，关键词按URL模板中的过滤器编码，默认为UTF-8
+	if compiled.Search.URL == nil {
+		return nil, fmt.Errorf("搜索URL模板无效: %s", searchRule.URL)
+	}
+	requestURL, err := compiled.Search.URL.Execute(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// 设置请求头和Cookies（如果规则中有指定），未指定 User-Agent 时由 Fetcher 设置
+	req := fetcher.Request{URL: requestURL, Header: ruleHeader(rule, StageSearch), Cookie: searchRule.Cookies}
+	if strings.ToLower(searchRule.Method) == "post" {
+		req.Method = http.MethodPost
+		if req.Body, req.ContentType, err = buildRequestBody(searchRule.Data, searchRule.BodyType, vars); err != nil {
+			return nil, err
+		}
+	}
+
+	return req.Build(context.Background())
+}
+
+// searchPages 按页码请求第2页起的搜索结果，某页没有新结果时停止
+func (c *Crawler) searchPages(keyword string, rule *model.Rule, first []model.SearchResult) []model.SearchResult {
+	seen := make(map[string]bool)
+	for _, result := range first {
+		seen[result.URL] = true
+	}
+
+	var results []model.SearchResult
+	for page := 2; page <= maxSearchPages+1; page++ {
+		req, err := newSearchRequest(keyword, page, rule)
+		if err != nil {
+			fmt.Printf("Debug: 创建分页请求失败: %v\n", err)
+			break
+		}
+		resp, err := c.fetcher.Do(req)
+		if err != nil {
+			fmt.Printf("Debug: 分页请求失败: %v\n", err)
+			break
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			break
+		}
+		pageResults, err := c.parseSearchResultsInternal(resp, rule, keyword, false)
+		resp.Body.Close()
+		if err != nil {
+			fmt.Printf("Debug: 解析分页结果失败: %v\n", err)
+			break
+		}
+
+		// 超出页数时部分站点返回空列表或重复最后一页
+		fresh := 0
+		for _, result := range pageResults {
+			if !seen[result.URL] {
+				seen[result.URL] = true
+				results = append(results, result)
+				fresh++
+			}
+		}
+		if fresh == 0 {
+			break
+		}
+	}
+	return results
+}
+
 // parseSearchResults 解析搜索结果
 func (c *Crawler) parseSearchResults(resp *http.Response, rule *model.Rule, keyword string) ([]model.SearchResult, error) {
 	return c.parseSearchResultsInternal(resp, rule, keyword, true)
@@ -208,28 +264,25 @@ func (c *Crawler) parseSearchResultsInternal(resp *http.Response, rule *model.Ru
 		return nil, fmt.Errorf("读取响应失败: %w", err)
 	}
 
-	// 将响应体转换为字符串
-	bodyStr := string(bodyBytes)
-
-	// 重新创建一个io.Reader以便goquery可以读取
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(bodyStr))
+	// JSON接口的响应转换为节点树，以便使用 JSONPath
+	doc, err := selector.ParseDocument(bodyBytes, resp.Header.Get("Content-Type"))
 	if err != nil {
 		return nil, fmt.Errorf("解析HTML文档失败: %w", err)
 	}
 
 	// 获取搜索规则
 	searchRule := rule.Search
+	compiled := compiledRule(rule)
 
 	// 选择搜索结果元素
-	resultElements := doc.Find(searchRule.Result)
+	resultElements := compiled.Search.Result.Select(doc.Selection)
 	// fmt.Printf("Debug: 选择器'%s'匹配到%d个元素\n", searchRule.Result, resultElements.Length())
 
 	// 特殊处理：部分书源完全匹配时会直接跳转到详情页（搜索结果为空 && 书名不为空）
 	if resultElements.Length() == 0 && searchRule.BookName != "" {
 		// 检查页面是否包含书籍信息选择器
-		bookNameSel := rule.Book.BookName
-		if bookNameSel != "" {
-			bookNameElements := doc.Find(bookNameSel)
+		if rule.Book.BookName != "" {
+			bookNameElements := compiled.Book.BookName.Select(doc.Selection)
 			if bookNameElements.Length() > 0 {
 				fmt.Printf("Debug: 检测到直接跳转到详情页的情况\n")
 
@@ -241,27 +294,28 @@ func (c *Crawler) parseSearchResultsInternal(resp *http.Response, rule *model.Ru
 				if bookName != "" {
 					result := model.SearchResult{
 						SourceId: rule.ID,
+						Source:   config.QualifiedSourceId(rule.File, rule.ID),
 						URL:      bookUrl,
 						BookName: bookName,
 					}
 
 					// 提取其他书籍信息
 					if rule.Book.Author != "" {
-						authorElements := doc.Find(rule.Book.Author)
+						authorElements := compiled.Book.Author.Select(doc.Selection)
 						if authorElements.Length() > 0 {
 							result.Author = strings.TrimSpace(authorElements.First().Text())
 						}
 					}
 
 					if rule.Book.LatestChapter != "" {
-						latestChapterElements := doc.Find(rule.Book.LatestChapter)
+						latestChapterElements := compiled.Book.LatestChapter.Select(doc.Selection)
 						if latestChapterElements.Length() > 0 {
 							result.LatestChapter = strings.TrimSpace(latestChapterElements.First().Text())
 						}
 					}
 
 					if rule.Book.LastUpdateTime != "" {
-						lastUpdateTimeElements := doc.Find(rule.Book.LastUpdateTime)
+						lastUpdateTimeElements := compiled.Book.LastUpdateTime.Select(doc.Selection)
 						if lastUpdateTimeElements.Length() > 0 {
 							result.LastUpdateTime = strings.TrimSpace(lastUpdateTimeElements.First().Text())
 						}
@@ -276,15 +330,17 @@ func (c *Crawler) parseSearchResultsInternal(resp *http.Response, rule *model.Ru
 
 	// 提取搜索结果
 	var results []model.SearchResult
+	js := c.jsContext(resp.Request.Context(), resp.Request.URL.String())
 	resultElements.Each(func(i int, s *goquery.Selection) {
 		result := model.SearchResult{
 			SourceId: rule.ID,
+			Source:   config.QualifiedSourceId(rule.File, rule.ID),
 		}
 
 		// 提取书籍信息
 		if searchRule.BookName != "" {
 			// 提取书名
-			bookName := c.extractText(s, searchRule.BookName)
+			bookName := compiled.Search.BookName.TextWith(s, js)
 			result.BookName = strings.TrimSpace(bookName)
 		}
 
@@ -295,44 +351,48 @@ func (c *Crawler) parseSearchResultsInternal(resp *http.Response, rule *model.Ru
 
 		// 提取作者
 		if searchRule.Author != "" {
-			author := c.extractText(s, searchRule.Author)
+			author := compiled.Search.Author.TextWith(s, js)
 			result.Author = strings.TrimSpace(author)
 		}
 
 		// 提取类别
 		if searchRule.Category != "" {
-			category := c.extractText(s, searchRule.Category)
+			category := compiled.Search.Category.TextWith(s, js)
 			result.Category = strings.TrimSpace(category)
 		}
 
 		// 提取字数
 		if searchRule.WordCount != "" {
-			wordCount := c.extractText(s, searchRule.WordCount)
+			wordCount := compiled.Search.WordCount.TextWith(s, js)
 			result.WordCount = strings.TrimSpace(wordCount)
 		}
 
 		// 提取状态
 		if searchRule.Status != "" {
-			status := c.extractText(s, searchRule.Status)
+			status := compiled.Search.Status.TextWith(s, js)
 			result.Status = strings.TrimSpace(status)
 		}
 
 		// 提取最新章节
 		if searchRule.LatestChapter != "" {
-			latestChapter := c.extractText(s, searchRule.LatestChapter)
+			latestChapter := compiled.Search.LatestChapter.TextWith(s, js)
 			result.LatestChapter = strings.TrimSpace(latestChapter)
 		}
 
 		// 提取最后更新时间
 		if searchRule.LastUpdateTime != "" {
-			lastUpdateTime := c.extractText(s, searchRule.LastUpdateTime)
+			lastUpdateTime := compiled.Search.LastUpdateTime.TextWith(s, js)
 			result.LastUpdateTime = strings.TrimSpace(lastUpdateTime)
 		}
 
-		// 提取书籍链接
-		if searchRule.BookName != "" {
+		// 提取书籍链接，未配置 bookUrl 时取书名元素的 href 属性
+		linkSelector := compiled.Search.BookName
+		if compiled.Search.BookURL != nil {
+			linkSelector = compiled.Search.BookURL
+		}
+		if linkSelector != nil {
 			// 尝试提取href属性并转换为绝对URL
-			bookURL := c.extractAbsAttr(s, searchRule.BookName, "href", resp.Request.URL.String())
+			bookURL := c.extractAbsAttr(s, linkSelector, "href", resp.Request.URL.String())
 			if bookURL != "" {
 				result.URL = bookURL
 			}
@@ -347,9 +407,9 @@ func (c *Crawler) parseSearchResultsInternal(resp *http.Response, rule *model.Ru
 	})
 
 	// 处理分页（仅在允许分页时处理）
-	if allowPagination && searchRule.Pagination && searchRule.NextPage != "" {
+	if allowPagination && searchRule.Pagination && searchRule.NextPage != "" && !rules.SearchUsesPage(compiled) {
 		// 提取分页链接
-		nextPageElements := doc.Find(searchRule.NextPage)
+		nextPageElements := compiled.Search.NextPage.Select(doc.Selection)
 		if nextPageElements.Length() > 0 {
 			fmt.Printf("Debug: 找到 %d 个分页链接\n", nextPageElements.Length())
 
@@ -373,9 +433,8 @@ func (c *Crawler) parseSearchResultsInternal(resp *http.Response, rule *model.Ru
 			})
 
 			// 限制分页数量，避免过多请求
-			maxPages := 3
-			if len(pageURLs) > maxPages {
-				pageURLs = pageURLs[:maxPages]
+			if len(pageURLs) > maxSearchPages {
+				pageURLs = pageURLs[:maxSearchPages]
 			}
 
 			// 逐个请求分页并解析结果（不允许再次分页）
@@ -383,18 +442,14 @@ func (c *Crawler) parseSearchResultsInternal(resp *http.Response, rule *model.Ru
 				// fmt.Printf("Debug: 请求分页: %s\n", pageURL)
 
 				// 创建分页请求
-				pageReq, err := http.NewRequest("GET", pageURL, nil)
+				pageReq, err := fetcher.Request{URL: pageURL, Header: ruleHeader(rule, StageSearch), Referer: resp.Request.URL.String()}.Build(context.Background())
 				if err != nil {
 					fmt.Printf("Debug: 创建分页请求失败: %v\n", err)
 					continue
 				}
 
-				// 设置请求头
-				pageReq.Header.Set("User-Agent", randomUserAgent())
-				pageReq.Header.Set("Referer", resp.Request.URL.String())
-
 				// 发送请求
-				pageResp, err := c.client.Do(pageReq)
+				pageResp, err := c.fetcher.Do(pageReq)
 				if err != nil {
 					fmt.Printf("Debug: 分页请求失败: %v\n", err)
 					continue
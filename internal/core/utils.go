@@ -1,28 +1,11 @@
 package core
 
 import (
-	"fmt"
-	"math/rand"
 	"net/url"
 	"strconv"
 	"strings"
-
-	"go-novel/internal/sse"
 )
 
-// randomUserAgent 生成随机User-Agent
-func randomUserAgent() string {
-	userAgents := []string{
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:89.0) Gecko/20100101 Firefox/89.0",
-		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.1 Safari/605.1.15",
-		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36 Edg/91.0.864.59",
-		"Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.0 Mobile/15E148 Safari/604.1",
-	}
-
-	return userAgents[rand.Intn(len(userAgents))]
-}
-
 // joinURL 连接基础URL和相对URL
 func joinURL(baseURL, relativeURL string) string {
 	// 解析基础URL
@@ -41,33 +24,6 @@ func joinURL(baseURL, relativeURL string) string {
 	return base.ResolveReference(rel).String()
 }
 
-// sendProgress 发送进度更新到特定客户端
-func sendProgressToClient(clientID string, current, total int) {
-	// 发送进度到特定SSE客户端
-	sse.SendProgressToClient(clientID, current, total)
-
-	// 记录日志，方便调试
-	fmt.Printf("下载进度: %d/%d (%.2f%%)\n", current, total, float64(current)/float64(total)*100)
-}
-
-// sendFinalProgressToClient 发送最终完成进度到特定客户端
-func sendFinalProgressToClient(clientID string, total int) {
-	// 确保进度为100%
-	sse.SendProgressToClient(clientID, total, total)
-
-	// 发送下载完成消息，使用标准的SendComplete函数
-	sse.SendCompleteToClient(clientID, total)
-
-	// 记录日志
-	fmt.Printf("下载完成，总章节数: %d\n", total)
-}
-
-// sendErrorToClient 发送错误信息到特定客户端
-func sendErrorToClient(clientID, message string) {
-	sse.SendErrorToClient(clientID, message)
-	fmt.Printf("下载错误: %s\n", message)
-}
-
 // getSourceIdFromUrl 从URL中提取源ID
 func getSourceIdFromUrl(bookUrl string) int {
 	// 查找URL中的sourceId参数
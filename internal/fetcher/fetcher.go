@@ -0,0 +1,160 @@
+// Package fetcher 发起HTTP请求：构建请求、可替换的传输，以及 User-Agent、重试、日志等中间件
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Fetcher 发起HTTP请求，*http.Client 即是一个 Fetcher
+type Fetcher interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Func 将函数转换为 Fetcher
+type Func func(req *http.Request) (*http.Response, error)
+
+// Do 调用函数本身
+func (f Func) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware 包装 Fetcher，在请求前后添加处理
+type Middleware func(next Fetcher) Fetcher
+
+// Chain 用中间件包装 Fetcher，第一个中间件在最外层，最先处理请求
+func Chain(f Fetcher, middlewares ...Middleware) Fetcher {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		f = middlewares[i](f)
+	}
+	return f
+}
+
+// options 创建 Fetcher 的选项
+type options struct {
+	transport   http.RoundTripper
+	timeout     time.Duration
+	jar         http.CookieJar
+	middlewares []Middleware
+}
+
+// Option 创建 Fetcher 的选项
+type Option func(*options)
+
+// WithTransport 使用指定的 http.RoundTripper，如 httptest 服务器的客户端传输或录制回放传输
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+// WithTimeout 设置单次请求的超时时间，包括读取响应体
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithCookieJar 使用 Cookie jar 保存响应中的 Cookie，重定向时同样生效
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(o *options) {
+		o.jar = jar
+	}
+}
+
+// WithMiddleware 追加中间件，按添加顺序由外到内执行
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// New 创建基于 http.Client 的 Fetcher，未指定传输时使用 http.DefaultTransport
+func New(opts ...Option) Fetcher {
+	o := options{transport: http.DefaultTransport}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	client := &http.Client{
+		Transport: o.transport,
+		Timeout:   o.timeout,
+		Jar:       o.jar,
+	}
+	return Chain(client, o.middlewares...)
+}
+
+// NewTransport 创建HTTP传输，proxyURL 不为空时通过该代理发起请求
+func NewTransport(proxyURL string) (http.RoundTripper, error) {
+	if proxyURL == "" {
+		return http.DefaultTransport, nil
+	}
+	proxy, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("代理地址无效: %w", err)
+	}
+	return &http.Transport{Proxy: http.ProxyURL(proxy)}, nil
+}
+
+// Request 请求描述，通过 Build 构建 *http.Request
+type Request struct {
+	Method      string // 为空时为 GET
+	URL         string
+	Body        string
+	ContentType string // 有请求体且为空时为 application/x-www-form-urlencoded
+	Header      http.Header
+	Referer     string
+	Cookie      string
+}
+
+// Build 构建请求，请求体可重复读取，以便重试
+func (r Request) Build(ctx context.Context) (*http.Request, error) {
+	method := strings.ToUpper(r.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var req *http.Request
+	var err error
+	if r.Body != "" {
+		req, err = http.NewRequestWithContext(ctx, method, r.URL, strings.NewReader(r.Body))
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, r.URL, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range r.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if r.Body != "" && req.Header.Get("Content-Type") == "" {
+		contentType := r.ContentType
+		if contentType == "" {
+			contentType = "application/x-www-form-urlencoded"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	if r.Referer != "" {
+		req.Header.Set("Referer", r.Referer)
+	}
+	if r.Cookie != "" {
+		req.Header.Set("Cookie", r.Cookie)
+	}
+	return req, nil
+}
+
+// Get 发起GET请求
+func Get(ctx context.Context, f Fetcher, url string) (*http.Response, error) {
+	req, err := Request{URL: url}.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return f.Do(req)
+}
@@ -0,0 +1,131 @@
+package fetcher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "abc"})
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/flaky":
+			// 前两次请求失败，第三次成功，请求体在重试时应保持不变
+			body, _ := io.ReadAll(r.Body)
+			if requests.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write(body)
+		default:
+			cookie, _ := r.Cookie("token")
+			if cookie != nil {
+				io.WriteString(w, r.UserAgent()+" "+cookie.Value)
+			} else {
+				io.WriteString(w, r.UserAgent())
+			}
+		}
+	}))
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	f := New(
+		WithTransport(server.Client().Transport),
+		WithCookieJar(jar),
+		WithMiddleware(UserAgent(func() string { return "test-agent" })),
+	)
+	read := func(resp *http.Response, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// 重定向时保存 Cookie，后续请求自动带上
+	if got := read(Get(context.Background(), f, server.URL+"/login")); got != "test-agent abc" {
+		t.Errorf("User-Agent 或 Cookie 不正确: %q", got)
+	}
+
+	// 请求中已设置的 User-Agent 不被覆盖
+	req, _ := Request{URL: server.URL, Header: http.Header{"User-Agent": {"custom"}}}.Build(context.Background())
+	if got := read(f.Do(req)); got != "custom abc" {
+		t.Errorf("请求中的 User-Agent 被覆盖: %q", got)
+	}
+
+	retry := Retry(RetryPolicy{MaxRetries: 3, MinInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond})(f)
+	req, _ = Request{Method: "post", URL: server.URL + "/flaky", Body: "q=仙逆"}.Build(context.Background())
+	if got := read(retry.Do(req)); got != "q=仙逆" {
+		t.Errorf("重试后的响应不正确: %q", got)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("期望请求 3 次，实际 %d 次", n)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	var requests atomic.Int32
+	failing := Func(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return &http.Response{StatusCode: http.StatusBadGateway, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	retry := Retry(RetryPolicy{MaxRetries: 5, MinInterval: time.Hour})(failing)
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err := Get(ctx, retry, "http://www.example.com/"); err != context.Canceled {
+		t.Errorf("期望返回 context.Canceled，实际 %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("取消后不应继续重试，实际请求 %d 次", n)
+	}
+
+	// 重试用尽后返回最后一次的响应
+	retry = Retry(RetryPolicy{MaxRetries: 2})(failing)
+	resp, err := Get(context.Background(), retry, "http://www.example.com/")
+	if err != nil || resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("重试用尽后应返回最后一次的响应: %v %v", resp, err)
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("期望共请求 4 次，实际 %d 次", n)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ok := Func(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+	limited := RateLimit(20 * time.Millisecond)(ok)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := Get(context.Background(), limited, "http://www.example.com/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("3 次请求至少间隔 40ms，实际 %v", elapsed)
+	}
+
+	// 等待期间取消请求
+	limited = RateLimit(time.Hour)(ok)
+	Get(context.Background(), limited, "http://www.example.com/")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := Get(ctx, limited, "http://www.example.com/"); err != context.Canceled {
+		t.Errorf("期望返回 context.Canceled，实际 %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package fetcher
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// userAgents 常见浏览器的 User-Agent
+var userAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:89.0) Gecko/20100101 Firefox/89.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.1 Safari/605.1.15",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36 Edg/91.0.864.59",
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.0 Mobile/15E148 Safari/604.1",
+}
+
+// RandomUserAgent 随机返回一个浏览器 User-Agent
+func RandomUserAgent() string {
+	return userAgents[rand.Intn(len(userAgents))]
+}
+
+// UserAgent 请求未设置 User-Agent 时使用 ua 返回的值
+func UserAgent(ua func() string) Middleware {
+	return func(next Fetcher) Fetcher {
+		return Func(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("User-Agent") == "" {
+				req = req.Clone(req.Context())
+				req.Header.Set("User-Agent", ua())
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+// RetryPolicy 重试策略，每次重试前等待 MinInterval 到 MaxInterval 之间的随机时间
+type RetryPolicy struct {
+	MaxRetries  int
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+// Retry 请求出错或状态码不是200时按策略重试，等待期间请求的 context 取消则立即返回。
+// 重试用尽后返回最后一次的响应，由调用方检查状态码
+func Retry(policy RetryPolicy) Middleware {
+	return func(next Fetcher) Fetcher {
+		return Func(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Do(req)
+			for i := 0; i < policy.MaxRetries; i++ {
+				if err == nil && resp.StatusCode == http.StatusOK {
+					return resp, nil
+				}
+				if resp != nil {
+					resp.Body.Close()
+				}
+
+				interval := policy.MinInterval
+				if policy.MaxInterval > policy.MinInterval {
+					interval += time.Duration(rand.Int63n(int64(policy.MaxInterval - policy.MinInterval)))
+				}
+				timer := time.NewTimer(interval)
+				select {
+				case <-timer.C:
+				case <-req.Context().Done():
+					timer.Stop()
+					return nil, req.Context().Err()
+				}
+
+				fmt.Printf("重试请求 %s (第 %d/%d 次)\n", req.URL, i+1, policy.MaxRetries)
+
+				// 请求体已被读取，重新获取后再发送
+				retry := req.Clone(req.Context())
+				if req.GetBody != nil {
+					if retry.Body, err = req.GetBody(); err != nil {
+						return nil, err
+					}
+				}
+				resp, err = next.Do(retry)
+			}
+
+			if err != nil && policy.MaxRetries > 0 {
+				return nil, fmt.Errorf("请求失败，已重试%d次: %w", policy.MaxRetries, err)
+			}
+			return resp, err
+		})
+	}
+}
+
+// Logging 输出失败的请求：请求出错或状态码不是2xx
+func Logging() Middleware {
+	return func(next Fetcher) Fetcher {
+		return Func(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+			if err != nil {
+				fmt.Printf("请求失败 %s %s: %v\n", req.Method, req.URL, err)
+			} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				fmt.Printf("请求失败 %s %s: 状态码 %d，耗时 %v\n", req.Method, req.URL, resp.StatusCode, time.Since(start))
+			}
+			return resp, err
+		})
+	}
+}
+
+// RateLimit 限制请求频率，相邻两次请求的发出时间至少间隔 interval，interval 不大于 0 时不限制。
+// 等待期间请求的 context 取消则立即返回
+func RateLimit(interval time.Duration) Middleware {
+	var mu sync.Mutex
+	var next time.Time
+	return func(f Fetcher) Fetcher {
+		if interval <= 0 {
+			return f
+		}
+		return Func(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			now := time.Now()
+			wait := max(next.Sub(now), 0)
+			next = now.Add(wait + interval)
+			mu.Unlock()
+
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-req.Context().Done():
+					timer.Stop()
+					return nil, req.Context().Err()
+				}
+			}
+			return f.Do(req)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Package fixture 录制书源页面并离线回放，用于规则和解析逻辑的回归测试
+package fixture
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-novel/internal/model"
+	"go-novel/internal/util"
+)
+
+// FileName 录制信息文件名，响应体保存在同一目录下
+const FileName = "fixture.json"
+
+// Fixture 一个书源的录制数据
+type Fixture struct {
+	RulesFile  string     `json:"rulesFile"`
+	RuleID     int        `json:"ruleId"`
+	RuleName   string     `json:"ruleName"`
+	Keyword    string     `json:"keyword,omitempty"` // 为空时不录制搜索
+	BookURL    string     `json:"bookUrl"`
+	RecordedAt time.Time  `json:"recordedAt"`
+	Responses  []Response `json:"responses"`
+	Expected   Expected   `json:"expected"`
+}
+
+// Response 录制的一次请求及响应
+type Response struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	Body        string `json:"body,omitempty"` // POST请求体
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Location    string `json:"location,omitempty"` // 重定向地址
+	File        string `json:"file"`               // 响应体文件名
+}
+
+// Expected 录制时的提取结果，回放时应得到相同的结果
+type Expected struct {
+	Search       *model.SearchResult `json:"search,omitempty"` // 与书籍URL对应的搜索结果
+	Book         model.Book          `json:"book"`
+	Chapters     int                 `json:"chapters"`
+	FirstChapter model.Chapter       `json:"firstChapter"`
+	LastChapter  model.Chapter       `json:"lastChapter"`
+	Content      string              `json:"content"` // 第一章正文
+}
+
+// DirName 返回书源录制数据的目录名，如 main-rules-1
+func DirName(rulesFile string, ruleID int) string {
+	base := strings.TrimSuffix(filepath.Base(rulesFile), filepath.Ext(rulesFile))
+	return fmt.Sprintf("%s-%d", base, ruleID)
+}
+
+// Load 读取目录中的录制数据
+func Load(dir string) (*Fixture, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var fx Fixture
+	if err := json.Unmarshal(data, &fx); err != nil {
+		return nil, fmt.Errorf("解析录制数据失败 %s: %w", dir, err)
+	}
+	return &fx, nil
+}
+
+// LoadAll 读取根目录下所有包含录制数据的子目录，返回目录到录制数据的映射
+func LoadAll(root string) (map[string]*Fixture, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	fixtures := make(map[string]*Fixture)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		if !util.FileExists(filepath.Join(dir, FileName)) {
+			continue
+		}
+		fx, err := Load(dir)
+		if err != nil {
+			return nil, err
+		}
+		fixtures[dir] = fx
+	}
+	return fixtures, nil
+}
+
+// Save 将录制信息写入目录，响应体文件由 Recorder 写入
+func (fx *Fixture) Save(dir string) error {
+	data, err := json.MarshalIndent(fx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFile(filepath.Join(dir, FileName), data, 0644)
+}
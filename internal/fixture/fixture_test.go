@@ -0,0 +1,101 @@
+package fixture
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-novel/internal/config"
+	"go-novel/internal/rules"
+)
+
+var update = flag.Bool("update", false, "使用回放结果更新录制数据中的期望值")
+
+// TestFixtures 回放 testdata 中录制的页面，检查提取结果与录制时一致。
+// 只覆盖已录制的书源，目前只有手写的示例站点 example-rules-1，内置书源需要用 go-novel record 录制后提交
+func TestFixtures(t *testing.T) {
+	fixtures, err := LoadAll("testdata")
+	if err != nil {
+		t.Fatalf("读取录制数据失败: %v", err)
+	}
+
+	for dir, fx := range fixtures {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			got, err := Replay(&config.Config{}, dir, fx)
+			if err != nil {
+				t.Fatalf("回放 %s (%d) 失败: %v", fx.RuleName, fx.RuleID, err)
+			}
+
+			if *update {
+				fx.Expected = got
+				if err := fx.Save(dir); err != nil {
+					t.Fatalf("更新期望值失败: %v", err)
+				}
+				return
+			}
+
+			for _, diff := range Diff(fx.Expected, got) {
+				t.Errorf("%s (%d) %s", fx.RuleName, fx.RuleID, diff)
+			}
+		})
+	}
+}
+
+// TestBuiltinFixtures 检查内置规则文件中的书源是否已录制。录制需要访问书源网站，
+// 未录制的书源标记为跳过，go test -v 的输出中可以看到回放测试实际覆盖的范围
+func TestBuiltinFixtures(t *testing.T) {
+	const file = "main-rules.json"
+	list, err := rules.GetRuleManager().LoadRules(file)
+	if err != nil {
+		t.Fatalf("加载内置规则失败: %v", err)
+	}
+
+	for _, rule := range list {
+		if rule.Disabled {
+			continue
+		}
+		t.Run(DirName(file, rule.ID), func(t *testing.T) {
+			if _, err := os.Stat(filepath.Join("testdata", DirName(file, rule.ID), FileName)); err != nil {
+				t.Skipf("%s (%d) 尚未录制，需运行 go-novel record --file %s --source %d", rule.Name, rule.ID, file, rule.ID)
+			}
+		})
+	}
+}
+
+// TestRecord 通过回放器录制一遍，检查录制器保存的数据可以被回放
+func TestRecord(t *testing.T) {
+	src := filepath.Join("testdata", "example-rules-1")
+	original, err := Load(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	recorder := NewRecorder(dir, NewReplayer(src, original))
+	recorded, err := extract(&config.Config{}, original, recorder)
+	if err != nil {
+		t.Fatalf("录制失败: %v", err)
+	}
+
+	fx := *original
+	fx.Responses = recorder.Responses()
+	fx.Expected = recorded
+	if len(fx.Responses) != len(original.Responses) {
+		t.Errorf("应录制 %d 个请求，实际 %d 个", len(original.Responses), len(fx.Responses))
+	}
+
+	got, err := Replay(&config.Config{}, dir, &fx)
+	if err != nil {
+		t.Fatalf("回放失败: %v", err)
+	}
+	for _, diff := range Diff(original.Expected, got) {
+		t.Error(diff)
+	}
+
+	// 未录制的请求不应访问网络
+	fx.Responses = fx.Responses[:1]
+	if _, err := Replay(&config.Config{}, dir, &fx); err == nil {
+		t.Errorf("缺少录制的请求时回放应失败")
+	}
+}
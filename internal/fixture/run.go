@@ -0,0 +1,146 @@
+package fixture
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"go-novel/internal/config"
+	"go-novel/internal/core"
+	"go-novel/internal/rules"
+)
+
+// Options 录制选项
+type Options struct {
+	RulesFile string
+	RuleID    int
+	Keyword   string // 搜索关键词，书源不支持搜索时忽略
+	BookURL   string // 为空时使用第一条搜索结果
+}
+
+// Record 录制书源的搜索、详情、目录和第一章页面，保存到 root 下以规则命名的目录，返回录制数据
+func Record(cfg *config.Config, root string, opts Options) (*Fixture, error) {
+	rule, err := rules.GetRuleManager().GetRuleById(opts.RulesFile, opts.RuleID)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		return nil, fmt.Errorf("未找到ID为 %d 的规则", opts.RuleID)
+	}
+
+	fx := &Fixture{
+		RulesFile:  opts.RulesFile,
+		RuleID:     rule.ID,
+		RuleName:   rule.Name,
+		Keyword:    opts.Keyword,
+		BookURL:    opts.BookURL,
+		RecordedAt: time.Now(),
+	}
+	if rule.Search.Disabled {
+		fx.Keyword = ""
+	}
+	if fx.Keyword == "" && fx.BookURL == "" {
+		return nil, fmt.Errorf("书源 %s 不支持搜索，请指定书籍URL", rule.Name)
+	}
+
+	// 重新录制时清除旧的响应文件
+	dir := filepath.Join(root, DirName(opts.RulesFile, rule.ID))
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+
+	recorder := NewRecorder(dir, core.NewTransport(cfg))
+	expected, err := extract(cfg, fx, recorder)
+	if err != nil {
+		return nil, err
+	}
+
+	fx.BookURL = expected.Book.URL
+	fx.Responses = recorder.Responses()
+	fx.Expected = expected
+	if err := fx.Save(dir); err != nil {
+		return nil, err
+	}
+	return fx, nil
+}
+
+// Replay 回放目录中的录制数据，返回提取结果
+func Replay(cfg *config.Config, dir string, fx *Fixture) (Expected, error) {
+	return extract(cfg, fx, NewReplayer(dir, fx))
+}
+
+// Diff 比较提取结果，返回不一致的字段说明
+func Diff(want, got Expected) []string {
+	var diffs []string
+	check := func(field string, w, g any) {
+		if !reflect.DeepEqual(w, g) {
+			diffs = append(diffs, fmt.Sprintf("%s: 期望 %+v，实际 %+v", field, w, g))
+		}
+	}
+
+	check("search", want.Search, got.Search)
+	check("book", want.Book, got.Book)
+	check("chapters", want.Chapters, got.Chapters)
+	check("firstChapter", want.FirstChapter, got.FirstChapter)
+	check("lastChapter", want.LastChapter, got.LastChapter)
+	if want.Content != got.Content {
+		diffs = append(diffs, fmt.Sprintf("content: 第一章正文不一致，期望 %d 字节，实际 %d 字节", len(want.Content), len(got.Content)))
+	}
+	return diffs
+}
+
+// extract 按下载流程依次执行搜索、解析书籍信息、目录和第一章
+func extract(cfg *config.Config, fx *Fixture, transport http.RoundTripper) (Expected, error) {
+	crawlCfg := *cfg
+	crawlCfg.Source.ActiveRules = fx.RulesFile
+	crawlCfg.Source.SourceId = fx.RuleID
+	crawlCfg.Source.SearchLimit = 0
+	crawlCfg.Crawl.EnableRetry = 0
+	crawler := core.NewCrawler(&crawlCfg, core.WithTransport(transport))
+
+	var expected Expected
+	bookURL := fx.BookURL
+
+	if fx.Keyword != "" {
+		results, err := crawler.Search(fx.Keyword)
+		if err != nil {
+			return expected, fmt.Errorf("搜索失败: %w", err)
+		}
+		for i := range results {
+			if bookURL == "" || results[i].URL == bookURL {
+				expected.Search = &results[i]
+				break
+			}
+		}
+		if expected.Search == nil {
+			return expected, fmt.Errorf("搜索 %s 未找到书籍: %s", fx.Keyword, bookURL)
+		}
+		bookURL = expected.Search.URL
+		// 限定ID包含规则文件的路径，录制和回放时不同，不参与对比
+		expected.Search.Source = ""
+	}
+
+	book, chapters, err := crawler.FetchCatalog(bookURL)
+	if err != nil {
+		return expected, err
+	}
+	if len(chapters) == 0 {
+		return expected, fmt.Errorf("目录为空: %s", bookURL)
+	}
+	expected.Book = *book
+	expected.Book.Source = ""
+	expected.Chapters = len(chapters)
+	expected.FirstChapter = chapters[0]
+	expected.LastChapter = chapters[len(chapters)-1]
+
+	content, err := crawler.FetchChapter(chapters[0].URL)
+	if err != nil {
+		return expected, fmt.Errorf("下载第一章失败: %w", err)
+	}
+	expected.Content = content
+
+	return expected, nil
+}
@@ -0,0 +1,155 @@
+package fixture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go-novel/internal/util"
+)
+
+// Recorder 录制请求的 http.RoundTripper，将响应体写入目录并记录请求信息
+type Recorder struct {
+	Transport http.RoundTripper
+	Dir       string
+
+	mutex     sync.Mutex
+	responses []Response
+}
+
+// NewRecorder 创建录制器，transport 为空时使用默认传输
+func NewRecorder(dir string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{Transport: transport, Dir: dir}
+}
+
+// RoundTrip 发起真实请求并保存响应，同一请求只保存第一次的响应
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if findResponse(r.responses, req.Method, req.URL.String(), reqBody) != nil {
+		return resp, nil
+	}
+
+	recorded := Response{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Body:        reqBody,
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Location:    resp.Header.Get("Location"),
+		File:        fmt.Sprintf("%03d.html", len(r.responses)+1),
+	}
+	if err := util.WriteFile(filepath.Join(r.Dir, recorded.File), body, 0644); err != nil {
+		return nil, err
+	}
+	r.responses = append(r.responses, recorded)
+
+	return resp, nil
+}
+
+// Responses 返回已录制的请求
+func (r *Recorder) Responses() []Response {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Response(nil), r.responses...)
+}
+
+// Replayer 回放录制数据的 http.RoundTripper，未录制的请求返回错误，不访问网络
+type Replayer struct {
+	Dir       string
+	Responses []Response
+}
+
+// NewReplayer 创建回放器
+func NewReplayer(dir string, fx *Fixture) *Replayer {
+	return &Replayer{Dir: dir, Responses: fx.Responses}
+}
+
+// RoundTrip 按请求方法、URL和请求体查找录制的响应
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := findResponse(r.Responses, req.Method, req.URL.String(), reqBody)
+	if recorded == nil {
+		return nil, fmt.Errorf("未录制的请求: %s %s", req.Method, req.URL)
+	}
+
+	body, err := os.ReadFile(filepath.Join(r.Dir, recorded.File))
+	if err != nil {
+		return nil, fmt.Errorf("读取录制的响应失败: %w", err)
+	}
+
+	header := make(http.Header)
+	if recorded.ContentType != "" {
+		header.Set("Content-Type", recorded.ContentType)
+	}
+	if recorded.Location != "" {
+		header.Set("Location", recorded.Location)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// readRequestBody 读取请求体并恢复，以便继续发送
+func readRequestBody(req *http.Request) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("读取请求体失败: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return string(body), nil
+}
+
+// findResponse 查找与请求匹配的录制响应
+func findResponse(responses []Response, method, url, body string) *Response {
+	for i := range responses {
+		r := &responses[i]
+		if r.Method == method && r.URL == url && r.Body == body {
+			return r
+		}
+	}
+	return nil
+}
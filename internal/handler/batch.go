@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"fmt"
+	"go-novel/internal/batch"
+	"go-novel/internal/config"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// batchRequest 批量下载请求，urls 与 text 二选一，text 为每行一本书的列表文本
+type batchRequest struct {
+	URLs     []string `json:"urls"`
+	Text     string   `json:"text"`
+	Format   string   `json:"format"`
+	SourceId *int     `json:"sourceId"`
+	Source   string   `json:"source"` // 书源的限定ID "规则文件#规则ID"，优先于 sourceId
+}
+
+// BatchCreate 创建批量下载任务并在后台执行
+func BatchCreate(c *gin.Context) {
+	var req batchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("请求格式错误: %v", err)})
+		return
+	}
+
+	lines, err := batch.ParseLines(strings.NewReader(strings.Join(append(req.URLs, req.Text), "\n")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("解析批量列表失败: %v", err)})
+		return
+	}
+
+	// 未指定书源时使用配置中的 source-id
+	source := req.Source
+	if source == "" {
+		sourceId := config.GetConfig().Copy().Source.SourceId
+		if req.SourceId != nil {
+			sourceId = *req.SourceId
+		}
+		source = strconv.Itoa(sourceId)
+	}
+
+	manager := batch.GetManager()
+	b, err := manager.Create(lines, req.Format, source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	go func() {
+		if _, err := manager.Run(b.ID); err != nil {
+			fmt.Printf("批量任务执行失败: %v\n", err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": fmt.Sprintf("已创建批量任务，共 %d 本书籍", len(b.Items)),
+		"data":    b,
+	})
+}
+
+// BatchList 获取全部批量任务
+func BatchList(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": batch.GetManager().List(),
+	})
+}
+
+// BatchGet 获取批量任务的进度和每本书的结果
+func BatchGet(c *gin.Context) {
+	b, exists := batch.GetManager().Get(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未找到批量任务"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": b,
+	})
+}
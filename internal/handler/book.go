@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"go-novel/internal/config"
 	"go-novel/internal/core"
+	"go-novel/internal/library"
 	"go-novel/internal/sse"
 	"go-novel/internal/util"
 	"io"
@@ -13,7 +14,6 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -26,7 +26,11 @@ func BookFetch(c *gin.Context) {
 	bookName := c.Query("bookName")
 	author := c.Query("author")
 	bookUrl := c.Query("url")
-	sourceId, _ := strconv.Atoi(c.Query("sourceId"))
+	// source 为搜索结果中的限定ID "规则文件#规则ID"，未提供时使用 sourceId
+	source := c.Query("source")
+	if source == "" {
+		source = c.Query("sourceId")
+	}
 	// 获取format参数，默认为epub
 	format := c.Query("format")
 	if format == "" {
@@ -58,8 +62,11 @@ func BookFetch(c *gin.Context) {
 	cfg := config.GetConfig()
 
 	// 设置下载配置
-	downloadCfg := *cfg // 复制一份配置
-	downloadCfg.Source.SourceId = sourceId
+	downloadCfg := cfg.Copy() // 复制一份配置
+	if err := downloadCfg.Source.SelectSource(source); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	// 设置文件格式
 	downloadCfg.Download.ExtName = format
 	// 设置下载ID
@@ -107,7 +114,8 @@ func BookFetch(c *gin.Context) {
 		"message":  "已开始下载书籍",
 		"bookName": bookName,
 		"author":   author,
-		"sourceId": sourceId,
+		"sourceId": downloadCfg.Source.SourceId,
+		"source":   source,
 		"format":   format,
 	})
 }
@@ -236,8 +244,8 @@ func LocalBooks(c *gin.Context) {
 	// 构建书籍列表
 	books := []map[string]interface{}{}
 	for _, file := range files {
-		// 只处理文件，跳过目录
-		if file.IsDir() {
+		// 只处理书籍文件，跳过目录以及书库索引等数据文件
+		if file.IsDir() || !library.IsBookFile(file.Name()) {
 			continue
 		}
 
@@ -282,6 +290,12 @@ func DeleteBook(c *gin.Context) {
 		return
 	}
 
+	// 只允许删除书籍文件，下载目录中的书库索引等数据文件不能通过该接口删除
+	if !library.IsBookFile(filename) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能删除书籍文件"})
+		return
+	}
+
 	// 获取配置
 	cfg := config.GetConfig()
 
@@ -316,6 +330,11 @@ func DeleteBook(c *gin.Context) {
 		return
 	}
 
+	// 同步移除书库索引记录
+	if err := library.GetLibrary(downloadPath).Remove(filename); err != nil {
+		log.Printf("移除书库索引记录失败: %v", err)
+	}
+
 	// 返回成功响应
 	c.JSON(http.StatusOK, gin.H{
 		"message": "文件删除成功",
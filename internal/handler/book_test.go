@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-novel/internal/config"
+	"go-novel/internal/library"
+	"go-novel/internal/watch"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLocalBooksSkipsDataFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	dir := config.GetConfig().Download.DownloadPath
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"仙逆(耳根).txt", library.IndexFileName, "." + library.IndexFileName + ".123.tmp", watch.WatchlistFileName} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := gin.New()
+	r.GET("/api/local/books", LocalBooks)
+	r.DELETE("/api/book", DeleteBook)
+
+	// 书籍列表只包含书籍文件
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/local/books", nil))
+	var resp struct {
+		Data []struct {
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v\n%s", err, w.Body.String())
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Name != "仙逆(耳根).txt" {
+		t.Errorf("书籍列表不应包含数据文件: %+v", resp.Data)
+	}
+
+	// 书库索引和追更列表不能通过删除书籍的接口删除
+	for _, name := range []string{library.IndexFileName, watch.WatchlistFileName} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/book?filename="+name, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("删除 %s 应返回 400，实际 %d", name, w.Code)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s 不应被删除: %v", name, err)
+		}
+	}
+}
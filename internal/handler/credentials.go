@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"fmt"
+	"go-novel/internal/config"
+	"go-novel/internal/model"
+	"go-novel/internal/rules"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CredentialsList 列出已保存登录凭据的书源，只返回用户名
+func CredentialsList(c *gin.Context) {
+	list, err := config.ListCredentials()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// credentialSource 将 source 参数转为保存凭据使用的限定ID，只填写规则ID时对应第一个激活的规则文件，与爬虫登录时查找凭据的方式一致
+func credentialSource(source string) (file string, id int, qualified string, err error) {
+	file, id, err = config.ParseSourceId(source)
+	if err != nil || id <= 0 {
+		return "", 0, "", fmt.Errorf("无效的书源ID: %s", source)
+	}
+	if file == "" {
+		file = config.GetConfig().Copy().Source.PrimaryRules()
+	}
+	return file, id, config.QualifiedSourceId(file, id), nil
+}
+
+// loginRule 返回需要登录的书源规则，书源不存在或没有登录规则时返回错误
+func loginRule(file string, id int) (*model.Rule, error) {
+	rule, err := rules.GetRuleManager().GetRuleById(file, id)
+	if err != nil || rule == nil {
+		return nil, fmt.Errorf("未找到书源: %s", config.QualifiedSourceId(file, id))
+	}
+	if rule.Login == nil {
+		return nil, fmt.Errorf("书源 %s 没有登录规则，无需保存登录凭据", config.QualifiedSourceId(file, id))
+	}
+	return rule, nil
+}
+
+// CredentialsPut 保存书源的登录凭据，source 为书源ID或限定ID "规则文件#规则ID"，
+// 请求体为 {"username": "...", "password": "..."}，其他字段可在登录规则中作为变量使用
+func CredentialsPut(c *gin.Context) {
+	file, id, source, err := credentialSource(c.Query("source"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := loginRule(file, id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var credential config.Credential
+	if err := c.ShouldBindJSON(&credential); err != nil || len(credential) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求体应为包含 username、password 的对象"})
+		return
+	}
+	if err := config.SetCredential(source, credential); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已保存登录凭据", "source": source})
+}
+
+// CredentialsDelete 删除书源的登录凭据，书源已不存在时也可以删除
+func CredentialsDelete(c *gin.Context) {
+	_, _, source, err := credentialSource(c.Query("source"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := config.GetCredential(source); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该书源没有保存登录凭据"})
+		return
+	}
+	if err := config.SetCredential(source, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已删除登录凭据"})
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-novel/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCredentialsSource(t *testing.T) {
+	t.Chdir(t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	// 第1条书源需要登录，第2条不需要
+	rule := `[{"id": 1, "name": "登录书源", "url": "https://www.example.com/", "search": {"disabled": true},
+"login": {"url": "/login", "method": "post", "data": "u={{username}}&p={{password}}"}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}},
+{"id": 2, "name": "普通书源", "url": "https://www.example.org/", "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}]`
+	if err := os.MkdirAll(filepath.Join("configs", "rules"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("configs", "rules", "login-rules.json"), []byte(rule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.GetConfig()
+	activeRules := cfg.Source.ActiveRules
+	cfg.Source.ActiveRules = "login-rules.json"
+	t.Cleanup(func() { cfg.Source.ActiveRules = activeRules })
+
+	r := gin.New()
+	r.PUT("/api/credentials", CredentialsPut)
+	r.DELETE("/api/credentials", CredentialsDelete)
+	request := func(method, source string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/api/credentials?source="+source, strings.NewReader(`{"username": "wang", "password": "secret"}`)))
+		return w.Code
+	}
+
+	// 只填写规则ID时按第一个激活的规则文件保存为限定ID，与爬虫登录时查找的键一致
+	if code := request(http.MethodPut, "1"); code != http.StatusOK {
+		t.Fatalf("保存登录凭据应成功，实际 %d", code)
+	}
+	if _, ok := config.GetCredential(config.QualifiedSourceId("login-rules.json", 1)); !ok {
+		t.Errorf("登录凭据应保存在限定ID下")
+	}
+	if _, ok := config.GetCredential("1"); ok {
+		t.Errorf("登录凭据不应保存在未限定的ID下")
+	}
+
+	// 书源不存在、没有登录规则或ID无效时拒绝保存
+	for _, source := range []string{"", "abc", "9", "login-rules.json%232", "other-rules.json%231"} {
+		if code := request(http.MethodPut, source); code != http.StatusBadRequest {
+			t.Errorf("source=%q 应返回 400，实际 %d", source, code)
+		}
+	}
+
+	if code := request(http.MethodDelete, "login-rules.json%231"); code != http.StatusOK {
+		t.Errorf("删除登录凭据应成功，实际 %d", code)
+	}
+	if code := request(http.MethodDelete, "1"); code != http.StatusNotFound {
+		t.Errorf("删除不存在的登录凭据应返回 404，实际 %d", code)
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"fmt"
+	"go-novel/internal/library"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LibraryList 获取书库索引处理函数，支持按作者、书源、状态过滤与排序
+func LibraryList(c *gin.Context) {
+	filter := library.Filter{
+		Author:  c.Query("author"),
+		Status:  c.Query("status"),
+		Format:  c.Query("format"),
+		Keyword: c.Query("kw"),
+	}
+	// sourceId 可以是规则ID或限定ID "规则文件#规则ID"
+	if source := c.Query("sourceId"); strings.Contains(source, "#") {
+		filter.Source = source
+	} else {
+		filter.SourceId, _ = strconv.Atoi(source)
+	}
+
+	// 默认按更新时间倒序
+	sortBy := c.DefaultQuery("sort", "updated")
+	desc := c.DefaultQuery("order", "desc") == "desc"
+
+	books, err := listLocalBooks(filter, sortBy, desc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("读取书库失败: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": books,
+	})
+}
+
+// LibraryRescan 根据下载目录中的文件重建书库索引
+func LibraryRescan(c *gin.Context) {
+	lib := library.GetLibrary(getDownloadPath())
+	if err := lib.Rescan(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("重建书库索引失败: %v", err)})
+		return
+	}
+
+	books, err := lib.List(library.Filter{}, "updated", true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("读取书库失败: %v", err)})
+		return
+	}
+
+	log.Printf("书库索引已重建，共 %d 本书籍", len(books))
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("书库索引已重建，共 %d 本书籍", len(books)),
+		"data":    books,
+	})
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"go-novel/internal/config"
+	"go-novel/internal/library"
+	"go-novel/internal/opds"
+	"go-novel/internal/util"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OPDSRoot OPDS导航目录
+func OPDSRoot(c *gin.Context) {
+	renderFeed(c, opds.NewRootFeed(time.Now()), opds.TypeNavigation)
+}
+
+// OPDSBooks 按书名排序的获取目录
+func OPDSBooks(c *gin.Context) {
+	books, err := listLocalBooks(library.Filter{}, "name", false)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	feed := opds.NewAcquisitionFeed("urn:go-novel:books", "全部书籍", "/opds/books", books)
+	renderFeed(c, feed, opds.TypeAcquisition)
+}
+
+// OPDSNew 按下载时间倒序的获取目录
+func OPDSNew(c *gin.Context) {
+	books, err := listLocalBooks(library.Filter{}, "updated", true)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	feed := opds.NewAcquisitionFeed("urn:go-novel:new", "最新下载", "/opds/new", books)
+	feed.AddLink(opds.RelSortNew, "/opds/new", opds.TypeAcquisition)
+	renderFeed(c, feed, opds.TypeAcquisition)
+}
+
+// OPDSSearch 按书名或作者搜索本地书库
+func OPDSSearch(c *gin.Context) {
+	keyword := strings.TrimSpace(c.Query("q"))
+
+	matched, err := listLocalBooks(library.Filter{Keyword: keyword}, "name", false)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	renderFeed(c, opds.NewSearchFeed(c.Query("q"), matched), opds.TypeAcquisition)
+}
+
+// OPDSOpenSearch OpenSearch描述文件
+func OPDSOpenSearch(c *gin.Context) {
+	data, err := opds.NewOpenSearchDescription("/opds/search?q={searchTerms}").Marshal()
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, opds.TypeOpenSearch+"; charset=utf-8", data)
+}
+
+// OPDSCover 从EPUB文件中读取封面图片
+func OPDSCover(c *gin.Context) {
+	filename := c.Query("filename")
+	if filename == "" || strings.Contains(filename, "..") || strings.ContainsAny(filename, `/\`) {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	fp := filepath.Join(getDownloadPath(), filename)
+	meta, err := util.ReadEpubMeta(fp)
+	if err != nil || meta.CoverPath == "" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	data, err := util.ReadEpubFile(fp, meta.CoverPath)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	contentType := meta.CoverType
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	c.Header("Cache-Control", "max-age=86400")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// renderFeed 输出OPDS目录
+func renderFeed(c *gin.Context, feed *opds.Feed, contentType string) {
+	data, err := feed.Marshal()
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, contentType+"; charset=utf-8", data)
+}
+
+// getDownloadPath 获取下载目录的绝对路径
+func getDownloadPath() string {
+	cfg := config.GetConfig()
+	if filepath.IsAbs(cfg.Download.DownloadPath) {
+		return cfg.Download.DownloadPath
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return cfg.Download.DownloadPath
+	}
+	return filepath.Join(wd, cfg.Download.DownloadPath)
+}
+
+// listLocalBooks 同步书库索引后按条件列出书籍
+func listLocalBooks(filter library.Filter, sortBy string, desc bool) ([]library.Entry, error) {
+	lib := library.GetLibrary(getDownloadPath())
+	if err := lib.Sync(); err != nil {
+		return nil, err
+	}
+	return lib.List(filter, sortBy, desc)
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-novel/internal/config"
+	"go-novel/internal/core"
+	"go-novel/internal/opds"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOPDSCoverAfterDownload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	gin.SetMode(gin.TestMode)
+
+	// 最小的JPEG文件头，足以识别媒体类型
+	cover := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00\xff\xd9")
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/book/1/":
+			w.Write([]byte(`<html><body><h1>仙逆</h1><p class="author">耳根</p><img class="cover" src="` + server.URL + `/cover.jpg">
+<div id="list"><a href="/book/1/1.html">第一章 离乡</a><a href="/book/1/2.html">第二章 入门</a></div></body></html>`))
+		case "/book/1/1.html", "/book/1/2.html":
+			w.Write([]byte(`<html><body><div id="content">王林站在山巅，望着远处连绵的群山。</div></body></html>`))
+		case "/cover.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write(cover)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	rule := `[{"id": 1, "name": "测试书源", "url": "` + server.URL + `/", "search": {"disabled": true},
+"book": {"bookName": "h1", "author": ".author", "coverUrl": "img.cover"}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}]`
+	if err := os.MkdirAll(filepath.Join("configs", "rules"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("configs", "rules", "main-rules.json"), []byte(rule), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := *config.GetConfig()
+	cfg.Download.ExtName = "epub"
+	cfg.Crawl.MinInterval, cfg.Crawl.MaxInterval = 0, 0
+	if err := os.MkdirAll(cfg.Download.DownloadPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.NewCrawler(&cfg).Crawl(server.URL + "/book/1/"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 下载完成后无需重建索引，OPDS目录即包含封面链接
+	r := gin.New()
+	r.GET("/opds/books", OPDSBooks)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/opds/books", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "仙逆") {
+		t.Fatalf("OPDS目录应包含下载的书籍: %d\n%s", w.Code, body)
+	}
+	if !strings.Contains(body, `rel="http://opds-spec.org/image"`) || !strings.Contains(body, "/opds/cover?filename=") {
+		t.Errorf("OPDS目录应包含封面链接:\n%s", body)
+	}
+}
+
+// opdsFeed 请求OPDS目录并解析为Atom目录
+func opdsFeed(t *testing.T, r http.Handler, target string) opds.Feed {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/atom+xml") {
+		t.Fatalf("%s 应返回OPDS目录: %d %s\n%s", target, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	var feed opds.Feed
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("%s 不是有效的XML: %v\n%s", target, err, w.Body.String())
+	}
+	return feed
+}
+
+func opdsRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/opds", OPDSRoot)
+	r.GET("/opds/books", OPDSBooks)
+	r.GET("/opds/new", OPDSNew)
+	r.GET("/opds/search", OPDSSearch)
+	return r
+}
+
+func TestOPDSEmptyLibrary(t *testing.T) {
+	t.Chdir(t.TempDir())
+	r := opdsRouter()
+
+	// 下载目录不存在或为空时各目录仍是有效的空目录
+	if feed := opdsFeed(t, r, "/opds"); len(feed.Entries) != 2 {
+		t.Errorf("导航目录应有 2 个条目: %+v", feed.Entries)
+	}
+	for _, target := range []string{"/opds/books", "/opds/new", "/opds/search?q=仙逆", "/opds/search"} {
+		if feed := opdsFeed(t, r, target); len(feed.Entries) != 0 {
+			t.Errorf("%s 在空书库中不应有条目: %+v", target, feed.Entries)
+		}
+	}
+}
+
+func TestOPDSSearch(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := config.GetConfig().Download.DownloadPath
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"仙逆(耳根).txt":       "书名：仙逆\n作者：耳根\n\n第1章 离乡\n",
+		"求魔(耳根).txt":       "书名：求魔\n作者：耳根\n\n第1章 魔\n",
+		"诡秘之主(爱潜水的乌贼).txt": "书名：诡秘之主\n作者：爱潜水的乌贼\n\n第1章 绯红\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := opdsRouter()
+
+	titles := func(feed opds.Feed) []string {
+		var names []string
+		for _, entry := range feed.Entries {
+			names = append(names, entry.Title)
+		}
+		return names
+	}
+
+	// 按书名或作者匹配，忽略首尾空白，结果按书名排序
+	if got := titles(opdsFeed(t, r, "/opds/search?q=%20%E8%80%B3%E6%A0%B9%20")); strings.Join(got, ",") != "仙逆,求魔" {
+		t.Errorf("按作者搜索的结果不正确: %v", got)
+	}
+	if got := titles(opdsFeed(t, r, "/opds/search?q=%E8%AF%A1%E7%A7%98")); strings.Join(got, ",") != "诡秘之主" {
+		t.Errorf("按书名搜索的结果不正确: %v", got)
+	}
+	if got := titles(opdsFeed(t, r, "/opds/search?q=")); len(got) != 3 {
+		t.Errorf("空查询应返回全部书籍: %v", got)
+	}
+
+	// 查询中的特殊字符在标题中原样保留，在 self 链接中转义
+	feed := opdsFeed(t, r, "/opds/search?q=a%26b%3C")
+	if len(feed.Entries) != 0 || feed.Title != "搜索: a&b<" {
+		t.Errorf("特殊字符查询的结果不正确: %s %v", feed.Title, titles(feed))
+	}
+	for _, link := range feed.Links {
+		if link.Rel == "self" && link.Href != "/opds/search?q=a%26b%3C" {
+			t.Errorf("self 链接应包含转义后的查询: %s", link.Href)
+		}
+	}
+}
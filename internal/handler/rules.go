@@ -0,0 +1,350 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"go-novel/internal/config"
+	"go-novel/internal/core"
+	"go-novel/internal/rules"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RulesLint 校验规则文件，返回带规则ID和字段路径的问题列表
+func RulesLint(c *gin.Context) {
+	file := c.DefaultQuery("file", config.GetConfig().Copy().Source.PrimaryRules())
+
+	issues, err := rules.GetRuleManager().Lint(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	errorCount := 0
+	for _, issue := range issues {
+		if issue.Severity == rules.SeverityError {
+			errorCount++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file":     file,
+		"valid":    errorCount == 0,
+		"errors":   errorCount,
+		"warnings": len(issues) - errorCount,
+		"data":     issues,
+	})
+}
+
+// RulesFiles 列出规则目录中的规则文件及当前激活的规则文件
+func RulesFiles(c *gin.Context) {
+	files, err := rules.ListFiles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"active":      config.GetConfig().Copy().Source.PrimaryRules(),
+		"activeFiles": config.GetConfig().Copy().Source.RuleFiles(),
+		"data":        files,
+	})
+}
+
+// RulesSetActive 切换激活的规则文件，请求体为 {"file": "..."} 或 {"files": ["...", "..."]}，写回配置文件后立即生效
+func RulesSetActive(c *gin.Context) {
+	var req struct {
+		File  string   `json:"file"`
+		Files []string `json:"files"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少file参数"})
+		return
+	}
+	if req.File != "" {
+		req.Files = append([]string{req.File}, req.Files...)
+	}
+	if len(req.Files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少file参数"})
+		return
+	}
+
+	// 只允许切换到可以正常加载的规则文件
+	for _, file := range req.Files {
+		if strings.Contains(file, ",") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的规则文件名: %s", file)})
+			return
+		}
+		if _, err := rules.ListRules(file); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	active := strings.Join(req.Files, ",")
+	if err := config.SetActiveRules(active); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     fmt.Sprintf("已切换规则文件: %s", active),
+		"active":      req.Files[0],
+		"activeFiles": req.Files,
+	})
+}
+
+// RulesList 列出规则文件中的书源，包括已停用的
+func RulesList(c *gin.Context) {
+	file := c.DefaultQuery("file", config.GetConfig().Copy().Source.PrimaryRules())
+
+	list, err := rules.ListRules(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file": file,
+		"data": list,
+	})
+}
+
+// RuleGet 获取单条规则的JSON
+func RuleGet(c *gin.Context) {
+	file := c.DefaultQuery("file", config.GetConfig().Copy().Source.PrimaryRules())
+	id, ok := ruleIdParam(c)
+	if !ok {
+		return
+	}
+
+	raw, err := rules.GetRawRule(file, id)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", raw)
+}
+
+// RulePut 新增或替换规则，请求体为规则JSON，校验未通过时返回问题列表且不保存
+func RulePut(c *gin.Context) {
+	file := c.DefaultQuery("file", config.GetConfig().Copy().Source.PrimaryRules())
+	id, ok := ruleIdParam(c)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
+		return
+	}
+
+	issues, err := rules.GetRuleManager().SaveRule(file, id, body)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("规则 %d 已保存", id),
+		"issues":  issues,
+	})
+}
+
+// RuleDelete 删除规则
+func RuleDelete(c *gin.Context) {
+	file := c.DefaultQuery("file", config.GetConfig().Copy().Source.PrimaryRules())
+	id, ok := ruleIdParam(c)
+	if !ok {
+		return
+	}
+
+	if err := rules.GetRuleManager().DeleteRule(file, id); err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("规则 %d 已删除", id)})
+}
+
+// RuleSetDisabled 停用或启用书源，请求体为 {"disabled": true}
+func RuleSetDisabled(c *gin.Context) {
+	file := c.DefaultQuery("file", config.GetConfig().Copy().Source.PrimaryRules())
+	id, ok := ruleIdParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Disabled *bool `json:"disabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Disabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少disabled参数"})
+		return
+	}
+
+	if err := rules.GetRuleManager().SetDisabled(file, id, *req.Disabled); err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	message := fmt.Sprintf("书源 %d 已启用", id)
+	if *req.Disabled {
+		message = fmt.Sprintf("书源 %d 已停用", id)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// RulesImport 导入规则包、规则数组或阅读 (Legado) 书源，请求体为JSON，合并到 file 指定的规则文件，
+// source 为来源名称，用于问题列表；dryRun=true 时只返回合并结果，不写入
+func RulesImport(c *gin.Context) {
+	file := c.DefaultQuery("file", config.GetConfig().Copy().Source.PrimaryRules())
+	source := c.DefaultQuery("source", "import.json")
+	dryRun := c.Query("dryRun") == "true"
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
+		return
+	}
+
+	result, err := rules.GetRuleManager().ImportRules(file, source, body, dryRun)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file": file,
+		"data": result,
+	})
+}
+
+// RulesExport 将规则文件中 ids 指定的规则 (逗号分隔，为空时全部) 导出为带元数据的规则包
+func RulesExport(c *gin.Context) {
+	file := c.DefaultQuery("file", config.GetConfig().Copy().Source.PrimaryRules())
+
+	var ids []int
+	for _, s := range strings.Split(c.Query("ids"), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "规则ID无效: " + s})
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	data, err := rules.ExportRules(file, ids)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	name := strings.TrimSuffix(file, ".json") + "-export.json"
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// RulesSetMeta 设置规则文件的元数据，请求体为 {"name": "", "version": "", "author": "", "description": "", "minAppVersion": ""}
+func RulesSetMeta(c *gin.Context) {
+	file := c.DefaultQuery("file", config.GetConfig().Copy().Source.PrimaryRules())
+
+	var meta rules.FileMeta
+	if err := c.ShouldBindJSON(&meta); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "元数据格式错误"})
+		return
+	}
+
+	issues, err := rules.GetRuleManager().SetMeta(file, meta)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "规则文件信息已保存",
+		"issues":  issues,
+	})
+}
+
+// ruleIdParam 解析路径中的规则ID，无效时直接返回错误响应
+func ruleIdParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "规则ID无效"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondRuleError 根据错误类型返回对应的状态码，校验失败时附带问题列表
+func respondRuleError(c *gin.Context, err error) {
+	var validationErr *rules.ValidationError
+	switch {
+	case errors.Is(err, rules.ErrRuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "issues": validationErr.Issues})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// RulesInfer 为没有规则的网站自动识别目录和正文，save 为 true 时将识别出的规则保存为草稿
+func RulesInfer(c *gin.Context) {
+	var req struct {
+		URL  string `json:"url" binding:"required"`
+		Save bool   `json:"save"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("请求格式错误: %v", err)})
+		return
+	}
+
+	cfg := config.GetConfig().Copy()
+	result, err := core.NewCrawler(&cfg).InferRule(req.URL)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{"data": result}
+	if req.Save {
+		id, issues, err := rules.GetRuleManager().SaveDraft(*result.Rule)
+		if err != nil {
+			respondRuleError(c, err)
+			return
+		}
+		resp["file"] = rules.DraftRulesFile
+		resp["id"] = id
+		resp["issues"] = issues
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RulePlayground 使用规则片段解析URL或粘贴的HTML，返回每个字段的提取结果
+func RulePlayground(c *gin.Context) {
+	var req core.PlaygroundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("请求格式错误: %v", err)})
+		return
+	}
+
+	cfg := config.GetConfig().Copy()
+	result, err := core.NewCrawler(&cfg).Playground(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
@@ -24,10 +24,10 @@ func AggregatedSearch(c *gin.Context) {
 	}
 
 	// 获取配置
-	cfg := config.GetConfig()
+	cfg := config.GetConfig().Copy()
 
 	// 执行聚合搜索
-	results := performAggregatedSearch(keyword, cfg)
+	results := performAggregatedSearch(keyword, &cfg)
 
 	// 返回结果
 	c.JSON(http.StatusOK, gin.H{
@@ -41,7 +41,7 @@ func performAggregatedSearch(keyword string, cfg *config.Config) []model.SearchR
 	ruleManager := rules.GetRuleManager()
 
 	// 获取可搜索的规则
-	searchableRules, err := ruleManager.GetSearchableRules(cfg.Source.ActiveRules)
+	searchableRules, err := ruleManager.GetSearchableRules(cfg.Source.RuleFiles()...)
 	if err != nil {
 		log.Printf("加载规则失败: %v", err)
 		return []model.SearchResult{}
@@ -66,6 +66,7 @@ func performAggregatedSearch(keyword string, cfg *config.Config) []model.SearchR
 
 			// 创建爬虫实例
 			searchCfg := *cfg // 复制配置
+			searchCfg.Source.ActiveRules = rule.File
 			searchCfg.Source.SourceId = rule.ID
 			crawler := core.NewCrawler(&searchCfg)
 
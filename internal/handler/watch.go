@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"fmt"
+	"go-novel/internal/watch"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WatchList 获取追更列表处理函数
+func WatchList(c *gin.Context) {
+	items, err := watch.GetWatcher().List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("读取追更列表失败: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": items,
+	})
+}
+
+// WatchAdd 添加书籍到追更列表，已在列表中时更新检查间隔和处理方式
+func WatchAdd(c *gin.Context) {
+	fileName := c.Query("fileName")
+	if fileName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少fileName参数"})
+		return
+	}
+
+	// 检查间隔（分钟），不传时使用全局配置
+	interval, err := strconv.Atoi(c.DefaultQuery("interval", "0"))
+	if err != nil || interval < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval参数无效"})
+		return
+	}
+
+	item, err := watch.GetWatcher().Add(fileName, interval, c.Query("mode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("已添加追更: %s", item.BookName),
+		"data":    item,
+	})
+}
+
+// WatchRemove 从追更列表中移除书籍
+func WatchRemove(c *gin.Context) {
+	fileName := c.Query("fileName")
+	if fileName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少fileName参数"})
+		return
+	}
+
+	if err := watch.GetWatcher().Remove(fileName); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已取消追更"})
+}
+
+// WatchCheck 立即检查一本书是否有新章节
+func WatchCheck(c *gin.Context) {
+	fileName := c.Query("fileName")
+	if fileName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少fileName参数"})
+		return
+	}
+
+	item, err := watch.GetWatcher().Check(fileName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "data": item})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": item.LastResult,
+		"data":    item,
+	})
+}
+
+// WatchUpdate 在后台增量更新一本书，进度通过SSE事件通知
+func WatchUpdate(c *gin.Context) {
+	fileName := c.Query("fileName")
+	if fileName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少fileName参数"})
+		return
+	}
+
+	go func() {
+		if _, err := watch.GetWatcher().Update(fileName); err != nil {
+			fmt.Printf("追更更新失败 %s: %v\n", fileName, err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "已开始增量更新"})
+}
@@ -0,0 +1,361 @@
+// Package library 维护下载目录中书籍的元数据索引
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-novel/internal/util"
+)
+
+// IndexFileName 索引文件名，保存在下载目录下
+const IndexFileName = "library.json"
+
+// Entry 书库中的一本书
+type Entry struct {
+	FileName       string    `json:"fileName"`
+	Format         string    `json:"format"`
+	Size           int64     `json:"size"`
+	BookName       string    `json:"bookName"`
+	Author         string    `json:"author"`
+	Intro          string    `json:"intro"`
+	Category       string    `json:"category"`
+	Status         string    `json:"status"`
+	WordCount      string    `json:"wordCount"`
+	CoverUrl       string    `json:"coverUrl"`
+	CoverType      string    `json:"coverType,omitempty"`
+	Language       string    `json:"language,omitempty"`
+	URL            string    `json:"url"`
+	SourceId       int       `json:"sourceId"`
+	Source         string    `json:"source,omitempty"` // 书源的限定ID "规则文件#规则ID"
+	ChapterCount   int       `json:"chapterCount"`
+	LastChapter    int       `json:"lastChapter,omitempty"` // 最后一章在书源目录中的序号，按章节范围下载时与章节数不同
+	LatestChapter  string    `json:"latestChapter"`
+	LastUpdateTime string    `json:"lastUpdateTime"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// Filter 列表过滤条件，空值表示不过滤
+type Filter struct {
+	Author   string
+	SourceId int
+	Source   string // 书源的限定ID
+	Status   string
+	Format   string
+	Keyword  string
+}
+
+// Library 书库索引
+type Library struct {
+	dir     string
+	entries map[string]*Entry
+	loaded  bool
+	mutex   sync.RWMutex
+}
+
+var (
+	libraries = make(map[string]*Library)
+	mutex     sync.Mutex
+)
+
+// GetLibrary 获取下载目录对应的书库实例
+func GetLibrary(dir string) *Library {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	lib, exists := libraries[dir]
+	if !exists {
+		lib = &Library{
+			dir:     dir,
+			entries: make(map[string]*Entry),
+		}
+		libraries[dir] = lib
+	}
+	return lib
+}
+
+// Dir 返回书库所在目录
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// load 从索引文件加载书库，调用方需持有写锁
+func (l *Library) load() error {
+	if l.loaded {
+		return nil
+	}
+
+	fp := filepath.Join(l.dir, IndexFileName)
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		if os.IsNotExist(err) {
+			l.loaded = true
+			return nil
+		}
+		return fmt.Errorf("读取书库索引失败: %w", err)
+	}
+
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("解析书库索引失败: %w", err)
+	}
+	for _, e := range entries {
+		l.entries[e.FileName] = e
+	}
+	l.loaded = true
+	return nil
+}
+
+// save 将书库写入索引文件，调用方需持有写锁
+func (l *Library) save() error {
+	entries := make([]*Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FileName < entries[j].FileName
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 原子写入，避免写入中断导致索引损坏
+	return util.WriteFileAtomic(filepath.Join(l.dir, IndexFileName), data, 0644)
+}
+
+// Upsert 添加或更新书籍记录
+func (l *Library) Upsert(entry Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.load(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entry.UpdatedAt = now
+	if old, exists := l.entries[entry.FileName]; exists {
+		entry.CreatedAt = old.CreatedAt
+	} else {
+		entry.CreatedAt = now
+	}
+
+	// 补充文件信息
+	if info, err := os.Stat(filepath.Join(l.dir, entry.FileName)); err == nil {
+		entry.Size = info.Size()
+	}
+
+	l.entries[entry.FileName] = &entry
+	return l.save()
+}
+
+// Remove 移除书籍记录
+func (l *Library) Remove(fileName string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.load(); err != nil {
+		return err
+	}
+	if _, exists := l.entries[fileName]; !exists {
+		return nil
+	}
+
+	delete(l.entries, fileName)
+	return l.save()
+}
+
+// Get 获取书籍记录
+func (l *Library) Get(fileName string) (*Entry, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.load(); err != nil {
+		return nil, false
+	}
+	e, exists := l.entries[fileName]
+	if !exists {
+		return nil, false
+	}
+	entry := *e
+	return &entry, true
+}
+
+// List 按条件过滤并排序书籍记录
+// sortBy 可选值：name, author, chapters, size, created, updated（默认）
+func (l *Library) List(filter Filter, sortBy string, desc bool) ([]Entry, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+
+	result := []Entry{}
+	for _, e := range l.entries {
+		if filter.Author != "" && !strings.Contains(e.Author, filter.Author) {
+			continue
+		}
+		if filter.SourceId > 0 && e.SourceId != filter.SourceId {
+			continue
+		}
+		if filter.Source != "" && e.Source != filter.Source {
+			continue
+		}
+		if filter.Status != "" && !strings.Contains(e.Status, filter.Status) {
+			continue
+		}
+		if filter.Format != "" && !strings.EqualFold(e.Format, filter.Format) {
+			continue
+		}
+		if filter.Keyword != "" {
+			kw := strings.ToLower(filter.Keyword)
+			if !strings.Contains(strings.ToLower(e.BookName), kw) && !strings.Contains(strings.ToLower(e.Author), kw) {
+				continue
+			}
+		}
+		result = append(result, *e)
+	}
+
+	less := func(i, j int) bool {
+		switch sortBy {
+		case "name":
+			return result[i].BookName < result[j].BookName
+		case "author":
+			return result[i].Author < result[j].Author
+		case "chapters":
+			return result[i].ChapterCount < result[j].ChapterCount
+		case "size":
+			return result[i].Size < result[j].Size
+		case "created":
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		default:
+			return result[i].UpdatedAt.Before(result[j].UpdatedAt)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if desc {
+			return less(j, i)
+		}
+		return less(i, j)
+	})
+
+	return result, nil
+}
+
+// Sync 同步索引与下载目录：补充新文件、移除已删除文件，已有记录保持不变
+func (l *Library) Sync() error {
+	return l.scan(false)
+}
+
+// Rescan 根据下载目录中的文件重建索引
+func (l *Library) Rescan() error {
+	return l.scan(true)
+}
+
+// scan 扫描下载目录，rebuild 为 true 时重新读取所有文件的元数据
+func (l *Library) scan(rebuild bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.load(); err != nil {
+		return err
+	}
+
+	files, err := os.ReadDir(l.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取下载目录失败: %w", err)
+	}
+
+	changed := false
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if file.IsDir() || !IsBookFile(file.Name()) {
+			continue
+		}
+		seen[file.Name()] = true
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		old, exists := l.entries[file.Name()]
+		if exists && !rebuild && old.Size == info.Size() {
+			continue
+		}
+
+		entry, err := ScanFile(filepath.Join(l.dir, file.Name()))
+		if err != nil {
+			fmt.Printf("读取书籍元数据失败 %s: %v\n", file.Name(), err)
+			continue
+		}
+
+		// 文件中没有的信息沿用原记录
+		if exists {
+			mergeEntry(entry, old)
+			entry.CreatedAt = old.CreatedAt
+		}
+		l.entries[file.Name()] = entry
+		changed = true
+	}
+
+	for name := range l.entries {
+		if !seen[name] {
+			delete(l.entries, name)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return l.save()
+}
+
+// mergeEntry 用旧记录补全新记录中的空字段
+func mergeEntry(entry, old *Entry) {
+	if entry.URL == "" {
+		entry.URL = old.URL
+	}
+	if entry.SourceId <= 0 {
+		entry.SourceId, entry.Source = old.SourceId, old.Source
+	}
+	if entry.Category == "" {
+		entry.Category = old.Category
+	}
+	if entry.Status == "" {
+		entry.Status = old.Status
+	}
+	if entry.WordCount == "" {
+		entry.WordCount = old.WordCount
+	}
+	if entry.CoverUrl == "" {
+		entry.CoverUrl = old.CoverUrl
+	}
+	if entry.LastUpdateTime == "" {
+		entry.LastUpdateTime = old.LastUpdateTime
+	}
+}
+
+// IsBookFile 判断文件是否为书库支持的书籍文件
+func IsBookFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".epub" || ext == ".txt"
+}
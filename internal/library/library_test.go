@@ -0,0 +1,81 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLibraryUpsertAndList(t *testing.T) {
+	dir := t.TempDir()
+	lib := GetLibrary(dir)
+
+	// 准备两个书籍文件
+	for _, name := range []string{"甲(张三).txt", "乙(李四).txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("书名：x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := lib.Upsert(Entry{FileName: "甲(张三).txt", BookName: "甲", Author: "张三", SourceId: 1, Status: "连载中", ChapterCount: 10}); err != nil {
+		t.Fatalf("写入索引失败: %v", err)
+	}
+	if err := lib.Upsert(Entry{FileName: "乙(李四).txt", BookName: "乙", Author: "李四", SourceId: 2, Status: "已完结", ChapterCount: 20}); err != nil {
+		t.Fatalf("写入索引失败: %v", err)
+	}
+
+	// 按作者过滤
+	books, err := lib.List(Filter{Author: "李四"}, "", false)
+	if err != nil || len(books) != 1 || books[0].BookName != "乙" {
+		t.Errorf("按作者过滤结果不正确: %+v, %v", books, err)
+	}
+
+	// 按书源过滤
+	books, _ = lib.List(Filter{SourceId: 1}, "", false)
+	if len(books) != 1 || books[0].BookName != "甲" {
+		t.Errorf("按书源过滤结果不正确: %+v", books)
+	}
+
+	// 按章节数倒序
+	books, _ = lib.List(Filter{}, "chapters", true)
+	if len(books) != 2 || books[0].ChapterCount != 20 {
+		t.Errorf("按章节数排序结果不正确: %+v", books)
+	}
+
+	// 重新加载后记录仍然存在
+	reloaded := &Library{dir: dir, entries: make(map[string]*Entry)}
+	books, _ = reloaded.List(Filter{Status: "完结"}, "", false)
+	if len(books) != 1 || books[0].URL != "" || books[0].SourceId != 2 {
+		t.Errorf("重新加载索引结果不正确: %+v", books)
+	}
+
+	// 删除文件后同步，记录被移除
+	os.Remove(filepath.Join(dir, "甲(张三).txt"))
+	if err := lib.Sync(); err != nil {
+		t.Fatalf("同步索引失败: %v", err)
+	}
+	if _, exists := lib.Get("甲(张三).txt"); exists {
+		t.Error("文件删除后索引记录未移除")
+	}
+}
+
+func TestScanTxtFile(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "仙逆(耳根).txt")
+	content := "书名：仙逆\n作者：耳根\n简介：顺为凡，逆则仙\n来源：https://example.com/book/1/\n\n\n\n第01章 离乡\n\n　　正文\n\n\n第02章 拜师\n\n作者：王林\n来源：https://example.com/other/\n　　正文\n"
+	if err := os.WriteFile(fp, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := ScanFile(fp)
+	if err != nil {
+		t.Fatalf("读取TXT元数据失败: %v", err)
+	}
+	// 章节正文中以 "作者：" 等开头的行不覆盖文件头中的信息
+	if entry.BookName != "仙逆" || entry.Author != "耳根" || entry.URL != "https://example.com/book/1/" {
+		t.Errorf("书籍信息不正确: %+v", entry)
+	}
+	if entry.ChapterCount != 2 || entry.LatestChapter != "拜师" {
+		t.Errorf("章节信息不正确: %d, %s", entry.ChapterCount, entry.LatestChapter)
+	}
+}
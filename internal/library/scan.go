@@ -0,0 +1,139 @@
+package library
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go-novel/internal/config"
+	"go-novel/internal/rules"
+	"go-novel/internal/util"
+)
+
+var (
+	// fileNameRegex 匹配 "书名(作者).扩展名" 格式的文件名
+	fileNameRegex = regexp.MustCompile(`^(.+)\((.+)\)\.[^.]+$`)
+	// txtChapterRegex 匹配TXT文件中的章节标题行
+	txtChapterRegex = regexp.MustCompile(`^第(\d+)章 (.*)$`)
+)
+
+// ScanFile 从书籍文件中读取元数据
+func ScanFile(fp string) (*Entry, error) {
+	info, err := os.Stat(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(fp)
+	entry := &Entry{
+		FileName:  name,
+		Format:    strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), "."),
+		Size:      info.Size(),
+		CreatedAt: info.ModTime(),
+		UpdatedAt: info.ModTime(),
+	}
+
+	// 先从文件名中解析书名和作者
+	if matches := fileNameRegex.FindStringSubmatch(name); len(matches) == 3 {
+		entry.BookName = matches[1]
+		entry.Author = matches[2]
+	} else {
+		entry.BookName = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	switch entry.Format {
+	case "epub":
+		err = scanEpub(fp, entry)
+	case "txt":
+		err = scanTxt(fp, entry)
+	default:
+		err = fmt.Errorf("不支持的文件格式: %s", entry.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.URL != "" {
+		entry.SourceId, entry.Source = matchSource(entry.URL)
+	}
+	return entry, nil
+}
+
+// scanEpub 从EPUB的OPF和目录中读取元数据
+func scanEpub(fp string, entry *Entry) error {
+	meta, err := util.ReadEpubMeta(fp)
+	if err != nil {
+		return err
+	}
+
+	if meta.Title != "" {
+		entry.BookName = meta.Title
+	}
+	if meta.Author != "" {
+		entry.Author = meta.Author
+	}
+	entry.Intro = meta.Description
+	entry.Language = meta.Language
+	entry.CoverType = meta.CoverType
+
+	// 生成EPUB时书籍URL写入了 dc:identifier
+	if strings.HasPrefix(meta.Identifier, "http") {
+		entry.URL = meta.Identifier
+	}
+
+	entry.ChapterCount = len(meta.Chapters)
+	if entry.ChapterCount > 0 {
+		entry.LatestChapter = meta.Chapters[entry.ChapterCount-1]
+	}
+	return nil
+}
+
+// scanTxt 从TXT文件头和章节标题行读取元数据，文件头只到第一个章节标题为止，正文中的同名前缀不影响元数据
+func scanTxt(fp string, entry *Entry) error {
+	f, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	header := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if matches := txtChapterRegex.FindStringSubmatch(line); len(matches) == 3 {
+			header = false
+			entry.ChapterCount++
+			entry.LastChapter, _ = strconv.Atoi(matches[1])
+			entry.LatestChapter = matches[2]
+			continue
+		}
+		if !header {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "书名："):
+			entry.BookName = strings.TrimPrefix(line, "书名：")
+		case strings.HasPrefix(line, "作者："):
+			entry.Author = strings.TrimPrefix(line, "作者：")
+		case strings.HasPrefix(line, "简介：") && entry.Intro == "":
+			entry.Intro = strings.TrimPrefix(line, "简介：")
+		case strings.HasPrefix(line, "来源："):
+			entry.URL = strings.TrimPrefix(line, "来源：")
+		}
+	}
+	return scanner.Err()
+}
+
+// matchSource 根据书籍URL的域名匹配激活规则中的书源，返回规则ID和限定ID
+func matchSource(bookUrl string) (int, string) {
+	rule, err := rules.GetRuleManager().MatchRuleByUrl(config.GetConfig().Copy().Source.RuleFiles(), bookUrl)
+	if err != nil || rule == nil {
+		return 0, ""
+	}
+	return rule.ID, config.QualifiedSourceId(rule.File, rule.ID)
+}
@@ -12,4 +12,5 @@ type Book struct {
 	WordCount      string `json:"wordCount"`
 	URL            string `json:"url"`
 	SourceId       int    `json:"sourceId"`
+	Source         string `json:"source"` // 书源的限定ID "规则文件#规则ID"
 }
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"regexp"
+
+	"go-novel/internal/charmap"
+	"go-novel/internal/selector"
+	"go-novel/internal/urltemplate"
+)
+
+// CompiledRule 预编译的规则，由规则管理器在加载规则时生成，字段为空时对应的选择器、模板和正则为 nil
+type CompiledRule struct {
+	Search  CompiledSearchRule
+	Book    CompiledBookRule
+	Toc     CompiledTocRule
+	Chapter CompiledChapterRule
+}
+
+type CompiledSearchRule struct {
+	URL            *urltemplate.Template
+	Data           *urltemplate.Template
+	Result         *selector.Selector
+	BookName       *selector.Selector
+	BookURL        *selector.Selector
+	Author         *selector.Selector
+	Category       *selector.Selector
+	WordCount      *selector.Selector
+	Status         *selector.Selector
+	LatestChapter  *selector.Selector
+	LastUpdateTime *selector.Selector
+	NextPage       *selector.Selector
+}
+
+type CompiledBookRule struct {
+	URL            *regexp.Regexp // 书籍URL的正则，分组可在目录URL模板中使用
+	BookName       *selector.Selector
+	Author         *selector.Selector
+	Intro          *selector.Selector
+	Category       *selector.Selector
+	CoverUrl       *selector.Selector
+	LatestChapter  *selector.Selector
+	LastUpdateTime *selector.Selector
+	Status         *selector.Selector
+	WordCount      *selector.Selector
+}
+
+type CompiledTocRule struct {
+	URL         *urltemplate.Template
+	Item        *selector.Selector
+	ChapterName *selector.Selector
+	ChapterURL  *selector.Selector
+	NextPage    *selector.Selector
+}
+
+type CompiledChapterRule struct {
+	Title     *selector.Selector
+	Content   *selector.Selector
+	NextPage  *selector.Selector
+	FilterTxt *regexp.Regexp
+	Decoder   *charmap.Decoder // 字符映射与干扰字符，未配置时为 nil
+}
@@ -1,67 +1,97 @@
 package model
 
 type Rule struct {
-	ID       int         `json:"id"`
-	URL      string      `json:"url"`
-	Name     string      `json:"name"`
-	Comment  string      `json:"comment"`
-	Language string      `json:"language"`
-	Search   SearchRule  `json:"search"`
-	Book     BookRule    `json:"book"`
-	Toc      TocRule     `json:"toc"`
-	Chapter  ChapterRule `json:"chapter"`
-	Crawl    CrawlRule   `json:"crawl"`
+	ID       int               `json:"id"`
+	URL      string            `json:"url"`
+	Name     string            `json:"name"`
+	Comment  string            `json:"comment"`
+	Language string            `json:"language"`
+	Disabled bool              `json:"disabled,omitempty"` // 停用的书源不参与搜索和下载
+	Headers  map[string]string `json:"headers,omitempty"`  // 所有请求的请求头，各阶段 headers 中的同名项优先
+	Login    *LoginRule        `json:"login,omitempty"`    // 需要登录的书源在请求详情页、目录和正文前登录
+	Search   SearchRule        `json:"search"`
+	Book     BookRule          `json:"book"`
+	Toc      TocRule           `json:"toc"`
+	Chapter  ChapterRule       `json:"chapter"`
+	Crawl    CrawlRule         `json:"crawl"`
+
+	File     string        `json:"-"` // 规则所在的规则文件，加载规则时设置
+	Compiled *CompiledRule `json:"-"` // 预编译的选择器与正则，加载规则时生成
+}
+
+// LoginRule 登录规则，发起登录请求或执行登录脚本，登录后的Cookie用于之后的请求。
+// URL、Data 为URL模板，可以使用 {{username}}、{{password}} 和登录凭据中的其他字段
+type LoginRule struct {
+	URL      string            `json:"url,omitempty"`
+	Method   string            `json:"method,omitempty"`   // 默认为 post
+	Data     string            `json:"data,omitempty"`     // 请求参数，格式同 search.data
+	BodyType string            `json:"bodyType,omitempty"` // data 的格式：form (默认)、json 或 raw
+	Headers  map[string]string `json:"headers,omitempty"`
+	Script   string            `json:"script,omitempty"`  // 代替登录请求的脚本，credential 为登录凭据，结果 r 用于检查 success
+	Success  string            `json:"success,omitempty"` // 登录响应中包含该文本时视为成功，为空时状态码为2xx即成功
+	Expired  string            `json:"expired,omitempty"` // 页面中包含该文本时视为登录失效，重新登录后重试
 }
 
 type SearchRule struct {
-	Disabled       bool   `json:"disabled"`
-	URL            string `json:"url"`
-	Method         string `json:"method"`
-	Data           string `json:"data"`
-	Cookies        string `json:"cookies"`
-	Result         string `json:"result"`
-	BookName       string `json:"bookName"`
-	Author         string `json:"author"`
-	Category       string `json:"category"`
-	WordCount      string `json:"wordCount"`
-	Status         string `json:"status"`
-	LatestChapter  string `json:"latestChapter"`
-	LastUpdateTime string `json:"lastUpdateTime"`
-	Pagination     bool   `json:"pagination"`
-	NextPage       string `json:"nextPage"`
+	Disabled       bool              `json:"disabled"`
+	URL            string            `json:"url"`
+	Method         string            `json:"method"`
+	Data           string            `json:"data"`
+	BodyType       string            `json:"bodyType,omitempty"` // data 的格式：form (默认)、json 或 raw
+	Cookies        string            `json:"cookies"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Result         string            `json:"result"`
+	BookName       string            `json:"bookName"`
+	BookURL        string            `json:"bookUrl,omitempty"` // 书籍链接，为空时取书名元素的 href 属性
+	Author         string            `json:"author"`
+	Category       string            `json:"category"`
+	WordCount      string            `json:"wordCount"`
+	Status         string            `json:"status"`
+	LatestChapter  string            `json:"latestChapter"`
+	LastUpdateTime string            `json:"lastUpdateTime"`
+	Pagination     bool              `json:"pagination"`
+	NextPage       string            `json:"nextPage"`
 }
 
 type BookRule struct {
-	URL            string `json:"url"`
-	BookName       string `json:"bookName"`
-	Author         string `json:"author"`
-	Intro          string `json:"intro"`
-	Category       string `json:"category"`
-	CoverUrl       string `json:"coverUrl"`
-	LatestChapter  string `json:"latestChapter"`
-	LastUpdateTime string `json:"lastUpdateTime"`
-	Status         string `json:"status"`
-	WordCount      string `json:"wordCount"`
+	URL            string            `json:"url"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	BookName       string            `json:"bookName"`
+	Author         string            `json:"author"`
+	Intro          string            `json:"intro"`
+	Category       string            `json:"category"`
+	CoverUrl       string            `json:"coverUrl"`
+	LatestChapter  string            `json:"latestChapter"`
+	LastUpdateTime string            `json:"lastUpdateTime"`
+	Status         string            `json:"status"`
+	WordCount      string            `json:"wordCount"`
 }
 
 type TocRule struct {
-	BaseUri    string `json:"baseUri"`
-	URL        string `json:"url"`
-	Item       string `json:"item"`
-	IsDesc     bool   `json:"isDesc"`
-	Pagination bool   `json:"pagination"`
-	NextPage   string `json:"nextPage"`
+	BaseUri     string            `json:"baseUri"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Item        string            `json:"item"`
+	ChapterName string            `json:"chapterName,omitempty"` // 章节名，相对于目录项，为空时取目录项的文本
+	ChapterURL  string            `json:"chapterUrl,omitempty"`  // 章节链接，相对于目录项，为空时取目录项的 href 属性
+	IsDesc      bool              `json:"isDesc"`
+	Pagination  bool              `json:"pagination"`
+	NextPage    string            `json:"nextPage"`
 }
 
 type ChapterRule struct {
-	Title              string `json:"title"`
-	Content            string `json:"content"`
-	ParagraphTagClosed bool   `json:"paragraphTagClosed"`
-	ParagraphTag       string `json:"paragraphTag"`
-	FilterTxt          string `json:"filterTxt"`
-	FilterTag          string `json:"filterTag"`
-	Pagination         bool   `json:"pagination"`
-	NextPage           string `json:"nextPage"`
+	Title              string            `json:"title"`
+	Content            string            `json:"content"`
+	ParagraphTagClosed bool              `json:"paragraphTagClosed"`
+	ParagraphTag       string            `json:"paragraphTag"`
+	FilterTxt          string            `json:"filterTxt"`
+	FilterTag          string            `json:"filterTag"`
+	Pagination         bool              `json:"pagination"`
+	NextPage           string            `json:"nextPage"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	CharMap            map[string]string `json:"charMap,omitempty"`    // 字符映射表，还原自定义字体替换的私用区字符，在 filterTxt 之前生效
+	StripNoise         bool              `json:"stripNoise,omitempty"` // 去除零宽字符等不可见的干扰字符
+	NoiseChars         string            `json:"noiseChars,omitempty"` // 额外去除的干扰字符
 }
 
 type CrawlRule struct {
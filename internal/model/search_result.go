@@ -10,4 +10,5 @@ type SearchResult struct {
 	LastUpdateTime string `json:"lastUpdateTime"`
 	URL            string `json:"url"`
 	SourceId       int    `json:"sourceId"`
+	Source         string `json:"source"` // 书源的限定ID "规则文件#规则ID"
 }
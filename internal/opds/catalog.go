@@ -0,0 +1,88 @@
+package opds
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go-novel/internal/library"
+)
+
+// NewRootFeed 创建导航目录，包含最新下载和全部书籍两个子目录
+func NewRootFeed(updated time.Time) *Feed {
+	feed := NewFeed("urn:go-novel:root", "Go Novel 书库", updated)
+	feed.AddLink("self", "/opds", TypeNavigation)
+	feed.AddLink("start", "/opds", TypeNavigation)
+	feed.AddLink("search", "/opds/opensearch.xml", TypeOpenSearch)
+
+	feed.AddNavigation("urn:go-novel:new", "最新下载", "按下载时间倒序排列的书籍", "/opds/new", TypeAcquisition)
+	feed.AddNavigation("urn:go-novel:books", "全部书籍", "按书名排列的全部书籍", "/opds/books", TypeAcquisition)
+	return feed
+}
+
+// NewSearchFeed 创建搜索结果的获取目录，query 为原始的查询内容
+func NewSearchFeed(query string, books []library.Entry) *Feed {
+	self := "/opds/search?q=" + url.QueryEscape(query)
+	return NewAcquisitionFeed("urn:go-novel:search", fmt.Sprintf("搜索: %s", query), self, books)
+}
+
+// NewAcquisitionFeed 根据书籍列表创建获取目录
+func NewAcquisitionFeed(id, title, self string, books []library.Entry) *Feed {
+	feed := NewFeed(id, title, time.Now())
+	feed.AddLink("self", self, TypeAcquisition)
+	feed.AddLink("start", "/opds", TypeNavigation)
+	feed.AddLink("up", "/opds", TypeNavigation)
+	feed.AddLink("search", "/opds/opensearch.xml", TypeOpenSearch)
+
+	for _, book := range books {
+		feed.Entries = append(feed.Entries, NewBookEntry(book))
+	}
+	return feed
+}
+
+// NewBookEntry 创建书籍条目，包含下载链接，EPUB有封面时包含封面链接
+func NewBookEntry(book library.Entry) Entry {
+	sum := md5.Sum([]byte(book.FileName))
+	entry := Entry{
+		ID:       "urn:go-novel:book:" + hex.EncodeToString(sum[:]),
+		Title:    book.BookName,
+		Updated:  FormatTime(book.UpdatedAt),
+		Language: book.Language,
+	}
+	if book.Author != "" {
+		entry.Authors = []Author{{Name: book.Author}}
+	}
+	if book.Intro != "" {
+		entry.Summary = &Content{Type: "text", Text: book.Intro}
+	}
+
+	escaped := url.QueryEscape(book.FileName)
+	entry.Links = append(entry.Links, Link{
+		Rel:   RelAcquisition,
+		Href:  "/api/book/download?filename=" + escaped,
+		Type:  BookContentType(book.Format),
+		Title: book.FileName,
+	})
+	if book.CoverType != "" {
+		coverHref := "/opds/cover?filename=" + escaped
+		entry.Links = append(entry.Links,
+			Link{Rel: RelImage, Href: coverHref, Type: book.CoverType},
+			Link{Rel: RelThumbnail, Href: coverHref, Type: book.CoverType},
+		)
+	}
+	return entry
+}
+
+// BookContentType 根据书籍格式返回媒体类型
+func BookContentType(format string) string {
+	switch format {
+	case "epub":
+		return "application/epub+zip"
+	case "txt":
+		return "text/plain"
+	default:
+		return "application/octet-stream"
+	}
+}
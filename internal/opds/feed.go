@@ -0,0 +1,158 @@
+// Package opds 提供OPDS 1.2目录（Atom）的数据结构与生成函数
+package opds
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const (
+	// NamespaceAtom Atom命名空间
+	NamespaceAtom = "http://www.w3.org/2005/Atom"
+	// NamespaceOPDS OPDS命名空间
+	NamespaceOPDS = "http://opds-spec.org/2010/catalog"
+	// NamespaceDC Dublin Core命名空间
+	NamespaceDC = "http://purl.org/dc/terms/"
+
+	// TypeNavigation 导航目录的媒体类型
+	TypeNavigation = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	// TypeAcquisition 获取目录的媒体类型
+	TypeAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	// TypeOpenSearch OpenSearch描述文件的媒体类型
+	TypeOpenSearch = "application/opensearchdescription+xml"
+
+	// RelAcquisition 获取链接
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	// RelImage 封面图片链接
+	RelImage = "http://opds-spec.org/image"
+	// RelThumbnail 封面缩略图链接
+	RelThumbnail = "http://opds-spec.org/image/thumbnail"
+	// RelSortNew 按时间排序的目录
+	RelSortNew = "http://opds-spec.org/sort/new"
+)
+
+// Feed Atom目录
+type Feed struct {
+	XMLName   xml.Name `xml:"feed"`
+	Xmlns     string   `xml:"xmlns,attr"`
+	XmlnsOPDS string   `xml:"xmlns:opds,attr"`
+	XmlnsDC   string   `xml:"xmlns:dc,attr"`
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Updated   string   `xml:"updated"`
+	Author    *Author  `xml:"author,omitempty"`
+	Links     []Link   `xml:"link"`
+	Entries   []Entry  `xml:"entry"`
+}
+
+// Author 作者
+type Author struct {
+	Name string `xml:"name"`
+}
+
+// Link 链接
+type Link struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+// Content 条目内容
+type Content struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// Entry 目录条目
+type Entry struct {
+	ID       string   `xml:"id"`
+	Title    string   `xml:"title"`
+	Updated  string   `xml:"updated"`
+	Authors  []Author `xml:"author,omitempty"`
+	Language string   `xml:"dc:language,omitempty"`
+	Summary  *Content `xml:"summary,omitempty"`
+	Content  *Content `xml:"content,omitempty"`
+	Links    []Link   `xml:"link"`
+}
+
+// NewFeed 创建目录
+func NewFeed(id, title string, updated time.Time) *Feed {
+	return &Feed{
+		Xmlns:     NamespaceAtom,
+		XmlnsOPDS: NamespaceOPDS,
+		XmlnsDC:   NamespaceDC,
+		ID:        id,
+		Title:     title,
+		Updated:   FormatTime(updated),
+		Author:    &Author{Name: "Go Novel"},
+	}
+}
+
+// AddLink 添加目录链接
+func (f *Feed) AddLink(rel, href, typ string) {
+	f.Links = append(f.Links, Link{Rel: rel, Href: href, Type: typ})
+}
+
+// AddNavigation 添加导航条目
+func (f *Feed) AddNavigation(id, title, summary, href, typ string) {
+	f.Entries = append(f.Entries, Entry{
+		ID:      id,
+		Title:   title,
+		Updated: f.Updated,
+		Content: &Content{Type: "text", Text: summary},
+		Links:   []Link{{Rel: "subsection", Href: href, Type: typ}},
+	})
+}
+
+// Marshal 生成带XML声明的目录内容
+func (f *Feed) Marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// OpenSearchDescription OpenSearch描述文件
+type OpenSearchDescription struct {
+	XMLName        xml.Name      `xml:"OpenSearchDescription"`
+	Xmlns          string        `xml:"xmlns,attr"`
+	ShortName      string        `xml:"ShortName"`
+	Description    string        `xml:"Description"`
+	InputEncoding  string        `xml:"InputEncoding"`
+	OutputEncoding string        `xml:"OutputEncoding"`
+	URL            OpenSearchURL `xml:"Url"`
+}
+
+// OpenSearchURL OpenSearch查询模板
+type OpenSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// NewOpenSearchDescription 创建OpenSearch描述文件，template 中使用 {searchTerms} 占位
+func NewOpenSearchDescription(template string) *OpenSearchDescription {
+	return &OpenSearchDescription{
+		Xmlns:          "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:      "Go Novel",
+		Description:    "搜索本地书库",
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		URL:            OpenSearchURL{Type: TypeAcquisition, Template: template},
+	}
+}
+
+// Marshal 生成带XML声明的描述文件内容
+func (d *OpenSearchDescription) Marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// FormatTime 按Atom要求格式化时间
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,142 @@
+package opds
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"go-novel/internal/library"
+)
+
+// linkByRel 查找指定关系的链接
+func linkByRel(links []Link, rel string) (Link, bool) {
+	for _, link := range links {
+		if link.Rel == rel {
+			return link, true
+		}
+	}
+	return Link{}, false
+}
+
+// roundTrip 生成目录后重新解析，检查输出是有效的XML
+func roundTrip(t *testing.T, feed *Feed) (string, Feed) {
+	t.Helper()
+	data, err := feed.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed Feed
+	if err := xml.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("目录不是有效的XML: %v\n%s", err, data)
+	}
+	return string(data), parsed
+}
+
+func TestRootFeed(t *testing.T) {
+	_, feed := roundTrip(t, NewRootFeed(time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)))
+
+	if feed.Updated != "2026-10-18T08:00:00Z" {
+		t.Errorf("更新时间格式不正确: %s", feed.Updated)
+	}
+	if link, ok := linkByRel(feed.Links, "search"); !ok || link.Href != "/opds/opensearch.xml" || link.Type != TypeOpenSearch {
+		t.Errorf("导航目录应包含OpenSearch链接: %+v", feed.Links)
+	}
+
+	want := map[string]string{"最新下载": "/opds/new", "全部书籍": "/opds/books"}
+	if len(feed.Entries) != len(want) {
+		t.Fatalf("导航目录应有 %d 个条目，实际 %d 个", len(want), len(feed.Entries))
+	}
+	for _, entry := range feed.Entries {
+		link, ok := linkByRel(entry.Links, "subsection")
+		if !ok || link.Href != want[entry.Title] || link.Type != TypeAcquisition {
+			t.Errorf("导航条目 %s 的链接不正确: %+v", entry.Title, entry.Links)
+		}
+	}
+}
+
+func TestAcquisitionFeed(t *testing.T) {
+	books := []library.Entry{
+		{FileName: "诡秘之主(爱潜水的乌贼).epub", Format: "epub", BookName: "诡秘之主", Author: "爱潜水的乌贼", Intro: "蒸汽与机械", CoverType: "image/jpeg", Language: "zh"},
+		{FileName: "A&B <test>.txt", Format: "txt", BookName: `A&B <"书名">`, Author: "作者<&>"},
+	}
+	data, feed := roundTrip(t, NewAcquisitionFeed("urn:go-novel:books", "全部书籍", "/opds/books", books))
+
+	if len(feed.Entries) != 2 {
+		t.Fatalf("应有 2 个书籍条目，实际 %d 个", len(feed.Entries))
+	}
+	if link, ok := linkByRel(feed.Links, "self"); !ok || link.Href != "/opds/books" || link.Type != TypeAcquisition {
+		t.Errorf("获取目录的 self 链接不正确: %+v", feed.Links)
+	}
+
+	epub := feed.Entries[0]
+	if link, ok := linkByRel(epub.Links, RelAcquisition); !ok || link.Type != "application/epub+zip" ||
+		link.Href != "/api/book/download?filename=%E8%AF%A1%E7%A7%98%E4%B9%8B%E4%B8%BB%28%E7%88%B1%E6%BD%9C%E6%B0%B4%E7%9A%84%E4%B9%8C%E8%B4%BC%29.epub" {
+		t.Errorf("EPUB下载链接不正确: %+v", epub.Links)
+	}
+	if link, ok := linkByRel(epub.Links, RelImage); !ok || link.Type != "image/jpeg" || !strings.HasPrefix(link.Href, "/opds/cover?filename=") {
+		t.Errorf("有封面的EPUB应包含封面链接: %+v", epub.Links)
+	}
+	// encoding/xml 解析时不识别 dc: 前缀，语言直接检查输出
+	if epub.Summary == nil || epub.Summary.Text != "蒸汽与机械" || !strings.Contains(data, "<dc:language>zh</dc:language>") {
+		t.Errorf("EPUB条目的简介或语言不正确: %+v", epub)
+	}
+
+	// 标题、作者和链接中的特殊字符被转义，解析后与原文一致
+	txt := feed.Entries[1]
+	if txt.Title != `A&B <"书名">` || len(txt.Authors) != 1 || txt.Authors[0].Name != "作者<&>" {
+		t.Errorf("标题或作者解析后与原文不一致: %+v", txt)
+	}
+	if link, ok := linkByRel(txt.Links, RelAcquisition); !ok || link.Type != "text/plain" || link.Href != "/api/book/download?filename=A%26B+%3Ctest%3E.txt" {
+		t.Errorf("TXT下载链接不正确: %+v", txt.Links)
+	}
+	if _, ok := linkByRel(txt.Links, RelImage); ok {
+		t.Errorf("没有封面的书籍不应包含封面链接")
+	}
+	if !strings.Contains(data, "<title>A&amp;B &lt;&#34;书名&#34;&gt;</title>") || !strings.Contains(data, "<name>作者&lt;&amp;&gt;</name>") {
+		t.Errorf("标题和作者应转义:\n%s", data)
+	}
+	if epub.ID == txt.ID {
+		t.Errorf("不同书籍的条目ID应不同")
+	}
+}
+
+func TestSearchFeed(t *testing.T) {
+	_, feed := roundTrip(t, NewSearchFeed("仙逆 & <耳根>", nil))
+
+	if feed.Title != "搜索: 仙逆 & <耳根>" {
+		t.Errorf("搜索目录标题不正确: %s", feed.Title)
+	}
+	if link, ok := linkByRel(feed.Links, "self"); !ok || link.Href != "/opds/search?q=%E4%BB%99%E9%80%86+%26+%3C%E8%80%B3%E6%A0%B9%3E" {
+		t.Errorf("搜索目录的 self 链接应包含转义后的查询: %+v", feed.Links)
+	}
+	if len(feed.Entries) != 0 {
+		t.Errorf("没有结果时不应有条目: %+v", feed.Entries)
+	}
+}
+
+func TestOpenSearchDescription(t *testing.T) {
+	data, err := NewOpenSearchDescription("/opds/search?q={searchTerms}").Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var desc OpenSearchDescription
+	if err := xml.Unmarshal(data, &desc); err != nil {
+		t.Fatalf("描述文件不是有效的XML: %v\n%s", err, data)
+	}
+	if desc.URL.Template != "/opds/search?q={searchTerms}" || desc.URL.Type != TypeAcquisition {
+		t.Errorf("查询模板不正确: %+v", desc.URL)
+	}
+	if !strings.Contains(string(data), `xmlns="http://a9.com/-/spec/opensearch/1.1/"`) {
+		t.Errorf("描述文件应声明OpenSearch命名空间:\n%s", data)
+	}
+}
+
+func TestBookContentType(t *testing.T) {
+	for format, want := range map[string]string{"epub": "application/epub+zip", "txt": "text/plain", "pdf": "application/octet-stream"} {
+		if got := BookContentType(format); got != want {
+			t.Errorf("%s 的媒体类型应为 %s，实际 %s", format, want, got)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-novel/internal/config"
+)
+
+// FileMeta 规则文件的元数据。带元数据的规则文件格式为 {"meta": {...}, "rules": [...]}，
+// 不带元数据时为规则数组，两种格式都可以加载
+type FileMeta struct {
+	Name          string `json:"name,omitempty"`
+	Version       string `json:"version,omitempty"`
+	Author        string `json:"author,omitempty"`
+	Description   string `json:"description,omitempty"`
+	Updated       string `json:"updated,omitempty"`       // 最后修改时间，RFC 3339 格式，保存规则时自动更新
+	MinAppVersion string `json:"minAppVersion,omitempty"` // 要求的最低 go-novel 版本，如 v1.2.0
+}
+
+// rulesFile 带元数据的规则文件
+type rulesFile struct {
+	Meta  *FileMeta         `json:"meta"`
+	Rules []json.RawMessage `json:"rules"`
+}
+
+// parseRulesFile 解析规则文件内容，返回元数据 (数组格式时为 nil) 和每条规则的原始JSON
+func parseRulesFile(data []byte) (*FileMeta, []json.RawMessage, error) {
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		var file rulesFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, nil, fmt.Errorf("%s", describeJSONError(data, err))
+		}
+		if file.Meta == nil {
+			file.Meta = &FileMeta{}
+		}
+		return file.Meta, file.Rules, nil
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, nil, fmt.Errorf("%s", describeJSONError(data, err))
+	}
+	return nil, raws, nil
+}
+
+// encodeRulesFile 格式化规则文件，meta 为 nil 时输出规则数组
+func encodeRulesFile(meta *FileMeta, raws []json.RawMessage) ([]byte, error) {
+	rules, err := marshalRawRules(raws)
+	if err != nil || meta == nil {
+		return rules, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(meta); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(`{"meta":`)
+	out.Write(bytes.TrimSpace(buf.Bytes()))
+	out.WriteString(`,"rules":`)
+	out.Write(rules)
+	out.WriteString("}")
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, out.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	return indented.Bytes(), nil
+}
+
+// touch 更新元数据中的修改时间
+func (m *FileMeta) touch() {
+	if m != nil {
+		m.Updated = time.Now().Format(time.RFC3339)
+	}
+}
+
+// checkAppVersion 检查当前程序版本是否满足规则文件的最低版本要求，开发版本不检查
+func (m *FileMeta) checkAppVersion() error {
+	if m == nil || m.MinAppVersion == "" || config.Version == config.DevVersion {
+		return nil
+	}
+	if compareVersions(config.Version, m.MinAppVersion) < 0 {
+		return fmt.Errorf("要求 go-novel %s 及以上版本，当前版本为 %s", m.MinAppVersion, config.Version)
+	}
+	return nil
+}
+
+// compareVersions 比较 v1.2.3 形式的版本号，忽略 v 前缀和 - 之后的预发布标识
+func compareVersions(a, b string) int {
+	parse := func(v string) []int {
+		v, _, _ = strings.Cut(strings.TrimPrefix(strings.TrimSpace(v), "v"), "-")
+		var parts []int
+		for _, s := range strings.Split(v, ".") {
+			n, _ := strconv.Atoi(s)
+			parts = append(parts, n)
+		}
+		return parts
+	}
+
+	pa, pb := parse(a), parse(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionPattern 元数据中 minAppVersion 的格式
+var versionPattern = regexp.MustCompile(`^v?\d+(\.\d+)*(-[0-9A-Za-z.]+)?$`)
+
+// SetMeta 设置规则文件的元数据，数组格式的文件保存后转为带元数据的格式
+func (rm *RuleManager) SetMeta(filename string, meta FileMeta) ([]Issue, error) {
+	if meta.MinAppVersion != "" && !versionPattern.MatchString(meta.MinAppVersion) {
+		return nil, fmt.Errorf("无效的版本号: %s", meta.MinAppVersion)
+	}
+	return rm.updateFile(filename, false, func(file *rulesFile) error {
+		file.Meta = &meta
+		return nil
+	})
+}
+
+// ExportRules 将规则文件中指定ID的规则导出为带元数据的规则包，ids 为空时导出全部规则。
+// 文件没有元数据时以文件名作为规则包名称
+func ExportRules(filename string, ids []int) ([]byte, error) {
+	fp, err := rulesFilePath(filename)
+	if err != nil {
+		return nil, err
+	}
+	meta, raws, err := readRuleFile(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) > 0 {
+		selected := make([]json.RawMessage, 0, len(ids))
+		for _, id := range ids {
+			index := ruleIndex(raws, id)
+			if index < 0 {
+				return nil, fmt.Errorf("%w: %d", ErrRuleNotFound, id)
+			}
+			selected = append(selected, raws[index])
+		}
+		raws = selected
+	}
+
+	if meta == nil {
+		meta = &FileMeta{Name: strings.TrimSuffix(filename, filepath.Ext(filename))}
+		meta.touch()
+	}
+	return encodeRulesFile(meta, raws)
+}
+
+// isLegadoSource 判断导入内容是否为阅读书源：书源对象包含 bookSourceUrl 字段
+func isLegadoSource(data []byte) bool {
+	var probe struct {
+		BookSourceURL *string `json:"bookSourceUrl"`
+	}
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		return json.Unmarshal(data, &probe) == nil && probe.BookSourceURL != nil
+	}
+	var items []json.RawMessage
+	if json.Unmarshal(data, &items) != nil || len(items) == 0 {
+		return false
+	}
+	return json.Unmarshal(items[0], &probe) == nil && probe.BookSourceURL != nil
+}
+
+// ImportRules 将规则包或规则数组合并到规则文件，文件不存在时创建并沿用规则包的元数据。
+// 阅读书源转交 ImportLegado 处理。合并时与已有规则网址相同的规则被覆盖，保留本地ID和停用状态，
+// 内容不同时给出警告；其余规则追加到文件，ID已被占用时改用新的ID；存在错误的规则被跳过。dryRun 为 true 时不写入
+func (rm *RuleManager) ImportRules(filename, source string, data []byte, dryRun bool) (*ImportResult, error) {
+	if isLegadoSource(data) {
+		return rm.ImportLegado(filename, source, data, dryRun)
+	}
+
+	meta, incoming, err := parseRulesFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析规则文件 %s 失败: %s", source, err)
+	}
+	if err := meta.checkAppVersion(); err != nil {
+		return nil, fmt.Errorf("无法导入 %s: %w", source, err)
+	}
+	rules, issues, err := validateIndexed(source, data)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := make(map[int]bool)
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			skipped[issue.Index] = true
+		}
+	}
+
+	var result *ImportResult
+	merge := func(file *rulesFile) error {
+		result = &ImportResult{Sources: len(incoming), Meta: meta, Issues: issues}
+		result.Imported = []RuleSummary{}
+		result.Updated = []RuleSummary{}
+		if file.Rules == nil && file.Meta == nil {
+			file.Meta = meta
+		}
+
+		nextID := maxRuleID(file.Rules)
+		for i, raw := range incoming {
+			if skipped[i] || rules[i] == nil {
+				continue
+			}
+			rule := *rules[i]
+			localID := rule.ID
+			local := struct {
+				ID       *int   `json:"id"`
+				Name     string `json:"name"`
+				Disabled bool   `json:"disabled"`
+			}{ID: &localID}
+			index := ruleURLIndex(file.Rules, rule.URL)
+			switch {
+			case index >= 0:
+				json.Unmarshal(file.Rules[index], &local)
+			case ruleIndex(file.Rules, rule.ID) >= 0:
+				nextID++
+				localID = nextID
+				result.Issues = append(result.Issues, Issue{
+					File: source, Index: i, RuleID: rule.ID, RuleName: rule.Name, Field: "id", Severity: SeverityWarning,
+					Message: fmt.Sprintf("ID已被 %s 中的规则占用，改为 %d", filename, localID),
+				})
+			}
+			if localID != rule.ID {
+				if raw, err = setJSONField(raw, "id", localID); err != nil {
+					return err
+				}
+				rule.ID = localID
+			}
+			if localID > nextID {
+				nextID = localID
+			}
+
+			if index >= 0 {
+				// 本地停用的书源导入后仍保持停用
+				if local.Disabled && !rule.Disabled {
+					if raw, err = setJSONField(raw, "disabled", true); err != nil {
+						return err
+					}
+					rule.Disabled = true
+				}
+				if !sameJSON(file.Rules[index], raw) {
+					result.Issues = append(result.Issues, Issue{
+						File: source, Index: i, RuleID: rule.ID, RuleName: rule.Name, Severity: SeverityWarning,
+						Message: fmt.Sprintf("将覆盖 %s 中网址相同的规则 %d (%s)，本地修改不会保留", filename, localID, local.Name),
+					})
+				}
+				file.Rules[index] = raw
+				result.Updated = append(result.Updated, ruleSummary(rule))
+			} else {
+				file.Rules = append(file.Rules, raw)
+				result.Imported = append(result.Imported, ruleSummary(rule))
+			}
+		}
+		return nil
+	}
+
+	if dryRun {
+		fp, err := rulesFilePath(filename)
+		if err != nil {
+			return nil, err
+		}
+		var file rulesFile
+		file.Meta, file.Rules, err = readRuleFile(fp)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err := merge(&file); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	if _, err := rm.updateFile(filename, true, merge); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sameJSON 两段JSON是否只有空白不同
+func sameJSON(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
+
+// ruleURLIndex 查找网址相同的规则在数组中的位置，忽略末尾的斜杠，不存在时返回 -1
+func ruleURLIndex(raws []json.RawMessage, ruleURL string) int {
+	ruleURL = strings.TrimRight(ruleURL, "/")
+	if ruleURL == "" {
+		return -1
+	}
+	for i, raw := range raws {
+		var header struct {
+			URL string `json:"url"`
+		}
+		if json.Unmarshal(raw, &header) == nil && strings.TrimRight(header.URL, "/") == ruleURL {
+			return i
+		}
+	}
+	return -1
+}
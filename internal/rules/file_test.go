@@ -0,0 +1,119 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-novel/internal/config"
+	"go-novel/internal/model"
+)
+
+func TestExportImportRules(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(RulesDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	manager := &RuleManager{rules: make(map[string][]model.Rule)}
+
+	rule := func(id int, name, url string) string {
+		return fmt.Sprintf(`{"id": %d, "name": %q, "url": %q, "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}`, id, name, url)
+	}
+	shared := "[" + rule(1, "书源一", "https://a.example.com/") + "," + rule(2, "书源二", "https://b.example.com/") + "," + rule(3, "书源三", "https://c.example.com/") + "]"
+	local := "[" + rule(1, "本地书源", "https://local.example.com/") + "," + rule(5, "旧书源二", "https://b.example.com") + "]"
+	os.WriteFile(filepath.Join(RulesDir(), "shared.json"), []byte(shared), 0644)
+	os.WriteFile(filepath.Join(RulesDir(), "local.json"), []byte(local), 0644)
+
+	// 设置元数据后文件转为带元数据的格式，规则仍可加载
+	if _, err := manager.SetMeta("shared.json", FileMeta{Name: "共享书源", Version: "1.0.0", Author: "tester"}); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := manager.GetRuleById("shared.json", 2); r == nil || r.Name != "书源二" {
+		t.Fatalf("带元数据的规则文件应能加载: %+v", r)
+	}
+	if err := manager.SetDisabled("shared.json", 3, true); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := ListFiles()
+	if len(files) != 2 || files[1].Meta == nil || files[1].Meta.Name != "共享书源" || files[1].Meta.Updated == "" || files[1].Rules != 3 {
+		t.Fatalf("修改规则后应保留元数据并更新修改时间: %+v", files)
+	}
+
+	bundle, err := ExportRules("shared.json", []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bundle), `"name": "共享书源"`) || strings.Contains(string(bundle), "书源三") {
+		t.Fatalf("导出的规则包不正确:\n%s", bundle)
+	}
+
+	// 网址相同的规则被覆盖并保留本地ID和停用状态，ID冲突的规则改用新ID
+	if err := manager.SetDisabled("local.json", 5, true); err != nil {
+		t.Fatal(err)
+	}
+	result, err := manager.ImportRules("local.json", "shared-export.json", bundle, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Updated) != 1 || result.Updated[0].ID != 5 || result.Updated[0].Name != "书源二" {
+		t.Errorf("网址相同的规则应覆盖并保留本地ID: %+v", result.Updated)
+	}
+	if len(result.Imported) != 1 || result.Imported[0].ID != 6 || len(result.Issues) != 2 || result.Issues[0].Field != "id" {
+		t.Errorf("ID冲突的规则应改用新ID并给出警告: %+v %+v", result.Imported, result.Issues)
+	}
+	if len(result.Issues) == 2 && (result.Issues[1].RuleID != 5 || !strings.Contains(result.Issues[1].Message, "旧书源二")) {
+		t.Errorf("覆盖内容不同的本地规则应给出警告: %+v", result.Issues[1])
+	}
+	list, _ := ListRules("local.json")
+	if len(list) != 3 || list[0].Name != "本地书源" || list[1].Name != "书源二" || !list[1].Disabled || list[2].Name != "书源一" {
+		t.Errorf("合并后的规则不正确: %+v", list)
+	}
+
+	// 再次导入时内容相同，不提示覆盖
+	result, err = manager.ImportRules("local.json", "shared-export.json", bundle, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range result.Issues {
+		if issue.RuleID == 5 {
+			t.Errorf("内容相同的规则不应提示覆盖: %+v", issue)
+		}
+	}
+
+	// 导入到不存在的文件时沿用规则包的元数据
+	if _, err := manager.ImportRules("new.json", "shared-export.json", bundle, false); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ListFiles(); files[1].Meta == nil || files[1].Meta.Version != "1.0.0" {
+		t.Errorf("新文件应沿用规则包的元数据: %+v", files[1])
+	}
+
+	// 不是JSON对象的元素被跳过，其后的规则仍与原始JSON对应
+	mixed := "[" + rule(1, "混合一", "https://m1.example.com/") + ", 5, " + rule(2, "混合二", "https://m2.example.com/") + "]"
+	result, err = manager.ImportRules("mixed.json", "mixed-source.json", []byte(mixed), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Imported) != 2 || result.Imported[1].Name != "混合二" || result.Imported[1].URL != "https://m2.example.com/" {
+		t.Errorf("应跳过非对象元素并导入其余规则: %+v", result.Imported)
+	}
+	if len(result.Issues) != 1 || result.Issues[0].Index != 1 || result.Issues[0].Severity != SeverityError {
+		t.Errorf("非对象元素应报告错误: %+v", result.Issues)
+	}
+	if r, _ := manager.GetRuleById("mixed.json", 2); r == nil || r.URL != "https://m2.example.com/" {
+		t.Errorf("写入的规则与原始JSON不对应: %+v", r)
+	}
+
+	// 要求更高版本的规则包拒绝导入，加载时给出警告
+	defer func(v string) { config.Version = v }(config.Version)
+	config.Version = "v1.0.0"
+	newer := strings.Replace(string(bundle), `"name": "共享书源"`, `"name": "共享书源", "minAppVersion": "v1.10.0"`, 1)
+	if _, err := manager.ImportRules("local.json", "newer.json", []byte(newer), true); err == nil {
+		t.Error("要求更高版本的规则包应拒绝导入")
+	}
+	if _, issues, _ := Validate("newer.json", []byte(newer)); len(issues) != 1 || issues[0].Field != "meta.minAppVersion" {
+		t.Errorf("加载要求更高版本的规则文件应给出警告: %+v", issues)
+	}
+}
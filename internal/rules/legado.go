@@ -0,0 +1,1036 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go-novel/internal/model"
+	"go-novel/internal/selector"
+)
+
+// ImportResult 导入规则包或阅读书源的结果
+type ImportResult struct {
+	Sources  int           `json:"sources"` // 书源总数
+	Meta     *FileMeta     `json:"meta,omitempty"`
+	Imported []RuleSummary `json:"imported"`
+	Updated  []RuleSummary `json:"updated,omitempty"` // 与已有规则网址相同而覆盖的规则
+	Issues   []Issue       `json:"issues"`            // 跳过的书源为错误，部分字段无法转换为警告
+	Rules    []model.Rule  `json:"-"`
+}
+
+// legadoSource 阅读 (Legado) 书源中参与转换的字段
+type legadoSource struct {
+	BookSourceName    string         `json:"bookSourceName"`
+	BookSourceURL     string         `json:"bookSourceUrl"`
+	BookSourceGroup   string         `json:"bookSourceGroup"`
+	BookSourceComment string         `json:"bookSourceComment"`
+	BookSourceType    int            `json:"bookSourceType"` // 0 为文字，其余为音频、图片、文件
+	Enabled           *bool          `json:"enabled"`
+	Header            string         `json:"header"`
+	LoginURL          string         `json:"loginUrl"`
+	SearchURL         string         `json:"searchUrl"`
+	RuleSearch        legadoSearch   `json:"ruleSearch"`
+	RuleBookInfo      legadoBookInfo `json:"ruleBookInfo"`
+	RuleToc           legadoToc      `json:"ruleToc"`
+	RuleContent       legadoContent  `json:"ruleContent"`
+}
+
+type legadoSearch struct {
+	BookList    string `json:"bookList"`
+	Name        string `json:"name"`
+	Author      string `json:"author"`
+	Kind        string `json:"kind"`
+	WordCount   string `json:"wordCount"`
+	LastChapter string `json:"lastChapter"`
+	Intro       string `json:"intro"`
+	CoverURL    string `json:"coverUrl"`
+	BookURL     string `json:"bookUrl"`
+}
+
+type legadoBookInfo struct {
+	Init        string `json:"init"`
+	Name        string `json:"name"`
+	Author      string `json:"author"`
+	Intro       string `json:"intro"`
+	Kind        string `json:"kind"`
+	LastChapter string `json:"lastChapter"`
+	UpdateTime  string `json:"updateTime"`
+	CoverURL    string `json:"coverUrl"`
+	TocURL      string `json:"tocUrl"`
+	WordCount   string `json:"wordCount"`
+}
+
+type legadoToc struct {
+	PreUpdateJs string `json:"preUpdateJs"`
+	ChapterList string `json:"chapterList"`
+	ChapterName string `json:"chapterName"`
+	ChapterURL  string `json:"chapterUrl"`
+	NextTocURL  string `json:"nextTocUrl"`
+}
+
+type legadoContent struct {
+	Content        string `json:"content"`
+	Title          string `json:"title"`
+	NextContentURL string `json:"nextContentUrl"`
+	WebJs          string `json:"webJs"`
+	SourceRegex    string `json:"sourceRegex"`
+	ReplaceRegex   string `json:"replaceRegex"`
+}
+
+// ConvertLegado 将阅读书源JSON（数组或单个书源）转换为规则，ID 从 firstID 开始依次分配。
+// 无法转换的书源不生成规则，Issues 中记录跳过的原因和未能转换的字段
+func ConvertLegado(filename string, data []byte, firstID int) (*ImportResult, error) {
+	data = bytes.TrimSpace(data)
+	var raws []json.RawMessage
+	if bytes.HasPrefix(data, []byte("{")) {
+		raws = []json.RawMessage{data}
+	} else if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, fmt.Errorf("解析阅读书源 %s 失败: %s", filename, describeJSONError(data, err))
+	}
+
+	result := &ImportResult{Sources: len(raws)}
+	nextID := firstID
+	for i, raw := range raws {
+		c := &legadoConverter{file: filename, index: i}
+		rule, ok := c.convert(raw, nextID)
+		if ok {
+			// 与加载规则时相同的校验，选择器转换结果无法编译时跳过该书源
+			for _, issue := range Compile(rule) {
+				issue.File, issue.Index = filename, i
+				if issue.Severity == SeverityError {
+					ok = false
+				}
+				c.issues = append(c.issues, issue)
+			}
+			rule.Compiled = nil
+		}
+		if ok {
+			result.Rules = append(result.Rules, *rule)
+			nextID++
+		} else {
+			for j := range c.issues {
+				c.issues[j].RuleID = 0
+			}
+		}
+		result.Issues = append(result.Issues, c.issues...)
+	}
+	return result, nil
+}
+
+// ImportLegado 转换阅读书源并追加到规则文件，文件不存在时创建；dryRun 为 true 时只转换不写入
+func (rm *RuleManager) ImportLegado(filename, source string, data []byte, dryRun bool) (*ImportResult, error) {
+	// 新规则的ID接在文件中已有规则之后，写入时在规则文件锁内分配
+	var result *ImportResult
+	convert := func(raws []json.RawMessage) ([]json.RawMessage, error) {
+		var err error
+		result, err = ConvertLegado(source, data, maxRuleID(raws)+1)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Imported = make([]RuleSummary, 0, len(result.Rules))
+		imported := make([]json.RawMessage, 0, len(result.Rules))
+		for _, rule := range result.Rules {
+			result.Imported = append(result.Imported, ruleSummary(rule))
+			raw, err := marshalRule(rule)
+			if err != nil {
+				return nil, err
+			}
+			imported = append(imported, raw)
+		}
+		if len(imported) == 0 {
+			return nil, errUnchanged
+		}
+		return append(raws, imported...), nil
+	}
+
+	if dryRun {
+		fp, err := rulesFilePath(filename)
+		if err != nil {
+			return nil, err
+		}
+		raws, err := readRawRules(fp)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if _, err := convert(raws); err != nil && !errors.Is(err, errUnchanged) {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	if _, err := rm.updateRules(filename, true, convert); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// legadoConverter 转换单个阅读书源
+type legadoConverter struct {
+	file   string
+	index  int
+	rule   model.Rule
+	issues []Issue
+}
+
+// add 记录问题，field 为阅读书源中的字段路径
+func (c *legadoConverter) add(field, severity, message string) {
+	c.issues = append(c.issues, Issue{
+		File:     c.file,
+		Index:    c.index,
+		RuleID:   c.rule.ID,
+		RuleName: c.rule.Name,
+		Field:    field,
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+// skip 记录导致书源无法导入的问题
+func (c *legadoConverter) skip(field, message string) (*model.Rule, bool) {
+	c.add(field, SeverityError, message)
+	return nil, false
+}
+
+// convert 转换书源，返回 false 表示跳过
+func (c *legadoConverter) convert(raw json.RawMessage, id int) (*model.Rule, bool) {
+	var src legadoSource
+	if err := json.Unmarshal(raw, &src); err != nil {
+		return c.skip("", fmt.Sprintf("无法识别的书源格式: %v", err))
+	}
+
+	c.rule = model.Rule{
+		ID:       id,
+		Name:     strings.TrimSpace(src.BookSourceName),
+		Comment:  strings.TrimSpace(src.BookSourceComment),
+		Language: "zh_CN",
+	}
+	r := &c.rule
+	if r.Comment == "" {
+		r.Comment = strings.TrimSpace(src.BookSourceGroup)
+	}
+	if src.Enabled != nil && !*src.Enabled {
+		r.Disabled = true
+	}
+
+	if src.BookSourceType != 0 {
+		return c.skip("bookSourceType", "只支持文字书源")
+	}
+	var ok bool
+	if r.URL, ok = legadoBaseURL(src.BookSourceURL); !ok {
+		return c.skip("bookSourceUrl", fmt.Sprintf("无效的书源地址: %s", src.BookSourceURL))
+	}
+	if src.Header != "" {
+		r.Headers = c.headers("header", json.RawMessage(src.Header))
+	}
+	if src.LoginURL != "" {
+		c.add("loginUrl", SeverityWarning, "不支持登录，已忽略")
+	}
+
+	// 目录和正文是下载必需的，无法转换时跳过书源
+	info := src.RuleBookInfo
+	if info.Init != "" {
+		return c.skip("ruleBookInfo.init", "不支持详情页预处理规则")
+	}
+	if info.TocURL != "" {
+		return c.skip("ruleBookInfo.tocUrl", "不支持从详情页提取目录页地址，目录需位于详情页")
+	}
+	if !c.convertToc(src.RuleToc) || !c.convertContent(src.RuleContent) {
+		return nil, false
+	}
+
+	c.convertBook(info)
+	c.convertSearch(src)
+	return r, true
+}
+
+// convertSearch 转换搜索规则，无法转换时停用搜索
+func (c *legadoConverter) convertSearch(src legadoSource) {
+	r := &c.rule
+	s := src.RuleSearch
+	if src.SearchURL == "" {
+		r.Search.Disabled = true
+		return
+	}
+
+	var ok bool
+	if r.Search.URL, r.Search.Method, r.Search.Data, ok = c.searchURL(r.URL, src.SearchURL); ok {
+		r.Search.Result, ok = c.list("ruleSearch.bookList", s.BookList)
+	}
+	if ok {
+		r.Search.BookName, ok = c.searchBookName(s)
+	}
+	if !ok {
+		r.Search = model.SearchRule{Disabled: true}
+		c.add("searchUrl", SeverityWarning, "搜索规则无法转换，已停用搜索")
+		return
+	}
+
+	r.Search.Author = c.text("ruleSearch.author", s.Author)
+	r.Search.Category = c.text("ruleSearch.kind", s.Kind)
+	r.Search.WordCount = c.text("ruleSearch.wordCount", s.WordCount)
+	r.Search.LatestChapter = c.text("ruleSearch.lastChapter", s.LastChapter)
+	if s.Intro != "" || s.CoverURL != "" {
+		c.add("ruleSearch", SeverityWarning, "搜索结果不包含简介和封面，已忽略")
+	}
+}
+
+// searchBookName 书籍链接取书名选择器的 href，两者不是同一元素时以链接为准
+func (c *legadoConverter) searchBookName(s legadoSearch) (string, bool) {
+	name, ok := c.parse("ruleSearch.name", s.Name, false)
+	if !ok {
+		return "", false
+	}
+	link, ok := c.parse("ruleSearch.bookUrl", s.BookURL, false)
+	if !ok {
+		return "", false
+	}
+	if link == nil || link.attr != "href" || link.empty() {
+		c.add("ruleSearch.bookUrl", SeverityWarning, "书籍链接必须是元素的 href 属性")
+		return "", false
+	}
+
+	if name == nil || name.attr != "" || !name.sameElement(link) {
+		c.add("ruleSearch.name", SeverityWarning, "书名与书籍链接不是同一元素，书名取书籍链接的文本")
+		name = &legadoSelector{steps: link.steps, xpath: link.xpath}
+	}
+	return c.render("ruleSearch.name", name, false)
+}
+
+// convertBook 转换详情页规则，无法转换的字段忽略
+func (c *legadoConverter) convertBook(info legadoBookInfo) {
+	b := &c.rule.Book
+	b.BookName = c.text("ruleBookInfo.name", info.Name)
+	b.Author = c.text("ruleBookInfo.author", info.Author)
+	b.Intro = c.text("ruleBookInfo.intro", info.Intro)
+	b.Category = c.text("ruleBookInfo.kind", info.Kind)
+	b.LatestChapter = c.text("ruleBookInfo.lastChapter", info.LastChapter)
+	b.LastUpdateTime = c.text("ruleBookInfo.updateTime", info.UpdateTime)
+	b.WordCount = c.text("ruleBookInfo.wordCount", info.WordCount)
+
+	// 封面取 src 属性，没有时取 content 属性
+	if sel, ok := c.parse("ruleBookInfo.coverUrl", info.CoverURL, false); ok && sel != nil {
+		if sel.attr != "src" && sel.attr != "content" {
+			c.add("ruleBookInfo.coverUrl", SeverityWarning, fmt.Sprintf("封面只支持 src 或 content 属性，不支持 %s", sel.extract))
+			return
+		}
+		sel.attr = ""
+		b.CoverUrl, _ = c.render("ruleBookInfo.coverUrl", sel, false)
+	}
+}
+
+// convertToc 转换目录规则，章节名和链接必须来自同一个 a 元素
+func (c *legadoConverter) convertToc(toc legadoToc) bool {
+	list, ok := c.parse("ruleToc.chapterList", toc.ChapterList, true)
+	if !ok || list == nil {
+		if ok {
+			c.add("ruleToc.chapterList", SeverityError, "缺少章节列表规则")
+		}
+		return false
+	}
+	name, ok := c.parse("ruleToc.chapterName", toc.ChapterName, false)
+	if !ok {
+		return false
+	}
+	link, ok := c.parse("ruleToc.chapterUrl", toc.ChapterURL, false)
+	if !ok {
+		return false
+	}
+	if name == nil || link == nil || name.attr != "" || link.attr != "href" || !name.sameElement(link) || len(name.js) > 0 || len(link.js) > 0 {
+		c.add("ruleToc.chapterName", SeverityError, "章节名和章节链接必须分别是同一元素的文本和 href 属性")
+		return false
+	}
+
+	item, ok := list.join(link)
+	if !ok {
+		c.add("ruleToc.chapterUrl", SeverityError, "无法与章节列表规则合并为一个选择器")
+		return false
+	}
+	if c.rule.Toc.Item, ok = c.render("ruleToc.chapterList", item, true); !ok {
+		return false
+	}
+	c.rule.Toc.IsDesc = list.reverse
+
+	if toc.NextTocURL != "" {
+		if next, ok := c.nextPage("ruleToc.nextTocUrl", toc.NextTocURL); ok {
+			c.rule.Toc.Pagination, c.rule.Toc.NextPage = true, next
+		}
+	}
+	if toc.PreUpdateJs != "" {
+		c.add("ruleToc.preUpdateJs", SeverityWarning, "不支持目录预处理脚本，已忽略")
+	}
+	return true
+}
+
+// convertContent 转换正文规则，替换为空的净化正则转换为 filterTxt
+func (c *legadoConverter) convertContent(content legadoContent) bool {
+	ch := &c.rule.Chapter
+	sel, ok := c.parse("ruleContent.content", content.Content, false)
+	if !ok || sel == nil {
+		if ok {
+			c.add("ruleContent.content", SeverityError, "缺少正文规则")
+		}
+		return false
+	}
+	if sel.attr != "" {
+		c.add("ruleContent.content", SeverityError, fmt.Sprintf("正文只支持提取文本，不支持 %s", sel.extract))
+		return false
+	}
+
+	if pattern, replacement, ok := strings.Cut(strings.TrimPrefix(content.ReplaceRegex, "##"), "##"); content.ReplaceRegex != "" {
+		if _, err := regexp.Compile(pattern); err == nil && (!ok || replacement == "") {
+			ch.FilterTxt = pattern
+		} else {
+			sel.js = append(sel.js, legadoReplaceJs(pattern, replacement, false))
+		}
+	}
+	if ch.Content, ok = c.render("ruleContent.content", sel, false); !ok {
+		return false
+	}
+
+	ch.Title = c.text("ruleContent.title", content.Title)
+	if content.NextContentURL != "" {
+		if next, ok := c.nextPage("ruleContent.nextContentUrl", content.NextContentURL); ok {
+			ch.Pagination, ch.NextPage = true, next
+		}
+	}
+	if content.WebJs != "" || content.SourceRegex != "" {
+		c.add("ruleContent.webJs", SeverityWarning, "不支持网页脚本和资源正则，已忽略")
+	}
+	return true
+}
+
+// nextPage 转换下一页链接规则
+func (c *legadoConverter) nextPage(field, raw string) (string, bool) {
+	sel, ok := c.parse(field, raw, false)
+	if !ok || sel == nil {
+		return "", false
+	}
+	if sel.attr != "href" || len(sel.js) > 0 {
+		c.add(field, SeverityWarning, "下一页只支持链接的 href 属性，已忽略")
+		return "", false
+	}
+	sel.attr = ""
+	next, ok := c.render(field, sel, true)
+	if ok {
+		c.add(field, SeverityWarning, "已转换为分页选择器，目前下载时不会跟随分页")
+	}
+	return next, ok
+}
+
+// text 转换提取文本的字段，无法转换时记录警告并返回空
+func (c *legadoConverter) text(field, raw string) string {
+	sel, ok := c.parse(field, raw, false)
+	if !ok || sel == nil {
+		return ""
+	}
+	if sel.empty() {
+		c.add(field, SeverityWarning, "不支持提取当前元素自身，已忽略")
+		return ""
+	}
+
+	// meta 标签取 content 属性
+	isMeta := sel.xpath == "" && len(sel.steps) > 0 && strings.HasPrefix(sel.steps[0].name, "meta[")
+	if sel.attr == "content" && isMeta {
+		sel.attr = ""
+	}
+	if sel.attr != "" {
+		c.add(field, SeverityWarning, fmt.Sprintf("文本字段不支持提取属性 %s，已忽略", sel.extract))
+		return ""
+	}
+
+	value, _ := c.render(field, sel, false)
+	return value
+}
+
+// list 转换列表选择器，列表不支持脚本和属性
+func (c *legadoConverter) list(field, raw string) (string, bool) {
+	sel, ok := c.parse(field, raw, true)
+	if !ok {
+		return "", false
+	}
+	if sel == nil {
+		c.add(field, SeverityWarning, "缺少列表规则")
+		return "", false
+	}
+	return c.render(field, sel, true)
+}
+
+// legadoStep 默认语法中的一级选择，如 class.name.0
+type legadoStep struct {
+	kind  string // class、id、tag、text、children，为空时 name 为CSS选择器
+	name  string
+	index string // 下标，如 0、-1、!0、0:2 (列举)，或 [1:3] (范围)
+	rng   bool   // index 来自 [] 写法，: 表示范围
+}
+
+// legadoSelector 解析后的阅读规则
+type legadoSelector struct {
+	steps   []legadoStep
+	xpath   string   // @XPath: 规则，与 steps 互斥
+	extract string   // 原始的提取方式，如 text、href
+	attr    string   // 提取的属性，为空时提取文本
+	js      []string // 依次执行的脚本，包括 ## 正则替换
+	reverse bool     // 列表规则以 - 开头，倒序
+}
+
+// empty 是否只提取上下文元素自身
+func (s *legadoSelector) empty() bool {
+	return len(s.steps) == 0 && s.xpath == ""
+}
+
+// sameElement 两个规则是否选择同一元素
+func (s *legadoSelector) sameElement(o *legadoSelector) bool {
+	if s.xpath != o.xpath || len(s.steps) != len(o.steps) {
+		return false
+	}
+	for i := range s.steps {
+		if s.steps[i] != o.steps[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// join 将相对于列表项的规则合并到列表规则中
+func (s *legadoSelector) join(item *legadoSelector) (*legadoSelector, bool) {
+	joined := *s
+	switch {
+	case item.empty():
+	case s.xpath == "" && item.xpath == "":
+		joined.steps = append(append([]legadoStep(nil), s.steps...), item.steps...)
+	case s.xpath != "" && item.xpath != "" && !strings.HasPrefix(item.xpath, "/"):
+		joined.xpath = s.xpath + "/" + item.xpath
+	default:
+		return nil, false
+	}
+	return &joined, true
+}
+
+var (
+	legadoIndexPattern   = regexp.MustCompile(`^!?-?\d+(:-?\d+)*$`)
+	legadoAttrPattern    = regexp.MustCompile(`\[([\w-]+)([~|^$*]?=)([^\]"']+)\]`)
+	legadoBracketPattern = regexp.MustCompile(`^(.*)\[(!?-?\d+(?:[:,]-?\d+)*)\]$`)
+	legadoTemplatePage   = regexp.MustCompile(`\{\{\s*page\s*\}\}|searchPage`)
+	legadoTemplateKey    = regexp.MustCompile(`\{\{\s*key\s*\}\}|searchKey`)
+	legadoJsObjects      = regexp.MustCompile(`\b(java|source|cookie|book|chapter|baseUrl|src)\b`)
+)
+
+// legadoExtractors 默认语法中表示提取文本的最后一级
+var legadoExtractors = map[string]bool{"text": true, "textNodes": true, "ownText": true, "html": true, "all": true}
+
+// parse 解析阅读规则，list 为 true 时所有层级都是选择；返回 false 表示规则不受支持并已记录问题
+func (c *legadoConverter) parse(field, raw string, list bool) (*legadoSelector, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, true
+	}
+	unsupported := func(message string) (*legadoSelector, bool) {
+		c.add(field, SeverityWarning, message)
+		return nil, false
+	}
+
+	sel := &legadoSelector{}
+	if list && (strings.HasPrefix(raw, "-") || strings.HasPrefix(raw, "+")) {
+		sel.reverse = raw[0] == '-'
+		raw = raw[1:]
+	}
+
+	switch {
+	case strings.HasPrefix(raw, "@json:") || strings.HasPrefix(raw, "$.") || strings.HasPrefix(raw, "$["):
+		return unsupported("不支持JSONPath规则")
+	case strings.Contains(raw, "{{") || strings.Contains(raw, "@put:") || strings.Contains(raw, "@get:"):
+		return unsupported("不支持模板和变量规则")
+	case strings.Contains(raw, "&&") || strings.Contains(raw, "%%"):
+		return unsupported("不支持 && 和 %% 组合规则")
+	case strings.Contains(raw, "||"):
+		c.add(field, SeverityWarning, "不支持 || 组合规则，只使用第一个规则")
+		raw, _, _ = strings.Cut(raw, "||")
+	}
+
+	// 脚本在选择和正则替换之后执行
+	rule, js, hasJs := strings.Cut(raw, "@js:")
+	if !hasJs {
+		if before, after, found := strings.Cut(raw, "<js>"); found {
+			code, rest, closed := strings.Cut(after, "</js>")
+			if !closed || strings.TrimSpace(rest) != "" {
+				return unsupported("脚本必须位于规则末尾")
+			}
+			rule, js, hasJs = before, code, true
+		}
+	}
+	if hasJs {
+		if list {
+			return unsupported("列表规则不支持脚本")
+		}
+		if strings.TrimSpace(rule) == "" {
+			return unsupported("不支持只有脚本的规则")
+		}
+		if legadoJsObjects.MatchString(js) {
+			return unsupported("脚本使用了阅读的内置对象，无法转换")
+		}
+	}
+
+	rule, pattern, hasRegex := strings.Cut(rule, "##")
+	if hasRegex {
+		if list {
+			return unsupported("列表规则不支持正则替换")
+		}
+		first := strings.HasSuffix(pattern, "###")
+		pattern = strings.TrimSuffix(pattern, "###")
+		pattern, replacement, _ := strings.Cut(pattern, "##")
+		sel.js = append(sel.js, legadoReplaceJs(pattern, replacement, first))
+	}
+	if hasJs {
+		sel.js = append(sel.js, "var result=r;r=String(eval("+jsString(js)+"))")
+	}
+
+	rule = strings.TrimSpace(rule)
+	var ok bool
+	switch {
+	case strings.HasPrefix(rule, "@XPath:") || strings.HasPrefix(rule, "/"):
+		ok = c.parseXPath(sel, strings.TrimPrefix(rule, "@XPath:"), list)
+	case strings.HasPrefix(rule, "@css:"):
+		ok = c.parseCSS(sel, strings.TrimPrefix(rule, "@css:"), list)
+	default:
+		ok = c.parseDefault(field, sel, rule, list)
+	}
+	if !ok {
+		return nil, false
+	}
+	return sel, true
+}
+
+// parseXPath 解析XPath规则，末尾的 /@attr 和 /text() 为提取方式
+func (c *legadoConverter) parseXPath(sel *legadoSelector, rule string, list bool) bool {
+	sel.xpath = rule
+	if list {
+		return true
+	}
+	if i := strings.LastIndex(rule, "/"); i >= 0 {
+		last := rule[i+1:]
+		switch {
+		case strings.HasPrefix(last, "@"):
+			sel.xpath, sel.extract, sel.attr = rule[:i], last[1:], last[1:]
+		case last == "text()":
+			sel.xpath, sel.extract = rule[:i], "text"
+		}
+	}
+	return true
+}
+
+// parseCSS 解析 @css: 规则，非列表规则的最后一级为提取方式
+func (c *legadoConverter) parseCSS(sel *legadoSelector, rule string, list bool) bool {
+	if !list {
+		i := strings.LastIndex(rule, "@")
+		if i < 0 {
+			sel.extract = "text"
+		} else {
+			rule, sel.extract = rule[:i], rule[i+1:]
+		}
+		sel.setExtract()
+	}
+	if rule = strings.TrimSpace(rule); rule != "" {
+		sel.steps = []legadoStep{{name: legadoCSS(rule)}}
+	}
+	return true
+}
+
+// parseDefault 解析默认语法，如 class.list@tag.a.0@href
+func (c *legadoConverter) parseDefault(field string, sel *legadoSelector, rule string, list bool) bool {
+	parts := strings.Split(rule, "@")
+	if !list {
+		sel.extract = parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+		sel.setExtract()
+	}
+
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		step := legadoStep{name: part}
+		if m := legadoBracketPattern.FindStringSubmatch(part); m != nil {
+			part, step.index, step.rng = m[1], m[2], true
+			step.name = part
+		}
+
+		kind, rest, found := strings.Cut(part, ".")
+		switch kind {
+		case "class", "id", "tag", "text":
+			if !found {
+				break
+			}
+			step.kind, step.name = kind, rest
+			// 旧写法的下标位于最后一个 . 或 ! 之后，如 tag.li.0、tag.tr!0
+			if i := strings.LastIndexAny(rest, ".!"); i >= 0 && step.index == "" && legadoIndexPattern.MatchString(rest[i+1:]) {
+				step.name, step.index = rest[:i], rest[i+1:]
+				if rest[i] == '!' {
+					step.index = "!" + step.index
+				}
+			}
+		case "children":
+			step.kind, step.name = kind, ""
+			if found && legadoIndexPattern.MatchString(rest) {
+				step.index = rest
+			}
+		}
+		if step.kind == "" {
+			step.name = legadoCSS(step.name)
+		}
+		if step.kind == "" && step.index != "" {
+			c.add(field, SeverityWarning, fmt.Sprintf("CSS选择器不支持下标: %s", part))
+			return false
+		}
+		sel.steps = append(sel.steps, step)
+	}
+	return true
+}
+
+// legadoCSS 为属性选择器中未加引号的值加上引号，省略了标签的 [property=...] 视为 meta 标签
+func legadoCSS(css string) string {
+	css = legadoAttrPattern.ReplaceAllString(css, `[$1$2"$3"]`)
+	if strings.HasPrefix(css, "[property=") || strings.HasPrefix(css, "[name=") {
+		css = "meta" + css
+	}
+	return css
+}
+
+// setExtract 根据提取方式设置要提取的属性
+func (s *legadoSelector) setExtract() {
+	s.extract = strings.TrimSpace(s.extract)
+	if legadoExtractors[s.extract] || s.extract == "" {
+		s.attr = ""
+		return
+	}
+	s.attr = s.extract
+}
+
+// render 生成规则中的选择器，带下标时生成XPath
+func (c *legadoConverter) render(field string, sel *legadoSelector, list bool) (string, bool) {
+	if list && len(sel.js) > 0 {
+		c.add(field, SeverityWarning, "列表规则不支持脚本")
+		return "", false
+	}
+
+	expr := sel.xpath
+	if expr != "" && !selector.IsXPath(expr) {
+		// 相对路径以 ( 开头才会被识别为XPath
+		expr = "(" + expr + ")"
+	}
+	if expr == "" {
+		var ok bool
+		if expr, ok = renderSteps(sel.steps); !ok {
+			c.add(field, SeverityWarning, "无法转换为CSS选择器或XPath")
+			return "", false
+		}
+	}
+	if len(sel.js) > 0 {
+		expr += "@js:" + strings.Join(sel.js, ";")
+	}
+	return expr, true
+}
+
+// renderSteps 没有下标且不以 children 开头时生成CSS选择器，否则生成相对于当前元素的XPath
+func renderSteps(steps []legadoStep) (string, bool) {
+	needXPath := len(steps) > 0 && steps[0].kind == "children"
+	for _, step := range steps {
+		if step.index != "" {
+			needXPath = true
+		}
+	}
+
+	if !needXPath {
+		parts := make([]string, 0, len(steps))
+		for _, step := range steps {
+			switch step.kind {
+			case "class":
+				parts = append(parts, "."+strings.Join(strings.Fields(step.name), "."))
+			case "id":
+				parts = append(parts, "#"+step.name)
+			case "tag":
+				parts = append(parts, step.name)
+			case "text":
+				parts = append(parts, fmt.Sprintf("*:containsOwn(%q)", step.name))
+			case "children":
+				parts = append(parts, "> *")
+			default:
+				parts = append(parts, step.name)
+			}
+		}
+		return strings.Join(parts, " "), true
+	}
+
+	parts := make([]string, 0, len(steps))
+	for _, step := range steps {
+		var part string
+		switch step.kind {
+		case "class":
+			part = "descendant::*"
+			for _, class := range strings.Fields(step.name) {
+				part += fmt.Sprintf("[contains(concat(' ', normalize-space(@class), ' '), %s)]", xpathString(" "+class+" "))
+			}
+		case "id":
+			part = fmt.Sprintf("descendant::*[@id=%s]", xpathString(step.name))
+		case "tag":
+			part = "descendant::" + step.name
+		case "text":
+			part = fmt.Sprintf("descendant::*[contains(text(), %s)]", xpathString(step.name))
+		case "children":
+			part = "child::*"
+		default:
+			return "", false
+		}
+		predicate, ok := xpathIndex(step)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, part+predicate)
+	}
+	// 以 ( 开头才会被识别为XPath
+	return "(" + strings.Join(parts, "/") + ")", true
+}
+
+// xpathIndex 将下标转换为XPath谓词，阅读的下标从0开始，负数从末尾计数
+func xpathIndex(step legadoStep) (string, bool) {
+	if step.index == "" {
+		return "", true
+	}
+	index := step.index
+	exclude := strings.HasPrefix(index, "!")
+	index = strings.TrimPrefix(index, "!")
+
+	position := func(s string) (string, bool) {
+		n, err := strconv.Atoi(s)
+		switch {
+		case err != nil:
+			return "", false
+		case n >= 0:
+			return strconv.Itoa(n + 1), true
+		case n == -1:
+			return "last()", true
+		default:
+			return fmt.Sprintf("last()-%d", -n-1), true
+		}
+	}
+
+	var conds []string
+	if start, end, isRange := strings.Cut(index, ":"); step.rng && isRange && !strings.Contains(end, ":") {
+		from, ok1 := position(start)
+		to, ok2 := position(end)
+		if !ok1 || !ok2 {
+			return "", false
+		}
+		conds = append(conds, fmt.Sprintf("position()>=%s and position()<=%s", from, to))
+	} else {
+		for _, s := range strings.FieldsFunc(index, func(r rune) bool { return r == ':' || r == ',' }) {
+			p, ok := position(s)
+			if !ok {
+				return "", false
+			}
+			conds = append(conds, "position()="+p)
+		}
+	}
+
+	cond := strings.Join(conds, " or ")
+	switch {
+	case exclude:
+		return "[not(" + cond + ")]", true
+	case len(conds) == 1 && !strings.Contains(cond, " and "):
+		return "[" + strings.TrimPrefix(cond, "position()=") + "]", true
+	default:
+		return "[" + cond + "]", true
+	}
+}
+
+// xpathString 生成XPath字符串字面量
+func xpathString(s string) string {
+	if strings.Contains(s, "'") {
+		return `"` + s + `"`
+	}
+	return "'" + s + "'"
+}
+
+// jsString 生成JavaScript字符串字面量，不转义HTML字符
+func jsString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSpace(buf.String())
+}
+
+// legadoReplaceJs 将 ##正则##替换 转换为脚本，first 为 true 时只保留第一个匹配替换后的结果
+func legadoReplaceJs(pattern, replacement string, first bool) string {
+	re := "new RegExp(" + jsString(pattern) + ")"
+	if first {
+		return fmt.Sprintf("var m=r.match(%s);r=m?m[0].replace(%s,%s):''", re, re, jsString(replacement))
+	}
+	return fmt.Sprintf("r=r.replace(new RegExp(%s,'g'),%s)", jsString(pattern), jsString(replacement))
+}
+
+// searchURL 转换搜索地址：{{key}} 替换为 %s，{{page}} 为第一页，POST 请求体转换为 data
+func (c *legadoConverter) searchURL(base, raw string) (string, string, string, bool) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "@js:") || strings.HasPrefix(raw, "<js>") {
+		c.add("searchUrl", SeverityWarning, "不支持脚本生成的搜索地址")
+		return "", "", "", false
+	}
+
+	address, optionText, _ := strings.Cut(raw, ",{")
+	var options struct {
+		Method  string          `json:"method"`
+		Body    json.RawMessage `json:"body"`
+		Charset string          `json:"charset"`
+		Headers json.RawMessage `json:"headers"`
+		WebView json.RawMessage `json:"webView"`
+	}
+	if optionText != "" {
+		if err := json.Unmarshal([]byte("{"+optionText), &options); err != nil {
+			c.add("searchUrl", SeverityWarning, fmt.Sprintf("无法解析搜索请求参数: %v", err))
+			return "", "", "", false
+		}
+	}
+	var body string
+	if len(options.Body) > 0 && json.Unmarshal(options.Body, &body) != nil {
+		c.add("searchUrl", SeverityWarning, "只支持表单格式的请求体")
+		return "", "", "", false
+	}
+	if options.Charset != "" && !strings.EqualFold(options.Charset, "utf-8") {
+		c.add("searchUrl", SeverityWarning, fmt.Sprintf("关键词按UTF-8编码，%s 编码的站点可能搜索不到", options.Charset))
+	}
+	if len(options.Headers) > 0 {
+		c.rule.Search.Headers = c.headers("searchUrl", options.Headers)
+	}
+	if len(options.WebView) > 0 {
+		c.add("searchUrl", SeverityWarning, "不支持 webView，已忽略")
+	}
+
+	fill := func(s string) (string, bool) {
+		s = legadoTemplatePage.ReplaceAllString(legadoTemplateKey.ReplaceAllString(s, "%s"), "1")
+		if strings.Contains(s, "{{") || strings.Contains(s, "<js>") {
+			c.add("searchUrl", SeverityWarning, "搜索地址中含有不支持的模板")
+			return "", false
+		}
+		return s, true
+	}
+	address, ok := fill(strings.TrimSpace(address))
+	if !ok {
+		return "", "", "", false
+	}
+	if body, ok = fill(body); !ok {
+		return "", "", "", false
+	}
+
+	baseURL, _ := url.Parse(base)
+	ref, err := url.Parse(strings.ReplaceAll(address, "%s", "KEYWORD"))
+	if err != nil {
+		c.add("searchUrl", SeverityWarning, fmt.Sprintf("无效的搜索地址: %s", address))
+		return "", "", "", false
+	}
+	address = strings.ReplaceAll(baseURL.ResolveReference(ref).String(), "KEYWORD", "%s")
+
+	if !strings.EqualFold(options.Method, "post") {
+		return address, "get", "", true
+	}
+
+	// 请求体 a=%s&b=1 转换为 {"a":"%s","b":"1"}
+	data := make(map[string]string)
+	for _, pair := range strings.Split(body, "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		if key == "" {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		data[key] = value
+	}
+	encoded, _ := json.Marshal(data)
+	return address, "post", string(encoded), true
+}
+
+// headers 转换请求头，可以是JSON对象或内容为JSON对象的字符串，脚本生成的请求头不受支持
+func (c *legadoConverter) headers(field string, raw json.RawMessage) map[string]string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		raw = json.RawMessage(text)
+	}
+	var headers map[string]string
+	if err := json.Unmarshal(raw, &headers); err != nil {
+		c.add(field, SeverityWarning, "只支持JSON对象格式的请求头，已忽略")
+		return nil
+	}
+	return headers
+}
+
+// legadoBaseURL 书源地址去掉 # 后的备注，没有路径时补充 /
+func legadoBaseURL(raw string) (string, bool) {
+	raw, _, _ = strings.Cut(strings.TrimSpace(raw), "#")
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), true
+}
+
+// marshalRule 将规则序列化为JSON，省略空字段，不转义HTML字符
+func marshalRule(rule model.Rule) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(rule); err != nil {
+		return nil, err
+	}
+	raw, _ := omitEmpty(bytes.TrimSpace(buf.Bytes()))
+	return raw, nil
+}
+
+// omitEmpty 递归删除对象中的空字符串、false、0 和空对象，保留字段顺序，第二个返回值表示整个值为空
+func omitEmpty(raw json.RawMessage) (json.RawMessage, bool) {
+	switch string(raw) {
+	case `""`, "false", "0", "null", "{}":
+		return raw, true
+	}
+	if !bytes.HasPrefix(raw, []byte("{")) {
+		return raw, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.Token()
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return raw, false
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return raw, false
+		}
+		value, empty := omitEmpty(value)
+		if empty {
+			continue
+		}
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		key, _ := json.Marshal(tok)
+		out.Write(key)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), out.Len() == 2
+}
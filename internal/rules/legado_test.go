@@ -0,0 +1,180 @@
+package rules
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"go-novel/internal/model"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const legadoSources = `[
+  {
+    "bookSourceName": "笔趣阁",
+    "bookSourceUrl": "https://www.biquge.example#备注",
+    "bookSourceGroup": "笔趣阁",
+    "bookSourceType": 0,
+    "enabled": true,
+    "header": "{\"Referer\": \"https://www.biquge.example/\"}",
+    "searchUrl": "/modules/article/search.php,{\"method\": \"POST\", \"body\": \"searchkey={{key}}&page={{page}}\", \"charset\": \"gbk\", \"headers\": {\"Accept-Language\": \"zh-CN\"}}",
+    "ruleSearch": {
+      "bookList": "id.checkform@tag.tr!0",
+      "name": "tag.td.0@tag.a@text",
+      "bookUrl": "tag.td.0@tag.a@href",
+      "author": "tag.td.-2@text",
+      "coverUrl": "tag.img@src"
+    },
+    "ruleBookInfo": {
+      "name": "[property=og:novel:book_name]@content",
+      "author": "@css:#info > p:nth-of-type(1)@text##作者：",
+      "intro": "id.intro@html",
+      "coverUrl": "id.fmimg@tag.img@data-original",
+      "lastChapter": "id.info@tag.a.-1@text@js:result.trim()"
+    },
+    "ruleToc": {
+      "chapterList": "-id.list@tag.dd!0:1@tag.a",
+      "chapterName": "text",
+      "chapterUrl": "href"
+    },
+    "ruleContent": {
+      "content": "id.content@html",
+      "title": "class.bookname@tag.h1@text",
+      "replaceRegex": "##本章未完.*|请收藏本站",
+      "nextContentUrl": "text.下一页@href"
+    }
+  },
+  {
+    "bookSourceName": "需要目录页",
+    "bookSourceUrl": "https://www.toc.example",
+    "ruleBookInfo": {"tocUrl": "id.list@a@href"},
+    "ruleToc": {"chapterList": "tag.a", "chapterName": "text", "chapterUrl": "href"},
+    "ruleContent": {"content": "id.content@text"}
+  },
+  {
+    "bookSourceName": "有声书",
+    "bookSourceUrl": "https://www.audio.example",
+    "bookSourceType": 1
+  },
+  {
+    "bookSourceName": "XPath书源",
+    "bookSourceUrl": "https://www.xpath.example/",
+    "searchUrl": "https://www.xpath.example/search?q={{key}}",
+    "ruleSearch": {
+      "bookList": "//div[@class='result']",
+      "name": "@XPath:./h3/a/text()",
+      "bookUrl": "@XPath:./a[@class='cover']/@href"
+    },
+    "ruleToc": {"chapterList": "@XPath://ul[@id='chapters']/li", "chapterName": "@XPath:a/text()", "chapterUrl": "@XPath:a/@href"},
+    "ruleContent": {"content": "@XPath://div[@id='txt']/text()"}
+  }
+]`
+
+const legadoPage = `<html><head><meta property="og:novel:book_name" content="仙逆"></head><body>
+<div id="info"><p>作者：耳根</p><a href="/1/">第一章</a><a href="/2/"> 第二章 </a></div>
+<div id="list"><dl><dd><a href="/dt">最新章节</a></dd><dd><a href="/dt2">最新章节2</a></dd><dd><a href="/1.html">第1章</a></dd><dd><a href="/2.html">第2章</a></dd></dl></div>
+<form id="checkform"><table><tr><th>书名</th><th>作者</th><th>状态</th></tr><tr><td><a href="/book/1/">仙逆</a></td><td>耳根</td><td>完本</td></tr></table></form>
+</body></html>`
+
+func TestConvertLegado(t *testing.T) {
+	result, err := ConvertLegado("legado.json", []byte(legadoSources), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Sources != 4 || len(result.Rules) != 2 {
+		t.Fatalf("应转换 4 个书源中的 2 个，实际 %d/%d: %+v", len(result.Rules), result.Sources, result.Issues)
+	}
+
+	skipped := map[string]string{}
+	for _, issue := range result.Issues {
+		if issue.Severity == SeverityError {
+			skipped[issue.RuleName] = issue.Field
+		}
+	}
+	if skipped["需要目录页"] != "ruleBookInfo.tocUrl" || skipped["有声书"] != "bookSourceType" || len(skipped) != 2 {
+		t.Errorf("跳过的书源不正确: %v", skipped)
+	}
+
+	r := result.Rules[0]
+	if r.ID != 10 || r.URL != "https://www.biquge.example/" || r.Comment != "笔趣阁" {
+		t.Errorf("书源信息不正确: %+v", r)
+	}
+	if r.Search.URL != "https://www.biquge.example/modules/article/search.php" || r.Search.Method != "post" || r.Search.Data != `{"page":"1","searchkey":"%s"}` {
+		t.Errorf("搜索请求不正确: %+v", r.Search)
+	}
+	if r.Headers["Referer"] != "https://www.biquge.example/" || r.Search.Headers["Accept-Language"] != "zh-CN" {
+		t.Errorf("请求头转换不正确: %v, %v", r.Headers, r.Search.Headers)
+	}
+	if r.Book.CoverUrl != "" || r.Chapter.FilterTxt != "本章未完.*|请收藏本站" || !r.Toc.IsDesc || !r.Chapter.Pagination {
+		t.Errorf("规则转换不正确: %+v", r)
+	}
+
+	// 转换后的选择器在页面上提取到与阅读相同的内容
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(legadoPage))
+	Compile(&r)
+	c := r.Compiled
+	if got := c.Book.BookName.Text(doc.Selection); got != "仙逆" {
+		t.Errorf("book.bookName %q 提取到 %q", r.Book.BookName, got)
+	}
+	if got := c.Book.Author.Text(doc.Selection); got != "耳根" {
+		t.Errorf("book.author %q 提取到 %q", r.Book.Author, got)
+	}
+	if got := c.Book.LatestChapter.Text(doc.Selection); got != "第二章" {
+		t.Errorf("book.latestChapter %q 提取到 %q", r.Book.LatestChapter, got)
+	}
+	var chapters []string
+	c.Toc.Item.Select(doc.Selection).Each(func(_ int, s *goquery.Selection) {
+		chapters = append(chapters, s.Text())
+	})
+	if strings.Join(chapters, ",") != "第1章,第2章" {
+		t.Errorf("toc.item %q 提取到 %v", r.Toc.Item, chapters)
+	}
+	items := c.Search.Result.Select(doc.Selection)
+	if items.Length() != 1 || c.Search.BookName.Attr(items, "href") != "/book/1/" || c.Search.Author.Text(items) != "耳根" {
+		t.Errorf("搜索规则 %q / %q / %q 提取结果不正确", r.Search.Result, r.Search.BookName, r.Search.Author)
+	}
+
+	// 书名与链接不是同一元素时，书名取链接的文本
+	x := result.Rules[1]
+	if x.ID != 11 || x.Search.BookName != "(./a[@class='cover'])" || x.Toc.Item != "//ul[@id='chapters']/li/a" {
+		t.Errorf("XPath书源转换不正确: %+v", x)
+	}
+}
+
+func TestImportLegado(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(RulesDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	manager := &RuleManager{rules: make(map[string][]model.Rule)}
+	const file = "legado-rules.json"
+
+	existing := `[{"id": 5, "name": "已有书源", "url": "https://www.example.com/", "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}]`
+	if err := os.WriteFile(RulesDir()+"/"+file, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 试运行不写入文件
+	if _, err := manager.ImportLegado(file, "legado.json", []byte(legadoSources), true); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := ListRules(file); len(list) != 1 {
+		t.Fatalf("试运行不应写入规则: %+v", list)
+	}
+
+	result, err := manager.ImportLegado(file, "legado.json", []byte(legadoSources), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Imported) != 2 || result.Imported[0].ID != 6 {
+		t.Errorf("导入的规则应从已有最大ID之后编号: %+v", result.Imported)
+	}
+	if r, _ := manager.GetRuleById(file, 7); r == nil || r.Name != "XPath书源" {
+		t.Errorf("导入的规则应能加载: %+v", r)
+	}
+	raw, _ := GetRawRule(file, 6)
+	if strings.Contains(string(raw), `"wordCount"`) || strings.Contains(string(raw), `<`) {
+		t.Errorf("导入的规则应省略空字段且不转义HTML字符:\n%s", raw)
+	}
+}
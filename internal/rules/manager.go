@@ -1,18 +1,23 @@
 package rules
 
 import (
-	"encoding/json"
 	"fmt"
 	"go-novel/internal/embed"
 	"go-novel/internal/model"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
 type RuleManager struct {
 	rules map[string][]model.Rule
-	mutex sync.RWMutex
+	// knownErrors 已缓存规则文件中已有错误的标识，热加载和保存时只拒绝新出现的错误
+	knownErrors map[string]map[string]bool
+	mutex       sync.RWMutex
+	// fileMutex 串行化规则文件的读取、修改和写回，避免并发保存时互相覆盖
+	fileMutex sync.Mutex
 }
 
 var (
@@ -38,56 +43,80 @@ func (rm *RuleManager) LoadRules(filename string) ([]model.Rule, error) {
 		return rules, nil
 	}
 
-	// 构建文件路径
-	pathsToTry := []string{
-		filename,
-		filepath.Join("configs", "rules", filename),
-		filepath.Join("..", "configs", "rules", filename),
+	data, err := readRulesFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// 校验规则，JSON格式错误时拒绝加载，其余问题只输出到日志，避免个别字段问题导致整个文件不可用
+	rules, issues, err := Validate(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		fmt.Printf("规则校验%s: %s\n", severityLabel(issue.Severity), issue.Error())
 	}
 
-	var data []byte
-	var err error
-	var path string
+	// 缓存规则
+	rm.cacheRules(filename, rules, errorKeys(issues))
 
-	// 尝试不同的路径
-	fileFound := false
-	for _, p := range pathsToTry {
-		if _, statErr := os.Stat(p); statErr == nil {
-			path = p
-			data, err = os.ReadFile(path)
-			if err == nil {
-				fileFound = true
-				break
-			}
-		}
+	return rules, nil
+}
+
+// cacheRules 缓存规则文件中的全部规则并记录其中已有的错误，调用方需持有写锁
+func (rm *RuleManager) cacheRules(filename string, rules []model.Rule, known map[string]bool) {
+	if rm.knownErrors == nil {
+		rm.knownErrors = make(map[string]map[string]bool)
 	}
+	rm.rules[filename] = rules
+	rm.knownErrors[filename] = known
+}
 
-	// 如果文件系统中找不到文件，尝试使用嵌入的文件
-	if !fileFound {
-		fmt.Printf("文件系统中未找到规则文件: %s，尝试使用嵌入的文件\n", filename)
-		embeddedData := embed.GetEmbeddedRulesFile(filename)
-		if embeddedData != nil {
-			data = embeddedData
-			fmt.Printf("成功加载嵌入的规则文件: %s\n", filename)
-		} else {
-			// 如果所有路径都失败了，返回最后一个错误
-			if err != nil {
-				return nil, err
-			}
-			return nil, fmt.Errorf("未找到规则文件: %s", filename)
-		}
+// Lint 重新读取规则文件并校验，不使用缓存
+func (rm *RuleManager) Lint(filename string) ([]Issue, error) {
+	data, err := readRulesFile(filename)
+	if err != nil {
+		return nil, err
 	}
 
-	// 解析JSON
-	var rules []model.Rule
-	if err := json.Unmarshal(data, &rules); err != nil {
+	_, issues, err := Validate(filename, data)
+	if err != nil {
 		return nil, err
 	}
+	return issues, nil
+}
 
-	// 缓存规则
-	rm.rules[filename] = rules
+// readRulesFile 读取规则文件，文件系统中不存在时使用嵌入的文件
+func readRulesFile(filename string) ([]byte, error) {
+	if p := resolveRulesPath(filename); p != "" {
+		return os.ReadFile(p)
+	}
 
-	return rules, nil
+	// 如果文件系统中找不到文件，尝试使用嵌入的文件
+	fmt.Printf("文件系统中未找到规则文件: %s，尝试使用嵌入的文件\n", filename)
+	embeddedData := embed.GetEmbeddedRulesFile(filename)
+	if embeddedData != nil {
+		fmt.Printf("成功加载嵌入的规则文件: %s\n", filename)
+		return embeddedData, nil
+	}
+
+	return nil, fmt.Errorf("未找到规则文件: %s", filename)
+}
+
+// resolveRulesPath 查找规则文件在文件系统中的路径，不存在时返回空字符串
+func resolveRulesPath(filename string) string {
+	pathsToTry := []string{
+		filename,
+		filepath.Join("configs", "rules", filename),
+		filepath.Join("..", "configs", "rules", filename),
+	}
+
+	for _, p := range pathsToTry {
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	return ""
 }
 
 func (rm *RuleManager) GetRuleById(filename string, id int) (*model.Rule, error) {
@@ -97,7 +126,7 @@ func (rm *RuleManager) GetRuleById(filename string, id int) (*model.Rule, error)
 	}
 
 	for _, rule := range rules {
-		if rule.ID == id {
+		if rule.ID == id && !rule.Disabled {
 			return &rule, nil
 		}
 	}
@@ -105,16 +134,48 @@ func (rm *RuleManager) GetRuleById(filename string, id int) (*model.Rule, error)
 	return nil, nil
 }
 
-func (rm *RuleManager) GetSearchableRules(filename string) ([]model.Rule, error) {
-	allRules, err := rm.LoadRules(filename)
-	if err != nil {
-		return nil, err
+// GetRuleByUrl 根据书籍URL的域名匹配规则
+func (rm *RuleManager) GetRuleByUrl(filename string, bookUrl string) (*model.Rule, error) {
+	return rm.MatchRuleByUrl([]string{filename}, bookUrl)
+}
+
+// MatchRuleByUrl 根据书籍URL的域名依次在多个规则文件中匹配规则
+func (rm *RuleManager) MatchRuleByUrl(files []string, bookUrl string) (*model.Rule, error) {
+	u, err := url.Parse(bookUrl)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("无效的URL: %s", bookUrl)
 	}
 
+	for _, filename := range files {
+		rules, err := rm.LoadRules(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rule := range rules {
+			ru, err := url.Parse(rule.URL)
+			if err == nil && !rule.Disabled && strings.EqualFold(ru.Host, u.Host) {
+				return &rule, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// GetSearchableRules 返回一个或多个规则文件中启用且支持搜索的规则
+func (rm *RuleManager) GetSearchableRules(files ...string) ([]model.Rule, error) {
 	var searchableRules []model.Rule
-	for _, rule := range allRules {
-		if !rule.Search.Disabled {
-			searchableRules = append(searchableRules, rule)
+	for _, filename := range files {
+		allRules, err := rm.LoadRules(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rule := range allRules {
+			if !rule.Disabled && !rule.Search.Disabled {
+				searchableRules = append(searchableRules, rule)
+			}
 		}
 	}
 
@@ -0,0 +1,471 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-novel/internal/model"
+	"go-novel/internal/util"
+)
+
+// ErrRuleNotFound 规则文件中不存在指定ID的规则
+var ErrRuleNotFound = errors.New("规则不存在")
+
+// ValidationError 保存前校验未通过，Issues 中包含错误和警告
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	for _, issue := range e.Issues {
+		if issue.Severity == SeverityError {
+			return fmt.Sprintf("规则校验未通过: %s", issue.Error())
+		}
+	}
+	return "规则校验未通过"
+}
+
+// FileInfo 规则文件信息
+type FileInfo struct {
+	Name    string    `json:"name"`
+	Rules   int       `json:"rules"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Error   string    `json:"error,omitempty"` // 文件无法解析时的错误信息
+	Meta    *FileMeta `json:"meta,omitempty"`
+}
+
+// RuleSummary 规则概要，用于规则列表
+type RuleSummary struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	Comment    string `json:"comment"`
+	Disabled   bool   `json:"disabled"`
+	Searchable bool   `json:"searchable"`
+}
+
+// RulesDir 返回可编辑规则文件所在的目录
+func RulesDir() string {
+	return filepath.Join("configs", "rules")
+}
+
+// rulesFilePath 返回规则文件在规则目录中的路径，只允许文件名，防止访问目录外的文件
+func rulesFilePath(filename string) (string, error) {
+	if filename == "" || filename != filepath.Base(filename) || strings.HasPrefix(filename, ".") {
+		return "", fmt.Errorf("无效的规则文件名: %s", filename)
+	}
+	if filepath.Ext(filename) != ".json" {
+		return "", fmt.Errorf("规则文件必须是 .json 文件: %s", filename)
+	}
+	return filepath.Join(RulesDir(), filename), nil
+}
+
+// ListFiles 列出规则目录中的规则文件
+func ListFiles() ([]FileInfo, error) {
+	entries, err := os.ReadDir(RulesDir())
+	if err != nil {
+		return nil, fmt.Errorf("读取规则目录失败: %w", err)
+	}
+
+	files := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		file := FileInfo{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()}
+		if meta, raws, err := readRuleFile(filepath.Join(RulesDir(), entry.Name())); err != nil {
+			file.Error = err.Error()
+		} else {
+			file.Rules, file.Meta = len(raws), meta
+		}
+		files = append(files, file)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// ListRules 列出规则文件中的所有规则，包括已停用的
+func ListRules(filename string) ([]RuleSummary, error) {
+	fp, err := rulesFilePath(filename)
+	if err != nil {
+		return nil, err
+	}
+	raws, err := readRawRules(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]RuleSummary, 0, len(raws))
+	for _, raw := range raws {
+		var rule model.Rule
+		if err := json.Unmarshal(raw, &rule); err != nil {
+			return nil, fmt.Errorf("解析规则失败: %w", err)
+		}
+		summaries = append(summaries, ruleSummary(rule))
+	}
+	return summaries, nil
+}
+
+// ruleSummary 生成规则概要
+func ruleSummary(rule model.Rule) RuleSummary {
+	return RuleSummary{
+		ID:         rule.ID,
+		Name:       rule.Name,
+		URL:        rule.URL,
+		Comment:    rule.Comment,
+		Disabled:   rule.Disabled,
+		Searchable: !rule.Search.Disabled,
+	}
+}
+
+// GetRawRule 读取规则的原始JSON，保留文件中的字段顺序
+func GetRawRule(filename string, id int) (json.RawMessage, error) {
+	fp, err := rulesFilePath(filename)
+	if err != nil {
+		return nil, err
+	}
+	raws, err := readRawRules(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	index := ruleIndex(raws, id)
+	if index < 0 {
+		return nil, ErrRuleNotFound
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, raws[index], "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// SaveRule 新增或替换规则，校验通过后写回规则文件，文件不存在时创建
+func (rm *RuleManager) SaveRule(filename string, id int, data []byte) ([]Issue, error) {
+	var header struct {
+		ID *int `json:"id"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("规则不是有效的JSON对象: %w", err)
+	}
+	if header.ID == nil {
+		var err error
+		if data, err = setJSONField(data, "id", id); err != nil {
+			return nil, err
+		}
+	} else if *header.ID != id {
+		return nil, fmt.Errorf("规则ID %d 与请求的ID %d 不一致", *header.ID, id)
+	}
+
+	return rm.updateRules(filename, true, func(raws []json.RawMessage) ([]json.RawMessage, error) {
+		if index := ruleIndex(raws, id); index >= 0 {
+			raws[index] = data
+			return raws, nil
+		}
+		return append(raws, data), nil
+	})
+}
+
+// DraftRulesFile 自动识别生成的草稿规则所在的规则文件，检查后再移动到激活的规则文件
+const DraftRulesFile = "draft-rules.json"
+
+// SaveDraft 将规则追加到草稿规则文件，文件不存在时创建，返回分配的规则ID
+func (rm *RuleManager) SaveDraft(rule model.Rule) (int, []Issue, error) {
+	issues, err := rm.updateRules(DraftRulesFile, true, func(raws []json.RawMessage) ([]json.RawMessage, error) {
+		rule.ID = maxRuleID(raws) + 1
+		raw, err := marshalRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		return append(raws, raw), nil
+	})
+	return rule.ID, issues, err
+}
+
+// DeleteRule 从规则文件中删除规则
+func (rm *RuleManager) DeleteRule(filename string, id int) error {
+	_, err := rm.updateRules(filename, false, func(raws []json.RawMessage) ([]json.RawMessage, error) {
+		index := ruleIndex(raws, id)
+		if index < 0 {
+			return nil, ErrRuleNotFound
+		}
+		return append(raws[:index], raws[index+1:]...), nil
+	})
+	return err
+}
+
+// SetDisabled 停用或启用书源
+func (rm *RuleManager) SetDisabled(filename string, id int, disabled bool) error {
+	_, err := rm.updateRules(filename, false, func(raws []json.RawMessage) ([]json.RawMessage, error) {
+		index := ruleIndex(raws, id)
+		if index < 0 {
+			return nil, ErrRuleNotFound
+		}
+
+		// 启用时移除 disabled 字段，保持规则文件简洁
+		var value any
+		if disabled {
+			value = true
+		}
+		raw, err := setJSONField(raws[index], "disabled", value)
+		if err != nil {
+			return nil, err
+		}
+		raws[index] = raw
+		return raws, nil
+	})
+	return err
+}
+
+// updateRules 读取规则文件、修改后校验并写回，校验出现错误时不写入
+func (rm *RuleManager) updateRules(filename string, create bool, modify func([]json.RawMessage) ([]json.RawMessage, error)) ([]Issue, error) {
+	return rm.updateFile(filename, create, func(file *rulesFile) (err error) {
+		file.Rules, err = modify(file.Rules)
+		return err
+	})
+}
+
+// errUnchanged 修改函数返回该错误时不写回规则文件，updateFile 返回成功
+var errUnchanged = errors.New("规则文件未修改")
+
+// updateFile 与 updateRules 相同，可同时修改元数据。文件带元数据时更新其中的修改时间
+func (rm *RuleManager) updateFile(filename string, create bool, modify func(*rulesFile) error) ([]Issue, error) {
+	fp, err := rulesFilePath(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	rm.fileMutex.Lock()
+	defer rm.fileMutex.Unlock()
+
+	var file rulesFile
+	file.Meta, file.Rules, err = readRuleFile(fp)
+	if err != nil && (!create || !errors.Is(err, os.ErrNotExist)) {
+		return nil, err
+	}
+	orig, _ := os.ReadFile(fp)
+	existing := existingErrors(filename, orig)
+
+	if err := modify(&file); errors.Is(err, errUnchanged) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	file.Meta.touch()
+
+	data, err := encodeRulesFile(file.Meta, file.Rules)
+	if err != nil {
+		return nil, err
+	}
+	// 保持原文件的换行符风格，内置规则文件使用CRLF
+	if bytes.Contains(orig, []byte("\r\n")) {
+		data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	}
+
+	// 与加载和热加载使用相同的标准：修改引入新错误时拒绝保存，避免写入错误的规则。
+	// 修改前已有的错误不阻止保存，否则无法删除或停用出错的规则，这些错误作为警告返回
+	rules, issues, err := Validate(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	keys := errorKeys(issues)
+	if newErrors(issues, existing) > 0 {
+		return nil, &ValidationError{Issues: issues}
+	}
+
+	if err := util.WriteFileAtomic(fp, data, 0644); err != nil {
+		return nil, fmt.Errorf("写入规则文件失败: %w", err)
+	}
+
+	// 已加载的规则立即生效，不等待文件监听。与 LoadRules 相同，已有错误的规则也一并缓存
+	rm.mutex.Lock()
+	if _, cached := rm.rules[filename]; cached {
+		rm.cacheRules(filename, rules, keys)
+	}
+	rm.mutex.Unlock()
+
+	return issues, nil
+}
+
+// existingErrors 返回规则文件内容中已有错误的标识，内容无法解析时为空
+func existingErrors(filename string, data []byte) map[string]bool {
+	_, issues, err := Validate(filename, data)
+	if err != nil {
+		return make(map[string]bool)
+	}
+	return errorKeys(issues)
+}
+
+// errorKeys 返回校验问题中错误的标识
+func errorKeys(issues []Issue) map[string]bool {
+	keys := make(map[string]bool)
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			keys[issueKey(issue)] = true
+		}
+	}
+	return keys
+}
+
+// issueKey 以规则ID和字段标识校验问题，规则在文件中的位置或其他字段变化时保持不变，
+// 停用出错的规则不会使其已有的错误被视为新错误
+func issueKey(issue Issue) string {
+	return strconv.Itoa(issue.RuleID) + "\x00" + issue.Field
+}
+
+// newErrors 将已有的错误降级为警告，返回新出现的错误数量
+func newErrors(issues []Issue, known map[string]bool) int {
+	count := 0
+	for i, issue := range issues {
+		if issue.Severity != SeverityError {
+			continue
+		}
+		if known[issueKey(issue)] {
+			issues[i].Severity = SeverityWarning
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// readRawRules 读取规则文件为原始JSON数组，保留每条规则中未建模的字段和字段顺序
+func readRawRules(fp string) ([]json.RawMessage, error) {
+	_, raws, err := readRuleFile(fp)
+	return raws, err
+}
+
+// readRuleFile 读取规则文件的元数据和原始规则，数组格式的文件元数据为 nil
+func readRuleFile(fp string) (*FileMeta, []json.RawMessage, error) {
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta, raws, err := parseRulesFile(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", filepath.Base(fp), err)
+	}
+	return meta, raws, nil
+}
+
+// marshalRawRules 将规则数组格式化为两个空格缩进的JSON，不转义HTML字符
+func marshalRawRules(raws []json.RawMessage) ([]byte, error) {
+	var array bytes.Buffer
+	array.WriteByte('[')
+	for i, raw := range raws {
+		if i > 0 {
+			array.WriteByte(',')
+		}
+		array.Write(raw)
+	}
+	array.WriteByte(']')
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, array.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ruleIndex 查找指定ID的规则在数组中的位置，不存在时返回 -1
+func ruleIndex(raws []json.RawMessage, id int) int {
+	for i, raw := range raws {
+		var header struct {
+			ID int `json:"id"`
+		}
+		if json.Unmarshal(raw, &header) == nil && header.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// maxRuleID 返回规则数组中最大的ID，没有规则时返回 0
+func maxRuleID(raws []json.RawMessage) int {
+	max := 0
+	for _, raw := range raws {
+		var header struct {
+			ID int `json:"id"`
+		}
+		if json.Unmarshal(raw, &header) == nil && header.ID > max {
+			max = header.ID
+		}
+	}
+	return max
+}
+
+// setJSONField 设置JSON对象的顶层字段并保留其余字段的顺序，value 为 nil 时删除该字段
+func setJSONField(raw json.RawMessage, key string, value any) (json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("规则必须是JSON对象")
+	}
+
+	var out bytes.Buffer
+	out.WriteByte('{')
+	found := false
+	write := func(k string, v []byte) {
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		kb, _ := json.Marshal(k)
+		out.Write(kb)
+		out.WriteByte(':')
+		out.Write(v)
+	}
+
+	var encoded []byte
+	if value != nil {
+		var err error
+		if encoded, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		k, _ := tok.(string)
+
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		if k == key {
+			found = true
+			if encoded != nil {
+				write(k, encoded)
+			}
+			continue
+		}
+		write(k, v)
+	}
+
+	if !found && encoded != nil {
+		write(key, encoded)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
@@ -0,0 +1,187 @@
+package rules
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-novel/internal/model"
+)
+
+func TestRuleStore(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(RulesDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := &RuleManager{rules: make(map[string][]model.Rule)}
+	const file = "my-rules.json"
+
+	// 文件不存在时创建，未填写ID时使用路径中的ID
+	rule := `{"name": "测试书源", "url": "https://www.example.com/", "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content", "paragraphTag": "<br>+"}}`
+	if _, err := manager.SaveRule(file, 3, []byte(rule)); err != nil {
+		t.Fatalf("保存规则失败: %v", err)
+	}
+	if r, err := manager.GetRuleById(file, 3); err != nil || r == nil || r.Name != "测试书源" {
+		t.Fatalf("应能加载保存的规则: %+v, %v", r, err)
+	}
+
+	// 写回的文件保留HTML字符且格式化
+	data, _ := os.ReadFile(filepath.Join(RulesDir(), file))
+	if !strings.Contains(string(data), `"paragraphTag": "<br>+"`) {
+		t.Errorf("规则文件格式不符合预期:\n%s", data)
+	}
+
+	// 校验失败时不保存
+	broken := strings.Replace(rule, "#list a", "#list[", 1)
+	_, err := manager.SaveRule(file, 3, []byte(broken))
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Issues) == 0 {
+		t.Errorf("无效的规则应返回校验错误，实际: %v", err)
+	}
+
+	// 停用后不再参与匹配
+	if err := manager.SetDisabled(file, 3, true); err != nil {
+		t.Fatalf("停用书源失败: %v", err)
+	}
+	if r, _ := manager.GetRuleById(file, 3); r != nil {
+		t.Errorf("停用的书源不应被返回")
+	}
+	if list, _ := ListRules(file); len(list) != 1 || !list[0].Disabled {
+		t.Errorf("规则列表应包含已停用的书源: %+v", list)
+	}
+	if err := manager.SetDisabled(file, 3, false); err != nil {
+		t.Fatalf("启用书源失败: %v", err)
+	}
+	if raw, _ := GetRawRule(file, 3); strings.Count(string(raw), `"disabled"`) != 1 {
+		t.Errorf("启用后应移除 disabled 字段:\n%s", raw)
+	}
+
+	if err := manager.DeleteRule(file, 3); err != nil {
+		t.Fatalf("删除规则失败: %v", err)
+	}
+	if err := manager.DeleteRule(file, 3); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("删除不存在的规则应返回 ErrRuleNotFound，实际: %v", err)
+	}
+
+	// 草稿规则追加到草稿文件，依次分配ID
+	draft := model.Rule{Name: "草稿", URL: "https://www.example.org/", Search: model.SearchRule{Disabled: true}, Toc: model.TocRule{Item: "#list a"}, Chapter: model.ChapterRule{Content: "#content"}}
+	for want := 1; want <= 2; want++ {
+		if id, _, err := manager.SaveDraft(draft); err != nil || id != want {
+			t.Fatalf("保存草稿规则应分配ID %d，实际 %d, %v", want, id, err)
+		}
+	}
+	if r, err := manager.GetRuleById(DraftRulesFile, 2); err != nil || r == nil || r.Name != "草稿" {
+		t.Errorf("应能加载保存的草稿规则: %+v, %v", r, err)
+	}
+
+	// 不允许访问规则目录外的文件
+	if _, err := ListRules("../config.ini"); err == nil {
+		t.Errorf("应拒绝目录外的文件")
+	}
+}
+
+func TestRuleStoreExistingErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(RulesDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	manager := &RuleManager{rules: make(map[string][]model.Rule)}
+	const file = "my-rules.json"
+
+	// 文件中第2条规则已经出错
+	rules := `[{"id": 1, "name": "正常", "url": "https://www.example.com/", "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}},
+{"id": 2, "name": "出错", "url": "https://www.example.org/", "search": {"disabled": true}, "toc": {"item": "#list["}, "chapter": {"content": "#content"}}]`
+	if err := os.WriteFile(filepath.Join(RulesDir(), file), []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.LoadRules(file); err != nil {
+		t.Fatalf("加载规则失败: %v", err)
+	}
+
+	// 其他规则已有的错误不阻止修改，作为警告返回，修改后立即生效
+	if err := manager.SetDisabled(file, 1, true); err != nil {
+		t.Fatalf("已有错误不应阻止停用其他规则: %v", err)
+	}
+	if r, _ := manager.GetRuleById(file, 1); r != nil {
+		t.Errorf("停用的书源不应继续从缓存返回")
+	}
+	issues, err := manager.SaveRule(file, 3, []byte(`{"name": "新增", "url": "https://www.example.net/", "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}`))
+	if err != nil {
+		t.Fatalf("已有错误不应阻止新增规则: %v", err)
+	}
+	found := false
+	for _, issue := range issues {
+		if issue.RuleID == 2 && issue.Field == "toc.item" {
+			found = issue.Severity == SeverityWarning
+		}
+	}
+	if !found {
+		t.Errorf("已有错误应作为警告返回: %+v", issues)
+	}
+
+	// 修改的规则出错时仍然拒绝保存
+	var validationErr *ValidationError
+	if _, err := manager.SaveRule(file, 1, []byte(`{"id": 1, "name": "正常", "url": "https://www.example.com/", "search": {"disabled": true}, "toc": {"item": "#list["}, "chapter": {"content": "#content"}}`)); !errors.As(err, &validationErr) {
+		t.Errorf("修改后的规则出错应拒绝保存，实际: %v", err)
+	}
+
+	// 可以停用和删除出错的规则
+	if err := manager.SetDisabled(file, 2, true); err != nil {
+		t.Fatalf("应能停用出错的规则: %v", err)
+	}
+	if r, _ := manager.GetRuleById(file, 2); r != nil {
+		t.Errorf("停用的出错规则不应继续从缓存返回")
+	}
+	if err := manager.SetDisabled(file, 2, false); err != nil {
+		t.Fatalf("应能启用出错的规则: %v", err)
+	}
+	if err := manager.DeleteRule(file, 2); err != nil {
+		t.Fatalf("应能删除出错的规则: %v", err)
+	}
+	if list, _ := ListRules(file); len(list) != 2 {
+		t.Errorf("删除后应剩余2条规则: %+v", list)
+	}
+	if r, _ := manager.GetRuleById(file, 2); r != nil {
+		t.Errorf("删除的规则不应继续从缓存返回")
+	}
+	if r, _ := manager.GetRuleById(file, 3); r == nil || r.Name != "新增" {
+		t.Errorf("新增的规则应立即生效: %+v", r)
+	}
+}
+
+func TestRuleStoreConcurrent(t *testing.T) {
+	t.Chdir(t.TempDir())
+	manager := &RuleManager{rules: make(map[string][]model.Rule)}
+	const file = "concurrent-rules.json"
+
+	// 并发保存不同的规则，每条都应写入且文件保持有效
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for id := 1; id <= 20; id++ {
+		wg.Go(func() {
+			rule := `{"name": "书源` + strconv.Itoa(id) + `", "url": "https://www` + strconv.Itoa(id) + `.example.com/", "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}`
+			if _, err := manager.SaveRule(file, id, []byte(rule)); err != nil {
+				errs <- err
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("保存规则失败: %v", err)
+	}
+
+	list, err := ListRules(file)
+	if err != nil || len(list) != 20 {
+		t.Fatalf("规则文件应包含 20 条规则，实际 %d 条: %v", len(list), err)
+	}
+	entries, _ := os.ReadDir(RulesDir())
+	if len(entries) != 1 {
+		t.Errorf("不应残留临时文件: %d 个文件", len(entries))
+	}
+}
@@ -0,0 +1,630 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-novel/internal/charmap"
+	"go-novel/internal/model"
+	"go-novel/internal/selector"
+	"go-novel/internal/urltemplate"
+	"go-novel/internal/util"
+	"maps"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	// SeverityError 规则无法按预期工作
+	SeverityError = "error"
+	// SeverityWarning 规则可以使用，但存在可疑之处
+	SeverityWarning = "warning"
+)
+
+// Issue 规则校验问题
+type Issue struct {
+	File     string `json:"file"`
+	Index    int    `json:"index"` // 规则在文件中的位置，从0开始，文件级问题为 -1
+	RuleID   int    `json:"ruleId"`
+	RuleName string `json:"ruleName"`
+	Field    string `json:"field"` // 字段路径，如 chapter.filterTxt
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Error 格式化为 "文件 规则ID(名称) 字段: 信息"，文件级问题省略规则部分
+func (i Issue) Error() string {
+	var b strings.Builder
+	b.WriteString(i.File)
+	if i.Index >= 0 || i.RuleID != 0 {
+		fmt.Fprintf(&b, " 规则 %d", i.RuleID)
+	}
+	if i.RuleName != "" {
+		fmt.Fprintf(&b, " (%s)", i.RuleName)
+	}
+	if i.Field != "" {
+		b.WriteString(" " + i.Field)
+	}
+	b.WriteString(": " + i.Message)
+	return b.String()
+}
+
+// legacyFields 原Java版本规则中的字段，当前版本未使用但可以保留
+var legacyFields = map[string]bool{
+	"ignoreSsl":               true,
+	"needProxy":               true,
+	"search.intro":            true,
+	"toc.list":                true,
+	"chapter.nextChapterLink": true,
+	"chapter.nextPageInJs":    true,
+}
+
+// selectorField 使用选择器的字段及其编译结果的存放位置
+type selectorField struct {
+	path   string
+	target **selector.Selector
+}
+
+// selectorFields 列出规则中使用选择器的字段
+func selectorFields(c *model.CompiledRule) []selectorField {
+	return []selectorField{
+		{"search.result", &c.Search.Result},
+		{"search.bookName", &c.Search.BookName},
+		{"search.bookUrl", &c.Search.BookURL},
+		{"search.author", &c.Search.Author},
+		{"search.category", &c.Search.Category},
+		{"search.wordCount", &c.Search.WordCount},
+		{"search.status", &c.Search.Status},
+		{"search.latestChapter", &c.Search.LatestChapter},
+		{"search.lastUpdateTime", &c.Search.LastUpdateTime},
+		{"search.nextPage", &c.Search.NextPage},
+		{"book.bookName", &c.Book.BookName},
+		{"book.author", &c.Book.Author},
+		{"book.intro", &c.Book.Intro},
+		{"book.category", &c.Book.Category},
+		{"book.coverUrl", &c.Book.CoverUrl},
+		{"book.latestChapter", &c.Book.LatestChapter},
+		{"book.lastUpdateTime", &c.Book.LastUpdateTime},
+		{"book.status", &c.Book.Status},
+		{"book.wordCount", &c.Book.WordCount},
+		{"toc.item", &c.Toc.Item},
+		{"toc.chapterName", &c.Toc.ChapterName},
+		{"toc.chapterUrl", &c.Toc.ChapterURL},
+		{"toc.nextPage", &c.Toc.NextPage},
+		{"chapter.title", &c.Chapter.Title},
+		{"chapter.content", &c.Chapter.Content},
+		{"chapter.nextPage", &c.Chapter.NextPage},
+	}
+}
+
+// listFields 选择元素列表的字段，不支持 @js: 后处理、@属性 提取和 ##正则## 替换
+var listFields = map[string]bool{
+	"search.result":    true,
+	"search.nextPage":  true,
+	"toc.item":         true,
+	"toc.nextPage":     true,
+	"chapter.nextPage": true,
+}
+
+// Validate 解析并校验规则文件内容。JSON语法错误时返回 error，其余问题以 Issue 列表返回。
+// 不是JSON对象的元素不返回规则，返回的规则与文件中的位置不一定对应
+func Validate(filename string, data []byte) ([]model.Rule, []Issue, error) {
+	indexed, issues, err := validateIndexed(filename, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules := make([]model.Rule, 0, len(indexed))
+	for _, rule := range indexed {
+		if rule != nil {
+			rules = append(rules, *rule)
+		}
+	}
+	return rules, issues, nil
+}
+
+// validateIndexed 与 Validate 相同，返回的规则与文件中的元素一一对应，不是JSON对象的元素为 nil
+func validateIndexed(filename string, data []byte) ([]*model.Rule, []Issue, error) {
+	meta, raws, err := parseRulesFile(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析规则文件 %s 失败: %s", filename, err)
+	}
+
+	v := &validator{file: filename}
+	if err := meta.checkAppVersion(); err != nil {
+		v.index = -1
+		v.add("meta.minAppVersion", SeverityWarning, err.Error())
+	}
+	rules := make([]*model.Rule, len(raws))
+	seen := make(map[int]int)
+
+	for i, raw := range raws {
+		v.index = i
+		v.rule = model.Rule{File: filename}
+
+		// 逐字段解码，类型错误的字段保留零值并记录问题
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			v.add("", SeverityError, "规则必须是JSON对象")
+			continue
+		}
+		v.decode(fields, reflect.ValueOf(&v.rule).Elem(), "")
+
+		if first, exists := seen[v.rule.ID]; exists {
+			v.add("id", SeverityError, fmt.Sprintf("ID与第 %d 条规则重复", first+1))
+		} else {
+			seen[v.rule.ID] = i
+		}
+
+		v.check()
+		rule := v.rule
+		rules[i] = &rule
+	}
+
+	return rules, v.issues, nil
+}
+
+// Compile 编译单条规则，供未经规则管理器加载的规则使用
+func Compile(rule *model.Rule) []Issue {
+	v := &validator{index: -1, rule: *rule}
+	v.check()
+	rule.Compiled = v.rule.Compiled
+	return v.issues
+}
+
+// validator 规则校验上下文
+type validator struct {
+	file   string
+	index  int
+	rule   model.Rule
+	issues []Issue
+}
+
+// add 记录问题
+func (v *validator) add(field, severity, message string) {
+	v.issues = append(v.issues, Issue{
+		File:     v.file,
+		Index:    v.index,
+		RuleID:   v.rule.ID,
+		RuleName: v.rule.Name,
+		Field:    field,
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+// decode 按结构体的json标签解码对象，检查未知字段和字段类型
+func (v *validator) decode(fields map[string]json.RawMessage, target reflect.Value, prefix string) {
+	known := make(map[string]reflect.Value)
+	t := target.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			known[name] = target.Field(i)
+		}
+	}
+
+	// 先解码id和name，使后续问题能带上规则标识
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fieldOrder(keys[i]) < fieldOrder(keys[j]) ||
+			fieldOrder(keys[i]) == fieldOrder(keys[j]) && keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		path := prefix + key
+		field, exists := known[key]
+		if !exists {
+			if legacyFields[path] {
+				v.add(path, SeverityWarning, "兼容字段，当前版本未使用")
+			} else {
+				v.add(path, SeverityError, "未知字段")
+			}
+			continue
+		}
+
+		raw := fields[key]
+		// 可选的对象，如 login，为 null 时保持为空
+		if field.Kind() == reflect.Pointer && field.Type().Elem().Kind() == reflect.Struct {
+			if string(bytes.TrimSpace(raw)) == "null" {
+				continue
+			}
+			field.Set(reflect.New(field.Type().Elem()))
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Struct {
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &nested); err != nil {
+				v.add(path, SeverityError, "应为JSON对象")
+				continue
+			}
+			v.decode(nested, field, path+".")
+			continue
+		}
+
+		if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+			v.add(path, SeverityError, fmt.Sprintf("类型错误，应为%s", kindName(field.Kind())))
+		}
+	}
+}
+
+// check 校验字段取值
+func (v *validator) check() {
+	r := &v.rule
+
+	if r.ID <= 0 {
+		v.add("id", SeverityError, "ID必须为正整数")
+	}
+	if r.Name == "" {
+		v.add("name", SeverityWarning, "缺少书源名称")
+	}
+	v.checkURL("url", r.URL, true)
+	compiled := &model.CompiledRule{}
+
+	// 搜索
+	if !r.Search.Disabled && r.Search.URL == "" && r.Search.Result == "" && r.Search.BookName == "" {
+		v.add("search", SeverityWarning, "未配置搜索规则，请设置 search.disabled 为 true")
+	} else if !r.Search.Disabled {
+		v.checkURL("search.url", r.Search.URL, true)
+		if r.Search.Result == "" {
+			v.add("search.result", SeverityError, "缺少搜索结果选择器")
+		}
+		if r.Search.BookName == "" {
+			v.add("search.bookName", SeverityError, "缺少书名选择器")
+		}
+	}
+	switch strings.ToLower(r.Search.Method) {
+	case "", "get", "post":
+	default:
+		v.add("search.method", SeverityError, fmt.Sprintf("不支持的请求方法: %s", r.Search.Method))
+	}
+
+	// 目录与正文
+	if r.Toc.Item == "" {
+		v.add("toc.item", SeverityError, "缺少章节列表选择器")
+	}
+	if r.Chapter.Content == "" {
+		v.add("chapter.content", SeverityError, "缺少正文选择器")
+	}
+
+	// 选择器
+	values := fieldValues(r)
+	for _, field := range selectorFields(compiled) {
+		if raw := values[field.path]; raw != "" {
+			*field.target = v.compileSelector(field.path, raw)
+		}
+	}
+
+	// 正则表达式
+	if r.Book.URL != "" {
+		compiled.Book.URL = v.checkRegex("book.url", r.Book.URL)
+	}
+	if r.Chapter.ParagraphTag != "" {
+		v.checkRegex("chapter.paragraphTag", r.Chapter.ParagraphTag)
+	}
+	if decoder, err := charmap.NewDecoder(r.Chapter.CharMap, r.Chapter.StripNoise, r.Chapter.NoiseChars); err != nil {
+		v.add("chapter.charMap", SeverityError, err.Error())
+	} else {
+		compiled.Chapter.Decoder = decoder
+	}
+	if r.Chapter.FilterTxt != "" {
+		compiled.Chapter.FilterTxt = v.checkRegex("chapter.filterTxt", FilterTxtPattern(r.Chapter.FilterTxt))
+	}
+
+	// URL模板，旧版的 %s 在搜索中表示关键词，在目录中表示书籍ID
+	// 旧版 POST 搜索的 %s 原样插入关键词，不做URL转义
+	if r.Search.URL != "" {
+		compiled.Search.URL = v.compileTemplate("search.url", urltemplate.Legacy(r.Search.URL, searchLegacyExpr(r.Search.Method)), searchVarNames)
+	}
+	if r.Search.Data != "" {
+		compiled.Search.Data = v.compileTemplate("search.data", urltemplate.Legacy(r.Search.Data, "keyword"), searchVarNames)
+	}
+	// 不是模板的 toc.url 是固定的目录页地址，按URL校验
+	if urltemplate.IsTemplate(r.Toc.URL) {
+		compiled.Toc.URL = v.compileTemplate("toc.url", urltemplate.Legacy(r.Toc.URL, "bookId|raw"), tocVarNames(compiled.Book.URL))
+	} else {
+		v.checkURL("toc.url", r.Toc.URL, false)
+	}
+	v.checkBody("search", r.Search.BodyType, compiled.Search.Data, urltemplate.Vars{"keyword": "x", "page": "1"})
+	if r.Search.Pagination && r.Search.NextPage == "" && !SearchUsesPage(compiled) {
+		v.add("search.nextPage", SeverityWarning, "开启了分页但缺少下一页选择器，搜索URL中也未使用 {{page}}")
+	}
+
+	// 登录
+	if l := r.Login; l != nil {
+		v.checkLogin(l)
+	}
+
+	// 请求头
+	v.checkHeaders("headers", r.Headers)
+	v.checkHeaders("search.headers", r.Search.Headers)
+	v.checkHeaders("book.headers", r.Book.Headers)
+	v.checkHeaders("toc.headers", r.Toc.Headers)
+	v.checkHeaders("chapter.headers", r.Chapter.Headers)
+	if r.Login != nil {
+		v.checkHeaders("login.headers", r.Login.Headers)
+	}
+
+	// 爬取参数
+	c := r.Crawl
+	if c.Threads < -1 || c.MinInterval < 0 || c.MaxInterval < 0 || c.MaxAttempts < 0 || c.RetryMinInterval < 0 || c.RetryMaxInterval < 0 {
+		v.add("crawl", SeverityError, "爬取参数不能为负数")
+	}
+	if c.MaxInterval > 0 && c.MinInterval > c.MaxInterval {
+		v.add("crawl.minInterval", SeverityError, "最小间隔大于最大间隔")
+	}
+	if c.RetryMaxInterval > 0 && c.RetryMinInterval > c.RetryMaxInterval {
+		v.add("crawl.retryMinInterval", SeverityError, "重试最小间隔大于最大间隔")
+	}
+
+	r.Compiled = compiled
+}
+
+// placeholderPattern URL模板中的 {{ }} 占位符
+var placeholderPattern = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// checkURL 校验URL，允许包含 %s 和 {{ }} 占位符
+func (v *validator) checkURL(field, value string, required bool) {
+	if value == "" {
+		if required {
+			v.add(field, SeverityError, "缺少URL")
+		}
+		return
+	}
+
+	value = placeholderPattern.ReplaceAllString(strings.ReplaceAll(value, "%s", "x"), "x")
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(field, SeverityError, fmt.Sprintf("无效的URL: %s", value))
+	}
+}
+
+// checkLogin 校验登录规则，登录模板中的变量来自登录凭据，不检查变量名
+func (v *validator) checkLogin(l *model.LoginRule) {
+	if l.URL == "" && l.Script == "" {
+		v.add("login", SeverityError, "缺少登录地址或登录脚本")
+	}
+	if l.URL != "" {
+		// 相对地址基于书源地址
+		if strings.Contains(l.URL, "://") {
+			v.checkURL("login.url", l.URL, false)
+		}
+		v.compileTemplate("login.url", l.URL, nil)
+	}
+	switch strings.ToLower(l.Method) {
+	case "", "get", "post":
+	default:
+		v.add("login.method", SeverityError, fmt.Sprintf("不支持的请求方法: %s", l.Method))
+	}
+	var data *urltemplate.Template
+	if l.Data != "" {
+		data = v.compileTemplate("login.data", l.Data, nil)
+	}
+	v.checkBody("login", l.BodyType, data, nil)
+	if l.Script != "" {
+		if _, err := util.CompileJs(l.Script); err != nil {
+			v.add("login.script", SeverityError, fmt.Sprintf("JavaScript语法错误: %v", err))
+		}
+	}
+}
+
+// checkBody 校验请求体格式，json 格式时用示例变量生成请求体并检查JSON语法
+func (v *validator) checkBody(prefix, bodyType string, data *urltemplate.Template, sample urltemplate.Vars) {
+	switch strings.ToLower(bodyType) {
+	case "", "form", "raw":
+	case "json":
+		if data == nil {
+			return
+		}
+		if sample == nil {
+			sample = make(urltemplate.Vars)
+			for _, name := range data.Names() {
+				sample[name] = "x"
+			}
+		}
+		body, err := data.ExecuteJSON(sample)
+		if err == nil && !json.Valid([]byte(body)) {
+			v.add(prefix+".data", SeverityError, "请求体不是合法的JSON")
+		}
+	default:
+		v.add(prefix+".bodyType", SeverityError, fmt.Sprintf("不支持的请求体格式: %s，可用: form、json、raw", bodyType))
+	}
+}
+
+// checkHeaders 校验请求头的名称和取值
+func (v *validator) checkHeaders(field string, headers map[string]string) {
+	for _, key := range slices.Sorted(maps.Keys(headers)) {
+		if !httpguts.ValidHeaderFieldName(key) {
+			v.add(field, SeverityError, fmt.Sprintf("无效的请求头名称: %q", key))
+		} else if !httpguts.ValidHeaderFieldValue(headers[key]) {
+			v.add(field, SeverityError, fmt.Sprintf("请求头 %s 的值无效", key))
+		}
+	}
+}
+
+// checkRegex 编译正则表达式，出错时记录问题并返回 nil
+func (v *validator) checkRegex(field, pattern string) *regexp.Regexp {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		v.add(field, SeverityError, fmt.Sprintf("正则表达式错误: %v", err))
+	}
+	return re
+}
+
+// searchVarNames 搜索URL和请求参数模板可用的变量
+var searchVarNames = map[string]bool{"keyword": true, "page": true}
+
+// searchLegacyExpr 旧版 %s 在搜索URL中对应的表达式，GET 请求按URL转义，POST 请求不转义
+func searchLegacyExpr(method string) string {
+	if strings.EqualFold(method, "post") {
+		return "keyword|raw"
+	}
+	return "keyword"
+}
+
+// tocVarNames 目录URL模板可用的变量：书籍URL、书籍ID、页码，以及书籍URL正则的分组 $1、$2… 和命名分组
+func tocVarNames(bookURL *regexp.Regexp) map[string]bool {
+	names := map[string]bool{"bookUrl": true, "bookId": true, "id": true, "page": true}
+	if bookURL != nil {
+		for i, name := range bookURL.SubexpNames() {
+			if i > 0 {
+				names["$"+strconv.Itoa(i)] = true
+			}
+			if name != "" {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+// SearchUsesPage 搜索URL或请求参数中是否使用了 {{page}}，使用时按页码翻页
+func SearchUsesPage(c *model.CompiledRule) bool {
+	return c.Search.URL != nil && c.Search.URL.Uses("page") || c.Search.Data != nil && c.Search.Data.Uses("page")
+}
+
+// compileTemplate 编译URL模板并检查变量，names 为 nil 时不检查，出错时记录问题并返回 nil
+func (v *validator) compileTemplate(field, raw string, names map[string]bool) *urltemplate.Template {
+	t, err := urltemplate.Compile(raw)
+	if err != nil {
+		v.add(field, SeverityError, err.Error())
+		return nil
+	}
+	for _, name := range t.Names() {
+		if names != nil && !names[name] {
+			v.add(field, SeverityError, fmt.Sprintf("未定义的变量 %s，可用变量: %s", name, strings.Join(slices.Sorted(maps.Keys(names)), "、")))
+		}
+	}
+	return t
+}
+
+// compileSelector 编译选择器，出错时记录问题并返回 nil，执行时该字段视为未配置
+func (v *validator) compileSelector(field, raw string) *selector.Selector {
+	sel, err := selector.Compile(raw)
+	if err != nil {
+		v.add(field, SeverityError, err.Error())
+		return nil
+	}
+	if listFields[field] && sel.HasJs() {
+		v.add(field, SeverityError, "该字段不支持@js:")
+	}
+	if listFields[field] && sel.HasExtract() {
+		v.add(field, SeverityError, "该字段选择元素列表，不支持@属性和##正则##")
+	}
+	if sel != nil {
+		sel.Origin = v.origin(field)
+	}
+	return sel
+}
+
+// origin 返回 "文件 规则ID (名称) 字段"，标识选择器的来源
+func (v *validator) origin(field string) string {
+	var b strings.Builder
+	if v.rule.File != "" {
+		b.WriteString(v.rule.File + " ")
+	}
+	fmt.Fprintf(&b, "规则 %d", v.rule.ID)
+	if v.rule.Name != "" {
+		fmt.Fprintf(&b, " (%s)", v.rule.Name)
+	}
+	b.WriteString(" " + field)
+	return b.String()
+}
+
+// FilterTxtPattern 将 filterTxt 转换为Go正则表达式，\1 不被支持，替换为 $1
+func FilterTxtPattern(filterTxt string) string {
+	return strings.ReplaceAll(filterTxt, `\1`, `$1`)
+}
+
+// fieldValues 按字段路径列出规则中的字符串字段
+func fieldValues(r *model.Rule) map[string]string {
+	values := make(map[string]string)
+	collectStrings(reflect.ValueOf(r).Elem(), "", values)
+	return values
+}
+
+// collectStrings 递归收集字符串字段
+func collectStrings(v reflect.Value, prefix string, values map[string]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		switch v.Field(i).Kind() {
+		case reflect.String:
+			values[prefix+name] = v.Field(i).String()
+		case reflect.Struct:
+			collectStrings(v.Field(i), prefix+name+".", values)
+		case reflect.Pointer:
+			if !v.Field(i).IsNil() && v.Field(i).Elem().Kind() == reflect.Struct {
+				collectStrings(v.Field(i).Elem(), prefix+name+".", values)
+			}
+		}
+	}
+}
+
+// fieldOrder 解码顺序，id和name优先
+func fieldOrder(key string) int {
+	switch key {
+	case "id":
+		return 0
+	case "name":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// kindName 字段类型的中文名
+func kindName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "字符串"
+	case reflect.Bool:
+		return "布尔值"
+	case reflect.Int, reflect.Int64:
+		return "整数"
+	case reflect.Map:
+		return "对象"
+	default:
+		return kind.String()
+	}
+}
+
+// severityLabel 问题级别的中文名
+func severityLabel(severity string) string {
+	if severity == SeverityError {
+		return "错误"
+	}
+	return "警告"
+}
+
+// describeJSONError 为JSON语法错误补充行列号
+func describeJSONError(data []byte, err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var offset int64
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err.Error()
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+	return fmt.Sprintf("第 %d 行第 %d 列: %v", line, col, err)
+}
@@ -0,0 +1,124 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	data := []byte(`[
+  {
+    "id": 1,
+    "name": "测试书源",
+    "url": "https://www.example.com/",
+    "search": {"url": "https://www.example.com/search?q=%s", "result": "div.item", "bookName": "a.title", "author": "//span["},
+    "toc": {"item": "#list a"},
+    "chapter": {"content": "#content@js:r = r.replace(", "filterTxt": "(本章完", "paragraphTagClosed": "no"},
+    "bookname": "h1"
+  },
+  {
+    "id": 1,
+    "name": "重复书源",
+    "url": "https://www.example.org/",
+    "search": {"disabled": true},
+    "book": {"url": "https://www.example.org/book/(?P<bid>\\d+)/"},
+    "login": {"url": "/login?u={{username}}", "method": "put", "script": "r = login("},
+    "toc": {"url": "https://www.example.org/{{bid/1000}}/{{bookid}}/", "item": "ul > li:nth-child(2n) > a"},
+    "chapter": {"content": "#content", "charMap": {"": "的"}}
+  }
+]`)
+
+	rules, issues, err := Validate("test-rules.json", data)
+	if err != nil {
+		t.Fatalf("校验规则失败: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("应解析出 2 条规则，实际 %d 条", len(rules))
+	}
+
+	// 每个字段路径应有的错误
+	expected := map[string]string{
+		"search.author":              "XPath错误",
+		"chapter.content":            "JavaScript语法错误",
+		"chapter.filterTxt":          "正则表达式错误",
+		"chapter.paragraphTagClosed": "类型错误",
+		"bookname":                   "未知字段",
+		"id":                         "ID与第 1 条规则重复",
+		"toc.url":                    "未定义的变量 bookid",
+		"login.method":               "不支持的请求方法",
+		"login.script":               "JavaScript语法错误",
+		"chapter.charMap":            "映射的字符不能为空",
+	}
+	for _, issue := range issues {
+		if issue.Severity != SeverityError {
+			continue
+		}
+		want, exists := expected[issue.Field]
+		if !exists {
+			t.Errorf("意外的问题: %s", issue.Error())
+			continue
+		}
+		if !strings.Contains(issue.Message, want) {
+			t.Errorf("%s 的问题应包含 %q，实际为 %q", issue.Field, want, issue.Message)
+		}
+		if issue.Field == "id" && issue.Index != 1 {
+			t.Errorf("重复ID应报告在第 2 条规则上，实际为第 %d 条", issue.Index+1)
+		}
+		delete(expected, issue.Field)
+	}
+	for field := range expected {
+		t.Errorf("未检测到 %s 的问题", field)
+	}
+
+	// JSON语法错误应报告行号
+	_, _, err = Validate("broken.json", []byte("[\n  {\"id\": 1,}\n]"))
+	if err == nil || !strings.Contains(err.Error(), "第 2 行") {
+		t.Errorf("JSON语法错误应包含行号，实际为: %v", err)
+	}
+}
+
+func TestValidateLiteralTocURL(t *testing.T) {
+	// 不是模板的 toc.url 按URL校验，查询字符串中的 ?、+、( 等字符不应被当作正则表达式
+	data := []byte(`[
+  {"id": 1, "name": "固定目录", "url": "https://www.example.com/", "search": {"disabled": true},
+   "toc": {"url": "https://www.example.com/toc?id=1&sort=a+b(1", "item": "#list a"}, "chapter": {"content": "#content"}},
+  {"id": 2, "name": "相对目录", "url": "https://www.example.com/", "search": {"disabled": true},
+   "toc": {"url": "/toc?id=1", "item": "#list a"}, "chapter": {"content": "#content"}}
+]`)
+
+	_, issues, err := Validate("literal-toc-rules.json", data)
+	if err != nil {
+		t.Fatalf("校验规则失败: %v", err)
+	}
+	var found bool
+	for _, issue := range issues {
+		if issue.Field != "toc.url" || issue.Severity != SeverityError {
+			continue
+		}
+		if issue.Index == 0 {
+			t.Errorf("带查询字符串的目录页URL不应报错: %s", issue.Error())
+		} else if strings.Contains(issue.Message, "无效的URL") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("相对的目录页URL应报告为无效的URL")
+	}
+}
+
+func TestValidateEmbeddedRules(t *testing.T) {
+	manager := GetRuleManager()
+
+	// 内置规则文件不应有无法解析的字段或语法错误
+	for _, filename := range []string{"main-rules.json", "flowlimit-rules.json", "non-searchable-rules.json", "proxy-rules.json"} {
+		issues, err := manager.Lint(filename)
+		if err != nil {
+			t.Fatalf("校验 %s 失败: %v", filename, err)
+		}
+		for _, issue := range issues {
+			if issue.Severity == SeverityError && (strings.Contains(issue.Message, "语法错误") || strings.Contains(issue.Message, "未知字段")) {
+				t.Errorf("内置规则存在问题: %s", issue.Error())
+			}
+		}
+	}
+}
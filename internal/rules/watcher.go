@@ -0,0 +1,164 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay 文件变化后等待的时间，编辑器保存时可能连续触发多次写入
+const reloadDelay = 300 * time.Millisecond
+
+// ReloadResult 规则文件热加载结果
+type ReloadResult struct {
+	File   string  `json:"file"`
+	Loaded bool    `json:"loaded"` // 是否已替换为新版本，为 false 时继续使用旧版本
+	Rules  int     `json:"rules"`
+	Issues []Issue `json:"issues,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// Reload 重新读取已缓存的规则文件，没有新出现的错误时替换缓存，否则保留旧版本
+func (rm *RuleManager) Reload(filename string) ReloadResult {
+	result := ReloadResult{File: filename}
+
+	// 只从文件系统读取，文件被删除或重命名时不回退到嵌入的文件
+	p := resolveRulesPath(filename)
+	if p == "" {
+		result.Error = fmt.Sprintf("未找到规则文件: %s，继续使用旧版本", filename)
+		return result
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	rules, issues, err := Validate(filename, data)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Issues = issues
+
+	// 与 LoadRules 使用相同的标准：已有错误的规则继续加载，只拒绝新出现的错误，
+	// 避免文件中个别规则出错时其他规则的修改无法生效
+	keys := errorKeys(issues)
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	if count := newErrors(issues, rm.knownErrors[filename]); count > 0 {
+		result.Error = fmt.Sprintf("规则校验发现 %d 个新错误，继续使用旧版本", count)
+		return result
+	}
+
+	// 正在进行的下载持有旧规则的副本，替换缓存不影响其继续执行
+	rm.cacheRules(filename, rules, keys)
+
+	result.Loaded = true
+	result.Rules = len(rules)
+	return result
+}
+
+// Watch 监听规则目录，已加载的规则文件变化时重新加载并通过 onReload 通知结果
+func (rm *RuleManager) Watch(ctx context.Context, onReload func(ReloadResult)) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("创建文件监听失败: %w", err)
+	}
+
+	// 监听目录而不是文件，编辑器保存时常以重命名方式替换文件
+	watched := 0
+	for _, dir := range []string{filepath.Join("configs", "rules"), filepath.Join("..", "configs", "rules")} {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := fw.Add(dir); err != nil {
+			fmt.Printf("监听规则目录失败 %s: %v\n", dir, err)
+			continue
+		}
+		watched++
+	}
+	if watched == 0 {
+		fw.Close()
+		return fmt.Errorf("未找到规则目录")
+	}
+
+	go func() {
+		defer fw.Close()
+
+		pending := make(map[string]bool)
+		timer := time.NewTimer(reloadDelay)
+		timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case event, ok := <-fw.Events:
+				if !ok {
+					return
+				}
+				if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+					continue
+				}
+				if filename := rm.cachedFileFor(event.Name); filename != "" {
+					pending[filename] = true
+					timer.Reset(reloadDelay)
+				}
+			case err, ok := <-fw.Errors:
+				if !ok {
+					return
+				}
+				fmt.Printf("规则目录监听出错: %v\n", err)
+			case <-timer.C:
+				for filename := range pending {
+					result := rm.Reload(filename)
+					if result.Loaded {
+						fmt.Printf("规则文件已重新加载: %s，共 %d 条规则\n", filename, result.Rules)
+					} else {
+						fmt.Printf("规则文件重新加载失败: %s: %s\n", filename, result.Error)
+						for _, issue := range result.Issues {
+							if issue.Severity == SeverityError {
+								fmt.Printf("规则校验错误: %s\n", issue.Error())
+							}
+						}
+					}
+					if onReload != nil {
+						onReload(result)
+					}
+				}
+				clear(pending)
+			}
+		}
+	}()
+
+	fmt.Println("规则文件热加载已启动")
+	return nil
+}
+
+// cachedFileFor 根据变化的文件路径查找对应的已缓存规则文件名，未缓存的文件在首次使用时才会加载
+func (rm *RuleManager) cachedFileFor(changed string) string {
+	changedAbs, err := filepath.Abs(changed)
+	if err != nil {
+		return ""
+	}
+
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	for filename := range rm.rules {
+		p := resolveRulesPath(filename)
+		if p == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil && abs == changedAbs {
+			return filename
+		}
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-novel/internal/model"
+)
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "reload-rules.json")
+	write := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`[{"id": 1, "name": "旧书源", "url": "https://www.example.com/", "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}]`)
+	manager := &RuleManager{rules: make(map[string][]model.Rule)}
+	if _, err := manager.LoadRules(file); err != nil {
+		t.Fatalf("加载规则失败: %v", err)
+	}
+
+	// 存在错误时保留旧版本
+	write(`[{"id": 1, "name": "新书源", "url": "https://www.example.com/", "search": {"disabled": true}, "toc": {"item": "#list["}, "chapter": {"content": "#content"}}]`)
+	if result := manager.Reload(file); result.Loaded || result.Error == "" {
+		t.Errorf("存在错误的规则不应被加载: %+v", result)
+	}
+	if rule, _ := manager.GetRuleById(file, 1); rule == nil || rule.Name != "旧书源" {
+		t.Errorf("加载失败时应继续使用旧版本，实际: %+v", rule)
+	}
+
+	// 校验通过时替换
+	write(`[{"id": 1, "name": "新书源", "url": "https://www.example.com/", "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}]`)
+	if result := manager.Reload(file); !result.Loaded {
+		t.Fatalf("规则应被重新加载: %+v", result)
+	}
+	if rule, _ := manager.GetRuleById(file, 1); rule == nil || rule.Name != "新书源" {
+		t.Errorf("重新加载后应使用新版本，实际: %+v", rule)
+	}
+
+	// 其他规则已有的错误不阻止重新加载，与启动时加载的标准一致
+	write(`[{"id": 1, "name": "新书源", "url": "https://www.example.com/", "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}},
+{"id": 2, "name": "出错", "url": "https://www.example.org/", "search": {"disabled": true}, "toc": {"item": "#list["}, "chapter": {"content": "#content"}}]`)
+	broken := &RuleManager{rules: make(map[string][]model.Rule)}
+	if _, err := broken.LoadRules(file); err != nil {
+		t.Fatalf("已有错误的规则文件应能加载: %v", err)
+	}
+	write(`[{"id": 1, "name": "修改后", "url": "https://www.example.com/", "search": {"disabled": true}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}},
+{"id": 2, "name": "出错", "url": "https://www.example.org/", "search": {"disabled": true}, "toc": {"item": "#list["}, "chapter": {"content": "#content"}}]`)
+	if result := broken.Reload(file); !result.Loaded {
+		t.Fatalf("已有错误不应阻止重新加载: %+v", result)
+	}
+	if rule, _ := broken.GetRuleById(file, 1); rule == nil || rule.Name != "修改后" {
+		t.Errorf("重新加载后应使用新版本，实际: %+v", rule)
+	}
+}
@@ -0,0 +1,418 @@
+package selector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// JSON响应转换为由 <json> 元素组成的节点树，使 JSONPath 与 CSS/XPath 共用选择范围和提取逻辑：
+// 每个值是一个 json 元素，type 属性为 object、array、string、number、bool 或 null，
+// 对象的成员和数组的元素是其子元素，key 属性为成员名或下标，标量的值为元素内的文本
+const jsonTag = "json"
+
+// IsJSON 根据 Content-Type 或内容判断响应是否为JSON
+func IsJSON(data []byte, contentType string) bool {
+	if strings.Contains(strings.ToLower(contentType), "json") {
+		return true
+	}
+	trimmed := bytes.TrimSpace(data)
+	return (bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("["))) && json.Valid(trimmed)
+}
+
+// ParseDocument 解析响应内容，JSON响应转换为节点树，其余按HTML解析
+func ParseDocument(data []byte, contentType string) (*goquery.Document, error) {
+	if IsJSON(data, contentType) {
+		return ParseJSON(data)
+	}
+	return goquery.NewDocumentFromReader(bytes.NewReader(data))
+}
+
+// ParseJSON 将JSON转换为节点树，成员保持原有顺序
+func ParseJSON(data []byte) (*goquery.Document, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	root := &html.Node{Type: html.DocumentNode}
+	value, err := decodeJSONNode(dec)
+	if err != nil {
+		return nil, fmt.Errorf("解析JSON失败: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("解析JSON失败: 末尾有多余的内容")
+	}
+	root.AppendChild(value)
+	return goquery.NewDocumentFromNode(root), nil
+}
+
+// decodeJSONNode 读取一个JSON值并转换为 json 元素
+func decodeJSONNode(dec *json.Decoder) (*html.Node, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &html.Node{Type: html.ElementNode, Data: jsonTag}
+	setType := func(t string) {
+		n.Attr = append(n.Attr, html.Attribute{Key: "type", Val: t})
+	}
+	appendChild := func(key string) error {
+		child, err := decodeJSONNode(dec)
+		if err != nil {
+			return err
+		}
+		child.Attr = append(child.Attr, html.Attribute{Key: "key", Val: key})
+		n.AppendChild(child)
+		return nil
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '{' {
+			setType("object")
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				if err := appendChild(key.(string)); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			setType("array")
+			for i := 0; dec.More(); i++ {
+				if err := appendChild(strconv.Itoa(i)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if _, err := dec.Token(); err != nil { // 结束的 } 或 ]
+			return nil, err
+		}
+	case string:
+		setType("string")
+		n.AppendChild(&html.Node{Type: html.TextNode, Data: t})
+	case json.Number:
+		setType("number")
+		n.AppendChild(&html.Node{Type: html.TextNode, Data: t.String()})
+	case bool:
+		setType("bool")
+		n.AppendChild(&html.Node{Type: html.TextNode, Data: strconv.FormatBool(t)})
+	default:
+		setType("null")
+	}
+	return n, nil
+}
+
+// isJSONNode 是否为JSON节点树中的值
+func isJSONNode(n *html.Node) bool {
+	return n != nil && n.Type == html.ElementNode && n.Data == jsonTag
+}
+
+// jsonType 返回JSON值的类型
+func jsonType(n *html.Node) string {
+	for _, a := range n.Attr {
+		if a.Key == "type" {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// jsonKey 返回JSON值在对象中的成员名或在数组中的下标
+func jsonKey(n *html.Node) string {
+	for _, a := range n.Attr {
+		if a.Key == "key" {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// jsonText 标量返回其值，null 返回空字符串，对象和数组返回紧凑的JSON
+func jsonText(n *html.Node) string {
+	switch jsonType(n) {
+	case "object", "array":
+		data, _ := json.Marshal(jsonValue(n))
+		return string(data)
+	case "null":
+		return ""
+	default:
+		if n.FirstChild != nil {
+			return n.FirstChild.Data
+		}
+		return ""
+	}
+}
+
+// jsonValue 将节点还原为可编码的值，对象成员保持原有顺序
+func jsonValue(n *html.Node) any {
+	switch jsonType(n) {
+	case "object":
+		var members orderedObject
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			members = append(members, orderedMember{jsonKey(c), jsonValue(c)})
+		}
+		return members
+	case "array":
+		items := []any{}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			items = append(items, jsonValue(c))
+		}
+		return items
+	case "number":
+		return json.Number(jsonText(n))
+	case "bool":
+		return jsonText(n) == "true"
+	case "null":
+		return nil
+	default:
+		return jsonText(n)
+	}
+}
+
+// orderedMember 对象成员
+type orderedMember struct {
+	key   string
+	value any
+}
+
+// orderedObject 按原有顺序编码的对象
+type orderedObject []orderedMember
+
+// MarshalJSON 按成员顺序编码对象
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(m.key)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonStep JSONPath 中的一步
+type jsonStep struct {
+	recursive bool     // .. 递归查找
+	wildcard  bool     // * 或 [*]
+	keys      []string // 成员名或下标，多个时为并集，如 ['a','b'] 或 [0,1]
+	slice     bool     // [start:end]
+	start     *int
+	end       *int
+}
+
+// compileJSONPath 解析 JSONPath，支持 $、.key、['key']、[n] (负数从末尾计)、[a,b]、[start:end]、* 和 ..key，
+// $ 表示当前选择范围。不支持过滤表达式
+func compileJSONPath(expr string) ([]jsonStep, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("JSONPath应以 $ 开头")
+	}
+
+	var steps []jsonStep
+	rest := expr[1:]
+	for rest != "" {
+		var step jsonStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			if name == "" {
+				return nil, fmt.Errorf("JSONPath错误: %s 中缺少成员名", expr)
+			}
+			if name == "*" {
+				step.wildcard = true
+			} else {
+				step.keys = []string{name}
+			}
+			steps = append(steps, step)
+			continue
+		case !strings.HasPrefix(rest, "["):
+			return nil, fmt.Errorf("JSONPath错误: %s 中无法解析 %q", expr, rest)
+		}
+
+		// 方括号
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("JSONPath错误: %s 中缺少 ]", expr)
+		}
+		inner := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+		switch {
+		case inner == "*":
+			step.wildcard = true
+		case strings.HasPrefix(inner, "?") || strings.HasPrefix(inner, "("):
+			return nil, fmt.Errorf("JSONPath错误: 不支持表达式 [%s]", inner)
+		case strings.Contains(inner, ":"):
+			step.slice = true
+			from, to, _ := strings.Cut(inner, ":")
+			var err error
+			if step.start, err = sliceBound(from); err != nil {
+				return nil, fmt.Errorf("JSONPath错误: [%s] 不是有效的切片", inner)
+			}
+			if step.end, err = sliceBound(to); err != nil {
+				return nil, fmt.Errorf("JSONPath错误: [%s] 不是有效的切片", inner)
+			}
+		default:
+			for _, part := range strings.Split(inner, ",") {
+				part = strings.TrimSpace(part)
+				if unquoted, ok := unquoteKey(part); ok {
+					step.keys = append(step.keys, unquoted)
+				} else if _, err := strconv.Atoi(part); err == nil {
+					step.keys = append(step.keys, part)
+				} else {
+					return nil, fmt.Errorf("JSONPath错误: [%s] 不是有效的成员名或下标", inner)
+				}
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// sliceBound 解析切片的起止位置，为空时返回 nil
+func sliceBound(s string) (*int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(s)
+	return &n, err
+}
+
+// unquoteKey 去掉成员名两侧的单引号或双引号
+func unquoteKey(s string) (string, bool) {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1], true
+	}
+	return "", false
+}
+
+// selectJSON 从上下文节点开始执行 JSONPath，文档节点视为其中的根值
+func selectJSON(contexts []*html.Node, steps []jsonStep) []*html.Node {
+	var nodes []*html.Node
+	for _, n := range contexts {
+		if n.Type == html.DocumentNode {
+			n = n.FirstChild
+		}
+		if isJSONNode(n) {
+			nodes = append(nodes, n)
+		}
+	}
+
+	for _, step := range steps {
+		var next []*html.Node
+		for _, n := range nodes {
+			if step.recursive {
+				walkJSON(n, func(d *html.Node) {
+					next = append(next, step.apply(d)...)
+				})
+			} else {
+				next = append(next, step.apply(n)...)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// walkJSON 按文档顺序访问节点及其所有后代值
+func walkJSON(n *html.Node, visit func(*html.Node)) {
+	visit(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isJSONNode(c) {
+			walkJSON(c, visit)
+		}
+	}
+}
+
+// apply 在一个节点上执行这一步，返回选中的子值
+func (step jsonStep) apply(n *html.Node) []*html.Node {
+	var children []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isJSONNode(c) {
+			children = append(children, c)
+		}
+	}
+
+	switch {
+	case step.wildcard:
+		return children
+	case step.slice:
+		if jsonType(n) != "array" {
+			return nil
+		}
+		start, end := 0, len(children)
+		if step.start != nil {
+			start = clampIndex(*step.start, len(children))
+		}
+		if step.end != nil {
+			end = clampIndex(*step.end, len(children))
+		}
+		if start >= end {
+			return nil
+		}
+		return children[start:end]
+	}
+
+	var selected []*html.Node
+	isArray := jsonType(n) == "array"
+	for _, key := range step.keys {
+		if isArray {
+			i, err := strconv.Atoi(key)
+			if err != nil {
+				continue
+			}
+			if i < 0 {
+				i += len(children)
+			}
+			if i >= 0 && i < len(children) {
+				selected = append(selected, children[i])
+			}
+			continue
+		}
+		for _, c := range children {
+			if jsonKey(c) == key {
+				selected = append(selected, c)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// clampIndex 将切片位置限制在 [0, length]，负数从末尾计
+func clampIndex(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	return min(max(i, 0), length)
+}
@@ -0,0 +1,108 @@
+package selector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const testJSON = `{
+	"code": 0,
+	"data": {
+		"book": {"name": "诡秘之主", "author": "爱潜水的乌贼", "tags": ["玄幻", "克苏鲁"], "finished": true, "intro": null},
+		"list": [
+			{"id": 1, "title": "第一章 绯红", "url": "/c/1"},
+			{"id": 2, "title": "第二章 情况", "url": "/c/2"},
+			{"id": 3, "title": "第三章 轮回", "url": "/c/3"}
+		],
+		"content": ["第一段", "第二段"]
+	}
+}`
+
+func TestJSONPath(t *testing.T) {
+	doc, err := ParseDocument([]byte(testJSON), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "$.data.book.name", want: "诡秘之主"},
+		{raw: "$['data']['book'][\"author\"]", want: "爱潜水的乌贼"},
+		{raw: "@json:data.book.tags[1]", want: "克苏鲁"},
+		{raw: "$.data.list[-1].title", want: "第三章 轮回"},
+		{raw: "$.data.list[*].id", want: "1\n2\n3"},
+		{raw: "$.data.list[0:2].id", want: "1\n2"},
+		{raw: "$.data.list[0,2].id", want: "1\n3"},
+		{raw: "$..author", want: "爱潜水的乌贼"},
+		{raw: "$.data.content", want: `["第一段","第二段"]`},
+		{raw: "$.data.content[*]", want: "第一段\n第二段"},
+		{raw: "$.data.book.finished", want: "true"},
+		{raw: "$.data.book.intro", want: ""},
+		{raw: "$.data.book.tags@js:r = JSON.parse(r).join('/')", want: "玄幻/克苏鲁"},
+		{raw: "$.data.missing.name", want: ""},
+	}
+	for _, tt := range tests {
+		sel, err := Compile(tt.raw)
+		if err != nil {
+			t.Fatalf("编译 %q 失败: %v", tt.raw, err)
+		}
+		if sel.Kind != KindJSON {
+			t.Errorf("%q 应识别为JSONPath", tt.raw)
+		}
+		if got := sel.Text(doc.Selection); got != tt.want {
+			t.Errorf("%q 期望 %q，实际 %q", tt.raw, tt.want, got)
+		}
+	}
+
+	// 列表项内的 $ 相对于当前项，属性取第一个匹配值
+	items, _ := Compile("$.data.list[*]")
+	title, _ := Compile("$.title")
+	link, _ := Compile("$.url")
+	var got []string
+	items.Select(doc.Selection).Each(func(i int, s *goquery.Selection) {
+		got = append(got, title.Text(s)+" "+link.Attr(s, "href"))
+	})
+	if strings.Join(got, ",") != "第一章 绯红 /c/1,第二章 情况 /c/2,第三章 轮回 /c/3" {
+		t.Errorf("列表项提取结果不正确: %v", got)
+	}
+
+	// XPath 同样可以在节点树上执行
+	xpath, _ := Compile("//json[@key='book']/json[@key='name']")
+	if got := xpath.Text(doc.Selection); got != "诡秘之主" {
+		t.Errorf("XPath查询JSON节点树的结果不正确: %q", got)
+	}
+
+	// HTML 文档上的 JSONPath 没有匹配
+	html, _ := goquery.NewDocumentFromReader(strings.NewReader(testPage))
+	if sel, _ := Compile("$.data"); sel.Text(html.Selection) != "" {
+		t.Error("HTML文档上的JSONPath不应有匹配")
+	}
+
+	for _, raw := range []string{"$.", "$.data[", "$.data[?(@.id > 1)]", "$.data[a]", "$.data[1:x]"} {
+		if _, err := Compile(raw); err == nil {
+			t.Errorf("JSONPath %q 应编译失败", raw)
+		}
+	}
+}
+
+func TestIsJSON(t *testing.T) {
+	tests := []struct {
+		data        string
+		contentType string
+		want        bool
+	}{
+		{`{"a": 1}`, "application/json; charset=utf-8", true},
+		{` [1, 2]`, "text/html", true},
+		{`{not json}`, "text/html", false},
+		{`<html></html>`, "", false},
+	}
+	for _, tt := range tests {
+		if got := IsJSON([]byte(tt.data), tt.contentType); got != tt.want {
+			t.Errorf("IsJSON(%q, %q) 期望 %v", tt.data, tt.contentType, tt.want)
+		}
+	}
+}
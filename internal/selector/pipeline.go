@@ -0,0 +1,83 @@
+package selector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pipeline 选择器之后、@js: 之前的处理步骤，按顺序执行：
+//
+//	[n]            取第 n 个匹配元素，从 0 开始，负数从末尾计 (仅CSS，XPath和JSONPath使用自身的下标语法)
+//	@text、@html    提取文本或内部HTML，@属性名 提取属性，如 a.title@href；选择器为空时作用于当前元素
+//	##正则##替换    对提取结果进行正则替换，替换部分可以使用 $1 等分组，省略时删除匹配内容，以 ### 结尾时只替换第一处
+type pipeline struct {
+	index   *int
+	extract string
+	regex   *regexp.Regexp
+	replace string
+	first   bool
+}
+
+var (
+	// extractPattern 末尾的 @text、@html 或 @属性名，@ 前不能是 XPath 中的 / [ ( = , 或空白
+	extractPattern = regexp.MustCompile(`^(|.*[^/\[(=,@\s])@([A-Za-z][\w:-]*)$`)
+	// indexPattern 末尾的 [n]
+	indexPattern = regexp.MustCompile(`^(.*\S)\[\s*(-?\d+)\s*\]$`)
+)
+
+// parsePipeline 从选择器末尾解析处理步骤，返回去掉这些步骤后的选择器
+func parsePipeline(expr string) (string, pipeline, error) {
+	var p pipeline
+
+	if before, rest, ok := strings.Cut(expr, "##"); ok {
+		expr = strings.TrimSpace(before)
+		pattern, replace, _ := strings.Cut(rest, "##")
+		if strings.HasSuffix(replace, "###") {
+			replace, p.first = strings.TrimSuffix(replace, "###"), true
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", p, fmt.Errorf("正则表达式错误: %w", err)
+		}
+		p.regex, p.replace = re, replace
+	}
+
+	// JSONPath 的值没有属性，下标使用自身的语法
+	if IsJSONPath(expr) {
+		return expr, p, nil
+	}
+
+	if m := extractPattern.FindStringSubmatch(expr); m != nil {
+		expr, p.extract = strings.TrimSpace(m[1]), m[2]
+	}
+	if !IsXPath(expr) {
+		if m := indexPattern.FindStringSubmatch(expr); m != nil {
+			index, _ := strconv.Atoi(m[2])
+			expr, p.index = m[1], &index
+		}
+	}
+	return expr, p, nil
+}
+
+// empty 是否没有任何处理步骤
+func (p pipeline) empty() bool {
+	return p.index == nil && p.extract == "" && p.regex == nil
+}
+
+// apply 对提取结果执行正则替换
+func (p pipeline) apply(value string) string {
+	if p.regex == nil {
+		return value
+	}
+	if !p.first {
+		return p.regex.ReplaceAllString(value, p.replace)
+	}
+	loc := p.regex.FindStringSubmatchIndex(value)
+	if loc == nil {
+		return value
+	}
+	replaced := p.regex.ExpandString(nil, p.replace, value, loc)
+	return value[:loc[0]] + string(replaced) + value[loc[1]:]
+}
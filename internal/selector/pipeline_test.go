@@ -0,0 +1,118 @@
+package selector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParsePipeline(t *testing.T) {
+	tests := []struct {
+		raw     string
+		expr    string
+		index   int // -99 表示没有下标
+		extract string
+		regex   string
+		replace string
+		first   bool
+	}{
+		{raw: "a.title", expr: "a.title", index: -99},
+		{raw: "a.title@href", expr: "a.title", index: -99, extract: "href"},
+		{raw: "#list a[2]@data-src", expr: "#list a", index: 2, extract: "data-src"},
+		{raw: "li[-1]", expr: "li", index: -1},
+		{raw: "@html", expr: "", index: -99, extract: "html"},
+		{raw: `meta[property="og:image"]@content`, expr: `meta[property="og:image"]`, index: -99, extract: "content"},
+		{raw: "a[href]", expr: "a[href]", index: -99},
+		{raw: "p.author##作者[:：]##", expr: "p.author", index: -99, regex: "作者[:：]"},
+		{raw: "span@text##(\\d+)万字##$1###", expr: "span", index: -99, extract: "text", regex: "(\\d+)万字", replace: "$1", first: true},
+		{raw: "//div[@id='info']/p[2]", expr: "//div[@id='info']/p[2]", index: -99},
+		{raw: "//a/@href", expr: "//a/@href", index: -99},
+		{raw: "//div[@id='info']//a@href", expr: "//div[@id='info']//a", index: -99, extract: "href"},
+		{raw: "$.data.list[1]##\\s##", expr: "$.data.list[1]", index: -99, regex: "\\s"},
+	}
+
+	for _, tt := range tests {
+		expr, p, err := parsePipeline(tt.raw)
+		if err != nil {
+			t.Errorf("%q 解析失败: %v", tt.raw, err)
+			continue
+		}
+		index := -99
+		if p.index != nil {
+			index = *p.index
+		}
+		var regex string
+		if p.regex != nil {
+			regex = p.regex.String()
+		}
+		if expr != tt.expr || index != tt.index || p.extract != tt.extract || regex != tt.regex || p.replace != tt.replace || p.first != tt.first {
+			t.Errorf("%q 解析为 %q %d %q %q %q %v", tt.raw, expr, index, p.extract, regex, p.replace, p.first)
+		}
+	}
+
+	if _, _, err := parsePipeline("p##(##"); err == nil {
+		t.Error("无效的正则应解析失败")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body>
+<div id="info"><h1>诡秘之主</h1><p>作者：爱潜水的乌贼</p><p>字数：446.8万字</p><p>状态：<b>完本</b></p></div>
+<ul id="list"><li><a href="/1.html">第一章</a></li><li><a href="/2.html">第二章</a></li><li><a href="/3.html">第三章</a></li></ul>
+</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		raw  string
+		attr string
+		want string
+	}{
+		{raw: "#list a@href", want: "/1.html"},
+		{raw: "#list a[1]", want: "第二章"},
+		{raw: "#list a[-1]@href", want: "/3.html"},
+		{raw: "#list a[5]", want: ""},
+		{raw: "#info p[2]@html", want: "状态：<b>完本</b>"},
+		{raw: "#info p[0]##作者[:：]##", want: "爱潜水的乌贼"},
+		{raw: "#info p[1]##.*?([\\d.]+)万字.*##$1", want: "446.8"},
+		{raw: "#list a##第(.)章##$1###", want: "一第二章第三章"},
+		{raw: "//ul[@id='list']/li[last()]/a@href", want: "/3.html"},
+		{raw: "#list a[1]@href##\\.html##@js:r = r + '/'", want: "/2/"},
+		// 选择器中的提取步骤优先于调用方指定的属性
+		{raw: "#list a@text", attr: "href", want: "第一章第二章第三章"},
+		{raw: "#list a[2]", attr: "href", want: "/3.html"},
+	}
+	for _, tt := range tests {
+		sel, err := Compile(tt.raw)
+		if err != nil {
+			t.Fatalf("编译 %q 失败: %v", tt.raw, err)
+		}
+		var got string
+		if tt.attr != "" {
+			got = sel.Attr(doc.Selection, tt.attr)
+		} else {
+			got = sel.Text(doc.Selection)
+		}
+		if got != tt.want {
+			t.Errorf("%q 期望 %q，实际 %q", tt.raw, tt.want, got)
+		}
+	}
+
+	// 选择器为空时作用于当前元素，如目录项的链接
+	items, _ := Compile("#list a")
+	link, _ := Compile("@href")
+	var links []string
+	items.Select(doc.Selection).Each(func(i int, s *goquery.Selection) {
+		links = append(links, link.Text(s))
+	})
+	if strings.Join(links, ",") != "/1.html,/2.html,/3.html" {
+		t.Errorf("当前元素的属性不正确: %v", links)
+	}
+
+	// 下标同样作用于元素列表
+	if sel, _ := Compile("#list li[1]"); sel.Select(doc.Selection).Length() != 1 || sel.Select(doc.Selection).Text() != "第二章" {
+		t.Error("带下标的列表选择器应只返回该元素")
+	}
+}
@@ -0,0 +1,381 @@
+// Package selector 实现规则中选择器的预编译与执行，支持CSS、XPath、meta标签、JSONPath 和 @js: 后处理
+package selector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"go-novel/internal/util"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/dop251/goja"
+	"golang.org/x/net/html"
+)
+
+// Kind 选择器类型
+type Kind int
+
+const (
+	// KindCSS CSS选择器
+	KindCSS Kind = iota
+	// KindXPath XPath表达式，以 / 或 ( 开头
+	KindXPath
+	// KindMeta meta标签选择器，以 meta[ 开头，取 content 属性
+	KindMeta
+	// KindJSON JSONPath，以 $ 或 @json: 开头，用于JSON响应
+	KindJSON
+)
+
+// String 返回选择器类型名称
+func (k Kind) String() string {
+	switch k {
+	case KindXPath:
+		return "xpath"
+	case KindMeta:
+		return "meta"
+	case KindJSON:
+		return "json"
+	default:
+		return "css"
+	}
+}
+
+// Selector 预编译的选择器
+type Selector struct {
+	Raw    string
+	Kind   Kind
+	Expr   string // 去掉处理步骤和 @js: 后缀的选择器部分
+	JsCode string
+	Origin string // 选择器所在的规则和字段，如 "main-rules.json 规则 3 (书源) book.author"，用于脚本错误信息
+
+	css   cascadia.Selector
+	xpath *xpath.Expr
+	json  []jsonStep
+	pipe  pipeline
+	js    *goja.Program
+}
+
+// Compile 编译选择器，空字符串返回 nil
+func Compile(raw string) (*Selector, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	expr, jsCode, hasJs := strings.Cut(raw, "@js:")
+	expr, pipe, err := parsePipeline(strings.TrimSpace(expr))
+	if err != nil {
+		return nil, err
+	}
+	s := &Selector{Raw: raw, Expr: expr, JsCode: jsCode, pipe: pipe}
+
+	if hasJs {
+		program, err := util.CompileJs(jsCode)
+		if err != nil {
+			return nil, fmt.Errorf("JavaScript语法错误: %w", err)
+		}
+		s.js = program
+	}
+
+	if s.Expr == "" {
+		if !hasJs && pipe.extract == "" {
+			return nil, fmt.Errorf("选择器为空")
+		}
+		return s, nil
+	}
+
+	switch {
+	case IsJSONPath(s.Expr):
+		s.Kind = KindJSON
+		path := strings.TrimPrefix(s.Expr, "@json:")
+		if !strings.HasPrefix(path, "$") {
+			path = "$." + path
+		}
+		if s.json, err = compileJSONPath(path); err != nil {
+			return nil, err
+		}
+	case IsXPath(s.Expr):
+		s.Kind = KindXPath
+		if s.xpath, err = xpath.Compile(s.Expr); err != nil {
+			return nil, fmt.Errorf("XPath错误: %w", err)
+		}
+	case strings.HasPrefix(s.Expr, "meta["):
+		s.Kind = KindMeta
+		if s.css, err = cascadia.Compile(s.Expr); err != nil {
+			return nil, fmt.Errorf("CSS选择器错误: %w", err)
+		}
+	default:
+		s.Kind = KindCSS
+		if s.css, err = cascadia.Compile(s.Expr); err != nil {
+			return nil, fmt.Errorf("CSS选择器错误: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// IsXPath 判断选择器是否为XPath
+func IsXPath(selector string) bool {
+	return strings.HasPrefix(selector, "/") || strings.HasPrefix(selector, "(")
+}
+
+// IsJSONPath 判断选择器是否为JSONPath：以 $. 、$[ 开头、只有 $，或带有 @json: 前缀
+func IsJSONPath(selector string) bool {
+	return selector == "$" || strings.HasPrefix(selector, "$.") || strings.HasPrefix(selector, "$[") || strings.HasPrefix(selector, "@json:")
+}
+
+// HasJs 是否带有 @js: 后处理
+func (s *Selector) HasJs() bool {
+	return s != nil && s.js != nil
+}
+
+// HasExtract 是否带有 @属性、@html 等提取步骤或 ##正则## 替换
+func (s *Selector) HasExtract() bool {
+	return s != nil && (s.pipe.extract != "" || s.pipe.regex != nil)
+}
+
+// Select 选择匹配的元素，用于搜索结果、目录等列表。选择器为空且带有提取步骤时返回当前元素，带有 [n] 时只返回该元素
+func (s *Selector) Select(sel *goquery.Selection) *goquery.Selection {
+	if s == nil || sel.Length() == 0 || (s.Expr == "" && s.pipe.extract == "") {
+		return sel.Slice(0, 0)
+	}
+	if s.Expr == "" {
+		return sel
+	}
+	return s.pick(s.find(sel))
+}
+
+// find 执行选择器，不应用下标
+func (s *Selector) find(sel *goquery.Selection) *goquery.Selection {
+	if s.Kind == KindXPath || s.Kind == KindJSON {
+		var nodes []*html.Node
+		if s.Kind == KindJSON {
+			nodes = selectJSON(sel.Nodes, s.json)
+		} else {
+			for _, n := range sel.Nodes {
+				nodes = append(nodes, htmlquery.QuerySelectorAll(n, s.xpath)...)
+			}
+		}
+		// 不能直接在 Slice(0, 0) 上追加，会覆盖原选择范围共享的底层数组
+		result := sel.Slice(0, 0)
+		result.Nodes = nil
+		return result.AddNodes(nodes...)
+	}
+	return sel.FindMatcher(s.css)
+}
+
+// pick 应用 [n] 下标
+func (s *Selector) pick(matched *goquery.Selection) *goquery.Selection {
+	if s.pipe.index == nil {
+		return matched
+	}
+	return matched.Eq(*s.pipe.index)
+}
+
+// Exists 是否存在匹配的元素
+func (s *Selector) Exists(sel *goquery.Selection) bool {
+	return s.Select(sel).Length() > 0
+}
+
+// Text 提取文本，meta标签取 content 属性，带 @js: 时对结果执行脚本
+func (s *Selector) Text(sel *goquery.Selection) string {
+	return s.TextWith(sel, nil)
+}
+
+// TextWith 与 Text 相同，脚本在页面上下文 ctx 中执行，ctx 可以为 nil
+func (s *Selector) TextWith(sel *goquery.Selection, ctx *util.JsContext) string {
+	if s == nil {
+		return ""
+	}
+	return s.runJs(s.value(sel, ""), sel, ctx)
+}
+
+// Attr 提取第一个匹配元素的属性，带 @js: 时对非空结果执行脚本
+func (s *Selector) Attr(sel *goquery.Selection, attr string) string {
+	return s.AttrWith(sel, attr, nil)
+}
+
+// AttrWith 与 Attr 相同，脚本在页面上下文 ctx 中执行，ctx 可以为 nil
+func (s *Selector) AttrWith(sel *goquery.Selection, attr string, ctx *util.JsContext) string {
+	if s == nil {
+		return ""
+	}
+
+	value := s.value(sel, attr)
+	if value == "" {
+		return ""
+	}
+	return s.runJs(value, sel, ctx)
+}
+
+// Trace 选择器的执行过程，用于规则调试
+type Trace struct {
+	Kind     string `json:"kind"` // css、xpath 或 meta
+	Js       bool   `json:"js"`
+	Matched  int    `json:"matched"`
+	BeforeJs string `json:"beforeJs,omitempty"` // 执行 @js: 前的值
+	Value    string `json:"value"`
+	JsError  string `json:"jsError,omitempty"`
+}
+
+// Debug 按 TextWith/AttrWith 相同的逻辑执行选择器，并记录匹配数量和脚本错误，attr 为空时提取文本
+func (s *Selector) Debug(sel *goquery.Selection, attr string, ctx *util.JsContext) Trace {
+	if s == nil {
+		return Trace{}
+	}
+
+	trace := Trace{Kind: s.Kind.String(), Js: s.js != nil}
+	trace.Matched = s.matched(sel).Length()
+	trace.Value = s.value(sel, attr)
+
+	if s.js == nil || (attr != "" && trace.Value == "") {
+		return trace
+	}
+
+	trace.BeforeJs = trace.Value
+	result, err := util.RunJs(s.js, trace.Value, s.jsContext(sel, ctx))
+	if err != nil {
+		trace.JsError = err.Error()
+		return trace
+	}
+	trace.Value = result
+	return trace
+}
+
+// value 按处理步骤提取值，不执行脚本。选择器中的 @text、@html、@属性 优先于 attr，attr 为空时提取文本
+func (s *Selector) value(sel *goquery.Selection, attr string) string {
+	if s.pipe.extract != "" {
+		attr = s.pipe.extract
+	}
+	matched := s.matched(sel)
+	if matched.Length() == 0 {
+		return ""
+	}
+
+	isText := attr == "" || attr == "text"
+	if s.Kind == KindMeta && isText {
+		attr, isText = "content", false
+	}
+
+	var value string
+	switch {
+	case attr == "html" || (s.Kind == KindJSON && isText):
+		// 多个匹配值按行拼接，如段落数组
+		var values []string
+		for _, n := range matched.Nodes {
+			values = append(values, s.nodeValue(n, attr))
+		}
+		value = strings.TrimSpace(strings.Join(values, "\n"))
+	case s.Kind == KindCSS && isText:
+		value = strings.TrimSpace(matched.Text())
+	default:
+		// 属性和XPath文本取第一个匹配元素
+		value = s.nodeValue(matched.Nodes[0], attr)
+		if value == "" && s.Kind == KindMeta && attr == "href" {
+			// 如果要获取href属性，但meta标签没有，尝试获取content属性
+			value = s.nodeValue(matched.Nodes[0], "content")
+		}
+	}
+	return s.pipe.apply(value)
+}
+
+// matched 返回提取值的元素，meta标签在整个文档中查找
+func (s *Selector) matched(sel *goquery.Selection) *goquery.Selection {
+	if s.Kind == KindMeta && s.Expr != "" {
+		return s.pick(s.metaRoot(sel).FindMatcher(s.css))
+	}
+	return s.Select(sel)
+}
+
+// nodeValue 提取单个元素的文本、内部HTML或属性，JSON值没有属性，总是取其值
+func (s *Selector) nodeValue(n *html.Node, attr string) string {
+	switch {
+	case s.Kind == KindJSON:
+		return jsonText(n)
+	case attr == "" || attr == "text":
+		return strings.TrimSpace(htmlquery.InnerText(n))
+	case attr == "html":
+		return strings.TrimSpace(htmlquery.OutputHTML(n, false))
+	default:
+		return htmlquery.SelectAttr(n, attr)
+	}
+}
+
+// metaRoot 返回选择范围所在的整个文档
+func (s *Selector) metaRoot(sel *goquery.Selection) *goquery.Selection {
+	if sel.Length() == 0 {
+		return sel
+	}
+
+	root := sel.Nodes[0]
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	return goquery.NewDocumentFromNode(root).Selection
+}
+
+// runJs 执行 @js: 脚本，出错时返回原值
+func (s *Selector) runJs(input string, sel *goquery.Selection, ctx *util.JsContext) string {
+	if s.js == nil {
+		return input
+	}
+
+	result, err := util.RunJs(s.js, input, s.jsContext(sel, ctx))
+	if err != nil {
+		fmt.Printf("JavaScript执行出错: %v\n", s.jsError(err))
+		return input
+	}
+	return result
+}
+
+// jsError 为脚本错误加上选择器所在的规则和字段
+func (s *Selector) jsError(err error) error {
+	if s.Origin == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", s.Origin, err)
+}
+
+// jsContext 复制页面上下文，并让脚本中的 query 系列函数在选择范围所在的整个文档上执行
+func (s *Selector) jsContext(sel *goquery.Selection, ctx *util.JsContext) *util.JsContext {
+	js := &util.JsContext{}
+	if ctx != nil {
+		*js = *ctx
+	}
+	js.Query = func(expr, attr string) ([]string, error) {
+		return Query(s.metaRoot(sel), expr, attr)
+	}
+	return js
+}
+
+// queryCache 脚本中 query 使用过的选择器，规则中的表达式数量有限，不做淘汰
+var queryCache sync.Map
+
+// Query 在选择范围内执行不带 @js: 的选择器，返回每个匹配元素的文本，attr 不为空时返回该属性的值。
+// 选择器可以带有 [n]、@属性 和 ##正则## 步骤
+func Query(sel *goquery.Selection, expr, attr string) ([]string, error) {
+	var s *Selector
+	if cached, ok := queryCache.Load(expr); ok {
+		s = cached.(*Selector)
+	} else {
+		var err error
+		if s, err = Compile(expr); err != nil {
+			return nil, err
+		}
+		if s == nil || s.js != nil {
+			return nil, fmt.Errorf("无效的查询选择器: %q", expr)
+		}
+		queryCache.Store(expr, s)
+	}
+
+	if attr == "" {
+		attr = s.pipe.extract
+	}
+	var values []string
+	for _, n := range s.matched(sel).Nodes {
+		values = append(values, s.pipe.apply(s.nodeValue(n, attr)))
+	}
+	return values, nil
+}
@@ -0,0 +1,185 @@
+package selector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go-novel/internal/util"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/htmlquery"
+)
+
+const testPage = `<html><head>
+<meta property="og:image" content="/cover.jpg">
+</head><body>
+<div id="info"><h1>诡秘之主</h1><p class="author">作者：爱潜水的乌贼</p></div>
+<ul id="list"><li><a href="/1.html">第一章</a></li><li><a href="/2.html">第二章</a></li></ul>
+</body></html>`
+
+func TestSelector(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(testPage))
+	if err != nil {
+		t.Fatalf("解析HTML失败: %v", err)
+	}
+
+	tests := []struct {
+		raw  string
+		attr string
+		want string
+	}{
+		{raw: "#info > h1", want: "诡秘之主"},
+		{raw: "p.author@js:r=r.replace('作者：', '')", want: "爱潜水的乌贼"},
+		{raw: "//div[@id='info']/h1", want: "诡秘之主"},
+		{raw: `meta[property="og:image"]`, want: "/cover.jpg"},
+		{raw: `meta[property="og:image"]@js:r='https://www.example.com'+r`, attr: "content", want: "https://www.example.com/cover.jpg"},
+		{raw: "#list a", attr: "href", want: "/1.html"},
+		{raw: "//ul[@id='list']//a", attr: "href", want: "/1.html"},
+	}
+
+	for _, tt := range tests {
+		sel, err := Compile(tt.raw)
+		if err != nil {
+			t.Fatalf("编译选择器 %q 失败: %v", tt.raw, err)
+		}
+
+		var got string
+		if tt.attr != "" {
+			got = sel.Attr(doc.Selection, tt.attr)
+		} else {
+			got = sel.Text(doc.Selection)
+		}
+		if got != tt.want {
+			t.Errorf("选择器 %q 期望 %q，实际 %q", tt.raw, tt.want, got)
+		}
+	}
+
+	// XPath在子元素范围内查找
+	items, _ := Compile("#list > li")
+	link, _ := Compile("//a")
+	var titles []string
+	items.Select(doc.Selection).Each(func(i int, s *goquery.Selection) {
+		titles = append(titles, link.Text(s))
+	})
+	if strings.Join(titles, ",") != "第一章,第二章" {
+		t.Errorf("XPath应在每个列表项内查找，实际: %v", titles)
+	}
+
+	// XPath选择不应修改原选择范围
+	root := doc.Selection.Nodes[0]
+	link.Select(doc.Selection)
+	if doc.Selection.Nodes[0] != root {
+		t.Errorf("XPath选择修改了原文档")
+	}
+
+	// 空选择器和 nil 选择器
+	if sel, err := Compile(""); sel != nil || err != nil {
+		t.Errorf("空选择器应返回 nil")
+	}
+	var empty *Selector
+	if empty.Text(doc.Selection) != "" || empty.Select(doc.Selection).Length() != 0 {
+		t.Errorf("nil 选择器应返回空结果")
+	}
+
+	// 脚本中的 query 在整个文档上执行，resolveUrl 以页面地址为准
+	chapter, _ := Compile(`@js:r = query("#info > h1") + ":" + queryAll("//ul/li/a").join("|") + ":" + resolveUrl(queryAttr("#list a", "href"))`)
+	items.Select(doc.Selection).First().Each(func(i int, s *goquery.Selection) {
+		got := chapter.TextWith(s, &util.JsContext{BaseURL: "https://www.example.com/book/"})
+		if got != "诡秘之主:第一章|第二章:https://www.example.com/1.html" {
+			t.Errorf("脚本查询文档的结果不正确: %q", got)
+		}
+	})
+
+	// 语法错误
+	for _, raw := range []string{"div[", "//div[", "div@js:r=("} {
+		if _, err := Compile(raw); err == nil {
+			t.Errorf("选择器 %q 应编译失败", raw)
+		}
+	}
+}
+
+// tocPage 生成包含 n 个章节的目录页
+func tocPage(n int) string {
+	var b strings.Builder
+	b.WriteString(`<html><body><div id="list"><dl>`)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, `<dd><a href="/book/1/%d.html">第%d章 标题</a><span class="time">2024-01-01</span></dd>`, i, i)
+	}
+	b.WriteString(`</dl></div></body></html>`)
+	return b.String()
+}
+
+// legacyXPathText 旧实现：将选择范围序列化为HTML后重新解析再查询
+func legacyXPathText(s *goquery.Selection, expr string) string {
+	htmlStr, err := s.Html()
+	if err != nil {
+		return ""
+	}
+	doc, err := htmlquery.Parse(strings.NewReader(htmlStr))
+	if err != nil {
+		return ""
+	}
+	node, err := htmlquery.Query(doc, expr)
+	if err != nil || node == nil {
+		return ""
+	}
+	return strings.TrimSpace(htmlquery.InnerText(node))
+}
+
+// legacyText 旧实现：每次调用都重新解析 @js: 后缀、判断类型并编译选择器
+func legacyText(s *goquery.Selection, raw string) string {
+	if strings.Contains(raw, "@js:") {
+		parts := strings.Split(raw, "@js:")
+		text := strings.TrimSpace(s.Find(parts[0]).Text())
+		result, err := util.CallJs(parts[1], text)
+		if err != nil {
+			return text
+		}
+		return result
+	}
+	if IsXPath(raw) {
+		return legacyXPathText(s, raw)
+	}
+	return strings.TrimSpace(s.Find(raw).Text())
+}
+
+func benchmarkTocDoc(b *testing.B) *goquery.Document {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(tocPage(3000)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return doc
+}
+
+// 目录页每个章节提取标题（XPath）和更新时间（@js:）
+const (
+	benchItem  = "#list > dl > dd"
+	benchTitle = "//a"
+	benchTime  = "span.time@js:r=r.replace('2024-', '')"
+)
+
+func BenchmarkTocLegacy(b *testing.B) {
+	doc := benchmarkTocDoc(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		doc.Find(benchItem).Each(func(_ int, s *goquery.Selection) {
+			legacyText(s, benchTitle)
+			legacyText(s, benchTime)
+		})
+	}
+}
+
+func BenchmarkTocCompiled(b *testing.B) {
+	doc := benchmarkTocDoc(b)
+	item, _ := Compile(benchItem)
+	title, _ := Compile(benchTitle)
+	updated, _ := Compile(benchTime)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		item.Select(doc.Selection).Each(func(_ int, s *goquery.Selection) {
+			title.Text(s)
+			updated.Text(s)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package sse
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -185,3 +186,18 @@ func SendCompleteToClient(clientID string, total int) {
 	message := fmt.Sprintf(`{"type":"book-download-complete","total":%d}`, total)
 	PushMessageToClient(clientID, message)
 }
+
+// BroadcastEvent 广播带类型的JSON事件到所有客户端
+func BroadcastEvent(eventType string, payload map[string]any) {
+	data := map[string]any{"type": eventType}
+	for k, v := range payload {
+		data[k] = v
+	}
+
+	message, err := json.Marshal(data)
+	if err != nil {
+		fmt.Printf("序列化SSE事件失败: %v\n", err)
+		return
+	}
+	PushMessageToAll(string(message))
+}
@@ -0,0 +1,411 @@
+// Package urltemplate 书源中的URL模板：{{表达式|过滤器}} 占位符，支持变量、整数运算和编码过滤器
+//
+//	https://example.com/search?q={{keyword|gbk}}&page={{page}}
+//	https://example.com/book/{{bookId/1000}}/{{bookId}}/
+//	https://example.com/list?offset={{(page-1)*20}}
+package urltemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// Vars 模板变量
+type Vars map[string]string
+
+// charsets 编码过滤器，先将值转换为对应编码，再按URL规则转义
+var charsets = map[string]encoding.Encoding{
+	"gbk":     simplifiedchinese.GBK,
+	"gb2312":  simplifiedchinese.GBK,
+	"gb18030": simplifiedchinese.GB18030,
+	"big5":    traditionalchinese.Big5,
+}
+
+// escapes 转义过滤器：raw 不转义，url 按查询参数转义，path 按路径转义，json 按JSON字符串内容转义
+var escapes = map[string]bool{"raw": true, "url": true, "path": true, "json": true}
+
+// Template 编译后的URL模板
+type Template struct {
+	raw   string
+	parts []part
+}
+
+// part 模板中的一段文本或一个占位符
+type part struct {
+	text    string
+	expr    *node
+	charset string
+	escape  string
+}
+
+// IsTemplate 是否包含 {{ }} 占位符或旧版的 %s 占位符
+func IsTemplate(raw string) bool {
+	return strings.Contains(raw, "{{") || strings.Contains(raw, "%s")
+}
+
+// Legacy 将旧版的 %s 占位符转换为 {{expr}}
+func Legacy(raw, expr string) string {
+	return strings.ReplaceAll(raw, "%s", "{{"+expr+"}}")
+}
+
+// Compile 编译模板，占位符外的文本原样保留
+func Compile(raw string) (*Template, error) {
+	t := &Template{raw: raw}
+	rest := raw
+	for rest != "" {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			t.parts = append(t.parts, part{text: rest})
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, part{text: rest[:start]})
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("URL模板错误: %s 中缺少 }}", raw)
+		}
+		inner := rest[start+2 : start+end]
+		p, err := compilePlaceholder(inner)
+		if err != nil {
+			return nil, fmt.Errorf("URL模板错误: {{%s}} %w", inner, err)
+		}
+		t.parts = append(t.parts, p)
+		rest = rest[start+end+2:]
+	}
+	return t, nil
+}
+
+// compilePlaceholder 编译 表达式|过滤器|过滤器
+func compilePlaceholder(inner string) (part, error) {
+	fields := strings.Split(inner, "|")
+	expr, err := parseExpr(fields[0])
+	if err != nil {
+		return part{}, err
+	}
+
+	p := part{expr: expr}
+	for _, filter := range fields[1:] {
+		filter = strings.ToLower(strings.TrimSpace(filter))
+		switch {
+		case charsets[filter] != nil:
+			p.charset = filter
+		case escapes[filter]:
+			p.escape = filter
+		default:
+			return part{}, fmt.Errorf("不支持的过滤器 %q，可用: gbk、gb18030、big5、raw、url、path、json", filter)
+		}
+	}
+	return p, nil
+}
+
+// String 返回模板原文
+func (t *Template) String() string {
+	return t.raw
+}
+
+// Names 返回模板中使用的变量名，按出现顺序去重
+func (t *Template) Names() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, p := range t.parts {
+		if p.expr == nil {
+			continue
+		}
+		p.expr.walk(func(n *node) {
+			if n.name != "" && !seen[n.name] {
+				seen[n.name] = true
+				names = append(names, n.name)
+			}
+		})
+	}
+	return names
+}
+
+// Uses 模板中是否使用了变量
+func (t *Template) Uses(name string) bool {
+	for _, n := range t.Names() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute 生成URL，占位符的值默认按查询参数转义
+func (t *Template) Execute(vars Vars) (string, error) {
+	return t.execute(vars, "url")
+}
+
+// ExecuteRaw 生成文本，占位符的值默认不转义，用于之后还会整体编码的表单参数
+func (t *Template) ExecuteRaw(vars Vars) (string, error) {
+	return t.execute(vars, "raw")
+}
+
+// ExecuteJSON 生成JSON请求体，占位符的值默认按JSON字符串内容转义，模板中需自行加上引号
+func (t *Template) ExecuteJSON(vars Vars) (string, error) {
+	return t.execute(vars, "json")
+}
+
+// execute 依次拼接文本和占位符的值，escape 为未指定转义过滤器时的转义方式
+func (t *Template) execute(vars Vars, escape string) (string, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.expr == nil {
+			b.WriteString(p.text)
+			continue
+		}
+
+		value, err := p.expr.eval(vars)
+		if err != nil {
+			return "", fmt.Errorf("URL模板 %s: %w", t.raw, err)
+		}
+		if p.charset != "" {
+			if value, err = charsets[p.charset].NewEncoder().String(value); err != nil {
+				return "", fmt.Errorf("URL模板 %s: 无法转换为 %s 编码: %w", t.raw, p.charset, err)
+			}
+		}
+
+		mode := escape
+		if p.escape != "" {
+			mode = p.escape
+		}
+		switch mode {
+		case "url":
+			value = url.QueryEscape(value)
+		case "path":
+			value = url.PathEscape(value)
+		case "json":
+			value = jsonEscape(value)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+// jsonEscape 转义为JSON字符串的内容，不含两侧引号，不转义HTML字符
+func jsonEscape(value string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(value)
+	quoted := strings.TrimSuffix(buf.String(), "\n")
+	return quoted[1 : len(quoted)-1]
+}
+
+// node 表达式节点：变量、整数或二元运算
+type node struct {
+	name  string
+	num   string
+	op    byte
+	left  *node
+	right *node
+}
+
+// walk 按先序访问节点
+func (n *node) walk(visit func(*node)) {
+	if n == nil {
+		return
+	}
+	visit(n)
+	n.left.walk(visit)
+	n.right.walk(visit)
+}
+
+// eval 计算节点的值，单独的变量保留原值，参与运算的值必须是整数
+func (n *node) eval(vars Vars) (string, error) {
+	switch {
+	case n.name != "":
+		value, ok := vars[n.name]
+		if !ok {
+			return "", fmt.Errorf("未定义的变量 %s", n.name)
+		}
+		return value, nil
+	case n.op == 0:
+		return n.num, nil
+	}
+
+	left, err := n.left.evalInt(vars)
+	if err != nil {
+		return "", err
+	}
+	right, err := n.right.evalInt(vars)
+	if err != nil {
+		return "", err
+	}
+	var result int64
+	switch n.op {
+	case '+':
+		result = left + right
+	case '-':
+		result = left - right
+	case '*':
+		result = left * right
+	case '/', '%':
+		if right == 0 {
+			return "", fmt.Errorf("除数为0")
+		}
+		if n.op == '/' {
+			result = left / right
+		} else {
+			result = left % right
+		}
+	}
+	return strconv.FormatInt(result, 10), nil
+}
+
+// evalInt 计算节点的整数值
+func (n *node) evalInt(vars Vars) (int64, error) {
+	value, err := n.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		if n.name != "" {
+			return 0, fmt.Errorf("变量 %s 的值 %q 不是整数", n.name, value)
+		}
+		return 0, fmt.Errorf("%q 不是整数", value)
+	}
+	return i, nil
+}
+
+// parser 表达式解析器：
+//
+//	expr   = term {("+" | "-") term}
+//	term   = factor {("*" | "/" | "%") factor}
+//	factor = "-" factor | "(" expr ")" | 整数 | 变量
+//
+// 变量名由字母、数字、_ 和 $ 组成，如 keyword、page、$1
+type parser struct {
+	s   string
+	pos int
+}
+
+// parseExpr 解析占位符中的表达式
+func parseExpr(s string) (*node, error) {
+	p := &parser{s: s}
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, fmt.Errorf("无法解析 %q", p.s[p.pos:])
+	}
+	return n, nil
+}
+
+// skipSpace 跳过空白
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// peek 返回下一个非空白字符，没有时返回 0
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+// expr 解析加减运算
+func (p *parser) expr() (*node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// term 解析乘除和取余运算
+func (p *parser) term() (*node, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/' || op == '%'; op = p.peek() {
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = &node{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// factor 解析负号、括号、整数或变量
+func (p *parser) factor() (*node, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return nil, fmt.Errorf("缺少表达式")
+	case c == '-':
+		p.pos++
+		operand, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return &node{op: '-', left: &node{num: "0"}, right: operand}, nil
+	case c == '(':
+		p.pos++
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("缺少 )")
+		}
+		p.pos++
+		return n, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && isNameChar(p.s[p.pos]) {
+		p.pos++
+	}
+	word := p.s[start:p.pos]
+	switch {
+	case word == "":
+		return nil, fmt.Errorf("无法解析 %q", p.s[start:])
+	case isDigits(word):
+		return &node{num: word}, nil
+	case word[0] >= '0' && word[0] <= '9':
+		return nil, fmt.Errorf("无效的变量名 %s", word)
+	default:
+		return &node{name: word}, nil
+	}
+}
+
+// isNameChar 是否为变量名或整数中的字符
+func isNameChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isDigits 是否全部为数字
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package urltemplate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExecute(t *testing.T) {
+	vars := Vars{"keyword": "仙逆 1", "page": "3", "bookId": "12345", "$1": "12345"}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"https://a.example/search?q={{keyword}}&p={{page}}", "https://a.example/search?q=%E4%BB%99%E9%80%86+1&p=3"},
+		{"https://a.example/search?q={{ keyword | gbk }}", "https://a.example/search?q=%CF%C9%C4%E6+1"},
+		{"https://a.example/s/{{keyword|path}}", "https://a.example/s/%E4%BB%99%E9%80%86%201"},
+		{"https://a.example/book/{{bookId/1000}}/{{bookId}}/", "https://a.example/book/12/12345/"},
+		{"https://a.example/list?offset={{(page-1)*20}}&n={{$1%7}}&m={{-page+10}}", "https://a.example/list?offset=40&n=4&m=7"},
+		{"https://a.example/{{keyword|raw}}", "https://a.example/仙逆 1"},
+		{"https://a.example/static", "https://a.example/static"},
+	}
+	for _, tt := range tests {
+		tmpl, err := Compile(tt.template)
+		if err != nil {
+			t.Errorf("%s: %v", tt.template, err)
+			continue
+		}
+		if got, err := tmpl.Execute(vars); err != nil || got != tt.want {
+			t.Errorf("%s: 得到 %q (%v)，期望 %q", tt.template, got, err, tt.want)
+		}
+	}
+
+	// 表单参数默认不转义，编码过滤器仍然生效
+	tmpl, _ := Compile("{{keyword}}|{{keyword|gbk}}|{{keyword|url}}")
+	if got, _ := tmpl.ExecuteRaw(vars); got != "仙逆 1|\xcf\xc9\xc4\xe6 1|%E4%BB%99%E9%80%86+1" {
+		t.Errorf("ExecuteRaw 结果不正确: %q", got)
+	}
+	tmpl, _ = Compile(`{"q": "{{keyword}}", "page": {{page}}}`)
+	if got, _ := tmpl.ExecuteJSON(Vars{"keyword": `"仙逆"<1>`, "page": "2"}); got != `{"q": "\"仙逆\"<1>", "page": 2}` {
+		t.Errorf("ExecuteJSON 结果不正确: %s", got)
+	}
+	tmpl, _ = Compile("{{keyword}}|{{keyword|gbk}}|{{keyword|url}}")
+	if names := tmpl.Names(); len(names) != 1 || !tmpl.Uses("keyword") || tmpl.Uses("page") {
+		t.Errorf("变量列表不正确: %v", names)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, raw := range []string{"{{keyword", "{{}}", "{{page+}}", "{{(page}}", "{{keyword|utf16}}", "{{1abc}}", "{{page page}}"} {
+		if _, err := Compile(raw); err == nil {
+			t.Errorf("%s 应编译失败", raw)
+		}
+	}
+
+	for raw, want := range map[string]string{
+		"{{bookId}}":    "未定义的变量 bookId",
+		"{{keyword*2}}": "不是整数",
+		"{{page/0}}":    "除数为0",
+	} {
+		tmpl, err := Compile(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tmpl.Execute(Vars{"keyword": "仙逆", "page": "1"}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: 错误 %v 应包含 %q", raw, err, want)
+		}
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	if !IsTemplate("https://a.example/s?q=%s") || IsTemplate("https://a.example/") {
+		t.Error("IsTemplate 结果不正确")
+	}
+	if got := Legacy("https://a.example/list/%s/", "bookId|raw"); got != "https://a.example/list/{{bookId|raw}}/" {
+		t.Errorf("Legacy 结果不正确: %s", got)
+	}
+}
@@ -0,0 +1,241 @@
+package util
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// EpubMeta EPUB元数据
+type EpubMeta struct {
+	Title       string
+	Author      string
+	Identifier  string
+	Description string
+	Language    string
+	// CoverPath 封面图片在EPUB压缩包内的路径
+	CoverPath string
+	// CoverType 封面图片的媒体类型
+	CoverType string
+	// Chapters 目录(toc.ncx)中的章节标题
+	Chapters []string
+}
+
+// epubContainer META-INF/container.xml 结构
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage OPF文件结构（只解析需要的部分）
+type epubPackage struct {
+	Metadata struct {
+		Identifiers  []string `xml:"identifier"`
+		Titles       []string `xml:"title"`
+		Creators     []string `xml:"creator"`
+		Descriptions []string `xml:"description"`
+		Languages    []string `xml:"language"`
+		Metas        []struct {
+			Name    string `xml:"name,attr"`
+			Content string `xml:"content,attr"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Items []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// epubNavPoint toc.ncx 中的目录项
+type epubNavPoint struct {
+	Label    string         `xml:"navLabel>text"`
+	Children []epubNavPoint `xml:"navPoint"`
+}
+
+// epubNcx toc.ncx 文件结构
+type epubNcx struct {
+	NavPoints []epubNavPoint `xml:"navMap>navPoint"`
+}
+
+// ReadEpubMeta 读取EPUB文件的元数据
+func ReadEpubMeta(fp string) (*EpubMeta, error) {
+	r, err := zip.OpenReader(fp)
+	if err != nil {
+		return nil, fmt.Errorf("打开EPUB文件失败: %w", err)
+	}
+	defer r.Close()
+
+	// 从container.xml中找到OPF文件路径
+	var container epubContainer
+	if err := decodeZipXML(&r.Reader, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 || container.Rootfiles[0].FullPath == "" {
+		return nil, fmt.Errorf("EPUB文件缺少OPF路径")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	var pkg epubPackage
+	if err := decodeZipXML(&r.Reader, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	meta := &EpubMeta{
+		Identifier:  firstNonEmpty(pkg.Metadata.Identifiers),
+		Title:       firstNonEmpty(pkg.Metadata.Titles),
+		Author:      firstNonEmpty(pkg.Metadata.Creators),
+		Description: firstNonEmpty(pkg.Metadata.Descriptions),
+		Language:    firstNonEmpty(pkg.Metadata.Languages),
+	}
+
+	// EPUB3 使用 properties="cover-image"，EPUB2 使用 <meta name="cover">
+	coverId := ""
+	for _, m := range pkg.Metadata.Metas {
+		if m.Name == "cover" {
+			coverId = m.Content
+			break
+		}
+	}
+	for _, item := range pkg.Items {
+		if meta.CoverPath == "" && (strings.Contains(item.Properties, "cover-image") || (coverId != "" && item.ID == coverId)) {
+			meta.CoverPath = path.Join(path.Dir(opfPath), item.Href)
+			meta.CoverType = item.MediaType
+		}
+
+		// 读取目录中的章节标题，目录缺失时不影响其他元数据
+		if item.MediaType == "application/x-dtbncx+xml" && meta.Chapters == nil {
+			var ncx epubNcx
+			if err := decodeZipXML(&r.Reader, path.Join(path.Dir(opfPath), item.Href), &ncx); err == nil {
+				meta.Chapters = flattenNavPoints(ncx.NavPoints, []string{})
+			}
+		}
+	}
+
+	return meta, nil
+}
+
+// EpubChapter EPUB中按阅读顺序排列的章节
+type EpubChapter struct {
+	Title      string
+	Paragraphs []string
+}
+
+// ReadEpubChapters 按阅读顺序读取EPUB中的章节标题 (h1) 和段落 (p)，没有 h1 的页面（如封面）跳过
+func ReadEpubChapters(fp string) ([]EpubChapter, error) {
+	r, err := zip.OpenReader(fp)
+	if err != nil {
+		return nil, fmt.Errorf("打开EPUB文件失败: %w", err)
+	}
+	defer r.Close()
+
+	var container epubContainer
+	if err := decodeZipXML(&r.Reader, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 || container.Rootfiles[0].FullPath == "" {
+		return nil, fmt.Errorf("EPUB文件缺少OPF路径")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+
+	var pkg epubPackage
+	if err := decodeZipXML(&r.Reader, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+	hrefs := make(map[string]string, len(pkg.Items))
+	for _, item := range pkg.Items {
+		hrefs[item.ID] = item.Href
+	}
+
+	var chapters []EpubChapter
+	for _, ref := range pkg.Spine {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		f, err := r.Open(path.Join(path.Dir(opfPath), href))
+		if err != nil {
+			return nil, fmt.Errorf("EPUB中未找到文件 %s: %w", href, err)
+		}
+		doc, err := goquery.NewDocumentFromReader(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析 %s 失败: %w", href, err)
+		}
+
+		title := strings.TrimSpace(doc.Find("h1").First().Text())
+		if title == "" {
+			continue
+		}
+		chapter := EpubChapter{Title: title}
+		doc.Find("p").Each(func(_ int, s *goquery.Selection) {
+			if text := strings.TrimSpace(s.Text()); text != "" {
+				chapter.Paragraphs = append(chapter.Paragraphs, text)
+			}
+		})
+		chapters = append(chapters, chapter)
+	}
+	return chapters, nil
+}
+
+// ReadEpubFile 读取EPUB压缩包内的单个文件
+func ReadEpubFile(fp, name string) ([]byte, error) {
+	r, err := zip.OpenReader(fp)
+	if err != nil {
+		return nil, fmt.Errorf("打开EPUB文件失败: %w", err)
+	}
+	defer r.Close()
+
+	f, err := r.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("EPUB中未找到文件 %s: %w", name, err)
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// decodeZipXML 解析压缩包内的XML文件
+func decodeZipXML(r *zip.Reader, name string, v any) error {
+	f, err := r.Open(name)
+	if err != nil {
+		return fmt.Errorf("EPUB中未找到文件 %s: %w", name, err)
+	}
+	defer f.Close()
+
+	if err := xml.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("解析 %s 失败: %w", name, err)
+	}
+	return nil
+}
+
+// flattenNavPoints 按顺序展开目录项的标题
+func flattenNavPoints(points []epubNavPoint, titles []string) []string {
+	for _, p := range points {
+		if label := strings.TrimSpace(p.Label); label != "" {
+			titles = append(titles, label)
+		}
+		titles = flattenNavPoints(p.Children, titles)
+	}
+	return titles
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values []string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -23,11 +23,16 @@ func SanitizeFileName(filename string) string {
 	return filename
 }
 
-// CreateDownloadDir 创建下载目录
-func CreateDownloadDir(basePath, bookName, author, ext string) (string, error) {
+// DownloadDirPath 返回书籍章节缓存目录的路径
+func DownloadDirPath(basePath, bookName, author, ext string) string {
 	// 构造目录名
 	dirName := SanitizeFileName(fmt.Sprintf("%s (%s) %s", bookName, author, strings.ToUpper(ext)))
-	dirPath := filepath.Join(basePath, dirName)
+	return filepath.Join(basePath, dirName)
+}
+
+// CreateDownloadDir 创建下载目录
+func CreateDownloadDir(basePath, bookName, author, ext string) (string, error) {
+	dirPath := DownloadDirPath(basePath, bookName, author, ext)
 
 	// 创建目录
 	err := os.MkdirAll(dirPath, 0755)
@@ -57,3 +62,27 @@ func WriteFile(fp string, content []byte, perm os.FileMode) error {
 	}
 	return nil
 }
+
+// WriteFileAtomic 先写入同目录下的临时文件再重命名，读取方和中途崩溃都不会留下写了一半的文件
+func WriteFileAtomic(fp string, content []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fp), "."+filepath.Base(fp)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fp)
+}
@@ -0,0 +1,329 @@
+package util
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// JsContext 脚本执行时的页面上下文，未提供的字段在脚本中为空
+type JsContext struct {
+	BaseURL string     // 当前页面地址，脚本中为 baseUrl，也是 resolveUrl 的默认基准地址
+	Book    *JsBook    // 当前书籍，脚本中为 book
+	Chapter *JsChapter // 当前章节，脚本中为 chapter
+	// Credential 登录凭据，仅在登录脚本中提供，脚本中为 credential
+	Credential map[string]string
+	// Query 在当前页面上执行 CSS/XPath 选择器，返回每个匹配元素的文本，attr 不为空时返回该属性的值
+	Query func(expr, attr string) ([]string, error)
+	// Fetch 发起HTTP请求并返回响应正文，为空时脚本不能发起请求
+	Fetch func(req JsRequest) (string, error)
+}
+
+// JsRequest 脚本发起的HTTP请求，URL 已转为绝对地址
+type JsRequest struct {
+	Method string
+	URL    string
+	Body   string
+	Header map[string]string
+}
+
+// JsBook 脚本中的 book 对象: {name, author, url}
+type JsBook struct {
+	Name   string
+	Author string
+	URL    string
+}
+
+// JsChapter 脚本中的 chapter 对象: {title, url, index}，index 从 1 开始
+type JsChapter struct {
+	Title string
+	URL   string
+	Index int
+}
+
+// registerApi 注册规则脚本可用的函数:
+//
+//	base64Encode(s) / base64Decode(s)  Base64 编解码，解码时兼容 URL 安全字符和省略填充
+//	md5(s)                             小写十六进制 MD5
+//	aesEncrypt(s, key, iv)             AES 加密并返回 Base64，iv 为空时使用 ECB 模式，否则为 CBC，PKCS7 填充
+//	aesDecrypt(s, key, iv)             解密 Base64 编码的 AES 密文
+//	resolveUrl(path, base)             将相对地址转为绝对地址，base 省略时使用 baseUrl
+//	query(expr) / queryAll(expr)       在当前页面上执行 CSS/XPath 选择器，返回第一个/全部匹配元素的文本
+//	queryAttr(expr, attr)              返回第一个匹配元素的属性值
+//	httpGet(url, headers)              发起GET请求并返回响应正文，相对地址基于 baseUrl
+//	httpPost(url, body, headers)       发起POST请求，body 为对象时按表单编码
+//	httpJson(url, body, headers)       省略 body 时发起GET请求，否则为POST，返回解析后的JSON
+//
+// 变量 baseUrl、book、chapter、credential 由每次执行的 JsContext 设置，函数出错时抛出异常。
+// 每次执行最多发起 DefaultJsMaxRequests 个请求，等待响应的时间不计入脚本超时
+func (j *JsEngine) registerApi() {
+	vm := j.vm
+	str := func(call goja.FunctionCall, i int) string {
+		if v := call.Argument(i); !goja.IsUndefined(v) && !goja.IsNull(v) {
+			return v.String()
+		}
+		return ""
+	}
+	throw := func(err error) {
+		panic(vm.NewGoError(err))
+	}
+
+	vm.Set("base64Encode", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(base64.StdEncoding.EncodeToString([]byte(str(call, 0))))
+	})
+	vm.Set("base64Decode", func(call goja.FunctionCall) goja.Value {
+		data, err := decodeBase64(str(call, 0))
+		if err != nil {
+			throw(err)
+		}
+		return vm.ToValue(string(data))
+	})
+	vm.Set("md5", func(call goja.FunctionCall) goja.Value {
+		sum := md5.Sum([]byte(str(call, 0)))
+		return vm.ToValue(hex.EncodeToString(sum[:]))
+	})
+	vm.Set("aesEncrypt", func(call goja.FunctionCall) goja.Value {
+		data, err := AesEncrypt([]byte(str(call, 0)), []byte(str(call, 1)), []byte(str(call, 2)))
+		if err != nil {
+			throw(err)
+		}
+		return vm.ToValue(base64.StdEncoding.EncodeToString(data))
+	})
+	vm.Set("aesDecrypt", func(call goja.FunctionCall) goja.Value {
+		data, err := decodeBase64(str(call, 0))
+		if err != nil {
+			throw(err)
+		}
+		if data, err = AesDecrypt(data, []byte(str(call, 1)), []byte(str(call, 2))); err != nil {
+			throw(err)
+		}
+		return vm.ToValue(string(data))
+	})
+	vm.Set("resolveUrl", func(call goja.FunctionCall) goja.Value {
+		base := str(call, 1)
+		if base == "" && j.ctx != nil {
+			base = j.ctx.BaseURL
+		}
+		return vm.ToValue(ResolveURL(base, str(call, 0)))
+	})
+
+	query := func(expr, attr string) []string {
+		if j.ctx == nil || j.ctx.Query == nil {
+			throw(errors.New("当前没有可查询的页面"))
+		}
+		values, err := j.ctx.Query(expr, attr)
+		if err != nil {
+			throw(err)
+		}
+		return values
+	}
+	first := func(values []string) goja.Value {
+		if len(values) == 0 {
+			return vm.ToValue("")
+		}
+		return vm.ToValue(values[0])
+	}
+	vm.Set("query", func(call goja.FunctionCall) goja.Value {
+		return first(query(str(call, 0), ""))
+	})
+	vm.Set("queryAll", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(query(str(call, 0), ""))
+	})
+	vm.Set("queryAttr", func(call goja.FunctionCall) goja.Value {
+		return first(query(str(call, 0), str(call, 1)))
+	})
+
+	fetch := func(method string, call goja.FunctionCall, body, headers goja.Value) string {
+		req := JsRequest{Method: method, URL: str(call, 0), Body: formBody(body), Header: make(map[string]string)}
+		if fields, ok := headers.Export().(map[string]any); ok {
+			for key, value := range fields {
+				req.Header[key] = fmt.Sprint(value)
+			}
+		}
+		result, err := j.fetch(req)
+		if err != nil {
+			throw(err)
+		}
+		return result
+	}
+	vm.Set("httpGet", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(fetch(http.MethodGet, call, nil, call.Argument(1)))
+	})
+	vm.Set("httpPost", func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(fetch(http.MethodPost, call, call.Argument(1), call.Argument(2)))
+	})
+	vm.Set("httpJson", func(call goja.FunctionCall) goja.Value {
+		method := http.MethodPost
+		if v := call.Argument(1); goja.IsUndefined(v) || goja.IsNull(v) {
+			method = http.MethodGet
+		}
+		body := fetch(method, call, call.Argument(1), call.Argument(2))
+		var value any
+		if err := json.Unmarshal([]byte(body), &value); err != nil {
+			throw(fmt.Errorf("响应不是有效的JSON: %w", err))
+		}
+		return vm.ToValue(value)
+	})
+}
+
+// fetch 通过上下文中的 Fetch 发起请求，检查请求数量上限，等待期间暂停超时计时
+func (j *JsEngine) fetch(req JsRequest) (string, error) {
+	if j.ctx == nil || j.ctx.Fetch == nil {
+		return "", errors.New("当前不能发起HTTP请求")
+	}
+	if j.requests >= DefaultJsMaxRequests {
+		return "", fmt.Errorf("单次执行最多发起 %d 个HTTP请求", DefaultJsMaxRequests)
+	}
+	j.requests++
+	req.URL = ResolveURL(j.ctx.BaseURL, req.URL)
+
+	resume := j.pauseTimeout()
+	body, err := j.ctx.Fetch(req)
+	resume()
+	return body, err
+}
+
+// formBody 将请求体转为字符串，对象按表单编码
+func formBody(v goja.Value) string {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return ""
+	}
+	fields, ok := v.Export().(map[string]any)
+	if !ok {
+		return v.String()
+	}
+	form := url.Values{}
+	for key, value := range fields {
+		form.Set(key, fmt.Sprint(value))
+	}
+	return form.Encode()
+}
+
+// setContext 设置本次执行的页面上下文变量，ctx 为 nil 时清空
+func (j *JsEngine) setContext(ctx *JsContext) {
+	j.ctx = ctx
+	j.requests = 0
+	baseURL, book, chapter, credential := "", goja.Null(), goja.Null(), goja.Null()
+	if ctx != nil {
+		baseURL = ctx.BaseURL
+		if ctx.Book != nil {
+			book = j.vm.ToValue(map[string]any{"name": ctx.Book.Name, "author": ctx.Book.Author, "url": ctx.Book.URL})
+		}
+		if ctx.Chapter != nil {
+			chapter = j.vm.ToValue(map[string]any{"title": ctx.Chapter.Title, "url": ctx.Chapter.URL, "index": ctx.Chapter.Index})
+		}
+		if ctx.Credential != nil {
+			values := make(map[string]any, len(ctx.Credential))
+			for key, value := range ctx.Credential {
+				values[key] = value
+			}
+			credential = j.vm.ToValue(values)
+		}
+	}
+	j.vm.Set("baseUrl", baseURL)
+	j.vm.Set("book", book)
+	j.vm.Set("chapter", chapter)
+	j.vm.Set("credential", credential)
+}
+
+// decodeBase64 解码标准或 URL 安全的 Base64，忽略空白和缺失的填充
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimRight(s, "=")
+	encoding := base64.RawStdEncoding
+	if strings.ContainsAny(s, "-_") {
+		encoding = base64.RawURLEncoding
+	}
+	data, err := encoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Base64解码失败: %w", err)
+	}
+	return data, nil
+}
+
+// ResolveURL 将相对地址转为基于 base 的绝对地址，无法解析时原样返回
+func ResolveURL(base, ref string) string {
+	if base == "" {
+		return ref
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
+
+// AesEncrypt 使用 PKCS7 填充进行 AES 加密，iv 为空时使用 ECB 模式，否则使用 CBC 模式
+func AesEncrypt(data, key, iv []byte) ([]byte, error) {
+	block, err := aesBlock(key, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	size := block.BlockSize()
+	padding := size - len(data)%size
+	data = append(bytes.Clone(data), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	out := make([]byte, len(data))
+	if len(iv) > 0 {
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+		return out, nil
+	}
+	for i := 0; i < len(data); i += size {
+		block.Encrypt(out[i:i+size], data[i:i+size])
+	}
+	return out, nil
+}
+
+// AesDecrypt 解密 AesEncrypt 加密的数据并去掉 PKCS7 填充
+func AesDecrypt(data, key, iv []byte) ([]byte, error) {
+	block, err := aesBlock(key, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	size := block.BlockSize()
+	if len(data) == 0 || len(data)%size != 0 {
+		return nil, fmt.Errorf("AES密文长度 %d 不是 %d 的倍数", len(data), size)
+	}
+	out := make([]byte, len(data))
+	if len(iv) > 0 {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	} else {
+		for i := 0; i < len(data); i += size {
+			block.Decrypt(out[i:i+size], data[i:i+size])
+		}
+	}
+
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > size || !bytes.Equal(out[len(out)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("AES解密失败: 密钥错误或填充无效")
+	}
+	return out[:len(out)-padding], nil
+}
+
+// aesBlock 创建 AES 分组密码，检查密钥和 iv 长度
+func aesBlock(key, iv []byte) (cipher.Block, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("AES密钥长度应为 16、24 或 32 字节，当前为 %d", len(key))
+	}
+	if len(iv) > 0 && len(iv) != block.BlockSize() {
+		return nil, fmt.Errorf("AES iv 长度应为 %d 字节，当前为 %d", block.BlockSize(), len(iv))
+	}
+	return block, nil
+}
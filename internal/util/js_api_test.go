@@ -0,0 +1,112 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJsApi(t *testing.T) {
+	ctx := &JsContext{
+		BaseURL: "https://www.example.com/book/1/",
+		Book:    &JsBook{Name: "诡秘之主", Author: "爱潜水的乌贼", URL: "https://www.example.com/book/1/"},
+		Chapter: &JsChapter{Title: "第一章 绯红", URL: "https://www.example.com/book/1/1.html", Index: 1},
+		Query: func(expr, attr string) ([]string, error) {
+			if attr != "" {
+				return []string{expr + "@" + attr}, nil
+			}
+			return []string{expr + "1", expr + "2"}, nil
+		},
+	}
+
+	tests := []struct {
+		name string
+		code string
+		ctx  *JsContext
+		want string
+	}{
+		{"base64Encode", `r = base64Encode(r)`, nil, "5rWL6K+V"},
+		{"base64Decode", `r = base64Decode("5rWL6K-V")`, nil, "测试"},
+		{"md5", `r = md5(r)`, nil, "db06c78d1e24cf708a14ce81c9b617ec"},
+		{"aes", `r = aesDecrypt(aesEncrypt(r, "0123456789abcdef", "fedcba9876543210"), "0123456789abcdef", "fedcba9876543210")`, nil, "测试"},
+		{"aesEcb", `r = aesDecrypt(aesEncrypt(r, "0123456789abcdef"), "0123456789abcdef")`, nil, "测试"},
+		{"resolveUrl", `r = resolveUrl("../2/") + " " + resolveUrl("/a.jpg", "https://img.example.com/x/")`, ctx, "https://www.example.com/book/2/ https://img.example.com/a.jpg"},
+		{"baseUrl", `r = baseUrl`, ctx, "https://www.example.com/book/1/"},
+		{"book", `r = book.name + "/" + book.author`, ctx, "诡秘之主/爱潜水的乌贼"},
+		{"chapter", `r = chapter.index + chapter.title`, ctx, "1第一章 绯红"},
+		{"noContext", `r = String(book) + String(chapter) + baseUrl`, nil, "nullnull"},
+		{"query", `r = query("h1") + "," + queryAll("p").join("|") + "," + queryAttr("img", "src")`, ctx, "h11,p1|p2,img@src"},
+	}
+
+	pool := NewJsPool(1, DefaultJsTimeout)
+	for _, tt := range tests {
+		program, err := CompileJs(tt.code)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got, err := pool.Run(program, "测试", tt.ctx); err != nil || got != tt.want {
+			t.Errorf("%s: 期望 %q，实际 %q, %v", tt.name, tt.want, got, err)
+		}
+	}
+
+	// 上一次执行的上下文不会泄漏到下一次
+	program, _ := CompileJs(`r = baseUrl`)
+	if got, _ := pool.Run(program, "x", nil); got != "" {
+		t.Errorf("上下文应在执行后清空，实际 %q", got)
+	}
+
+	// 出错时抛出异常，可以在脚本中捕获
+	for code, want := range map[string]string{
+		`r = aesDecrypt(base64Encode("0123456789abcdef"), "short")`: "AES密钥长度",
+		`r = query("h1")`:         "没有可查询的页面",
+		`r = base64Decode("!!!")`: "Base64解码失败",
+	} {
+		if _, err := pool.Call(code, ""); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s 期望错误包含 %q，实际 %v", code, want, err)
+		}
+	}
+	if got, _ := pool.Call(`try { aesDecrypt("AAAA", "0123456789abcdef") } catch (e) { r = "caught" }`, ""); got != "caught" {
+		t.Errorf("脚本中应能捕获异常，实际 %q", got)
+	}
+}
+
+func TestJsHttp(t *testing.T) {
+	var requests []JsRequest
+	ctx := &JsContext{
+		BaseURL: "https://www.example.com/book/1/",
+		Fetch: func(req JsRequest) (string, error) {
+			requests = append(requests, req)
+			time.Sleep(30 * time.Millisecond)
+			return `{"text": "正文"}`, nil
+		},
+	}
+
+	// 等待响应的时间不计入脚本超时
+	pool := NewJsPool(1, 50*time.Millisecond)
+	program, _ := CompileJs(`r = httpGet("1.html", {Referer: baseUrl}) && httpPost("/api", {id: 1, k: "a b"}) && httpJson("/api", null, {"X-Token": "t"}).text`)
+	if got, err := pool.Run(program, "", ctx); err != nil || got != "正文" {
+		t.Fatalf("脚本请求的结果不正确: %q, %v", got, err)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("期望 3 个请求，实际 %+v", requests)
+	}
+	if r := requests[0]; r.Method != "GET" || r.URL != "https://www.example.com/book/1/1.html" || r.Header["Referer"] != ctx.BaseURL {
+		t.Errorf("GET请求不正确: %+v", r)
+	}
+	if r := requests[1]; r.Method != "POST" || r.URL != "https://www.example.com/api" || r.Body != "id=1&k=a+b" {
+		t.Errorf("POST请求不正确: %+v", r)
+	}
+	if r := requests[2]; r.Method != "GET" || r.Header["X-Token"] != "t" {
+		t.Errorf("httpJson 请求不正确: %+v", r)
+	}
+
+	// 没有上下文时不能发起请求，每次执行的请求数量有上限
+	if _, err := pool.Call(`httpGet("/")`, ""); err == nil || !strings.Contains(err.Error(), "不能发起") {
+		t.Errorf("没有上下文时不能发起请求: %v", err)
+	}
+	ctx.Fetch = func(req JsRequest) (string, error) { return "", nil }
+	program, _ = CompileJs(`for (var i = 0; i < 100; i++) httpGet("/")`)
+	if _, err := pool.Run(program, "", ctx); err == nil || !strings.Contains(err.Error(), "最多发起") {
+		t.Errorf("超过请求数量上限应出错: %v", err)
+	}
+}
@@ -1,19 +1,43 @@
 package util
 
 import (
+	"errors"
+	"fmt"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/dop251/goja"
 )
 
-// JsEngine JavaScript引擎封装
+const (
+	// DefaultJsTimeout 单次脚本执行的超时时间
+	DefaultJsTimeout = 2 * time.Second
+	// DefaultJsMaxCallStack 调用栈深度上限，防止无限递归
+	DefaultJsMaxCallStack = 1024
+	// DefaultJsMaxOutput 脚本返回结果和HTTP响应的长度上限 (字节)
+	DefaultJsMaxOutput = 8 << 20
+	// DefaultJsMaxRequests 单次执行中脚本可发起的HTTP请求数量上限
+	DefaultJsMaxRequests = 10
+)
+
+// ErrJsTimeout 脚本执行超时，通常是规则中存在死循环
+var ErrJsTimeout = errors.New("JavaScript执行超时")
+
+// JsEngine 单个JavaScript运行时。goja.Runtime 不是并发安全的，由 JsPool 保证同一时间只有一个goroutine使用
 type JsEngine struct {
-	vm *goja.Runtime
+	vm       *goja.Runtime
+	base     *goja.Object // 冻结的全局对象，每次执行使用以它为原型的新全局对象
+	ctx      *JsContext   // 当前执行的页面上下文
+	requests int          // 本次执行已发起的HTTP请求数量
+	timer    *time.Timer  // 本次执行的超时计时器
+	deadline time.Time
 }
 
 // NewJsEngine 创建新的JavaScript引擎实例
 func NewJsEngine() *JsEngine {
 	vm := goja.New()
+	vm.SetMaxCallStackSize(DefaultJsMaxCallStack)
 
 	// 注册常用的字符串方法
 	vm.Set("replace", func(call goja.FunctionCall) goja.Value {
@@ -46,48 +70,241 @@ func NewJsEngine() *JsEngine {
 		return vm.ToValue(parts)
 	})
 
-	return &JsEngine{vm: vm}
+	engine := &JsEngine{vm: vm}
+	engine.registerApi()
+
+	// 设置代码是固定的，执行失败说明代码本身有误
+	setup, err := vm.RunProgram(jsSetupProgram)
+	if err != nil {
+		panic(fmt.Sprintf("初始化JavaScript运行时失败: %v", err))
+	}
+	fn, _ := goja.AssertFunction(setup)
+	if _, err := fn(goja.Undefined(), vm.GlobalObject()); err != nil {
+		panic(fmt.Sprintf("初始化JavaScript运行时失败: %v", err))
+	}
+	engine.base = vm.GlobalObject()
+
+	return engine
 }
 
-// Call 执行JavaScript代码处理输入
-func (j *JsEngine) Call(jsCode string, input string) (string, error) {
-	// 如果JavaScript代码为空，直接返回原始输入
-	if jsCode == "" {
-		return input, nil
+// jsSetupCode 冻结全局对象和从它可以访问到的内置对象 (构造函数、原型、JSON、Math 以及注册的API函数)，
+// 脚本对它们的修改在非严格模式下被忽略，defineProperty 等操作抛出异常。
+// Object.prototype 等原型上的方法改为访问器，对象仍可以定义同名的自有属性 (如 obj.toString = ...)
+const jsSetupCode = `(function(global) {
+	var ownKeys = Reflect.ownKeys, getDesc = Reflect.getOwnPropertyDescriptor, define = Reflect.defineProperty,
+		getProto = Reflect.getPrototypeOf;
+
+	function tame(proto) {
+		ownKeys(proto).forEach(function(key) {
+			var desc = getDesc(proto, key);
+			if (!("value" in desc) || !desc.writable || !desc.configurable) {
+				return;
+			}
+			var value = desc.value;
+			define(proto, key, {
+				get: function() { return value; },
+				set: function(v) {
+					if (this !== proto && (typeof this === "object" || typeof this === "function") && this !== null) {
+						define(this, key, {value: v, writable: true, enumerable: true, configurable: true});
+					}
+				},
+				enumerable: desc.enumerable,
+				configurable: false
+			});
+		});
+	}
+	tame(Object.prototype);
+	tame(Error.prototype);
+	tame(Function.prototype);
+
+	var seen = new Set();
+	function deepFreeze(value) {
+		if ((typeof value !== "object" && typeof value !== "function") || value === null || seen.has(value)) {
+			return;
+		}
+		seen.add(value);
+		Object.freeze(value);
+		deepFreeze(getProto(value));
+		ownKeys(value).forEach(function(key) {
+			var desc = getDesc(value, key);
+			deepFreeze(desc.value);
+			deepFreeze(desc.get);
+			deepFreeze(desc.set);
+		});
+	}
+	// 不能通过全局对象的属性访问到的内置原型
+	var roots = [global, [][Symbol.iterator](), new Map().entries(), new Set().values(), ""[Symbol.iterator](),
+		"".matchAll(/a/g), function*() {}, (function*() {})()];
+	try {
+		roots.push(new Function("return async function() {}")());
+	} catch (e) {}
+	roots.forEach(deepFreeze);
+})`
+
+var jsSetupProgram = goja.MustCompile("setup", jsSetupCode, false)
+
+// reset 使用以冻结的全局对象为原型的新全局对象，丢弃上一次执行新增或修改的全局变量
+func (j *JsEngine) reset() {
+	global := j.vm.NewObject()
+	global.SetPrototype(j.base)
+	global.DefineDataProperty("globalThis", global, goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	j.vm.SetGlobalObject(global)
+}
+
+// run 执行预编译的JavaScript程序处理输入，超过 timeout 时中断执行。
+// interrupted 为 true 时运行时可能处于中断状态，不能再使用
+func (j *JsEngine) run(program *goja.Program, input string, ctx *JsContext, timeout time.Duration) (result string, interrupted bool, err error) {
+	j.reset()
+	j.setContext(ctx)
+	defer j.setContext(nil)
+
+	if timeout > 0 {
+		j.deadline = time.Now().Add(timeout)
+		j.timer = time.AfterFunc(timeout, func() {
+			j.vm.Interrupt(ErrJsTimeout)
+		})
+		defer func() {
+			// 计时器已触发说明中断可能在脚本结束后才生效
+			if !j.timer.Stop() {
+				interrupted = true
+			}
+			j.timer = nil
+		}()
 	}
 
-	// 构造函数代码
-	funcCode := "function func(r) { " + jsCode + "; return r; }"
+	value, err := j.call(program, input)
+	var interruptedErr *goja.InterruptedError
+	if errors.As(err, &interruptedErr) {
+		return input, true, ErrJsTimeout
+	}
+	if err != nil {
+		return input, false, err
+	}
+	if len(value) > DefaultJsMaxOutput {
+		return input, false, fmt.Errorf("JavaScript返回结果过大: %d 字节", len(value))
+	}
+	return value, false, nil
+}
 
-	// 执行函数定义
-	_, err := j.vm.RunString(funcCode)
+// pauseTimeout 暂停超时计时，用于等待HTTP响应，返回恢复计时的函数。等待时间由请求自身的超时限制
+func (j *JsEngine) pauseTimeout() (resume func()) {
+	if j.timer == nil || !j.timer.Stop() {
+		return func() {}
+	}
+	remaining := time.Until(j.deadline)
+	return func() {
+		j.deadline = time.Now().Add(remaining)
+		j.timer.Reset(remaining)
+	}
+}
+
+// call 执行程序得到处理函数，再以输入调用该函数
+func (j *JsEngine) call(program *goja.Program, input string) (string, error) {
+	value, err := j.vm.RunProgram(program)
 	if err != nil {
-		return input, err
+		return "", err
 	}
 
-	// 调用函数
-	fn, ok := goja.AssertFunction(j.vm.Get("func"))
+	fn, ok := goja.AssertFunction(value)
 	if !ok {
 		return input, nil // 如果不是函数，返回原始输入
 	}
 
 	// 执行函数并获取结果
 	result, err := fn(goja.Undefined(), j.vm.ToValue(input))
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+// JsPool JavaScript运行时池，每次执行从池中取出独占的运行时，最多同时存在 size 个运行时，全部占用时等待归还。
+// 运行时创建时冻结内置对象，每次执行使用新的全局对象，脚本新增或修改的全局变量和内置对象 (如 String.prototype、JSON.parse)
+// 不会影响之后的规则；被中断的运行时直接丢弃。goja 无法限制堆内存，死循环中持续分配的脚本由超时中断，返回结果有长度上限
+type JsPool struct {
+	idle    chan *JsEngine
+	slots   chan struct{} // 已创建的运行时数量
+	timeout time.Duration
+}
+
+// NewJsPool 创建运行时池，size 为运行时数量上限，timeout 为单次执行的超时时间，0 表示不限制
+func NewJsPool(size int, timeout time.Duration) *JsPool {
+	if size <= 0 {
+		size = 1
+	}
+	return &JsPool{
+		idle:    make(chan *JsEngine, size),
+		slots:   make(chan struct{}, size),
+		timeout: timeout,
+	}
+}
+
+// Call 编译并执行JavaScript代码处理输入
+func (p *JsPool) Call(jsCode string, input string) (string, error) {
+	// 如果JavaScript代码为空，直接返回原始输入
+	if jsCode == "" {
+		return input, nil
+	}
+
+	program, err := CompileJs(jsCode)
 	if err != nil {
 		return input, err
 	}
+	return p.Run(program, input, nil)
+}
 
-	return result.String(), nil
+// Run 在页面上下文 ctx 中执行预编译的JavaScript程序处理输入，ctx 可以为 nil，出错时返回原始输入
+func (p *JsPool) Run(program *goja.Program, input string, ctx *JsContext) (string, error) {
+	engine := p.acquire()
+	result, interrupted, err := engine.run(program, input, ctx, p.timeout)
+	p.release(engine, interrupted)
+	return result, err
 }
 
-// GlobalJsEngine 全局JavaScript引擎实例
-var GlobalJsEngine *JsEngine
+// acquire 取出空闲的运行时，没有空闲且未达到上限时新建
+func (p *JsPool) acquire() *JsEngine {
+	select {
+	case engine := <-p.idle:
+		return engine
+	default:
+	}
+
+	select {
+	case engine := <-p.idle:
+		return engine
+	case p.slots <- struct{}{}:
+		return NewJsEngine()
+	}
+}
 
-func init() {
-	GlobalJsEngine = NewJsEngine()
+// release 归还运行时，被中断的运行时直接丢弃，下次需要时重新创建
+func (p *JsPool) release(engine *JsEngine, discard bool) {
+	if discard {
+		<-p.slots
+		return
+	}
+	p.idle <- engine
 }
 
+// GlobalJsPool 全局JavaScript运行时池
+var GlobalJsPool = NewJsPool(max(4, runtime.GOMAXPROCS(0)), DefaultJsTimeout)
+
 // CallJs 全局JavaScript调用函数
 func CallJs(jsCode string, input string) (string, error) {
-	return GlobalJsEngine.Call(jsCode, input)
+	return GlobalJsPool.Call(jsCode, input)
+}
+
+// RunJs 使用全局运行时池在页面上下文中执行预编译的JavaScript程序
+func RunJs(program *goja.Program, input string, ctx *JsContext) (string, error) {
+	return GlobalJsPool.Run(program, input, ctx)
+}
+
+// wrapJsCode 将规则中的JavaScript片段包装为函数表达式，r 为输入也是返回值
+func wrapJsCode(jsCode string) string {
+	return "(function(r) { " + jsCode + "; return r; })"
+}
+
+// CompileJs 预编译规则中的JavaScript片段
+func CompileJs(jsCode string) (*goja.Program, error) {
+	return goja.Compile("", wrapJsCode(jsCode), false)
 }
@@ -0,0 +1,131 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJsPoolConcurrent(t *testing.T) {
+	pool := NewJsPool(4, DefaultJsTimeout)
+	program, err := CompileJs(`var n = parseInt(r); globalThis.last = n; r = String(n * 2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				n := i*100 + j
+				result, err := pool.Run(program, fmt.Sprint(n), nil)
+				if err != nil || result != fmt.Sprint(n*2) {
+					errs <- fmt.Errorf("输入 %d 得到 %q, %v", n, result, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestJsPoolLimits(t *testing.T) {
+	pool := NewJsPool(1, 100*time.Millisecond)
+
+	start := time.Now()
+	result, err := pool.Call(`while (true) {}`, "原文")
+	if !errors.Is(err, ErrJsTimeout) || result != "原文" {
+		t.Fatalf("死循环应超时并返回原始输入: %q, %v", result, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("超时中断耗时过长: %v", elapsed)
+	}
+
+	if _, err := pool.Call(`function f() { return f() + 1 } f()`, "x"); err == nil {
+		t.Error("无限递归应返回错误")
+	}
+
+	// 出错后运行时池仍可正常使用
+	if result, err := pool.Call(`r = r.toUpperCase()`, "abc"); err != nil || result != "ABC" {
+		t.Errorf("出错后运行时池应可继续使用: %q, %v", result, err)
+	}
+}
+
+func TestJsPoolIsolation(t *testing.T) {
+	pool := NewJsPool(1, DefaultJsTimeout)
+
+	// 全局变量不会带到下一次执行
+	for i := 0; i < 3; i++ {
+		if result, err := pool.Call(`count = (typeof count === "undefined" ? 0 : count) + 1; r = String(count)`, ""); err != nil || result != "1" {
+			t.Fatalf("第 %d 次执行不应看到之前的全局变量: %q, %v", i+1, result, err)
+		}
+	}
+
+	// 替换的API不影响之后的规则
+	if _, err := pool.Call(`httpGet = function() { return "evil" }; trim = null`, ""); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := pool.Call(`r = typeof httpGet + "," + trim("  a  ")`, ""); err != nil || result != "function,a" {
+		t.Errorf("API应恢复为原始实现: %q, %v", result, err)
+	}
+	if result, err := pool.Call(`r = String(httpGet).indexOf("evil") < 0`, ""); err != nil || result != "true" {
+		t.Errorf("httpGet 不应被之前的脚本替换: %q, %v", result, err)
+	}
+
+	// 修改内置对象的原型和方法不影响之后的规则
+	if _, err := pool.Call(`String.prototype.trim = function(){return "evil"}; JSON.parse = function(){return {x:"evil"}}`, ""); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := pool.Call(`r = "  a  ".trim() + "," + JSON.parse('{"x":"ok"}').x`, ""); err != nil || result != "a,ok" {
+		t.Errorf("内置对象应恢复为原始实现: %q, %v", result, err)
+	}
+	for _, code := range []string{`Object.defineProperty(Array.prototype, "evil", {get: function() { return 1 }})`, `Object.setPrototypeOf(Math, {evil: 1})`} {
+		if _, err := pool.Call(code, ""); err == nil {
+			t.Errorf("内置对象已冻结，修改应抛出异常: %s", code)
+		}
+	}
+	if result, err := pool.Call(`r = typeof [].evil + "," + typeof Math.evil`, ""); err != nil || result != "undefined,undefined" {
+		t.Errorf("内置对象的属性和原型应恢复: %q, %v", result, err)
+	}
+
+	// 对象仍可以定义与 Object.prototype 上的方法同名的属性
+	if result, err := pool.Call(`var o = {}; o.toString = function() { return "own" }; r = String(o)`, ""); err != nil || result != "own" {
+		t.Errorf("对象应能定义自有的 toString: %q, %v", result, err)
+	}
+}
+
+func TestJsPoolReuse(t *testing.T) {
+	pool := NewJsPool(1, DefaultJsTimeout)
+	if _, err := pool.Call(`leaked = 1`, ""); err != nil {
+		t.Fatal(err)
+	}
+	engine := <-pool.idle
+	pool.idle <- engine
+
+	// 运行时在脚本之间复用，被中断的运行时丢弃后重新创建
+	if result, err := pool.Call(`r = typeof leaked`, ""); err != nil || result != "undefined" {
+		t.Errorf("复用的运行时不应看到之前的全局变量: %q, %v", result, err)
+	}
+	if reused := <-pool.idle; reused != engine {
+		t.Error("运行时应被复用")
+	} else {
+		pool.idle <- reused
+	}
+
+	pool.timeout = 50 * time.Millisecond
+	if _, err := pool.Call(`while (true) {}`, ""); !errors.Is(err, ErrJsTimeout) {
+		t.Fatalf("死循环应超时: %v", err)
+	}
+	if len(pool.idle) != 0 || len(pool.slots) != 0 {
+		t.Errorf("被中断的运行时应被丢弃")
+	}
+}
@@ -0,0 +1,472 @@
+// Package watch 实现连载书籍的追更：定时检查书源目录，发现新章节时通知或自动增量更新
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go-novel/internal/config"
+	"go-novel/internal/core"
+	"go-novel/internal/library"
+	"go-novel/internal/sse"
+	"go-novel/internal/util"
+)
+
+// WatchlistFileName 追更列表文件名，与书库索引一起保存在下载目录下，不是书籍文件，不会出现在书籍列表中
+const WatchlistFileName = "watchlist.json"
+
+const (
+	// ModeDefault 使用全局配置 watch.auto-update
+	ModeDefault = ""
+	// ModeNotify 发现新章节后仅通知
+	ModeNotify = "notify"
+	// ModeUpdate 发现新章节后自动增量更新
+	ModeUpdate = "update"
+)
+
+const (
+	StatusIdle     = "idle"
+	StatusChecking = "checking"
+	StatusUpdating = "updating"
+)
+
+// defaultInterval 未配置检查间隔时使用的默认值（分钟）
+const defaultInterval = 360
+
+// Item 追更列表中的一本书
+type Item struct {
+	FileName      string    `json:"fileName"`
+	BookName      string    `json:"bookName"`
+	Author        string    `json:"author"`
+	URL           string    `json:"url"`
+	SourceId      int       `json:"sourceId"`
+	Source        string    `json:"source,omitempty"` // 书源的限定ID "规则文件#规则ID"
+	Format        string    `json:"format"`
+	Interval      int       `json:"interval"` // 检查间隔（分钟），0 表示使用全局配置
+	Mode          string    `json:"mode"`
+	KnownChapters int       `json:"knownChapters"`
+	LatestChapter string    `json:"latestChapter"`
+	NewChapters   int       `json:"newChapters"`
+	Status        string    `json:"status"`
+	LastCheckAt   time.Time `json:"lastCheckAt"`
+	LastResult    string    `json:"lastResult"`
+	LastError     string    `json:"lastError"`
+	LastUpdateAt  time.Time `json:"lastUpdateAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Watcher 追更管理器
+type Watcher struct {
+	config  *config.Config
+	lib     *library.Library
+	options []core.Option // 创建爬虫的选项
+	items   map[string]*Item
+	loaded  bool
+	running bool
+	mutex   sync.Mutex
+}
+
+var (
+	watcher *Watcher
+	once    sync.Once
+)
+
+// GetWatcher 获取追更管理器实例
+func GetWatcher() *Watcher {
+	once.Do(func() {
+		cfg := config.GetConfig()
+		watcher = &Watcher{
+			config: cfg,
+			lib:    library.GetLibrary(cfg.Download.DownloadPath),
+			items:  make(map[string]*Item),
+		}
+	})
+	return watcher
+}
+
+// Start 启动定时检查，ctx 取消后停止
+func (w *Watcher) Start(ctx context.Context) {
+	w.mutex.Lock()
+	if w.running {
+		w.mutex.Unlock()
+		return
+	}
+	w.running = true
+	w.mutex.Unlock()
+
+	fmt.Printf("追更检查已启动，默认间隔 %d 分钟\n", w.defaultInterval())
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			// 逐本检查，避免同时请求过多书源
+			for _, fileName := range w.dueItems(time.Now()) {
+				if _, err := w.Check(fileName); err != nil {
+					fmt.Printf("追更检查失败 %s: %v\n", fileName, err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				w.mutex.Lock()
+				w.running = false
+				w.mutex.Unlock()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Add 添加书库中的书籍到追更列表，已存在时更新检查间隔和处理方式
+func (w *Watcher) Add(fileName string, interval int, mode string) (*Item, error) {
+	if mode != ModeDefault && mode != ModeNotify && mode != ModeUpdate {
+		return nil, fmt.Errorf("不支持的处理方式: %s", mode)
+	}
+
+	// 先同步书库索引，确保刚下载的书籍可以被找到
+	if err := w.lib.Sync(); err != nil {
+		return nil, err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+
+	if item, exists := w.items[fileName]; exists {
+		item.Interval = interval
+		item.Mode = mode
+		result := *item
+		return &result, w.save()
+	}
+
+	entry, exists := w.lib.Get(fileName)
+	if !exists {
+		return nil, fmt.Errorf("书库中未找到书籍: %s", fileName)
+	}
+	if entry.URL == "" {
+		return nil, fmt.Errorf("书籍缺少来源URL，无法追更: %s", fileName)
+	}
+
+	item := &Item{
+		FileName:      entry.FileName,
+		BookName:      entry.BookName,
+		Author:        entry.Author,
+		URL:           entry.URL,
+		SourceId:      entry.SourceId,
+		Source:        entry.Source,
+		Format:        entry.Format,
+		Interval:      interval,
+		Mode:          mode,
+		KnownChapters: knownChapters(entry),
+		LatestChapter: entry.LatestChapter,
+		Status:        StatusIdle,
+		CreatedAt:     time.Now(),
+	}
+	w.items[fileName] = item
+
+	result := *item
+	return &result, w.save()
+}
+
+// Remove 从追更列表中移除书籍
+func (w *Watcher) Remove(fileName string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.load(); err != nil {
+		return err
+	}
+	if _, exists := w.items[fileName]; !exists {
+		return fmt.Errorf("追更列表中未找到书籍: %s", fileName)
+	}
+
+	delete(w.items, fileName)
+	return w.save()
+}
+
+// List 返回追更列表
+func (w *Watcher) List() ([]Item, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(w.items))
+	for _, item := range w.items {
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items, nil
+}
+
+// sourceConfig 复制配置并指定书籍的书源，书源所在的规则文件已不再激活时按URL匹配书源
+func (w *Watcher) sourceConfig(item Item) config.Config {
+	cfg := w.config.Copy()
+	cfg.Source.SourceId = item.SourceId
+	if item.Source != "" && cfg.Source.SelectSource(item.Source) != nil {
+		cfg.Source.SourceId = 0
+	}
+	return cfg
+}
+
+// Check 立即检查一本书是否有新章节
+func (w *Watcher) Check(fileName string) (*Item, error) {
+	item, err := w.begin(fileName, StatusChecking)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := w.sourceConfig(item)
+	crawler := core.NewCrawler(&cfg, w.options...)
+	book, chapters, err := crawler.FetchCatalog(item.URL)
+
+	w.mutex.Lock()
+	current := w.items[fileName]
+	if current == nil {
+		// 检查期间被移除
+		w.mutex.Unlock()
+		return nil, fmt.Errorf("追更列表中未找到书籍: %s", fileName)
+	}
+	current.Status = StatusIdle
+	current.LastCheckAt = time.Now()
+	if err != nil {
+		current.LastError = err.Error()
+		current.LastResult = "检查失败"
+	} else {
+		current.LastError = ""
+		current.NewChapters = len(chapters) - current.KnownChapters
+		if current.NewChapters < 0 {
+			current.NewChapters = 0
+		}
+		if len(chapters) > 0 {
+			current.LatestChapter = chapters[len(chapters)-1].Title
+		} else if book.LatestChapter != "" {
+			current.LatestChapter = book.LatestChapter
+		}
+		if current.NewChapters > 0 {
+			current.LastResult = fmt.Sprintf("发现 %d 章新章节", current.NewChapters)
+		} else {
+			current.LastResult = "暂无更新"
+		}
+	}
+	result := *current
+	saveErr := w.save()
+	w.mutex.Unlock()
+
+	if err != nil {
+		return &result, err
+	}
+	if saveErr != nil {
+		fmt.Printf("保存追更列表失败: %v\n", saveErr)
+	}
+
+	fmt.Printf("追更检查《%s》: %s\n", result.BookName, result.LastResult)
+	if result.NewChapters > 0 {
+		sse.BroadcastEvent("watch-new-chapters", map[string]any{
+			"fileName":      result.FileName,
+			"bookName":      result.BookName,
+			"newChapters":   result.NewChapters,
+			"latestChapter": result.LatestChapter,
+		})
+
+		if w.autoUpdate(&result) {
+			go func() {
+				if _, err := w.Update(fileName); err != nil {
+					fmt.Printf("追更自动更新失败 %s: %v\n", fileName, err)
+				}
+			}()
+		}
+	}
+
+	return &result, nil
+}
+
+// Update 增量更新一本书：复用章节缓存，只下载新章节后重新生成书籍文件
+func (w *Watcher) Update(fileName string) (*Item, error) {
+	item, err := w.begin(fileName, StatusUpdating)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := w.sourceConfig(item)
+	cfg.Download.ExtName = item.Format
+	cfg.Download.DownloadId = ""
+	cfg.Download.Incremental = true
+	// 保留章节缓存，下次更新时只需下载新章节；没有缓存时从已生成的书籍文件中还原
+	cfg.Download.PreserveChapterCache = 1
+	err = core.NewCrawler(&cfg, w.options...).Crawl(item.URL)
+
+	w.mutex.Lock()
+	current := w.items[fileName]
+	if current == nil {
+		w.mutex.Unlock()
+		return nil, fmt.Errorf("追更列表中未找到书籍: %s", fileName)
+	}
+	current.Status = StatusIdle
+	if err != nil {
+		current.LastError = err.Error()
+		current.LastResult = "更新失败"
+	} else {
+		current.LastError = ""
+		current.LastResult = fmt.Sprintf("已更新 %d 章", current.NewChapters)
+		current.LastUpdateAt = time.Now()
+		current.NewChapters = 0
+		if entry, exists := w.lib.Get(fileName); exists {
+			current.KnownChapters = knownChapters(entry)
+			current.LatestChapter = entry.LatestChapter
+		}
+	}
+	result := *current
+	if saveErr := w.save(); saveErr != nil {
+		fmt.Printf("保存追更列表失败: %v\n", saveErr)
+	}
+	w.mutex.Unlock()
+
+	if err != nil {
+		return &result, err
+	}
+
+	sse.BroadcastEvent("watch-updated", map[string]any{
+		"fileName":      result.FileName,
+		"bookName":      result.BookName,
+		"knownChapters": result.KnownChapters,
+		"latestChapter": result.LatestChapter,
+	})
+	return &result, nil
+}
+
+// knownChapters 已下载到书源目录中的第几章。按章节范围下载的书籍章节数少于目录，
+// 使用最后一章的序号，避免把范围之前的章节当作新章节；旧索引和扫描得到的书籍没有序号时使用章节数
+func knownChapters(entry *library.Entry) int {
+	if entry.LastChapter > 0 {
+		return entry.LastChapter
+	}
+	return entry.ChapterCount
+}
+
+// begin 将书籍标记为检查中或更新中，同一本书同时只允许一个任务
+func (w *Watcher) begin(fileName, status string) (Item, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.load(); err != nil {
+		return Item{}, err
+	}
+
+	item, exists := w.items[fileName]
+	if !exists {
+		return Item{}, fmt.Errorf("追更列表中未找到书籍: %s", fileName)
+	}
+	if item.Status != StatusIdle && item.Status != "" {
+		return Item{}, fmt.Errorf("书籍正在处理中: %s", fileName)
+	}
+
+	item.Status = status
+	return *item, nil
+}
+
+// dueItems 返回到达检查时间的书籍
+func (w *Watcher) dueItems(now time.Time) []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.load(); err != nil {
+		fmt.Printf("加载追更列表失败: %v\n", err)
+		return nil
+	}
+
+	var due []string
+	for name, item := range w.items {
+		interval := item.Interval
+		if interval <= 0 {
+			interval = w.defaultInterval()
+		}
+		if item.Status == StatusIdle && now.Sub(item.LastCheckAt) >= time.Duration(interval)*time.Minute {
+			due = append(due, name)
+		}
+	}
+	sort.Strings(due)
+	return due
+}
+
+// defaultInterval 全局检查间隔（分钟）
+func (w *Watcher) defaultInterval() int {
+	if w.config.Watch.Interval > 0 {
+		return w.config.Watch.Interval
+	}
+	return defaultInterval
+}
+
+// autoUpdate 判断发现新章节后是否自动更新
+func (w *Watcher) autoUpdate(item *Item) bool {
+	switch item.Mode {
+	case ModeUpdate:
+		return true
+	case ModeNotify:
+		return false
+	default:
+		return w.config.Watch.AutoUpdate == 1
+	}
+}
+
+// load 从文件加载追更列表，调用方需持有锁
+func (w *Watcher) load() error {
+	if w.loaded {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(w.lib.Dir(), WatchlistFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			w.loaded = true
+			return nil
+		}
+		return fmt.Errorf("读取追更列表失败: %w", err)
+	}
+
+	var items []*Item
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("解析追更列表失败: %w", err)
+	}
+	for _, item := range items {
+		// 程序重启时中断的任务恢复为空闲
+		item.Status = StatusIdle
+		w.items[item.FileName] = item
+	}
+	w.loaded = true
+	return nil
+}
+
+// save 保存追更列表，调用方需持有锁
+func (w *Watcher) save() error {
+	items := make([]*Item, 0, len(w.items))
+	for _, item := range w.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return util.WriteFileAtomic(filepath.Join(w.lib.Dir(), WatchlistFileName), data, 0644)
+}
@@ -0,0 +1,124 @@
+package watch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go-novel/internal/config"
+	"go-novel/internal/core"
+	"go-novel/internal/fetcher"
+	"go-novel/internal/library"
+)
+
+func TestWatcher(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// 不发起网络请求的书源，目录章节数可以在检查之间调整
+	total := 5
+	site := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch {
+		case r.URL.Path == "/book/1/":
+			var toc strings.Builder
+			for i := 1; i <= total; i++ {
+				fmt.Fprintf(&toc, `<a href="/book/1/%d.html">标题%d</a>`, i, i)
+			}
+			fmt.Fprintf(w, `<html><body><h1>仙逆</h1><p class="author">耳根</p><div id="list">%s</div></body></html>`, toc.String())
+		case strings.HasPrefix(r.URL.Path, "/book/1/"):
+			fmt.Fprintf(w, `<html><body><div id="content">%s 的正文</div></body></html>`, r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	stub := fetcher.Func(func(req *http.Request) (*http.Response, error) {
+		recorder := httptest.NewRecorder()
+		site.ServeHTTP(recorder, req)
+		resp := recorder.Result()
+		resp.Request = req
+		return resp, nil
+	})
+
+	rule := `[{"id": 1, "name": "测试书源", "url": "http://watch.example/", "search": {"disabled": true},
+"book": {"bookName": "h1", "author": ".author"}, "toc": {"item": "#list a"}, "chapter": {"content": "#content"}}]`
+	if err := os.MkdirAll(filepath.Join("configs", "rules"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("configs", "rules", "main-rules.json"), []byte(rule), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.GetConfig().Copy()
+	cfg.Download.ExtName = "txt"
+	cfg.Crawl.MinInterval, cfg.Crawl.MaxInterval = 0, 0
+	if err := os.MkdirAll(cfg.Download.DownloadPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只下载最后两章
+	download := cfg
+	download.Download.ChapterRange = "4-5"
+	if err := core.NewCrawler(&download, core.WithFetcher(stub)).Crawl("http://watch.example/book/1/"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Watcher{
+		config:  &cfg,
+		lib:     library.GetLibrary(cfg.Download.DownloadPath),
+		options: []core.Option{core.WithFetcher(stub)},
+		items:   make(map[string]*Item),
+	}
+	const fileName = "仙逆(耳根).txt"
+	item, err := w.Add(fileName, 30, ModeNotify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.KnownChapters != 5 {
+		t.Errorf("按范围下载的书籍应以最后一章的序号作为已知章节数，实际 %d", item.KnownChapters)
+	}
+
+	// 新添加的书籍立即检查
+	if due := w.dueItems(time.Now()); !slices.Equal(due, []string{fileName}) {
+		t.Errorf("新添加的书籍应立即检查: %v", due)
+	}
+	if item, err = w.Check(fileName); err != nil || item.NewChapters != 0 || item.LastResult != "暂无更新" {
+		t.Fatalf("目录没有变化时不应发现新章节: %+v, %v", item, err)
+	}
+
+	// 检查后按间隔安排下次检查
+	if due := w.dueItems(time.Now().Add(29 * time.Minute)); len(due) != 0 {
+		t.Errorf("未到检查间隔不应再次检查: %v", due)
+	}
+	if due := w.dueItems(time.Now().Add(31 * time.Minute)); !slices.Equal(due, []string{fileName}) {
+		t.Errorf("到达检查间隔后应再次检查: %v", due)
+	}
+
+	total = 7
+	if item, err = w.Check(fileName); err != nil || item.NewChapters != 2 || item.LatestChapter != "标题7" {
+		t.Fatalf("应发现2章新章节: %+v, %v", item, err)
+	}
+
+	// 增量更新后已知章节数与目录一致
+	if item, err = w.Update(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if item.KnownChapters != 7 || item.NewChapters != 0 || item.LastResult != "已更新 2 章" || item.LatestChapter != "标题7" {
+		t.Errorf("更新后的追更状态不正确: %+v", item)
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.Download.DownloadPath, fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "标题7") {
+		t.Errorf("更新后的书籍应包含新章节:\n%s", data)
+	}
+	if item, err = w.Check(fileName); err != nil || item.NewChapters != 0 {
+		t.Errorf("更新后不应再发现新章节: %+v, %v", item, err)
+	}
+}
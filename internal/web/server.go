@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"io"
@@ -13,7 +14,9 @@ import (
 	"go-novel/internal/config"
 	soembed "go-novel/internal/embed"
 	"go-novel/internal/handler"
+	"go-novel/internal/rules"
 	"go-novel/internal/sse"
+	"go-novel/internal/watch"
 
 	"github.com/gin-gonic/gin"
 )
@@ -64,10 +67,11 @@ func serveEmbedFile(c *gin.Context, fs embed.FS, filePath string) {
 	c.Data(http.StatusOK, contentType, content)
 }
 
-func StartServer(cfg *config.Config) {
+// StartServer 启动Web服务，服务退出时返回错误
+func StartServer(cfg *config.Config) error {
 	if cfg.Web.Enabled != 1 {
 		fmt.Println("Web server is disabled")
-		return
+		return nil
 	}
 
 	// 设置为发布模式
@@ -121,7 +125,44 @@ func StartServer(cfg *config.Config) {
 			c.JSON(http.StatusOK, gin.H{"downloadURL": downloadURL})
 		})
 		api.GET("/local/books", handler.LocalBooks)
+		api.GET("/library", handler.LibraryList)
+		api.POST("/library/rescan", handler.LibraryRescan)
 		api.DELETE("/book", handler.DeleteBook)
+		api.GET("/watch", handler.WatchList)
+		api.POST("/watch", handler.WatchAdd)
+		api.DELETE("/watch", handler.WatchRemove)
+		api.POST("/watch/check", handler.WatchCheck)
+		api.POST("/watch/update", handler.WatchUpdate)
+		api.POST("/batch", handler.BatchCreate)
+		api.GET("/batch", handler.BatchList)
+		api.GET("/batch/:id", handler.BatchGet)
+		api.GET("/rules/lint", handler.RulesLint)
+		api.POST("/rules/playground", handler.RulePlayground)
+		api.POST("/rules/infer", handler.RulesInfer)
+		api.GET("/rules/files", handler.RulesFiles)
+		api.POST("/rules/import", handler.RulesImport)
+		api.GET("/rules/export", handler.RulesExport)
+		api.PUT("/rules/meta", handler.RulesSetMeta)
+		api.PUT("/rules/active", handler.RulesSetActive)
+		api.GET("/rules", handler.RulesList)
+		api.GET("/rules/:id", handler.RuleGet)
+		api.PUT("/rules/:id", handler.RulePut)
+		api.DELETE("/rules/:id", handler.RuleDelete)
+		api.PUT("/rules/:id/disabled", handler.RuleSetDisabled)
+		api.GET("/credentials", handler.CredentialsList)
+		api.PUT("/credentials", handler.CredentialsPut)
+		api.DELETE("/credentials", handler.CredentialsDelete)
+	}
+
+	// OPDS目录路由，供KOReader等阅读器订阅本地书库
+	catalog := r.Group("/opds")
+	{
+		catalog.GET("", handler.OPDSRoot)
+		catalog.GET("/books", handler.OPDSBooks)
+		catalog.GET("/new", handler.OPDSNew)
+		catalog.GET("/search", handler.OPDSSearch)
+		catalog.GET("/opensearch.xml", handler.OPDSOpenSearch)
+		catalog.GET("/cover", handler.OPDSCover)
 	}
 
 	// SSE路由
@@ -130,6 +171,24 @@ func StartServer(cfg *config.Config) {
 	// 启动SSE心跳服务
 	startSSEHeartbeat()
 
+	// 启动追更定时检查
+	if cfg.Watch.Enabled == 1 {
+		watch.GetWatcher().Start(context.Background())
+	}
+
+	// 启动规则文件热加载，修改 configs/rules 下的规则无需重启服务
+	if err := rules.GetRuleManager().Watch(context.Background(), func(result rules.ReloadResult) {
+		sse.BroadcastEvent("rules-changed", map[string]any{
+			"file":   result.File,
+			"loaded": result.Loaded,
+			"rules":  result.Rules,
+			"error":  result.Error,
+			"issues": result.Issues,
+		})
+	}); err != nil {
+		fmt.Printf("规则文件热加载未启动: %v\n", err)
+	}
+
 	// 启动服务器
 	port := cfg.Web.Port
 	if port == 0 {
@@ -137,5 +196,5 @@ func StartServer(cfg *config.Config) {
 	}
 
 	fmt.Printf("服务器启动在端口 %d，访问地址：http://localhost:%d\n", port, port)
-	r.Run(":" + fmt.Sprintf("%d", port))
+	return r.Run(":" + fmt.Sprintf("%d", port))
 }